@@ -0,0 +1,68 @@
+package config
+
+// BuildConfig holds the esbuild settings used to bundle handlers. Settings can
+// come from a terrable.json file, the module's "build" attribute and each
+// handler's own "build" attribute, with later sources taking precedence.
+type BuildConfig struct {
+	Target   string
+	Format   string
+	External []string
+	Define   map[string]string
+	Loader   map[string]string
+	Tsconfig string
+	Minify   *bool
+}
+
+// MergeBuildConfig layers override on top of base. Scalar settings and the
+// external list are replaced when set in override, while define and loader
+// entries are merged key by key.
+func MergeBuildConfig(base *BuildConfig, override *BuildConfig) *BuildConfig {
+	if base == nil && override == nil {
+		return nil
+	}
+
+	merged := &BuildConfig{}
+
+	for _, source := range []*BuildConfig{base, override} {
+		if source == nil {
+			continue
+		}
+
+		if source.Target != "" {
+			merged.Target = source.Target
+		}
+
+		if source.Format != "" {
+			merged.Format = source.Format
+		}
+
+		if source.External != nil {
+			merged.External = append([]string(nil), source.External...)
+		}
+
+		for key, value := range source.Define {
+			if merged.Define == nil {
+				merged.Define = make(map[string]string)
+			}
+			merged.Define[key] = value
+		}
+
+		for key, value := range source.Loader {
+			if merged.Loader == nil {
+				merged.Loader = make(map[string]string)
+			}
+			merged.Loader[key] = value
+		}
+
+		if source.Tsconfig != "" {
+			merged.Tsconfig = source.Tsconfig
+		}
+
+		if source.Minify != nil {
+			minify := *source.Minify
+			merged.Minify = &minify
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,8 @@
+package config
+
+import "time"
+
+type ShutdownConfig struct {
+	GracePeriod      time.Duration
+	CleanBuildOutput bool
+}
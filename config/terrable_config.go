@@ -1,31 +1,196 @@
 package config
 
+import "strings"
+
 type TerrableConfig struct {
 	Handlers             []HandlerMapping
 	EnvironmentVariables map[string]string
 	HttpApi              *APIGatewayConfig
 	RestApi              *APIGatewayConfig
+	WebSocketApi         *WebSocketAPIConfig
 	Timeout              int
+	Build                *BuildConfig
 }
 
 type HandlerMapping struct {
 	Name             string
 	Source           string
 	ConfiguredSource string
+	Runtime          string
 	Http             map[string]string
-	Sqs              map[string]interface{}
+	FunctionURL      *FunctionURLConfig
+	WebSocket        *WebSocketConfig
+	Sqs              *SqsConfig
+	Sns              *SnsConfig
+	S3               *S3Config
 	Schedule         *ScheduleConfig
-	Timeout          int
+	// EventPattern is the JSON text of the EventBridge pattern that selects
+	// the events delivered to the handler.
+	EventPattern string
+	// Async changes how schedules, S3, SNS, EventBridge and Event invocations
+	// invoke the handler. Nil means the defaults of DefaultAsyncConfig.
+	Async   *AsyncConfig
+	Timeout int
+	Build   *BuildConfig
+}
+
+// FunctionURLConfig serves a handler the way a Lambda function URL does, either
+// under its own path on the offline server or on its own port.
+type FunctionURLConfig struct {
+	// Path is the prefix the function URL is served under. It is empty when
+	// Port is set.
+	Path string
+	Port int
+	// AuthType is NONE or AWS_IAM.
+	AuthType string
+	// Cors applies to the function URL only, whatever the API Gateway CORS
+	// configuration is.
+	Cors *CorsConfig
+}
+
+// WebSocketConfig attaches a handler to routes of the WebSocket API.
+type WebSocketConfig struct {
+	// Routes lists route keys, such as $connect, $disconnect, $default or
+	// the value the route selection expression selects for a message.
+	Routes []string
+}
+
+// SqsConfig describes the queue that triggers a handler. Zero values fall back
+// to the defaults of an SQS event source mapping.
+type SqsConfig struct {
+	Queue                        string
+	BatchSize                    int
+	MaximumBatchingWindowSeconds int
+	VisibilityTimeoutSeconds     int
+	MaxReceiveCount              int
+	// ContentBasedDeduplication derives the deduplication ID of messages sent
+	// to a FIFO queue without one from their body.
+	ContentBasedDeduplication bool
+	// Sns subscribes the queue to a topic, so that messages published to it
+	// are sent to the queue.
+	Sns *SnsConfig
+}
+
+// QueueName returns the name of the queue, which is the last segment of its ARN.
+func (config SqsConfig) QueueName() string {
+	if index := strings.LastIndex(config.Queue, ":"); index >= 0 {
+		return config.Queue[index+1:]
+	}
+
+	return config.Queue
+}
+
+// SnsConfig subscribes a handler, or the queue of an SQS trigger, to a topic.
+type SnsConfig struct {
+	Topic string
+	// FilterPolicy is the JSON text of the subscription filter policy. It is
+	// applied to the message attributes, or to the message body when
+	// FilterPolicyScope is MessageBody.
+	FilterPolicy      string
+	FilterPolicyScope string
+	// RawMessageDelivery sends queues the message itself rather than the SNS
+	// notification.
+	RawMessageDelivery bool
+}
+
+// TopicName returns the name of the topic, which is the last segment of its ARN.
+func (config SnsConfig) TopicName() string {
+	if index := strings.LastIndex(config.Topic, ":"); index >= 0 {
+		return config.Topic[index+1:]
+	}
+
+	return config.Topic
+}
+
+// S3Config emulates an S3 event notification for a bucket by watching a local
+// directory, where each file is an object keyed by its relative path.
+type S3Config struct {
+	Bucket string
+	// Directory is the absolute path of the directory that stands in for the
+	// bucket.
+	Directory string
+	// Events lists the notification event types, such as s3:ObjectCreated:*,
+	// that invoke the handler.
+	Events       []string
+	FilterPrefix string
+	FilterSuffix string
+}
+
+// BucketName returns the name of the bucket, which is the last segment of its ARN.
+func (config S3Config) BucketName() string {
+	if index := strings.LastIndex(config.Bucket, ":"); index >= 0 {
+		return config.Bucket[index+1:]
+	}
+
+	return config.Bucket
+}
+
+// AsyncConfig sets how often an asynchronous invocation of a handler is
+// retried and where records of its outcome are sent.
+type AsyncConfig struct {
+	MaximumRetryAttempts   int
+	MaximumEventAgeSeconds int
+	// RetryBackoffSeconds is how long the first retry waits. Each later retry
+	// waits twice as long as the one before it.
+	RetryBackoffSeconds int
+	// OnSuccess and OnFailure are the destinations of invocation records: a
+	// handler name or Lambda function ARN, or any other ARN, whose records
+	// are written to a local log. Empty means no destination.
+	OnSuccess string
+	OnFailure string
+}
+
+// DefaultAsyncConfig returns the retry settings Lambda uses when none are
+// configured, except that retries wait seconds rather than minutes.
+func DefaultAsyncConfig() AsyncConfig {
+	return AsyncConfig{
+		MaximumRetryAttempts:   2,
+		MaximumEventAgeSeconds: 21600,
+		RetryBackoffSeconds:    1,
+	}
 }
 
 type ScheduleConfig struct {
 	Expression string
+	// Timezone is the IANA time zone cron expressions are evaluated in. It
+	// defaults to UTC.
+	Timezone string
+	// Input, InputPath and InputTransformer change what the handler receives
+	// in place of the scheduled event, as they do for an EventBridge target.
+	// At most one of them is set. Input is JSON text.
+	Input            string
+	InputPath        string
+	InputTransformer *InputTransformerConfig
+}
+
+type InputTransformerConfig struct {
+	InputPaths    map[string]string
+	InputTemplate string
 }
 
 type APIGatewayConfig struct {
 	Cors *CorsConfig
 }
 
+// WebSocketAPIConfig describes the WebSocket API that handlers with websocket
+// routes are served through.
+type WebSocketAPIConfig struct {
+	// RouteSelectionExpression selects the route of a message from its JSON
+	// body, such as $request.body.action.
+	RouteSelectionExpression string
+	// Path is where clients connect on the offline server.
+	Path string
+}
+
+// DefaultWebSocketAPIConfig returns the settings used when handlers have
+// websocket routes but the module has no websocket_api.
+func DefaultWebSocketAPIConfig() WebSocketAPIConfig {
+	return WebSocketAPIConfig{
+		RouteSelectionExpression: "$request.body.action",
+		Path:                     "/",
+	}
+}
+
 type CorsConfig struct {
 	AllowOrigins     []string
 	AllowMethods     []string
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/terrable-dev/terrable/config"
 	"github.com/terrable-dev/terrable/offline"
@@ -24,8 +27,9 @@ func main() {
 					port := cCtx.String("port")
 					nodeDebugPort := cCtx.Int("node-debug-port")
 					envFile := cCtx.String("envfile")
+					shutdownConfig := NewShutdownConfig(cCtx.Int("shutdown-grace-period"), cCtx.Bool("clean"))
 
-					err := offline.Run(filePath, moduleName, port, NewDebugConfig(nodeDebugPort), envFile)
+					err := offline.Run(filePath, moduleName, port, NewDebugConfig(nodeDebugPort), envFile, shutdownConfig, cCtx.Bool("run-schedules"))
 
 					if err != nil {
 						return err
@@ -56,7 +60,7 @@ func main() {
 						Name:     "node-debug-port",
 						Required: false,
 						Value:    "9229",
-						Usage:    "The port number that the Node.js debugger should listen on",
+						Usage:    "The base port number for the Node.js debuggers. Each handler runs in its own process and listens on the next port in handler name order",
 					},
 					&cli.StringFlag{
 						Name:     "envfile",
@@ -64,6 +68,197 @@ func main() {
 						Value:    "",
 						Usage:    "File containing environment variables in key-value (.env) format",
 					},
+					&cli.IntFlag{
+						Name:     "shutdown-grace-period",
+						Required: false,
+						Value:    10,
+						Usage:    "Seconds to wait for in-flight invocations to finish when shutting down",
+					},
+					&cli.BoolFlag{
+						Name:     "clean",
+						Required: false,
+						Usage:    "Remove the .terrable build output directory on shutdown",
+					},
+					&cli.BoolFlag{
+						Name:     "run-schedules",
+						Required: false,
+						Usage:    "Invoke handlers with a schedule trigger whenever their schedule expression fires",
+					},
+				},
+			},
+			{
+				Name:      "invoke",
+				Usage:     "Compile a single handler and run it once with an event",
+				ArgsUsage: "<handler>",
+				Action: func(cCtx *cli.Context) error {
+					if rerun, err := rerunWithFlagsFirst(cCtx); rerun {
+						return err
+					}
+
+					handlerName := cCtx.Args().First()
+					if handlerName == "" {
+						return fmt.Errorf("a handler name is required, for example: terrable invoke MyHandler --event event.json")
+					}
+
+					event, err := readEvent(cCtx.String("event"))
+					if err != nil {
+						return err
+					}
+
+					return offline.Invoke(cCtx.String("file"), cCtx.String("module"), handlerName, cCtx.String("envfile"), event)
+				},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "file",
+						Aliases:  []string{"f"},
+						Required: false,
+						Usage:    "Path to the Terraform file",
+					},
+					&cli.StringFlag{
+						Name:     "module",
+						Aliases:  []string{"m"},
+						Required: false,
+						Usage:    "Name of the terraform module containing the handler",
+					},
+					&cli.StringFlag{
+						Name:     "event",
+						Aliases:  []string{"e"},
+						Required: false,
+						Usage:    "Path to a JSON file containing the event. Reads the event from stdin when omitted or set to -",
+					},
+					&cli.StringFlag{
+						Name:     "envfile",
+						Required: false,
+						Value:    "",
+						Usage:    "File containing environment variables in key-value (.env) format",
+					},
+				},
+			},
+			{
+				Name:      "schedule",
+				Usage:     "List the next times a scheduled handler would be invoked",
+				ArgsUsage: "<handler>",
+				Action: func(cCtx *cli.Context) error {
+					if rerun, err := rerunWithFlagsFirst(cCtx); rerun {
+						return err
+					}
+
+					handlerName := cCtx.Args().First()
+					if handlerName == "" {
+						return fmt.Errorf("a handler name is required, for example: terrable schedule MyHandler --next 10")
+					}
+
+					return offline.PrintSchedule(cCtx.String("file"), cCtx.String("module"), handlerName, cCtx.Int("next"))
+				},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "file",
+						Aliases:  []string{"f"},
+						Required: false,
+						Usage:    "Path to the Terraform file",
+					},
+					&cli.StringFlag{
+						Name:     "module",
+						Aliases:  []string{"m"},
+						Required: false,
+						Usage:    "Name of the terraform module containing the handler",
+					},
+					&cli.IntFlag{
+						Name:     "next",
+						Aliases:  []string{"n"},
+						Required: false,
+						Value:    10,
+						Usage:    "Number of upcoming trigger times to list",
+					},
+				},
+			},
+			{
+				Name:      "generate-event",
+				Usage:     "Print an event shaped exactly like the ones offline mode sends to handlers",
+				ArgsUsage: fmt.Sprintf("<%s>", strings.Join(offline.EventSources, "|")),
+				Action: func(cCtx *cli.Context) error {
+					if rerun, err := rerunWithFlagsFirst(cCtx); rerun {
+						return err
+					}
+
+					source := cCtx.Args().First()
+					if source == "" {
+						return fmt.Errorf("an event source is required: %s", strings.Join(offline.EventSources, ", "))
+					}
+
+					input, err := newEventInput(cCtx)
+					if err != nil {
+						return err
+					}
+
+					event, err := offline.GenerateEvent(source, input)
+					if err != nil {
+						return err
+					}
+
+					fmt.Println(string(event))
+					return nil
+				},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "method",
+						Value: "GET",
+						Usage: "HTTP method of http, http-v2 and function-url events",
+					},
+					&cli.StringFlag{
+						Name:  "path",
+						Value: "/",
+						Usage: "Request path of http, http-v2 and function-url events",
+					},
+					&cli.StringSliceFlag{
+						Name:  "header",
+						Usage: "Request header of http, http-v2 and function-url events, as Name=value. Can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "query",
+						Usage: "Query string parameter of http, http-v2 and function-url events, as name=value. Can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "path-param",
+						Usage: "Path parameter of http, http-v2 and function-url events, as name=value. Can be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "body",
+						Usage: "Request body of http, http-v2 and function-url events, the message body of sqs and sns events, or the object content of s3 events",
+					},
+					&cli.StringFlag{
+						Name:  "body-file",
+						Usage: "Read the body from a file instead of --body",
+					},
+					&cli.StringSliceFlag{
+						Name:  "message",
+						Usage: "Body of an sqs message. Can be repeated to build a batch",
+					},
+					&cli.StringFlag{
+						Name:  "queue",
+						Value: "queue",
+						Usage: "Queue name used in the eventSourceARN of sqs events",
+					},
+					&cli.StringFlag{
+						Name:  "topic",
+						Value: "topic",
+						Usage: "Topic name used in the TopicArn of sns events",
+					},
+					&cli.StringFlag{
+						Name:  "bucket",
+						Value: "bucket",
+						Usage: "Bucket name of s3 events",
+					},
+					&cli.StringFlag{
+						Name:  "key",
+						Value: "object",
+						Usage: "Object key of s3 events",
+					},
+					&cli.StringFlag{
+						Name:  "rule",
+						Value: "scheduled-rule",
+						Usage: "Rule name used in the resources of schedule events",
+					},
 				},
 			},
 		},
@@ -80,3 +275,109 @@ func NewDebugConfig(nodeDebugPort int) config.DebugConfig {
 		NodeJsDebugPort: nodeDebugPort,
 	}
 }
+
+func NewShutdownConfig(gracePeriodSeconds int, cleanBuildOutput bool) config.ShutdownConfig {
+	return config.ShutdownConfig{
+		GracePeriod:      time.Duration(gracePeriodSeconds) * time.Second,
+		CleanBuildOutput: cleanBuildOutput,
+	}
+}
+
+func readEvent(eventPath string) ([]byte, error) {
+	if eventPath != "" && eventPath != "-" {
+		event, err := os.ReadFile(eventPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read event file: %w", err)
+		}
+
+		return event, nil
+	}
+
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		return nil, fmt.Errorf("provide an event with --event or pipe one to stdin")
+	}
+
+	event, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("could not read event from stdin: %w", err)
+	}
+
+	return event, nil
+}
+
+func newEventInput(cCtx *cli.Context) (offline.EventInput, error) {
+	input := offline.EventInput{
+		Method:        cCtx.String("method"),
+		Path:          cCtx.String("path"),
+		Body:          cCtx.String("body"),
+		QueueName:     cCtx.String("queue"),
+		MessageBodies: cCtx.StringSlice("message"),
+		RuleName:      cCtx.String("rule"),
+		TopicName:     cCtx.String("topic"),
+		BucketName:    cCtx.String("bucket"),
+		ObjectKey:     cCtx.String("key"),
+	}
+
+	if bodyFile := cCtx.String("body-file"); bodyFile != "" {
+		body, err := os.ReadFile(bodyFile)
+		if err != nil {
+			return input, fmt.Errorf("could not read body file: %w", err)
+		}
+
+		input.Body = string(body)
+	}
+
+	var err error
+
+	if input.Headers, err = parseKeyValueFlag("header", cCtx.StringSlice("header")); err != nil {
+		return input, err
+	}
+
+	if input.QueryParameters, err = parseKeyValueFlag("query", cCtx.StringSlice("query")); err != nil {
+		return input, err
+	}
+
+	if input.PathParameters, err = parseKeyValueFlag("path-param", cCtx.StringSlice("path-param")); err != nil {
+		return input, err
+	}
+
+	return input, nil
+}
+
+func parseKeyValueFlag(name string, values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	parsed := make(map[string]string, len(values))
+
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --%s %q: expected name=value", name, value)
+		}
+
+		parsed[key] = val
+	}
+
+	return parsed, nil
+}
+
+// rerunWithFlagsFirst lets flags follow a command's argument, as in
+// "terrable invoke MyHandler --event event.json". urfave/cli stops parsing
+// flags at the first argument, so the command is run again with the argument
+// moved after the flags.
+func rerunWithFlagsFirst(cCtx *cli.Context) (bool, error) {
+	args := cCtx.Args()
+	if args.Len() < 2 || !strings.HasPrefix(args.Get(1), "-") {
+		return false, nil
+	}
+
+	// The command's arguments are always the tail of os.Args.
+	argumentIndex := len(os.Args) - args.Len()
+	reordered := append([]string{}, os.Args[:argumentIndex]...)
+	reordered = append(reordered, args.Tail()...)
+	reordered = append(reordered, args.First())
+
+	return true, cCtx.App.Run(reordered)
+}
@@ -0,0 +1,293 @@
+package offline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+	"github.com/terrable-dev/terrable/config"
+)
+
+// asyncDestinationLogName is the file, in the build output directory, that
+// records for destinations which are not handlers are appended to.
+const asyncDestinationLogName = "async-destinations.log"
+
+// asyncQueue invokes handlers the way Lambda's queue for asynchronous
+// invocations does. A failed invocation is retried with backoff until its
+// retry attempts run out or the event becomes too old, and a record of the
+// outcome is sent to the success or failure destination of the handler.
+type asyncQueue struct {
+	mutex    sync.Mutex
+	handlers map[string]*HandlerInstance
+
+	execute func(handler *HandlerInstance, event []byte) HandlerOutput
+	// backoffUnit is how long one second of backoff or event age lasts, so
+	// that tests don't have to wait for retries.
+	backoffUnit time.Duration
+	logPath     string
+	logMutex    sync.Mutex
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// asyncDestinationRecord is the record Lambda sends to the destination of an
+// asynchronous invocation.
+type asyncDestinationRecord struct {
+	Version         string                         `json:"version"`
+	Timestamp       string                         `json:"timestamp"`
+	RequestContext  asyncDestinationRequestContext `json:"requestContext"`
+	RequestPayload  json.RawMessage                `json:"requestPayload"`
+	ResponseContext asyncDestinationResponse       `json:"responseContext"`
+	ResponsePayload json.RawMessage                `json:"responsePayload,omitempty"`
+}
+
+type asyncDestinationRequestContext struct {
+	RequestID              string `json:"requestId"`
+	FunctionArn            string `json:"functionArn"`
+	Condition              string `json:"condition"`
+	ApproximateInvokeCount int    `json:"approximateInvokeCount"`
+}
+
+type asyncDestinationResponse struct {
+	StatusCode      int    `json:"statusCode"`
+	ExecutedVersion string `json:"executedVersion"`
+	FunctionError   string `json:"functionError,omitempty"`
+}
+
+func newAsyncQueue(logPath string) *asyncQueue {
+	return &asyncQueue{
+		handlers:    make(map[string]*HandlerInstance),
+		execute:     executeAsyncEvent,
+		backoffUnit: time.Second,
+		logPath:     logPath,
+		done:        make(chan struct{}),
+	}
+}
+
+// setHandlers replaces the handlers that destinations are looked up in.
+func (queue *asyncQueue) setHandlers(handlers map[string]*HandlerInstance) {
+	queue.mutex.Lock()
+	queue.handlers = handlers
+	queue.mutex.Unlock()
+}
+
+// Close stops waiting to retry invocations. An attempt that is already running
+// finishes, but it is not retried and its outcome is not sent anywhere.
+func (queue *asyncQueue) Close() {
+	queue.closeOnce.Do(func() {
+		close(queue.done)
+	})
+}
+
+// invokeEvent invokes the handler asynchronously with event encoded as JSON.
+func (queue *asyncQueue) invokeEvent(handler *HandlerInstance, event interface{}) HandlerOutput {
+	payload, _ := json.Marshal(event)
+	return queue.invoke(handler, payload)
+}
+
+// invoke invokes the handler asynchronously with the JSON event and returns
+// the output of its first attempt. A failed attempt is retried in the
+// background, so that callers are not held up while the retries back off.
+func (queue *asyncQueue) invoke(handler *HandlerInstance, event []byte) HandlerOutput {
+	queued := time.Now()
+	output := queue.execute(handler, event)
+
+	if delay, retry := queue.settle(handler, event, queued, output, 1); retry {
+		go queue.retry(handler, event, queued, delay)
+	}
+
+	return output
+}
+
+// retry attempts the invocation again after each delay until it succeeds, it
+// will no longer be retried or the queue is closed.
+func (queue *asyncQueue) retry(handler *HandlerInstance, event []byte, queued time.Time, delay time.Duration) {
+	for attempts := 2; ; attempts++ {
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-queue.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		output := queue.execute(handler, event)
+
+		var retry bool
+		if delay, retry = queue.settle(handler, event, queued, output, attempts); !retry {
+			return
+		}
+	}
+}
+
+// settle decides what follows an attempt. It returns how long to wait before
+// retrying a failed attempt, or sends the outcome to a destination and
+// returns false when the invocation will not be retried.
+func (queue *asyncQueue) settle(handler *HandlerInstance, event []byte, queued time.Time, output HandlerOutput, attempts int) (time.Duration, bool) {
+	settings := asyncSettings(handler.handlerConfig)
+	name := handler.handlerConfig.Name
+	failure := invocationFailure(output)
+	delay := time.Duration(settings.RetryBackoffSeconds) * queue.backoffUnit << (attempts - 1)
+
+	// Callers print the error of the first attempt themselves.
+	if attempts > 1 && output.err != nil {
+		fmt.Println(output.err)
+	}
+
+	var condition string
+
+	switch {
+	case failure == "":
+		condition = "Success"
+	case attempts > settings.MaximumRetryAttempts:
+		condition = "RetriesExhausted"
+	case time.Since(queued)+delay > time.Duration(settings.MaximumEventAgeSeconds)*queue.backoffUnit:
+		condition = "EventAgeExceeded"
+	default:
+		color.New(color.FgHiYellow).Printf("Async invocation of %s failed (%s), retry %d of %d in %s\n", name, failure, attempts, settings.MaximumRetryAttempts, delay)
+		return delay, true
+	}
+
+	destination := settings.OnSuccess
+	if condition != "Success" {
+		color.New(color.FgHiRed).Printf("Async invocation of %s discarded after %d attempts (%s)\n", name, attempts, condition)
+		destination = settings.OnFailure
+	}
+
+	if destination != "" {
+		queue.sendRecord(destination, newAsyncDestinationRecord(handler.handlerConfig, event, output, condition, attempts))
+	}
+
+	return 0, false
+}
+
+// sendRecord invokes the destination handler with the record, without
+// waiting for it, or appends the record to the log when the destination is
+// not a handler.
+func (queue *asyncQueue) sendRecord(destination string, record asyncDestinationRecord) {
+	payload, _ := json.Marshal(record)
+	source := lambdaFunctionName(record.RequestContext.FunctionArn)
+
+	if name, ok := asyncDestinationHandler(destination); ok {
+		queue.mutex.Lock()
+		handler, found := queue.handlers[name]
+		queue.mutex.Unlock()
+
+		if found {
+			fmt.Printf("Async %s record of %s sent to %s\n", record.RequestContext.Condition, source, name)
+			go queue.invoke(handler, payload)
+			return
+		}
+	}
+
+	if err := queue.appendToLog(destination, payload); err != nil {
+		fmt.Println(fmt.Errorf("error writing the async %s record of %s: %w", record.RequestContext.Condition, source, err))
+		return
+	}
+
+	fmt.Printf("Async %s record of %s for %s written to %s\n", record.RequestContext.Condition, source, destination, queue.logPath)
+}
+
+// appendToLog writes the record as one line of JSON together with the
+// destination it was meant for.
+func (queue *asyncQueue) appendToLog(destination string, record json.RawMessage) error {
+	line, _ := json.Marshal(map[string]interface{}{
+		"destination": destination,
+		"record":      record,
+	})
+
+	queue.logMutex.Lock()
+	defer queue.logMutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(queue.logPath), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(queue.logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func newAsyncDestinationRecord(handler config.HandlerMapping, event []byte, output HandlerOutput, condition string, attempts int) asyncDestinationRecord {
+	record := asyncDestinationRecord{
+		Version:   "1.0",
+		Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		RequestContext: asyncDestinationRequestContext{
+			RequestID:              uuid.New().String(),
+			FunctionArn:            lambdaFunctionArn(handler.Name) + ":$LATEST",
+			Condition:              condition,
+			ApproximateInvokeCount: attempts,
+		},
+		RequestPayload: event,
+		ResponseContext: asyncDestinationResponse{
+			StatusCode:      200,
+			ExecutedVersion: "$LATEST",
+		},
+	}
+
+	if output.err != nil {
+		record.ResponseContext.FunctionError = "Unhandled"
+		record.ResponsePayload, _ = json.Marshal(map[string]string{
+			"errorType":    "ServiceException",
+			"errorMessage": output.err.Error(),
+		})
+
+		return record
+	}
+
+	if functionError := lambdaFunctionError(handler, output.handlerResult); functionError != nil {
+		record.ResponseContext.FunctionError = "Unhandled"
+		record.ResponsePayload = functionError
+
+		return record
+	}
+
+	record.ResponsePayload = handlerResultPayload(output.handlerResult)
+	return record
+}
+
+// asyncSettings returns the asynchronous invocation settings of a handler.
+func asyncSettings(handler config.HandlerMapping) config.AsyncConfig {
+	if handler.Async != nil {
+		return *handler.Async
+	}
+
+	return config.DefaultAsyncConfig()
+}
+
+// asyncDestinationHandler returns the name of the handler a destination
+// invokes, when it is a handler name or a Lambda function ARN.
+func asyncDestinationHandler(destination string) (string, bool) {
+	if !strings.HasPrefix(destination, "arn:") {
+		return destination, true
+	}
+
+	if strings.HasPrefix(destination, "arn:aws:lambda:") {
+		return lambdaFunctionName(destination), true
+	}
+
+	return "", false
+}
+
+func executeAsyncEvent(handler *HandlerInstance, event []byte) HandlerOutput {
+	result, err := handler.Execute(generateRuntimeCode(handler, string(event)))
+
+	return HandlerOutput{
+		handlerResult: result,
+		err:           err,
+	}
+}
@@ -0,0 +1,234 @@
+package offline
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+func newTestAsyncQueue(t *testing.T, handlers ...*HandlerInstance) (*asyncQueue, *recordedInvocations[string]) {
+	t.Helper()
+
+	queue := newAsyncQueue(filepath.Join(t.TempDir(), asyncDestinationLogName))
+	queue.backoffUnit = time.Millisecond
+	t.Cleanup(queue.Close)
+
+	handlerMap := make(map[string]*HandlerInstance, len(handlers))
+	for _, handler := range handlers {
+		handlerMap[handler.handlerConfig.Name] = handler
+	}
+
+	queue.setHandlers(handlerMap)
+
+	recorded := newRecordedInvocations[string]()
+	queue.execute = func(handler *HandlerInstance, event []byte) HandlerOutput {
+		recorded.record(handler, string(event))
+
+		if handler.handlerConfig.Name == "Failing" {
+			return HandlerOutput{handlerResult: newHandlerErrorResult(runtimeErrorResponse{
+				ErrorMessage: "payment declined",
+				ErrorType:    "Error",
+				StackTrace:   []string{"Error: payment declined"},
+			})}
+		}
+
+		return HandlerOutput{handlerResult: newHandlerResult(json.RawMessage(`{"handled":true}`))}
+	}
+
+	return queue, recorded
+}
+
+func newAsyncTestHandler(name string, async *config.AsyncConfig) *HandlerInstance {
+	return &HandlerInstance{handlerConfig: config.HandlerMapping{Name: name, Timeout: 3, Async: async}}
+}
+
+func readAsyncDestinationLog(t *testing.T, queue *asyncQueue) []map[string]interface{} {
+	t.Helper()
+
+	content, err := os.ReadFile(queue.logPath)
+	if err != nil {
+		t.Fatalf("failed to read the destination log: %v", err)
+	}
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("expected a JSON line, got %q", line)
+		}
+
+		lines = append(lines, entry)
+	}
+
+	return lines
+}
+
+func TestAsyncQueueRetriesAndLogsTheFailure(t *testing.T) {
+	handler := newAsyncTestHandler("Failing", &config.AsyncConfig{
+		MaximumRetryAttempts:   2,
+		MaximumEventAgeSeconds: 60,
+		RetryBackoffSeconds:    5,
+		OnFailure:              "arn:aws:sqs:eu-west-1:000000000000:failures",
+	})
+	queue, recorded := newTestAsyncQueue(t, handler)
+	queue.backoffUnit = 10 * time.Millisecond
+
+	start := time.Now()
+	output := queue.invoke(handler, []byte(`{"orderId":"o-1"}`))
+
+	if invocationFailure(output) == "" {
+		t.Error("expected the output of the failed first attempt")
+	}
+
+	if attempts := recorded.get("Failing"); len(attempts) != 1 {
+		t.Fatalf("expected invoke to return after the first attempt, got %v", attempts)
+	}
+
+	waitFor(t, func() bool {
+		contents, _ := os.ReadFile(queue.logPath)
+		return strings.HasSuffix(string(contents), "\n")
+	})
+
+	if attempts := recorded.get("Failing"); len(attempts) != 3 {
+		t.Fatalf("expected the invocation and two retries, got %v", attempts)
+	}
+
+	// Retries wait 5 and then 10 units of backoff.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected retries to back off, took %s", elapsed)
+	}
+
+	lines := readAsyncDestinationLog(t, queue)
+	if len(lines) != 1 {
+		t.Fatalf("expected one record, got %v", lines)
+	}
+
+	record, _ := json.Marshal(lines[0]["record"])
+
+	checks := map[string]interface{}{
+		"version":                               "1.0",
+		"requestContext.condition":              "RetriesExhausted",
+		"requestContext.approximateInvokeCount": float64(3),
+		"requestContext.functionArn":            "arn:aws:lambda:eu-west-1:000000000000:function:Failing:$LATEST",
+		"requestPayload.orderId":                "o-1",
+		"responseContext.statusCode":            float64(200),
+		"responseContext.functionError":         "Unhandled",
+		"responsePayload.errorMessage":          "payment declined",
+	}
+
+	for path, expected := range checks {
+		if value := jsonPathValue(t, record, path); value != expected {
+			t.Errorf("expected %s to be %v, got %v", path, expected, value)
+		}
+	}
+
+	if lines[0]["destination"] != "arn:aws:sqs:eu-west-1:000000000000:failures" {
+		t.Errorf("expected the record to name its destination, got %v", lines[0]["destination"])
+	}
+}
+
+func TestAsyncQueueSendsSuccessRecordsToHandlers(t *testing.T) {
+	handler := newAsyncTestHandler("Fulfilment", &config.AsyncConfig{MaximumRetryAttempts: 2, MaximumEventAgeSeconds: 60, OnSuccess: "Audit"})
+	queue, recorded := newTestAsyncQueue(t, handler, newAsyncTestHandler("Audit", nil))
+
+	queue.invoke(handler, []byte(`{"orderId":"o-2"}`))
+
+	waitFor(t, func() bool { return len(recorded.get("Audit")) == 1 })
+
+	record := []byte(recorded.get("Audit")[0])
+
+	if condition := jsonPathValue(t, record, "requestContext.condition"); condition != "Success" {
+		t.Errorf("expected a Success record, got %v", condition)
+	}
+
+	if payload := jsonPathValue(t, record, "responsePayload"); !reflect.DeepEqual(payload, map[string]interface{}{"handled": true}) {
+		t.Errorf("expected the record to carry exactly the returned value, got %v", payload)
+	}
+
+	if _, err := os.Stat(queue.logPath); !os.IsNotExist(err) {
+		t.Error("expected nothing to be written to the log")
+	}
+}
+
+func TestAsyncQueueDiscardsEventsThatBecomeTooOld(t *testing.T) {
+	handler := newAsyncTestHandler("Failing", &config.AsyncConfig{
+		MaximumRetryAttempts:   2,
+		MaximumEventAgeSeconds: 60,
+		RetryBackoffSeconds:    60,
+		OnFailure:              "failures-log",
+	})
+	queue, recorded := newTestAsyncQueue(t, handler)
+
+	queue.invoke(handler, []byte(`{}`))
+
+	if attempts := recorded.get("Failing"); len(attempts) != 1 {
+		t.Errorf("expected no retry once the event would be too old, got %d attempts", len(attempts))
+	}
+
+	// A destination without a handler of that name is written to the log.
+	lines := readAsyncDestinationLog(t, queue)
+	record, _ := json.Marshal(lines[0]["record"])
+
+	if condition := jsonPathValue(t, record, "requestContext.condition"); condition != "EventAgeExceeded" {
+		t.Errorf("expected an EventAgeExceeded record, got %v", condition)
+	}
+}
+
+func TestAsyncQueueWithoutDestinations(t *testing.T) {
+	handler := newAsyncTestHandler("Failing", &config.AsyncConfig{MaximumRetryAttempts: 0, MaximumEventAgeSeconds: 60})
+	queue, recorded := newTestAsyncQueue(t, handler)
+
+	queue.invoke(handler, []byte(`{}`))
+
+	if attempts := recorded.get("Failing"); len(attempts) != 1 {
+		t.Errorf("expected a single attempt without retries, got %d", len(attempts))
+	}
+
+	if _, err := os.Stat(queue.logPath); !os.IsNotExist(err) {
+		t.Error("expected nothing to be written to the log")
+	}
+}
+
+func TestAsyncDestinationHandler(t *testing.T) {
+	tests := map[string]string{
+		"Audit": "Audit",
+		"arn:aws:lambda:eu-west-1:000000000000:function:Audit":         "Audit",
+		"arn:aws:lambda:eu-west-1:000000000000:function:Audit:$LATEST": "Audit",
+		"arn:aws:sqs:eu-west-1:000000000000:failures":                  "",
+		"arn:aws:events:eu-west-1:000000000000:event-bus/default":      "",
+	}
+
+	for destination, expected := range tests {
+		name, ok := asyncDestinationHandler(destination)
+		if ok != (expected != "") || name != expected {
+			t.Errorf("expected %s to invoke %q, got %q", destination, expected, name)
+		}
+	}
+}
+
+// jsonPathValue reads a dotted path from a JSON document.
+func jsonPathValue(t *testing.T, document []byte, path string) interface{} {
+	t.Helper()
+
+	var value interface{}
+	if err := json.Unmarshal(document, &value); err != nil {
+		t.Fatalf("expected JSON, got %s", document)
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		value = object[key]
+	}
+
+	return value
+}
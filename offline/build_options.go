@@ -0,0 +1,278 @@
+package offline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/terrable-dev/terrable/config"
+)
+
+var esTargets = map[string]api.Target{
+	"esnext": api.ESNext,
+	"es5":    api.ES5,
+	"es6":    api.ES2015,
+	"es2015": api.ES2015,
+	"es2016": api.ES2016,
+	"es2017": api.ES2017,
+	"es2018": api.ES2018,
+	"es2019": api.ES2019,
+	"es2020": api.ES2020,
+	"es2021": api.ES2021,
+	"es2022": api.ES2022,
+	"es2023": api.ES2023,
+	"es2024": api.ES2024,
+}
+
+var engineNames = map[string]api.EngineName{
+	"chrome":  api.EngineChrome,
+	"deno":    api.EngineDeno,
+	"edge":    api.EngineEdge,
+	"firefox": api.EngineFirefox,
+	"hermes":  api.EngineHermes,
+	"ie":      api.EngineIE,
+	"ios":     api.EngineIOS,
+	"node":    api.EngineNode,
+	"opera":   api.EngineOpera,
+	"rhino":   api.EngineRhino,
+	"safari":  api.EngineSafari,
+}
+
+var loaders = map[string]api.Loader{
+	"base64":     api.LoaderBase64,
+	"binary":     api.LoaderBinary,
+	"copy":       api.LoaderCopy,
+	"css":        api.LoaderCSS,
+	"dataurl":    api.LoaderDataURL,
+	"default":    api.LoaderDefault,
+	"empty":      api.LoaderEmpty,
+	"file":       api.LoaderFile,
+	"global-css": api.LoaderGlobalCSS,
+	"js":         api.LoaderJS,
+	"json":       api.LoaderJSON,
+	"jsx":        api.LoaderJSX,
+	"local-css":  api.LoaderLocalCSS,
+	"text":       api.LoaderText,
+	"ts":         api.LoaderTS,
+	"tsx":        api.LoaderTSX,
+}
+
+const esModuleRequireBanner = `import { createRequire as __terrableCreateRequire } from "module"; const require = __terrableCreateRequire(import.meta.url);`
+
+var engineTargetPattern = regexp.MustCompile(`^([a-z]+)(\d+(?:\.\d+){0,2})$`)
+
+// handlerBuildOptions maps a handler's build settings onto the esbuild options
+// used to bundle it. Unset settings keep terrable's defaults.
+func handlerBuildOptions(handlerConfig config.HandlerMapping, outdir string) (api.BuildOptions, error) {
+	buildOptions := api.BuildOptions{
+		EntryPoints: []string{handlerConfig.Source},
+		Bundle:      true,
+		Write:       true,
+		Format:      api.FormatCommonJS,
+		Platform:    api.PlatformNode,
+		Target:      api.ES2015,
+		Sourcemap:   api.SourceMapLinked,
+		Metafile:    true,
+		GlobalName:  "exports",
+		Outdir:      outdir,
+	}
+
+	format, err := resolveBuildFormat(handlerConfig)
+	if err != nil {
+		return buildOptions, err
+	}
+
+	if extension := buildOutputExtension(handlerConfig, format); extension != ".js" {
+		buildOptions.OutExtension = map[string]string{".js": extension}
+	}
+
+	if format == api.FormatESModule {
+		buildOptions.Format = api.FormatESModule
+		buildOptions.GlobalName = ""
+		// ES2015 cannot express top-level await, which ES module handlers rely on.
+		buildOptions.Target = api.ES2022
+		// Bundled CommonJS dependencies may still call require() for Node.js
+		// built-ins, which ES modules do not provide by default.
+		buildOptions.Banner = map[string]string{"js": esModuleRequireBanner}
+	}
+
+	build := handlerConfig.Build
+	if build == nil {
+		return buildOptions, nil
+	}
+
+	if build.Target != "" {
+		target, engines, err := parseBuildTarget(build.Target)
+		if err != nil {
+			return buildOptions, err
+		}
+
+		buildOptions.Target = target
+		buildOptions.Engines = engines
+	}
+
+	buildOptions.External = build.External
+	buildOptions.Define = build.Define
+	buildOptions.Tsconfig = build.Tsconfig
+
+	if len(build.Loader) > 0 {
+		buildOptions.Loader = make(map[string]api.Loader, len(build.Loader))
+
+		for extension, loaderName := range build.Loader {
+			loader, err := parseLoader(extension, loaderName)
+			if err != nil {
+				return buildOptions, err
+			}
+
+			buildOptions.Loader[extension] = loader
+		}
+	}
+
+	if build.Minify != nil && *build.Minify {
+		buildOptions.MinifyWhitespace = true
+		buildOptions.MinifyIdentifiers = true
+		buildOptions.MinifySyntax = true
+	}
+
+	return buildOptions, nil
+}
+
+// resolveBuildFormat decides whether a handler is bundled as CommonJS or as an
+// ES module. An explicit "format" setting wins, then the source file extension,
+// then the "type" of the nearest package.json, mirroring how Node.js decides.
+func resolveBuildFormat(handlerConfig config.HandlerMapping) (api.Format, error) {
+	if handlerConfig.Build != nil && handlerConfig.Build.Format != "" {
+		switch strings.ToLower(handlerConfig.Build.Format) {
+		case "esm":
+			return api.FormatESModule, nil
+		case "cjs":
+			return api.FormatCommonJS, nil
+		default:
+			return api.FormatDefault, fmt.Errorf(`invalid build format %q: expected "esm" or "cjs"`, handlerConfig.Build.Format)
+		}
+	}
+
+	switch strings.ToLower(filepath.Ext(handlerConfig.Source)) {
+	case ".mjs", ".mts":
+		return api.FormatESModule, nil
+	case ".cjs", ".cts":
+		return api.FormatCommonJS, nil
+	}
+
+	packageType, err := nearestPackageType(filepath.Dir(handlerConfig.Source))
+	if err != nil {
+		return api.FormatDefault, err
+	}
+
+	if packageType == "module" {
+		return api.FormatESModule, nil
+	}
+
+	return api.FormatCommonJS, nil
+}
+
+// buildOutputExtension names the bundle so that Node.js loads it in the format
+// it was built in. A handler that asks for CommonJS, through its "format"
+// setting or a .cjs or .cts source, may live in a "type": "module" package,
+// where a .js bundle would be loaded as an ES module.
+func buildOutputExtension(handlerConfig config.HandlerMapping, format api.Format) string {
+	if format == api.FormatESModule {
+		return ".mjs"
+	}
+
+	if handlerConfig.Build != nil && handlerConfig.Build.Format != "" {
+		return ".cjs"
+	}
+
+	switch strings.ToLower(filepath.Ext(handlerConfig.Source)) {
+	case ".cjs", ".cts":
+		return ".cjs"
+	}
+
+	return ".js"
+}
+
+func nearestPackageType(dir string) (string, error) {
+	for {
+		packageJSONPath := filepath.Join(dir, "package.json")
+		content, err := os.ReadFile(packageJSONPath)
+
+		if err == nil {
+			var packageJSON struct {
+				Type string `json:"type"`
+			}
+
+			if err := json.Unmarshal(content, &packageJSON); err != nil {
+				return "", fmt.Errorf("could not parse %s: %w", packageJSONPath, err)
+			}
+
+			return packageJSON.Type, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("could not read %s: %w", packageJSONPath, err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+
+		dir = parent
+	}
+}
+
+// parseBuildTarget accepts the same comma separated targets as esbuild's
+// --target flag, such as "node20" or "es2020,node18".
+func parseBuildTarget(value string) (api.Target, []api.Engine, error) {
+	target := api.DefaultTarget
+	var engines []api.Engine
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+
+		if esTarget, ok := esTargets[part]; ok {
+			target = esTarget
+			continue
+		}
+
+		match := engineTargetPattern.FindStringSubmatch(part)
+		if match == nil {
+			return target, nil, fmt.Errorf("invalid build target %q", part)
+		}
+
+		engineName, ok := engineNames[match[1]]
+		if !ok {
+			return target, nil, fmt.Errorf("invalid build target %q: unknown engine %q", part, match[1])
+		}
+
+		engines = append(engines, api.Engine{Name: engineName, Version: match[2]})
+	}
+
+	return target, engines, nil
+}
+
+func parseLoader(extension string, loaderName string) (api.Loader, error) {
+	if !strings.HasPrefix(extension, ".") {
+		return api.LoaderNone, fmt.Errorf("invalid loader extension %q: extensions must start with a '.'", extension)
+	}
+
+	loader, ok := loaders[loaderName]
+	if !ok {
+		names := make([]string, 0, len(loaders))
+		for name := range loaders {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		return api.LoaderNone, fmt.Errorf("invalid loader %q for %s: expected one of %s", loaderName, extension, strings.Join(names, ", "))
+	}
+
+	return loader, nil
+}
@@ -0,0 +1,257 @@
+package offline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestParseBuildTarget(t *testing.T) {
+	tests := []struct {
+		value          string
+		expectedTarget api.Target
+		expectedEngine []api.Engine
+		expectErr      bool
+	}{
+		{value: "es2020", expectedTarget: api.ES2020},
+		{value: "node20", expectedTarget: api.DefaultTarget, expectedEngine: []api.Engine{{Name: api.EngineNode, Version: "20"}}},
+		{value: "ES2022, node18.19", expectedTarget: api.ES2022, expectedEngine: []api.Engine{{Name: api.EngineNode, Version: "18.19"}}},
+		{value: "node", expectErr: true},
+		{value: "netscape4", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			target, engines, err := parseBuildTarget(tt.value)
+
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("expected %q to be rejected", tt.value)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if target != tt.expectedTarget {
+				t.Errorf("expected target %v, got %v", tt.expectedTarget, target)
+			}
+
+			if len(engines) != len(tt.expectedEngine) {
+				t.Fatalf("expected engines %v, got %v", tt.expectedEngine, engines)
+			}
+
+			for i := range engines {
+				if engines[i] != tt.expectedEngine[i] {
+					t.Errorf("expected engine %v, got %v", tt.expectedEngine[i], engines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerBuildOptionsAppliesBuildSettings(t *testing.T) {
+	minify := true
+
+	buildOptions, err := handlerBuildOptions(config.HandlerMapping{
+		Name:   "Handler",
+		Source: "/src/handler.ts",
+		Build: &config.BuildConfig{
+			Target:   "node20",
+			External: []string{"@aws-sdk/*"},
+			Define:   map[string]string{"STAGE": `"local"`},
+			Loader:   map[string]string{".txt": "text"},
+			Tsconfig: "/src/tsconfig.build.json",
+			Minify:   &minify,
+		},
+	}, "/out")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buildOptions.Format != api.FormatCommonJS || buildOptions.Platform != api.PlatformNode {
+		t.Errorf("expected default format and platform to be kept")
+	}
+
+	if len(buildOptions.Engines) != 1 || buildOptions.Engines[0].Name != api.EngineNode {
+		t.Errorf("expected node engine target, got %v", buildOptions.Engines)
+	}
+
+	if len(buildOptions.External) != 1 || buildOptions.External[0] != "@aws-sdk/*" {
+		t.Errorf("expected external modules to be applied, got %v", buildOptions.External)
+	}
+
+	if buildOptions.Define["STAGE"] != `"local"` {
+		t.Errorf("expected define to be applied, got %v", buildOptions.Define)
+	}
+
+	if buildOptions.Loader[".txt"] != api.LoaderText {
+		t.Errorf("expected loader to be applied, got %v", buildOptions.Loader)
+	}
+
+	if buildOptions.Tsconfig != "/src/tsconfig.build.json" {
+		t.Errorf("expected tsconfig to be applied, got %q", buildOptions.Tsconfig)
+	}
+
+	if !buildOptions.MinifyWhitespace || !buildOptions.MinifyIdentifiers || !buildOptions.MinifySyntax {
+		t.Errorf("expected minification to be enabled")
+	}
+}
+
+func TestHandlerBuildOptionsRejectsUnknownLoader(t *testing.T) {
+	_, err := handlerBuildOptions(config.HandlerMapping{
+		Name:  "Handler",
+		Build: &config.BuildConfig{Loader: map[string]string{".txt": "words"}},
+	}, "/out")
+
+	if err == nil {
+		t.Fatal("expected an unknown loader to be rejected")
+	}
+}
+
+func TestResolveBuildFormat(t *testing.T) {
+	moduleDir := t.TempDir()
+	writeHandlerSource(t, moduleDir, "package.json", `{ "type": "module" }`)
+
+	nestedDir := filepath.Join(moduleDir, "src", "handlers")
+	if err := os.MkdirAll(nestedDir, 0o755); err != nil {
+		t.Fatalf("failed to create nested directory: %v", err)
+	}
+
+	commonJSDir := t.TempDir()
+	writeHandlerSource(t, commonJSDir, "package.json", `{ "name": "commonjs-package" }`)
+
+	tests := []struct {
+		name     string
+		handler  config.HandlerMapping
+		expected api.Format
+	}{
+		{
+			name:     "mjs source",
+			handler:  config.HandlerMapping{Source: filepath.Join(commonJSDir, "handler.mjs")},
+			expected: api.FormatESModule,
+		},
+		{
+			name:     "mts source",
+			handler:  config.HandlerMapping{Source: filepath.Join(commonJSDir, "handler.mts")},
+			expected: api.FormatESModule,
+		},
+		{
+			name:     "nearest package.json with module type",
+			handler:  config.HandlerMapping{Source: filepath.Join(nestedDir, "handler.ts")},
+			expected: api.FormatESModule,
+		},
+		{
+			name:     "cjs source in module package",
+			handler:  config.HandlerMapping{Source: filepath.Join(nestedDir, "handler.cjs")},
+			expected: api.FormatCommonJS,
+		},
+		{
+			name:     "package.json without type",
+			handler:  config.HandlerMapping{Source: filepath.Join(commonJSDir, "handler.ts")},
+			expected: api.FormatCommonJS,
+		},
+		{
+			name: "explicit format wins",
+			handler: config.HandlerMapping{
+				Source: filepath.Join(nestedDir, "handler.ts"),
+				Build:  &config.BuildConfig{Format: "cjs"},
+			},
+			expected: api.FormatCommonJS,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := resolveBuildFormat(tt.handler)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if format != tt.expected {
+				t.Errorf("expected format %v, got %v", tt.expected, format)
+			}
+		})
+	}
+
+	_, err := resolveBuildFormat(config.HandlerMapping{Build: &config.BuildConfig{Format: "umd"}})
+	if err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
+
+func TestHandlerBuildOptionsBundlesESModules(t *testing.T) {
+	buildOptions, err := handlerBuildOptions(config.HandlerMapping{
+		Source: filepath.Join(t.TempDir(), "handler.mts"),
+	}, "/out")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buildOptions.Format != api.FormatESModule {
+		t.Errorf("expected ES module format, got %v", buildOptions.Format)
+	}
+
+	if buildOptions.OutExtension[".js"] != ".mjs" {
+		t.Errorf("expected .mjs output extension, got %v", buildOptions.OutExtension)
+	}
+
+	if buildOptions.GlobalName != "" {
+		t.Errorf("expected no global name for ES modules, got %q", buildOptions.GlobalName)
+	}
+}
+
+func TestHandlerBuildOptionsNamesCommonJSBundlesInModulePackages(t *testing.T) {
+	moduleDir := t.TempDir()
+	writeHandlerSource(t, moduleDir, "package.json", `{ "type": "module" }`)
+
+	tests := []struct {
+		name     string
+		handler  config.HandlerMapping
+		expected string
+	}{
+		{
+			name: "explicit cjs format",
+			handler: config.HandlerMapping{
+				Source: filepath.Join(moduleDir, "handler.ts"),
+				Build:  &config.BuildConfig{Format: "cjs"},
+			},
+			expected: ".cjs",
+		},
+		{
+			name:     "cts source",
+			handler:  config.HandlerMapping{Source: filepath.Join(moduleDir, "handler.cts")},
+			expected: ".cjs",
+		},
+		{
+			name:     "module package",
+			handler:  config.HandlerMapping{Source: filepath.Join(moduleDir, "handler.ts")},
+			expected: ".mjs",
+		},
+		{
+			name:     "no package type",
+			handler:  config.HandlerMapping{Source: filepath.Join(t.TempDir(), "handler.ts")},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buildOptions, err := handlerBuildOptions(tt.handler, "/out")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if extension := buildOptions.OutExtension[".js"]; extension != tt.expected {
+				t.Errorf("expected output extension %q, got %q", tt.expected, extension)
+			}
+		})
+	}
+}
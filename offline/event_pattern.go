@@ -0,0 +1,499 @@
+package offline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// eventPattern is a compiled EventBridge event pattern. Every field must match
+// and, for each $or, at least one of its alternatives.
+type eventPattern struct {
+	fields map[string]eventPatternField
+	anyOf  [][]*eventPattern
+}
+
+// eventPatternField matches a nested object with another pattern, or a value
+// with any one of its conditions.
+type eventPatternField struct {
+	nested     *eventPattern
+	conditions []eventCondition
+}
+
+// eventCondition reports whether a field matches, given its value and whether
+// the event has the field at all.
+type eventCondition func(value interface{}, present bool) bool
+
+// newEventPattern compiles the JSON text of an event pattern.
+func newEventPattern(patternJSON string) (*eventPattern, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(patternJSON)))
+	decoder.UseNumber()
+
+	var pattern interface{}
+	if err := decoder.Decode(&pattern); err != nil {
+		return nil, fmt.Errorf("event pattern is not valid JSON: %w", err)
+	}
+
+	object, ok := pattern.(map[string]interface{})
+	if !ok || len(object) == 0 {
+		return nil, fmt.Errorf("event pattern must be a JSON object with at least one field")
+	}
+
+	return compileEventPattern(object, "")
+}
+
+func compileEventPattern(object map[string]interface{}, path string) (*eventPattern, error) {
+	pattern := &eventPattern{fields: make(map[string]eventPatternField)}
+
+	for _, key := range sortedKeys(object) {
+		fieldPath := strings.TrimPrefix(path+"."+key, ".")
+
+		if key == "$or" {
+			alternatives, err := compileOrAlternatives(object[key], path, fieldPath)
+			if err != nil {
+				return nil, err
+			}
+
+			pattern.anyOf = append(pattern.anyOf, alternatives)
+			continue
+		}
+
+		switch value := object[key].(type) {
+		case map[string]interface{}:
+			nested, err := compileEventPattern(value, fieldPath)
+			if err != nil {
+				return nil, err
+			}
+
+			pattern.fields[key] = eventPatternField{nested: nested}
+		case []interface{}:
+			if len(value) == 0 {
+				return nil, fmt.Errorf("%s must list at least one value to match", fieldPath)
+			}
+
+			var conditions []eventCondition
+			for _, element := range value {
+				condition, err := compileEventCondition(element, fieldPath)
+				if err != nil {
+					return nil, err
+				}
+
+				conditions = append(conditions, condition)
+			}
+
+			pattern.fields[key] = eventPatternField{conditions: conditions}
+		default:
+			return nil, fmt.Errorf("%s must be an array of values to match or a nested object", fieldPath)
+		}
+	}
+
+	return pattern, nil
+}
+
+func compileOrAlternatives(value interface{}, parentPath string, path string) ([]*eventPattern, error) {
+	elements, ok := value.([]interface{})
+	if !ok || len(elements) < 2 {
+		return nil, fmt.Errorf("%s must be an array of at least two patterns", path)
+	}
+
+	alternatives := make([]*eventPattern, len(elements))
+	for i, element := range elements {
+		object, ok := element.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must only contain objects", path)
+		}
+
+		alternative, err := compileEventPattern(object, parentPath)
+		if err != nil {
+			return nil, err
+		}
+
+		alternatives[i] = alternative
+	}
+
+	return alternatives, nil
+}
+
+// compileEventCondition compiles one element of a field's array: a literal, or
+// an object holding a single content filter.
+func compileEventCondition(element interface{}, path string) (eventCondition, error) {
+	filter, isFilter := element.(map[string]interface{})
+	if !isFilter {
+		if _, isArray := element.([]interface{}); isArray {
+			return nil, fmt.Errorf("%s cannot contain nested arrays", path)
+		}
+
+		return leafCondition(equalsLiteral(element)), nil
+	}
+
+	if len(filter) != 1 {
+		return nil, fmt.Errorf("%s content filters must have exactly one operator, got %d", path, len(filter))
+	}
+
+	for operator, operand := range filter {
+		switch operator {
+		case "exists":
+			exists, ok := operand.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s exists must be true or false", path)
+			}
+
+			return func(value interface{}, present bool) bool {
+				if _, isObject := value.(map[string]interface{}); isObject {
+					return !exists
+				}
+
+				return present == exists
+			}, nil
+		case "anything-but":
+			match, err := compileAnythingBut(operand, path)
+			if err != nil {
+				return nil, err
+			}
+
+			return leafCondition(func(value interface{}) bool { return !match(value) }), nil
+		case "numeric":
+			match, err := compileNumeric(operand, path)
+			if err != nil {
+				return nil, err
+			}
+
+			return leafCondition(match), nil
+		case "cidr":
+			block, ok := operand.(string)
+			_, network, err := net.ParseCIDR(block)
+			if !ok || err != nil {
+				return nil, fmt.Errorf("%s cidr must be an IP address range such as 10.0.0.0/24", path)
+			}
+
+			return leafCondition(func(value interface{}) bool {
+				text, ok := value.(string)
+				ip := net.ParseIP(text)
+				return ok && ip != nil && network.Contains(ip)
+			}), nil
+		default:
+			match, err := compileStringFilter(operator, operand, path)
+			if err != nil {
+				return nil, err
+			}
+
+			return leafCondition(match), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// compileStringFilter compiles the prefix, suffix, equals-ignore-case and
+// wildcard filters, which only match strings.
+func compileStringFilter(operator string, operand interface{}, path string) (func(value interface{}) bool, error) {
+	text, isText := operand.(string)
+
+	var match func(value string) bool
+
+	switch operator {
+	case "prefix", "suffix":
+		ignoreCase := false
+
+		if object, ok := operand.(map[string]interface{}); ok && len(object) == 1 {
+			text, isText = object["equals-ignore-case"].(string)
+			ignoreCase = true
+		}
+
+		if !isText {
+			return nil, fmt.Errorf("%s %s must be a string or {\"equals-ignore-case\": string}", path, operator)
+		}
+
+		affix := text
+		if ignoreCase {
+			affix = strings.ToLower(text)
+		}
+
+		match = func(value string) bool {
+			if ignoreCase {
+				value = strings.ToLower(value)
+			}
+
+			if operator == "prefix" {
+				return strings.HasPrefix(value, affix)
+			}
+
+			return strings.HasSuffix(value, affix)
+		}
+	case "equals-ignore-case":
+		if !isText {
+			return nil, fmt.Errorf("%s equals-ignore-case must be a string", path)
+		}
+
+		match = func(value string) bool { return strings.EqualFold(value, text) }
+	case "wildcard":
+		if !isText {
+			return nil, fmt.Errorf("%s wildcard must be a string", path)
+		}
+
+		expression, err := compileWildcard(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s %w", path, err)
+		}
+
+		match = expression.MatchString
+	default:
+		return nil, fmt.Errorf("%s uses the unknown content filter %q", path, operator)
+	}
+
+	return func(value interface{}) bool {
+		text, ok := value.(string)
+		return ok && match(text)
+	}, nil
+}
+
+// compileAnythingBut returns what anything-but excludes: a literal, a list of
+// literals, or a prefix, suffix, equals-ignore-case or wildcard filter.
+func compileAnythingBut(operand interface{}, path string) (func(value interface{}) bool, error) {
+	switch operand := operand.(type) {
+	case map[string]interface{}:
+		if len(operand) != 1 {
+			return nil, fmt.Errorf("%s anything-but must have exactly one operator", path)
+		}
+
+		for operator, nested := range operand {
+			if list, ok := nested.([]interface{}); ok && (operator == "equals-ignore-case" || operator == "wildcard") {
+				var matches []func(value interface{}) bool
+				for _, element := range list {
+					match, err := compileStringFilter(operator, element, path+" anything-but")
+					if err != nil {
+						return nil, err
+					}
+
+					matches = append(matches, match)
+				}
+
+				return anyOf(matches), nil
+			}
+
+			return compileStringFilter(operator, nested, path+" anything-but")
+		}
+	case []interface{}:
+		var matches []func(value interface{}) bool
+		for _, element := range operand {
+			if !isEventLiteral(element) {
+				return nil, fmt.Errorf("%s anything-but lists can only contain strings and numbers", path)
+			}
+
+			matches = append(matches, equalsLiteral(element))
+		}
+
+		return anyOf(matches), nil
+	}
+
+	if !isEventLiteral(operand) {
+		return nil, fmt.Errorf("%s anything-but must be a string, a number, a list of them or a content filter", path)
+	}
+
+	return equalsLiteral(operand), nil
+}
+
+// compileNumeric compiles a list of one or two comparisons, such as
+// [">", 0, "<=", 5].
+func compileNumeric(operand interface{}, path string) (func(value interface{}) bool, error) {
+	list, ok := operand.([]interface{})
+	if !ok || (len(list) != 2 && len(list) != 4) {
+		return nil, fmt.Errorf("%s numeric must be one or two comparisons, such as [\">\", 0, \"<=\", 5]", path)
+	}
+
+	var comparisons []func(number float64) bool
+
+	for i := 0; i < len(list); i += 2 {
+		operator, _ := list[i].(string)
+
+		limitNumber, ok := list[i+1].(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("%s numeric %q must be followed by a number", path, operator)
+		}
+
+		limit, _ := limitNumber.Float64()
+
+		switch operator {
+		case "=":
+			comparisons = append(comparisons, func(number float64) bool { return number == limit })
+		case "<":
+			comparisons = append(comparisons, func(number float64) bool { return number < limit })
+		case "<=":
+			comparisons = append(comparisons, func(number float64) bool { return number <= limit })
+		case ">":
+			comparisons = append(comparisons, func(number float64) bool { return number > limit })
+		case ">=":
+			comparisons = append(comparisons, func(number float64) bool { return number >= limit })
+		default:
+			return nil, fmt.Errorf("%s numeric operator %v must be one of =, <, <=, > and >=", path, list[i])
+		}
+	}
+
+	return func(value interface{}) bool {
+		number, ok := eventNumber(value)
+		if !ok {
+			return false
+		}
+
+		for _, comparison := range comparisons {
+			if !comparison(number) {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
+// compileWildcard turns a pattern where * matches any run of characters, and
+// \* a literal asterisk, into a regular expression.
+func compileWildcard(pattern string) (*regexp.Regexp, error) {
+	if strings.Contains(pattern, "**") {
+		return nil, fmt.Errorf("wildcard %q cannot contain consecutive *", pattern)
+	}
+
+	var expression strings.Builder
+	expression.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern) && (pattern[i+1] == '*' || pattern[i+1] == '\\'):
+			expression.WriteString(regexp.QuoteMeta(pattern[i+1 : i+2]))
+			i++
+		case pattern[i] == '*':
+			expression.WriteString("(?s:.*)")
+		default:
+			expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	expression.WriteString("$")
+
+	return regexp.MustCompile(expression.String()), nil
+}
+
+// leafCondition matches a field that is present with a value, or with an
+// array holding at least one value, that match reports as matching.
+func leafCondition(match func(value interface{}) bool) eventCondition {
+	return func(value interface{}, present bool) bool {
+		if !present {
+			return false
+		}
+
+		if elements, ok := value.([]interface{}); ok {
+			for _, element := range elements {
+				if match(element) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		return match(value)
+	}
+}
+
+func equalsLiteral(literal interface{}) func(value interface{}) bool {
+	if number, ok := eventNumber(literal); ok {
+		return func(value interface{}) bool {
+			valueNumber, ok := eventNumber(value)
+			return ok && valueNumber == number
+		}
+	}
+
+	return func(value interface{}) bool {
+		return value == literal
+	}
+}
+
+func anyOf(matches []func(value interface{}) bool) func(value interface{}) bool {
+	return func(value interface{}) bool {
+		for _, match := range matches {
+			if match(value) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func isEventLiteral(value interface{}) bool {
+	switch value.(type) {
+	case string, json.Number, float64:
+		return true
+	}
+
+	return false
+}
+
+func eventNumber(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return value, true
+	case json.Number:
+		number, err := value.Float64()
+		return number, err == nil
+	}
+
+	return 0, false
+}
+
+// Matches reports whether a decoded event matches the pattern.
+func (pattern *eventPattern) Matches(event map[string]interface{}) bool {
+	for key, field := range pattern.fields {
+		value, present := event[key]
+
+		if field.nested != nil {
+			nestedEvent, _ := value.(map[string]interface{})
+			if !field.nested.Matches(nestedEvent) {
+				return false
+			}
+
+			continue
+		}
+
+		matched := false
+		for _, condition := range field.conditions {
+			if condition(value, present) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	for _, alternatives := range pattern.anyOf {
+		matched := false
+		for _, alternative := range alternatives {
+			if alternative.Matches(event) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
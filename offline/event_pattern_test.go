@@ -0,0 +1,134 @@
+package offline
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testEventJSON = `{
+	"version": "0",
+	"id": "event-id",
+	"detail-type": "Order Placed",
+	"source": "com.example.orders",
+	"account": "000000000000",
+	"time": "2026-10-19T12:00:00Z",
+	"region": "eu-west-1",
+	"resources": ["arn:aws:s3:::orders-bucket"],
+	"detail": {
+		"orderId": "order-1234",
+		"status": "PLACED",
+		"total": 42.5,
+		"quantity": 3,
+		"items": ["book", "pen"],
+		"customer": {"tier": "gold", "email": "Someone@Example.com"},
+		"sourceIp": "10.0.0.12",
+		"note": null
+	}
+}`
+
+func TestEventPatternMatching(t *testing.T) {
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(testEventJSON), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		pattern  string
+		expected bool
+	}{
+		{"literal", `{"source": ["com.example.orders"]}`, true},
+		{"literal mismatch", `{"source": ["com.example.payments"]}`, false},
+		{"any listed literal", `{"source": ["com.example.payments", "com.example.orders"]}`, true},
+		{"every field must match", `{"source": ["com.example.orders"], "detail-type": ["Order Shipped"]}`, false},
+		{"nested field", `{"detail": {"customer": {"tier": ["gold"]}}}`, true},
+		{"number literal", `{"detail": {"quantity": [3]}}`, true},
+		{"number literal compares numerically", `{"detail": {"total": [42.50]}}`, true},
+		{"null literal", `{"detail": {"note": [null]}}`, true},
+		{"null literal does not match a missing field", `{"detail": {"missing": [null]}}`, false},
+		{"array value matches any element", `{"detail": {"items": ["pen"]}}`, true},
+		{"array value without a matching element", `{"detail": {"items": ["ink"]}}`, false},
+		{"resources", `{"resources": ["arn:aws:s3:::orders-bucket"]}`, true},
+		{"prefix", `{"detail": {"orderId": [{"prefix": "order-"}]}}`, true},
+		{"prefix mismatch", `{"detail": {"orderId": [{"prefix": "refund-"}]}}`, false},
+		{"prefix ignoring case", `{"detail": {"orderId": [{"prefix": {"equals-ignore-case": "ORDER-"}}]}}`, true},
+		{"suffix", `{"detail": {"orderId": [{"suffix": "1234"}]}}`, true},
+		{"suffix ignoring case", `{"detail": {"customer": {"email": [{"suffix": {"equals-ignore-case": "@EXAMPLE.COM"}}]}}}`, true},
+		{"equals ignoring case", `{"detail": {"customer": {"email": [{"equals-ignore-case": "someone@example.com"}]}}}`, true},
+		{"anything-but literal", `{"detail": {"status": [{"anything-but": "CANCELLED"}]}}`, true},
+		{"anything-but matching literal", `{"detail": {"status": [{"anything-but": "PLACED"}]}}`, false},
+		{"anything-but list", `{"detail": {"status": [{"anything-but": ["CANCELLED", "PLACED"]}]}}`, false},
+		{"anything-but number", `{"detail": {"quantity": [{"anything-but": 3}]}}`, false},
+		{"anything-but prefix", `{"detail": {"orderId": [{"anything-but": {"prefix": "refund-"}}]}}`, true},
+		{"anything-but suffix", `{"detail": {"orderId": [{"anything-but": {"suffix": "1234"}}]}}`, false},
+		{"anything-but needs the field", `{"detail": {"missing": [{"anything-but": "x"}]}}`, false},
+		{"numeric range", `{"detail": {"total": [{"numeric": [">", 0, "<=", 50]}]}}`, true},
+		{"numeric out of range", `{"detail": {"total": [{"numeric": [">=", 50]}]}}`, false},
+		{"numeric equals", `{"detail": {"quantity": [{"numeric": ["=", 3]}]}}`, true},
+		{"numeric does not match strings", `{"detail": {"orderId": [{"numeric": [">", 0]}]}}`, false},
+		{"exists", `{"detail": {"orderId": [{"exists": true}]}}`, true},
+		{"exists on a missing field", `{"detail": {"missing": [{"exists": true}]}}`, false},
+		{"does not exist", `{"detail": {"missing": [{"exists": false}]}}`, true},
+		{"does not exist on a present field", `{"detail": {"orderId": [{"exists": false}]}}`, false},
+		{"exists on an object", `{"detail": {"customer": [{"exists": true}]}}`, false},
+		{"wildcard", `{"detail": {"orderId": [{"wildcard": "order-*4"}]}}`, true},
+		{"wildcard mismatch", `{"detail": {"orderId": [{"wildcard": "*-5*"}]}}`, false},
+		{"escaped wildcard", `{"detail": {"orderId": [{"wildcard": "order\\*"}]}}`, false},
+		{"cidr", `{"detail": {"sourceIp": [{"cidr": "10.0.0.0/24"}]}}`, true},
+		{"cidr mismatch", `{"detail": {"sourceIp": [{"cidr": "10.0.1.0/24"}]}}`, false},
+		{"literal or filter", `{"detail": {"status": ["SHIPPED", {"prefix": "PL"}]}}`, true},
+		{"$or", `{"$or": [{"source": ["com.example.payments"]}, {"detail": {"quantity": [{"numeric": [">", 2]}]}}]}`, true},
+		{"$or without a match", `{"$or": [{"source": ["com.example.payments"]}, {"detail": {"quantity": [{"numeric": [">", 5]}]}}]}`, false},
+		{"nested $or", `{"detail": {"$or": [{"status": ["SHIPPED"]}, {"customer": {"tier": ["gold"]}}]}}`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pattern, err := newEventPattern(test.pattern)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if matched := pattern.Matches(event); matched != test.expected {
+				t.Errorf("expected %s to match: %v, got %v", test.pattern, test.expected, matched)
+			}
+		})
+	}
+}
+
+func TestEventPatternRejectsInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		message string
+	}{
+		{`not json`, "not valid JSON"},
+		{`{}`, "at least one field"},
+		{`{"source": "com.example.orders"}`, "source must be an array of values to match or a nested object"},
+		{`{"source": []}`, "source must list at least one value to match"},
+		{`{"source": [["nested"]]}`, "cannot contain nested arrays"},
+		{`{"source": [{"prefix": "a", "suffix": "b"}]}`, "exactly one operator"},
+		{`{"source": [{"unknown": "a"}]}`, `unknown content filter "unknown"`},
+		{`{"source": [{"exists": "yes"}]}`, "exists must be true or false"},
+		{`{"source": [{"numeric": [">"]}]}`, "one or two comparisons"},
+		{`{"source": [{"numeric": [">", "1"]}]}`, "must be followed by a number"},
+		{`{"source": [{"numeric": ["!=", 1]}]}`, "must be one of"},
+		{`{"source": [{"cidr": "10.0.0.1"}]}`, "cidr must be an IP address range"},
+		{`{"source": [{"wildcard": "a**b"}]}`, "consecutive *"},
+		{`{"source": [{"anything-but": {"prefix": "a", "suffix": "b"}}]}`, "anything-but must have exactly one operator"},
+		{`{"$or": [{"source": ["a"]}]}`, "at least two patterns"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			_, err := newEventPattern(test.pattern)
+			if err == nil {
+				t.Fatalf("expected %s to be rejected", test.pattern)
+			}
+
+			if !strings.Contains(err.Error(), test.message) {
+				t.Errorf("expected error containing %q, got %q", test.message, err)
+			}
+		})
+	}
+}
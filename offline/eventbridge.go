@@ -0,0 +1,350 @@
+package offline
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/gorilla/mux"
+)
+
+const (
+	eventBridgeAPITargetPrefix = "AWSEvents."
+	eventBridgeAPIContentType  = "application/x-amz-json-1.1"
+	maxPutEventsEntries        = 10
+)
+
+// eventBus delivers events to every handler whose event_pattern matches them.
+// All event buses share the same rules, whichever bus an event is put on.
+type eventBus struct {
+	rules   []eventRule
+	execute func(handler *HandlerInstance, event map[string]interface{}) HandlerOutput
+}
+
+type eventRule struct {
+	handler *HandlerInstance
+	pattern *eventPattern
+}
+
+func (rule eventRule) handlerName() string {
+	return rule.handler.handlerConfig.Name
+}
+
+type eventDelivery struct {
+	Handler string `json:"handler"`
+	Outcome string `json:"outcome"`
+}
+
+// newEventBus builds a rule for each handler with an event pattern, in handler
+// name order. Patterns are checked when the configuration is validated.
+func newEventBus(handlerInstances []*HandlerInstance, async *asyncQueue) *eventBus {
+	bus := &eventBus{
+		execute: func(handler *HandlerInstance, event map[string]interface{}) HandlerOutput {
+			return async.invokeEvent(handler, event)
+		},
+	}
+
+	for _, handler := range handlerInstances {
+		if handler.handlerConfig.EventPattern == "" {
+			continue
+		}
+
+		pattern, err := newEventPattern(handler.handlerConfig.EventPattern)
+		if err != nil {
+			continue
+		}
+
+		bus.rules = append(bus.rules, eventRule{handler: handler, pattern: pattern})
+	}
+
+	sort.Slice(bus.rules, func(i, j int) bool {
+		return bus.rules[i].handler.handlerConfig.Name < bus.rules[j].handler.handlerConfig.Name
+	})
+
+	return bus
+}
+
+// matchingRules returns the rules whose pattern matches the event. The event
+// is round-tripped through JSON so that patterns see the same types as they
+// would in AWS.
+func (bus *eventBus) matchingRules(event map[string]interface{}) []eventRule {
+	eventJSON, _ := json.Marshal(event)
+
+	var decoded map[string]interface{}
+	json.Unmarshal(eventJSON, &decoded)
+
+	var matched []eventRule
+	for _, rule := range bus.rules {
+		if rule.pattern.Matches(decoded) {
+			matched = append(matched, rule)
+		}
+	}
+
+	return matched
+}
+
+// put delivers an event to the matching handlers in the background, as
+// EventBridge invokes its targets asynchronously.
+func (bus *eventBus) put(event map[string]interface{}) {
+	rules := bus.matchingRules(event)
+	printMatches(fmt.Sprintf("EventBridge %s %q (%s)", event["source"], event["detail-type"], event["id"]), rules, eventRule.handlerName, "no handlers")
+
+	for _, rule := range rules {
+		go bus.deliver(rule, event)
+	}
+}
+
+// putAndWait delivers an event to the matching handlers and waits for every
+// delivery to finish.
+func (bus *eventBus) putAndWait(event map[string]interface{}) []eventDelivery {
+	rules := bus.matchingRules(event)
+	printMatches(fmt.Sprintf("EventBridge %s %q (%s)", event["source"], event["detail-type"], event["id"]), rules, eventRule.handlerName, "no handlers")
+
+	deliveries := make([]eventDelivery, len(rules))
+
+	var wg sync.WaitGroup
+	for i, rule := range rules {
+		wg.Add(1)
+		go func(index int, rule eventRule) {
+			defer wg.Done()
+			deliveries[index] = bus.deliver(rule, event)
+		}(i, rule)
+	}
+
+	wg.Wait()
+
+	return deliveries
+}
+
+func (bus *eventBus) deliver(rule eventRule, event map[string]interface{}) eventDelivery {
+	name := rule.handler.handlerConfig.Name
+	start := time.Now()
+
+	output := bus.execute(rule.handler, event)
+	if output.err != nil {
+		fmt.Println(output.err)
+	}
+
+	delivery := eventDelivery{Handler: name, Outcome: "succeeded"}
+
+	if failure := invocationFailure(output); failure != "" {
+		delivery.Outcome = "failed: " + failure
+		color.New(color.FgHiYellow).Printf("EventBridge event %s failed in %s (%s) after %dms\n\n", event["id"], name, failure, time.Since(start).Milliseconds())
+	} else {
+		color.New(color.FgHiGreen).Printf("EventBridge event %s delivered to %s in %dms\n\n", event["id"], name, time.Since(start).Milliseconds())
+	}
+
+	return delivery
+}
+
+// putEventsEntry is an entry of a PutEvents request. Detail is JSON text.
+type putEventsEntry struct {
+	Source       string
+	DetailType   string
+	Detail       string
+	Resources    []string
+	Time         json.RawMessage
+	EventBusName string
+}
+
+type putEventsResultEntry struct {
+	EventId      string `json:",omitempty"`
+	ErrorCode    string `json:",omitempty"`
+	ErrorMessage string `json:",omitempty"`
+}
+
+// newEvent checks an entry the way PutEvents does and builds the event it puts
+// on the bus.
+func (entry putEventsEntry) newEvent() (map[string]interface{}, putEventsResultEntry) {
+	for _, required := range []struct{ name, value string }{
+		{"Source", entry.Source},
+		{"DetailType", entry.DetailType},
+		{"Detail", entry.Detail},
+	} {
+		if required.value == "" {
+			return nil, putEventsResultEntry{
+				ErrorCode:    "InvalidArgument",
+				ErrorMessage: fmt.Sprintf("Parameter %s is not valid. Reason: %s is a required argument.", required.name, required.name),
+			}
+		}
+	}
+
+	var detail map[string]interface{}
+	if err := json.Unmarshal([]byte(entry.Detail), &detail); err != nil || detail == nil {
+		return nil, putEventsResultEntry{ErrorCode: "MalformedDetail", ErrorMessage: "Detail is malformed."}
+	}
+
+	eventTime, ok := parsePutEventsTime(entry.Time)
+	if !ok {
+		return nil, putEventsResultEntry{ErrorCode: "InvalidArgument", ErrorMessage: "Parameter Time is not valid."}
+	}
+
+	event := newEventBridgeEvent(eventBridgeEntry{
+		Source:     entry.Source,
+		DetailType: entry.DetailType,
+		Detail:     entry.Detail,
+		Resources:  entry.Resources,
+		Time:       eventTime,
+	})
+
+	return event, putEventsResultEntry{EventId: event["id"].(string)}
+}
+
+// parsePutEventsTime reads an entry's time, which AWS SDKs send as seconds
+// since the epoch. RFC 3339 strings are accepted too. It defaults to now.
+func parsePutEventsTime(value json.RawMessage) (time.Time, bool) {
+	if len(value) == 0 || string(value) == "null" {
+		return time.Now(), true
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(value, &seconds); err == nil {
+		whole, fraction := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(fraction*float64(time.Second))), true
+	}
+
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		parsed, err := time.Parse(time.RFC3339, text)
+		return parsed, err == nil
+	}
+
+	return time.Time{}, false
+}
+
+// registerEventBridgeAPIRoutes serves PutEvents from the EventBridge API, using
+// the AWS JSON protocol, so that events put with an AWS SDK reach handlers
+// with a matching event_pattern.
+//
+// Requests are POSTed to the root path and identified by their X-Amz-Target
+// header, so the route is registered ahead of handler routes.
+func registerEventBridgeAPIRoutes(r *mux.Router, bus *eventBus) {
+	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), eventBridgeAPITargetPrefix)
+
+		if action != "PutEvents" {
+			writeEventBridgeAPIError(w, "UnknownOperationException", fmt.Sprintf("terrable does not support the EventBridge %s action.", action))
+			return
+		}
+
+		var request struct {
+			Entries []putEventsEntry
+		}
+
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeEventBridgeAPIError(w, "ValidationException", fmt.Sprintf("The request body is not valid JSON: %s", err))
+			return
+		}
+
+		if len(request.Entries) == 0 || len(request.Entries) > maxPutEventsEntries {
+			writeEventBridgeAPIError(w, "ValidationException", fmt.Sprintf("1 validation error detected: Value at 'entries' failed to satisfy constraint: Member must have length between 1 and %d", maxPutEventsEntries))
+			return
+		}
+
+		response := struct {
+			FailedEntryCount int
+			Entries          []putEventsResultEntry
+		}{}
+
+		var events []map[string]interface{}
+
+		for _, entry := range request.Entries {
+			event, result := entry.newEvent()
+			if event == nil {
+				response.FailedEntryCount++
+			} else {
+				events = append(events, event)
+			}
+
+			response.Entries = append(response.Entries, result)
+		}
+
+		fmt.Printf("EventBridge API PutEvents\n")
+
+		for _, event := range events {
+			bus.put(event)
+		}
+
+		body, _ := json.Marshal(response)
+
+		w.Header().Set("Content-Type", eventBridgeAPIContentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}).
+		Methods(http.MethodPost).
+		HeadersRegexp("X-Amz-Target", "^"+strings.ReplaceAll(eventBridgeAPITargetPrefix, ".", `\.`))
+}
+
+func writeEventBridgeAPIError(w http.ResponseWriter, code string, message string) {
+	body, _ := json.Marshal(map[string]string{
+		"__type":  code,
+		"message": message,
+	})
+
+	w.Header().Set("Content-Type", eventBridgeAPIContentType)
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(body)
+}
+
+// registerEventBridgeRoutes adds the endpoints for putting events by hand and
+// listing the rules.
+//
+// POST /_eventbridge takes a single PutEvents entry, whose Detail may also be
+// a JSON object, and responds once every matching handler has finished with
+// the outcome of each delivery. GET /_eventbridge lists the event patterns.
+func registerEventBridgeRoutes(r *mux.Router, bus *eventBus) {
+	r.HandleFunc("/_eventbridge", func(w http.ResponseWriter, r *http.Request) {
+		var entry struct {
+			putEventsEntry
+			Detail json.RawMessage
+		}
+
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": fmt.Sprintf("The request body is not a valid event: %s", err)})
+			return
+		}
+
+		entry.putEventsEntry.Detail = string(entry.Detail)
+
+		var detailText string
+		if json.Unmarshal(entry.Detail, &detailText) == nil {
+			entry.putEventsEntry.Detail = detailText
+		}
+
+		event, result := entry.newEvent()
+		if event == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": result.ErrorMessage})
+			return
+		}
+
+		deliveries := bus.putAndWait(event)
+		if deliveries == nil {
+			deliveries = []eventDelivery{}
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"eventId":    result.EventId,
+			"deliveries": deliveries,
+		})
+	}).Methods(http.MethodPost)
+
+	r.HandleFunc("/_eventbridge", func(w http.ResponseWriter, r *http.Request) {
+		rules := make([]map[string]interface{}, len(bus.rules))
+		for i, rule := range bus.rules {
+			rules[i] = map[string]interface{}{
+				"handler":      rule.handler.handlerConfig.Name,
+				"eventPattern": json.RawMessage(rule.handler.handlerConfig.EventPattern),
+			}
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"rules": rules})
+	}).Methods(http.MethodGet)
+}
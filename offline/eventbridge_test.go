@@ -0,0 +1,190 @@
+package offline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func newTestEventBus(t *testing.T) (*mux.Router, *recordedInvocations[map[string]interface{}]) {
+	t.Helper()
+
+	bus := newEventBus([]*HandlerInstance{
+		{handlerConfig: config.HandlerMapping{Name: "Shipping", EventPattern: `{"detail-type": ["Order Placed"], "detail": {"total": [{"numeric": [">", 0]}]}}`}},
+		{handlerConfig: config.HandlerMapping{Name: "Audit", EventPattern: `{"source": [{"prefix": "com.example."}]}`}},
+		{handlerConfig: config.HandlerMapping{Name: "Api", Http: map[string]string{"GET": "/"}}},
+	}, nil)
+
+	recorded := newRecordedInvocations[map[string]interface{}]()
+	bus.execute = func(handler *HandlerInstance, event map[string]interface{}) HandlerOutput {
+		recorded.record(handler, event)
+
+		if handler.handlerConfig.Name == "Audit" {
+			return HandlerOutput{handlerResult: newHandlerErrorResult(runtimeErrorResponse{ErrorMessage: "audit log unavailable", ErrorType: "Error"})}
+		}
+
+		return HandlerOutput{handlerResult: &handlerResult{StatusCode: 200}}
+	}
+
+	r := mux.NewRouter()
+	registerEventBridgeAPIRoutes(r, bus)
+	registerEventBridgeRoutes(r, bus)
+
+	return r, recorded
+}
+
+func callEventBridgeAPI(t *testing.T, r http.Handler, action string, request string) (int, map[string]interface{}) {
+	t.Helper()
+
+	httpRequest := httptest.NewRequest(http.MethodPost, "http://localhost:3000/", strings.NewReader(request))
+	httpRequest.Header.Set("Content-Type", eventBridgeAPIContentType)
+	httpRequest.Header.Set("X-Amz-Target", eventBridgeAPITargetPrefix+action)
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httpRequest)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse %s response %q: %v", action, recorder.Body.String(), err)
+	}
+
+	return recorder.Code, response
+}
+
+func TestEventBusOrdersRulesByHandlerName(t *testing.T) {
+	r, _ := newTestEventBus(t)
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/_eventbridge", nil))
+
+	expected := `{"rules":[
+		{"handler":"Audit","eventPattern":{"source":[{"prefix":"com.example."}]}},
+		{"handler":"Shipping","eventPattern":{"detail-type":["Order Placed"],"detail":{"total":[{"numeric":[">",0]}]}}}
+	]}`
+
+	if !jsonEqual(t, recorder.Body.Bytes(), []byte(expected)) {
+		t.Errorf("expected %s, got %s", expected, recorder.Body.String())
+	}
+}
+
+func TestPutEventsDeliversToMatchingHandlers(t *testing.T) {
+	r, recorded := newTestEventBus(t)
+
+	status, response := callEventBridgeAPI(t, r, "PutEvents", `{"Entries": [
+		{"Source": "com.example.orders", "DetailType": "Order Placed", "Detail": "{\"total\": 12.5}", "Resources": ["arn:aws:s3:::orders"], "Time": 1792411200, "EventBusName": "orders"},
+		{"Source": "com.example.orders", "DetailType": "Order Placed", "Detail": "{\"total\": 0}"},
+		{"Source": "com.example.orders", "DetailType": "Order Placed"},
+		{"Source": "com.example.orders", "DetailType": "Order Placed", "Detail": "[1, 2]"}
+	]}`)
+
+	if status != http.StatusOK {
+		t.Fatalf("unexpected PutEvents response %d %v", status, response)
+	}
+
+	if response["FailedEntryCount"] != float64(2) {
+		t.Errorf("expected 2 failed entries, got %v", response["FailedEntryCount"])
+	}
+
+	entries := response["Entries"].([]interface{})
+	if len(entries) != 4 {
+		t.Fatalf("expected a result for every entry, got %v", entries)
+	}
+
+	first := entries[0].(map[string]interface{})
+	if first["EventId"] == nil || first["ErrorCode"] != nil {
+		t.Errorf("expected the first entry to succeed, got %v", first)
+	}
+
+	missingDetail := entries[2].(map[string]interface{})
+	if missingDetail["ErrorCode"] != "InvalidArgument" || missingDetail["ErrorMessage"] != "Parameter Detail is not valid. Reason: Detail is a required argument." {
+		t.Errorf("unexpected result for an entry without detail: %v", missingDetail)
+	}
+
+	malformedDetail := entries[3].(map[string]interface{})
+	if malformedDetail["ErrorCode"] != "MalformedDetail" {
+		t.Errorf("unexpected result for an entry with malformed detail: %v", malformedDetail)
+	}
+
+	waitFor(t, func() bool { return len(recorded.get("Audit")) == 2 && len(recorded.get("Shipping")) == 1 })
+
+	event := recorded.get("Shipping")[0]
+	if event["id"] != first["EventId"] || event["source"] != "com.example.orders" || event["detail-type"] != "Order Placed" {
+		t.Errorf("unexpected event %v", event)
+	}
+
+	if event["time"] != "2026-10-19T12:00:00Z" {
+		t.Errorf("expected the entry time, got %v", event["time"])
+	}
+
+	detail, _ := json.Marshal(event["detail"])
+	if !jsonEqual(t, detail, []byte(`{"total": 12.5}`)) {
+		t.Errorf("unexpected detail %s", detail)
+	}
+}
+
+func TestPutEventsErrors(t *testing.T) {
+	r, _ := newTestEventBus(t)
+
+	tests := []struct {
+		action  string
+		request string
+		code    string
+	}{
+		{"PutRule", `{}`, "UnknownOperationException"},
+		{"PutEvents", `{"Entries": []}`, "ValidationException"},
+		{"PutEvents", `{"Entries": [` + strings.Repeat(`{"Source": "a", "DetailType": "b", "Detail": "{}"},`, 10) + `{"Source": "a", "DetailType": "b", "Detail": "{}"}]}`, "ValidationException"},
+		{"PutEvents", `not json`, "ValidationException"},
+	}
+
+	for _, test := range tests {
+		status, response := callEventBridgeAPI(t, r, test.action, test.request)
+		if status != http.StatusBadRequest || response["__type"] != test.code {
+			t.Errorf("expected %s for %s %s, got %d %v", test.code, test.action, test.request, status, response)
+		}
+	}
+}
+
+func TestPutEventEndpointWaitsForDeliveries(t *testing.T) {
+	r, recorded := newTestEventBus(t)
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/_eventbridge", strings.NewReader(
+		`{"Source": "com.example.orders", "DetailType": "Order Placed", "Detail": {"total": 5}}`,
+	)))
+
+	var response struct {
+		EventId    string          `json:"eventId"`
+		Deliveries []eventDelivery `json:"deliveries"`
+	}
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	expected := []eventDelivery{
+		{Handler: "Audit", Outcome: "failed: handler error: audit log unavailable"},
+		{Handler: "Shipping", Outcome: "succeeded"},
+	}
+
+	if len(response.Deliveries) != len(expected) || response.Deliveries[0] != expected[0] || response.Deliveries[1] != expected[1] {
+		t.Errorf("expected deliveries %v, got %v", expected, response.Deliveries)
+	}
+
+	if len(recorded.get("Shipping")) != 1 || recorded.get("Shipping")[0]["id"] != response.EventId {
+		t.Errorf("expected Shipping to receive event %s, got %v", response.EventId, recorded.get("Shipping"))
+	}
+
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/_eventbridge", strings.NewReader(
+		`{"Source": "com.example.orders", "Detail": "{}"}`,
+	)))
+
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "DetailType is a required argument") {
+		t.Errorf("expected the entry to be rejected, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
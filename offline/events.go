@@ -0,0 +1,708 @@
+package offline
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventInput describes an event for GenerateEvent. Fields that don't apply to
+// the chosen event source are ignored.
+type EventInput struct {
+	Method          string
+	Path            string
+	Headers         map[string]string
+	QueryParameters map[string]string
+	PathParameters  map[string]string
+	Body            string
+	QueueName       string
+	MessageBodies   []string
+	RuleName        string
+	TopicName       string
+	BucketName      string
+	ObjectKey       string
+}
+
+// EventSources lists the event sources GenerateEvent supports.
+var EventSources = []string{"http", "http-v2", "function-url", "sqs", "sns", "s3", "schedule"}
+
+// GenerateEvent builds an event exactly as offline mode would send it to a
+// handler, so that it can be saved as a fixture or piped to "terrable invoke".
+func GenerateEvent(source string, input EventInput) ([]byte, error) {
+	var event map[string]interface{}
+
+	switch source {
+	case "http":
+		event = newHttpEvent(input.httpRequest())
+	case "http-v2":
+		event = newHttpV2Event(input.httpRequest(), "localhost")
+	case "function-url":
+		event = newFunctionURLEvent(input.httpRequest(), "localhost", nil)
+	case "sqs":
+		bodies := input.MessageBodies
+		if len(bodies) == 0 {
+			bodies = []string{input.Body}
+		}
+
+		messages := make([]map[string]interface{}, len(bodies))
+		for i, body := range bodies {
+			messages[i] = newSqsMessage(valueOrDefault(input.QueueName, "queue"), []byte(body))
+		}
+
+		event = newSqsEvent(messages)
+	case "sns":
+		message := snsMessage{
+			TopicArn:  snsTopicArn(valueOrDefault(input.TopicName, "topic")),
+			Message:   input.Body,
+			Timestamp: time.Now(),
+		}
+
+		event = newSnsEvent(newSnsRecord(message.TopicArn+":subscription", message))
+	case "s3":
+		event = newS3Event(newS3Record(s3EventRecord{
+			Bucket:    valueOrDefault(input.BucketName, "bucket"),
+			EventName: "ObjectCreated:Put",
+			Key:       valueOrDefault(input.ObjectKey, "object"),
+			Size:      int64(len(input.Body)),
+			ETag:      fmt.Sprintf("%x", md5.Sum([]byte(input.Body))),
+			Time:      time.Now(),
+		}))
+	case "schedule":
+		event = newScheduledEvent(valueOrDefault(input.RuleName, "scheduled-rule"))
+	default:
+		return nil, fmt.Errorf("unknown event source %q: expected one of %s", source, strings.Join(EventSources, ", "))
+	}
+
+	var output bytes.Buffer
+
+	encoder := json.NewEncoder(&output)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(event); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSpace(output.Bytes()), nil
+}
+
+func (input EventInput) httpRequest() httpEventRequest {
+	return httpEventRequest{
+		Method:          strings.ToUpper(valueOrDefault(input.Method, http.MethodGet)),
+		Path:            valueOrDefault(input.Path, "/"),
+		Headers:         input.Headers,
+		QueryParameters: input.QueryParameters,
+		PathParameters:  input.PathParameters,
+		Body:            []byte(input.Body),
+	}
+}
+
+// httpEventRequest is the part of an HTTP request that API Gateway passes on
+// to a handler.
+type httpEventRequest struct {
+	Method          string
+	Path            string
+	Headers         map[string]string
+	QueryParameters map[string]string
+	PathParameters  map[string]string
+	Body            []byte
+}
+
+func newHttpEventRequest(r *http.Request, body []byte, pathParameters map[string]string) httpEventRequest {
+	queryParams := make(map[string]string)
+
+	for key, values := range r.URL.Query() {
+		queryParams[key] = values[len(values)-1] // Take the last value
+	}
+
+	headers := make(map[string]string)
+
+	for key, values := range r.Header {
+		headers[key] = values[0]
+	}
+
+	return httpEventRequest{
+		Method:          r.Method,
+		Path:            r.URL.Path,
+		Headers:         headers,
+		QueryParameters: queryParams,
+		PathParameters:  pathParameters,
+		Body:            body,
+	}
+}
+
+// newHttpEvent builds an API Gateway proxy event in the 1.0 payload format.
+func newHttpEvent(request httpEventRequest) map[string]interface{} {
+	// Format for API Gateway behaviours
+	var bodyValue interface{}
+
+	// Set body
+	if len(request.Body) > 0 {
+		bodyValue = string(request.Body)
+	} else {
+		bodyValue = nil
+	}
+
+	// Set query string params
+	var queryParamsValue interface{}
+
+	if len(request.QueryParameters) > 0 {
+		queryParamsValue = request.QueryParameters
+	} else {
+		queryParamsValue = nil
+	}
+
+	// Set path parameters
+	var pathParamsValue interface{}
+
+	if len(request.PathParameters) > 0 {
+		pathParamsValue = request.PathParameters
+	} else {
+		pathParamsValue = nil
+	}
+
+	headers := request.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	return map[string]interface{}{
+		"body":                  bodyValue,
+		"queryStringParameters": queryParamsValue,
+		"httpMethod":            request.Method,
+		"path":                  request.Path,
+		"headers":               headers,
+		"pathParameters":        pathParamsValue,
+	}
+}
+
+// newHttpV2Event builds an API Gateway HTTP API or function URL event in the
+// 2.0 payload format.
+func newHttpV2Event(request httpEventRequest, domainName string) map[string]interface{} {
+	now := time.Now().UTC()
+
+	headers := make(map[string]string, len(request.Headers))
+	var cookies []string
+
+	for key, value := range request.Headers {
+		if strings.EqualFold(key, "Cookie") {
+			for _, cookie := range strings.Split(value, ";") {
+				cookies = append(cookies, strings.TrimSpace(cookie))
+			}
+			continue
+		}
+
+		headers[strings.ToLower(key)] = value
+	}
+
+	queryKeys := make([]string, 0, len(request.QueryParameters))
+	for key := range request.QueryParameters {
+		queryKeys = append(queryKeys, key)
+	}
+
+	sort.Strings(queryKeys)
+
+	queryPairs := make([]string, 0, len(queryKeys))
+	for _, key := range queryKeys {
+		queryPairs = append(queryPairs, url.QueryEscape(key)+"="+url.QueryEscape(request.QueryParameters[key]))
+	}
+
+	event := map[string]interface{}{
+		"version":         "2.0",
+		"routeKey":        "$default",
+		"rawPath":         request.Path,
+		"rawQueryString":  strings.Join(queryPairs, "&"),
+		"headers":         headers,
+		"isBase64Encoded": false,
+		"requestContext": map[string]interface{}{
+			"accountId":    "000000000000",
+			"apiId":        "local",
+			"domainName":   domainName,
+			"domainPrefix": strings.SplitN(domainName, ".", 2)[0],
+			"http": map[string]interface{}{
+				"method":    request.Method,
+				"path":      request.Path,
+				"protocol":  "HTTP/1.1",
+				"sourceIp":  "127.0.0.1",
+				"userAgent": headers["user-agent"],
+			},
+			"requestId": uuid.New().String(),
+			"routeKey":  "$default",
+			"stage":     "$default",
+			"time":      now.Format("02/Jan/2006:15:04:05 -0700"),
+			"timeEpoch": now.UnixMilli(),
+		},
+	}
+
+	if len(cookies) > 0 {
+		event["cookies"] = cookies
+	}
+
+	if len(request.QueryParameters) > 0 {
+		event["queryStringParameters"] = request.QueryParameters
+	}
+
+	if len(request.PathParameters) > 0 {
+		event["pathParameters"] = request.PathParameters
+	}
+
+	if len(request.Body) > 0 {
+		event["body"] = string(request.Body)
+	}
+
+	return event
+}
+
+// newFunctionURLEvent builds a function URL event, which is a 2.0 payload
+// event whose API ID is the URL ID. Requests to URLs that use AWS_IAM auth
+// carry the caller's identity in the authorizer.
+func newFunctionURLEvent(request httpEventRequest, domainName string, authorizer map[string]interface{}) map[string]interface{} {
+	event := newHttpV2Event(request, domainName)
+
+	requestContext := event["requestContext"].(map[string]interface{})
+	requestContext["apiId"] = requestContext["domainPrefix"]
+
+	if authorizer != nil {
+		requestContext["authorizer"] = authorizer
+	}
+
+	return event
+}
+
+// webSocketEventRequest is what API Gateway passes on to the integration of a
+// WebSocket route. Headers and query parameters are those of the request that
+// opened the connection, and are only sent on $connect and $disconnect.
+type webSocketEventRequest struct {
+	RouteKey  string
+	EventType string
+	RequestID string
+	// MessageID, Body and IsBinary are set for messages only.
+	MessageID string
+	Body      []byte
+	IsBinary  bool
+	// DisconnectStatusCode and DisconnectReason are set for $disconnect only.
+	DisconnectStatusCode int
+	DisconnectReason     string
+
+	ConnectionID    string
+	ConnectedAt     time.Time
+	DomainName      string
+	SourceIP        string
+	UserAgent       string
+	Headers         http.Header
+	QueryParameters url.Values
+}
+
+// newWebSocketEvent builds a WebSocket API event for a connection, message or
+// disconnection.
+func newWebSocketEvent(request webSocketEventRequest) map[string]interface{} {
+	now := time.Now().UTC()
+
+	requestContext := map[string]interface{}{
+		"routeKey":          request.RouteKey,
+		"eventType":         request.EventType,
+		"extendedRequestId": request.RequestID,
+		"requestTime":       now.Format("02/Jan/2006:15:04:05 -0700"),
+		"messageDirection":  "IN",
+		"stage":             webSocketStage,
+		"connectedAt":       request.ConnectedAt.UnixMilli(),
+		"requestTimeEpoch":  now.UnixMilli(),
+		"identity": map[string]interface{}{
+			"sourceIp":  request.SourceIP,
+			"userAgent": request.UserAgent,
+		},
+		"requestId":    request.RequestID,
+		"domainName":   request.DomainName,
+		"connectionId": request.ConnectionID,
+		"apiId":        "local",
+	}
+
+	event := map[string]interface{}{
+		"requestContext":  requestContext,
+		"isBase64Encoded": false,
+	}
+
+	if request.EventType == "MESSAGE" {
+		requestContext["messageId"] = request.MessageID
+
+		if request.IsBinary {
+			event["body"] = base64.StdEncoding.EncodeToString(request.Body)
+			event["isBase64Encoded"] = true
+		} else {
+			event["body"] = string(request.Body)
+		}
+
+		return event
+	}
+
+	if request.EventType == "DISCONNECT" {
+		requestContext["disconnectStatusCode"] = request.DisconnectStatusCode
+		requestContext["disconnectReason"] = request.DisconnectReason
+	}
+
+	headers := make(map[string]string, len(request.Headers))
+	multiValueHeaders := make(map[string][]string, len(request.Headers))
+	for key, values := range request.Headers {
+		headers[key] = values[0]
+		multiValueHeaders[key] = values
+	}
+
+	event["headers"] = headers
+	event["multiValueHeaders"] = multiValueHeaders
+
+	if len(request.QueryParameters) > 0 && request.EventType == "CONNECT" {
+		queryParameters := make(map[string]string, len(request.QueryParameters))
+		for key, values := range request.QueryParameters {
+			queryParameters[key] = values[len(values)-1]
+		}
+
+		event["queryStringParameters"] = queryParameters
+		event["multiValueQueryStringParameters"] = map[string][]string(request.QueryParameters)
+	}
+
+	return event
+}
+
+func newSqsMessage(queueName string, body []byte) map[string]interface{} {
+	now := time.Now()
+
+	return newSqsRecord(sqsRecord{
+		MessageID:             uuid.New().String(),
+		Body:                  string(body),
+		QueueArn:              sqsQueueArn(queueName),
+		ReceiveCount:          1,
+		SentTimestamp:         now,
+		FirstReceiveTimestamp: now,
+	})
+}
+
+// sqsRecord is what a queue knows about a message at the moment it is
+// delivered to a handler.
+type sqsRecord struct {
+	MessageID             string
+	Body                  string
+	MessageAttributes     map[string]sqsMessageAttribute
+	GroupID               string
+	DeduplicationID       string
+	SequenceNumber        string
+	QueueArn              string
+	ReceiveCount          int
+	SentTimestamp         time.Time
+	FirstReceiveTimestamp time.Time
+}
+
+// sqsMessageAttribute is a message attribute as it is sent through the SQS API.
+type sqsMessageAttribute struct {
+	DataType    string  `json:"DataType"`
+	StringValue *string `json:"StringValue,omitempty"`
+	BinaryValue []byte  `json:"BinaryValue,omitempty"`
+}
+
+func newSqsRecord(record sqsRecord) map[string]interface{} {
+	messageAttributes := make(map[string]interface{}, len(record.MessageAttributes))
+
+	for name, attribute := range record.MessageAttributes {
+		recordAttribute := map[string]interface{}{
+			"dataType":         attribute.DataType,
+			"stringListValues": []string{},
+			"binaryListValues": []string{},
+		}
+
+		if attribute.StringValue != nil {
+			recordAttribute["stringValue"] = *attribute.StringValue
+		}
+
+		if attribute.BinaryValue != nil {
+			recordAttribute["binaryValue"] = attribute.BinaryValue
+		}
+
+		messageAttributes[name] = recordAttribute
+	}
+
+	attributes := map[string]interface{}{
+		"ApproximateReceiveCount":          fmt.Sprintf("%d", record.ReceiveCount),
+		"SentTimestamp":                    fmt.Sprintf("%d", record.SentTimestamp.UnixMilli()),
+		"SenderId":                         "SIMULATOR",
+		"ApproximateFirstReceiveTimestamp": fmt.Sprintf("%d", record.FirstReceiveTimestamp.UnixMilli()),
+	}
+
+	// Messages from FIFO queues also carry their ordering attributes
+	if record.SequenceNumber != "" {
+		attributes["MessageGroupId"] = record.GroupID
+		attributes["MessageDeduplicationId"] = record.DeduplicationID
+		attributes["SequenceNumber"] = record.SequenceNumber
+	}
+
+	return map[string]interface{}{
+		"messageId":         record.MessageID,
+		"body":              record.Body,
+		"attributes":        attributes,
+		"messageAttributes": messageAttributes,
+		"md5OfBody":         fmt.Sprintf("%x", md5.Sum([]byte(record.Body))),
+		"eventSource":       "aws:sqs",
+		"eventSourceARN":    record.QueueArn,
+		"awsRegion":         "eu-west-1",
+	}
+}
+
+// sqsQueueArn returns queue unchanged when it is already an ARN, otherwise the
+// ARN of a local queue with that name.
+func sqsQueueArn(queue string) string {
+	if strings.HasPrefix(queue, "arn:") {
+		return queue
+	}
+
+	return fmt.Sprintf("arn:aws:sqs:eu-west-1:000000000000:%s", queue)
+}
+
+func newSqsEvent(messages []map[string]interface{}) map[string]interface{} {
+	records := make([]interface{}, len(messages))
+	for i, message := range messages {
+		records[i] = message
+	}
+
+	return map[string]interface{}{
+		"Records": records,
+	}
+}
+
+// snsMessage is a message published to a topic.
+type snsMessage struct {
+	ID                string
+	TopicArn          string
+	Subject           string
+	Message           string
+	MessageAttributes map[string]sqsMessageAttribute
+	GroupID           string
+	DeduplicationID   string
+	Timestamp         time.Time
+	// Structured messages are JSON objects holding a message for each
+	// protocol and a default one.
+	Structured bool
+}
+
+// snsTopicArn returns topic unchanged when it is already an ARN, otherwise the
+// ARN of a local topic with that name.
+func snsTopicArn(topic string) string {
+	if strings.HasPrefix(topic, "arn:") {
+		return topic
+	}
+
+	return fmt.Sprintf("arn:aws:sns:eu-west-1:000000000000:%s", topic)
+}
+
+// newSnsNotification returns the notification SNS delivers for a message. Lambda
+// records and queue messages spell the URL fields differently, so they are
+// named by signingCertURLKey and unsubscribeURLKey.
+func newSnsNotification(subscriptionArn string, message snsMessage, signingCertURLKey string, unsubscribeURLKey string) map[string]interface{} {
+	messageAttributes := make(map[string]interface{}, len(message.MessageAttributes))
+
+	for name, attribute := range message.MessageAttributes {
+		value := ""
+		if attribute.StringValue != nil {
+			value = *attribute.StringValue
+		} else {
+			value = base64.StdEncoding.EncodeToString(attribute.BinaryValue)
+		}
+
+		messageAttributes[name] = map[string]interface{}{
+			"Type":  attribute.DataType,
+			"Value": value,
+		}
+	}
+
+	var subject interface{}
+	if message.Subject != "" {
+		subject = message.Subject
+	}
+
+	return map[string]interface{}{
+		"Type":              "Notification",
+		"MessageId":         valueOrDefault(message.ID, uuid.New().String()),
+		"TopicArn":          message.TopicArn,
+		"Subject":           subject,
+		"Message":           message.Message,
+		"Timestamp":         message.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"SignatureVersion":  "1",
+		"Signature":         "EXAMPLE",
+		signingCertURLKey:   "EXAMPLE",
+		unsubscribeURLKey:   fmt.Sprintf("http://localhost/?Action=Unsubscribe&SubscriptionArn=%s", subscriptionArn),
+		"MessageAttributes": messageAttributes,
+	}
+}
+
+func newSnsRecord(subscriptionArn string, message snsMessage) map[string]interface{} {
+	return map[string]interface{}{
+		"EventSource":          "aws:sns",
+		"EventVersion":         "1.0",
+		"EventSubscriptionArn": subscriptionArn,
+		"Sns":                  newSnsNotification(subscriptionArn, message, "SigningCertUrl", "UnsubscribeUrl"),
+	}
+}
+
+// newSnsEvent wraps a record in an event. SNS invokes Lambda functions with one
+// record per message.
+func newSnsEvent(record map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"Records": []interface{}{record},
+	}
+}
+
+// s3EventRecord describes a change to an object in a bucket. Size and ETag are
+// only sent for created objects.
+type s3EventRecord struct {
+	Bucket          string
+	ConfigurationID string
+	EventName       string
+	Key             string
+	Size            int64
+	ETag            string
+	Sequencer       string
+	Time            time.Time
+}
+
+// s3BucketArn returns bucket unchanged when it is already an ARN, otherwise the
+// ARN of the bucket with that name.
+func s3BucketArn(bucket string) string {
+	if strings.HasPrefix(bucket, "arn:") {
+		return bucket
+	}
+
+	return "arn:aws:s3:::" + bucket
+}
+
+func newS3Record(record s3EventRecord) map[string]interface{} {
+	bucketName := record.Bucket
+	if index := strings.LastIndex(bucketName, ":"); index >= 0 {
+		bucketName = bucketName[index+1:]
+	}
+
+	// Keys are URL encoded the way S3 encodes them, which leaves slashes as
+	// they are.
+	object := map[string]interface{}{
+		"key":       strings.ReplaceAll(url.QueryEscape(record.Key), "%2F", "/"),
+		"sequencer": valueOrDefault(record.Sequencer, fmt.Sprintf("%016X", record.Time.UnixNano())),
+	}
+
+	if strings.HasPrefix(record.EventName, "ObjectCreated:") {
+		object["size"] = record.Size
+		object["eTag"] = record.ETag
+	}
+
+	return map[string]interface{}{
+		"eventVersion": "2.1",
+		"eventSource":  "aws:s3",
+		"awsRegion":    "eu-west-1",
+		"eventTime":    record.Time.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"eventName":    record.EventName,
+		"userIdentity": map[string]interface{}{
+			"principalId": "EXAMPLE",
+		},
+		"requestParameters": map[string]interface{}{
+			"sourceIPAddress": "127.0.0.1",
+		},
+		"responseElements": map[string]interface{}{
+			"x-amz-request-id": strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", "")[:16]),
+			"x-amz-id-2":       "EXAMPLE",
+		},
+		"s3": map[string]interface{}{
+			"s3SchemaVersion": "1.0",
+			"configurationId": valueOrDefault(record.ConfigurationID, "terrable"),
+			"bucket": map[string]interface{}{
+				"name": bucketName,
+				"ownerIdentity": map[string]interface{}{
+					"principalId": "EXAMPLE",
+				},
+				"arn": s3BucketArn(record.Bucket),
+			},
+			"object": object,
+		},
+	}
+}
+
+// newS3Event wraps a record in an event. S3 invokes Lambda functions with one
+// record per object change.
+func newS3Event(record map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"Records": []interface{}{record},
+	}
+}
+
+func newScheduledEvent(ruleName string) map[string]interface{} {
+	ruleArn := fmt.Sprintf("arn:aws:events:eu-west-1:000000000000:rule/%s", ruleName)
+
+	return newEventBridgeEvent(eventBridgeEntry{
+		Source:     "aws.events",
+		DetailType: "Scheduled Event",
+		Resources:  []string{ruleArn},
+		Time:       time.Now(),
+	})
+}
+
+// eventBridgeEntry is an event as it is put on an event bus. Detail is JSON
+// text and defaults to an empty object.
+type eventBridgeEntry struct {
+	ID         string
+	Source     string
+	DetailType string
+	Detail     string
+	Resources  []string
+	Time       time.Time
+}
+
+func newEventBridgeEvent(entry eventBridgeEntry) map[string]interface{} {
+	var detail interface{} = map[string]interface{}{}
+	if entry.Detail != "" {
+		json.Unmarshal([]byte(entry.Detail), &detail)
+	}
+
+	resources := entry.Resources
+	if resources == nil {
+		resources = []string{}
+	}
+
+	return map[string]interface{}{
+		"version":     "0",
+		"id":          valueOrDefault(entry.ID, uuid.New().String()),
+		"detail-type": entry.DetailType,
+		"source":      entry.Source,
+		"account":     "000000000000",
+		"time":        entry.Time.UTC().Format(time.RFC3339),
+		"region":      "eu-west-1",
+		"resources":   resources,
+		"detail":      detail,
+	}
+}
+
+func valueOrDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
+// printMatches logs which of matches an event was delivered to, naming each of
+// them with name, or none when there were no matches.
+func printMatches[T any](event string, matches []T, name func(T) string, none string) {
+	names := make([]string, len(matches))
+	for i, match := range matches {
+		names[i] = name(match)
+	}
+
+	matched := none
+	if len(names) > 0 {
+		matched = strings.Join(names, ", ")
+	}
+
+	fmt.Printf("%s matched %s\n", event, matched)
+}
@@ -0,0 +1,251 @@
+package offline
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordedInvocations collects the events test handlers are invoked with, by
+// handler name.
+type recordedInvocations[T any] struct {
+	mutex  sync.Mutex
+	events map[string][]T
+}
+
+func newRecordedInvocations[T any]() *recordedInvocations[T] {
+	return &recordedInvocations[T]{events: map[string][]T{}}
+}
+
+func (recorded *recordedInvocations[T]) record(handler *HandlerInstance, event T) {
+	recorded.mutex.Lock()
+	defer recorded.mutex.Unlock()
+
+	recorded.events[handler.handlerConfig.Name] = append(recorded.events[handler.handlerConfig.Name], event)
+}
+
+func (recorded *recordedInvocations[T]) get(name string) []T {
+	recorded.mutex.Lock()
+	defer recorded.mutex.Unlock()
+
+	return recorded.events[name]
+}
+
+func TestGenerateHttpEventMatchesOfflineRequests(t *testing.T) {
+	request := httptest.NewRequest("POST", "/users/42?expand=orders", strings.NewReader(`{"name":"terrable"}`))
+	request.Header = map[string][]string{"Content-Type": {"application/json"}}
+
+	offlineEvent, _ := json.Marshal(newHttpEvent(newHttpEventRequest(request, []byte(`{"name":"terrable"}`), map[string]string{"id": "42"})))
+
+	generatedEvent, err := GenerateEvent("http", EventInput{
+		Method:          "post",
+		Path:            "/users/42",
+		Headers:         map[string]string{"Content-Type": "application/json"},
+		QueryParameters: map[string]string{"expand": "orders"},
+		PathParameters:  map[string]string{"id": "42"},
+		Body:            `{"name":"terrable"}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var expected, actual map[string]interface{}
+	json.Unmarshal(offlineEvent, &expected)
+	json.Unmarshal(generatedEvent, &actual)
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected the generated event to match offline mode\nexpected: %v\nactual:   %v", expected, actual)
+	}
+}
+
+func TestGenerateHttpV2Event(t *testing.T) {
+	generatedEvent, err := GenerateEvent("http-v2", EventInput{
+		Path:            "/items",
+		Headers:         map[string]string{"User-Agent": "curl", "Cookie": "a=1; b=2"},
+		QueryParameters: map[string]string{"z": "1", "a": "x y"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var event struct {
+		Version        string            `json:"version"`
+		RawPath        string            `json:"rawPath"`
+		RawQueryString string            `json:"rawQueryString"`
+		Cookies        []string          `json:"cookies"`
+		Headers        map[string]string `json:"headers"`
+		RequestContext struct {
+			DomainName string `json:"domainName"`
+			HTTP       struct {
+				Method    string `json:"method"`
+				UserAgent string `json:"userAgent"`
+			} `json:"http"`
+		} `json:"requestContext"`
+	}
+
+	if err := json.Unmarshal(generatedEvent, &event); err != nil {
+		t.Fatalf("failed to parse event: %v", err)
+	}
+
+	if event.Version != "2.0" || event.RawPath != "/items" || event.RawQueryString != "a=x+y&z=1" {
+		t.Errorf("unexpected event: %s", generatedEvent)
+	}
+
+	if !reflect.DeepEqual(event.Cookies, []string{"a=1", "b=2"}) || event.Headers["user-agent"] != "curl" {
+		t.Errorf("expected cookies to be split out and headers to be lower cased: %s", generatedEvent)
+	}
+
+	if event.RequestContext.DomainName != "localhost" || event.RequestContext.HTTP.Method != "GET" || event.RequestContext.HTTP.UserAgent != "curl" {
+		t.Errorf("unexpected request context: %s", generatedEvent)
+	}
+}
+
+func TestGenerateFunctionURLEvent(t *testing.T) {
+	generatedEvent, err := GenerateEvent("function-url", EventInput{Method: "POST", Path: "/orders", Body: `{"id":1}`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var event struct {
+		Version        string `json:"version"`
+		RawPath        string `json:"rawPath"`
+		Body           string `json:"body"`
+		RequestContext struct {
+			APIID        string `json:"apiId"`
+			DomainName   string `json:"domainName"`
+			DomainPrefix string `json:"domainPrefix"`
+			HTTP         struct {
+				Method string `json:"method"`
+			} `json:"http"`
+		} `json:"requestContext"`
+	}
+
+	if err := json.Unmarshal(generatedEvent, &event); err != nil {
+		t.Fatalf("failed to parse event: %v", err)
+	}
+
+	if event.Version != "2.0" || event.RawPath != "/orders" || event.Body != `{"id":1}` || event.RequestContext.HTTP.Method != "POST" {
+		t.Errorf("unexpected event: %s", generatedEvent)
+	}
+
+	if event.RequestContext.DomainName != "localhost" || event.RequestContext.APIID != event.RequestContext.DomainPrefix {
+		t.Errorf("expected the API ID to be the URL ID: %s", generatedEvent)
+	}
+}
+
+func TestGenerateSqsEventBatches(t *testing.T) {
+	generatedEvent, err := GenerateEvent("sqs", EventInput{QueueName: "orders", MessageBodies: []string{"one", "two"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var event struct {
+		Records []struct {
+			Body           string `json:"body"`
+			EventSourceARN string `json:"eventSourceARN"`
+		} `json:"Records"`
+	}
+
+	if err := json.Unmarshal(generatedEvent, &event); err != nil {
+		t.Fatalf("failed to parse event: %v", err)
+	}
+
+	if len(event.Records) != 2 || event.Records[0].Body != "one" || event.Records[1].Body != "two" {
+		t.Fatalf("expected one record per message, got %s", generatedEvent)
+	}
+
+	if event.Records[0].EventSourceARN != "arn:aws:sqs:eu-west-1:000000000000:orders" {
+		t.Errorf("expected the queue name in the event source ARN, got %s", event.Records[0].EventSourceARN)
+	}
+}
+
+func TestGenerateSnsEvent(t *testing.T) {
+	generatedEvent, err := GenerateEvent("sns", EventInput{TopicName: "orders", Body: "order placed"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var event struct {
+		Records []struct {
+			EventSource string `json:"EventSource"`
+			Sns         struct {
+				TopicArn string `json:"TopicArn"`
+				Message  string `json:"Message"`
+			} `json:"Sns"`
+		} `json:"Records"`
+	}
+
+	if err := json.Unmarshal(generatedEvent, &event); err != nil {
+		t.Fatalf("failed to parse event: %v", err)
+	}
+
+	if len(event.Records) != 1 || event.Records[0].EventSource != "aws:sns" || event.Records[0].Sns.Message != "order placed" {
+		t.Fatalf("expected one SNS record with the message, got %s", generatedEvent)
+	}
+
+	if event.Records[0].Sns.TopicArn != "arn:aws:sns:eu-west-1:000000000000:orders" {
+		t.Errorf("expected the topic name in the topic ARN, got %s", event.Records[0].Sns.TopicArn)
+	}
+}
+
+func TestGenerateS3Event(t *testing.T) {
+	generatedEvent, err := GenerateEvent("s3", EventInput{BucketName: "uploads", ObjectKey: "photos/my cat.jpg", Body: "hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var event struct {
+		Records []struct {
+			EventSource string `json:"eventSource"`
+			EventName   string `json:"eventName"`
+			S3          struct {
+				Bucket struct {
+					Name string `json:"name"`
+					Arn  string `json:"arn"`
+				} `json:"bucket"`
+				Object struct {
+					Key  string `json:"key"`
+					Size int    `json:"size"`
+					ETag string `json:"eTag"`
+				} `json:"object"`
+			} `json:"s3"`
+		} `json:"Records"`
+	}
+
+	if err := json.Unmarshal(generatedEvent, &event); err != nil {
+		t.Fatalf("failed to parse event: %v", err)
+	}
+
+	if len(event.Records) != 1 || event.Records[0].EventSource != "aws:s3" || event.Records[0].EventName != "ObjectCreated:Put" {
+		t.Fatalf("expected one S3 record for a created object, got %s", generatedEvent)
+	}
+
+	s3 := event.Records[0].S3
+	if s3.Bucket.Name != "uploads" || s3.Bucket.Arn != "arn:aws:s3:::uploads" {
+		t.Errorf("unexpected bucket %+v", s3.Bucket)
+	}
+
+	if s3.Object.Key != "photos/my+cat.jpg" || s3.Object.Size != 5 || s3.Object.ETag != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("unexpected object %+v", s3.Object)
+	}
+}
+
+func TestGenerateScheduleEvent(t *testing.T) {
+	generatedEvent, err := GenerateEvent("schedule", EventInput{RuleName: "nightly"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(string(generatedEvent), `"arn:aws:events:eu-west-1:000000000000:rule/nightly"`) {
+		t.Errorf("expected the rule ARN in the resources, got %s", generatedEvent)
+	}
+}
+
+func TestGenerateEventRejectsUnknownSources(t *testing.T) {
+	if _, err := GenerateEvent("kinesis", EventInput{}); err == nil {
+		t.Error("expected an unknown event source to be rejected")
+	}
+}
@@ -0,0 +1,302 @@
+package offline
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/terrable-dev/terrable/config"
+)
+
+// functionURL serves a handler the way a Lambda function URL does. Every
+// request below the URL invokes the handler with a 2.0 payload event whose
+// path is relative to the URL.
+type functionURL struct {
+	handler *HandlerInstance
+	config  config.FunctionURLConfig
+}
+
+// registerFunctionURLRoutes serves the function URLs that have a path rather
+// than a port of their own.
+func registerFunctionURLRoutes(r *mux.Router, handlerInstances []*HandlerInstance) {
+	for _, handlerInstance := range handlerInstances {
+		urlConfig := handlerInstance.handlerConfig.FunctionURL
+		if urlConfig == nil || urlConfig.Path == "" {
+			continue
+		}
+
+		url := functionURL{handler: handlerInstance, config: *urlConfig}
+
+		r.Path(urlConfig.Path).Handler(url)
+		r.PathPrefix(urlConfig.Path + "/").Handler(url)
+	}
+}
+
+func (url functionURL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := url.handler.handlerConfig.Name
+	cors := url.config.Cors
+
+	// Lambda answers preflight requests itself when the URL has CORS
+	// configured, without authorising them or invoking the function.
+	if cors != nil && r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		writeFunctionURLPreflight(w, r, cors)
+		return
+	}
+
+	var authorizer map[string]interface{}
+	if url.config.AuthType == "AWS_IAM" {
+		var ok bool
+		if authorizer, ok = functionURLIAMAuthorizer(r); !ok {
+			fmt.Printf("%s %s (%s function URL) rejected an unsigned request\n\n", r.Method, r.URL.Path, name)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"Message":"Forbidden"}`))
+			return
+		}
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	request := newHttpEventRequest(r, body, nil)
+	request.Path = url.relativePath(r.URL.Path)
+
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	eventJSON, _ := json.Marshal(newFunctionURLEvent(request, host, authorizer))
+
+	fmt.Printf("%s %s (%s function URL) \n", r.Method, r.URL.Path, name)
+	start := time.Now()
+
+	result, err := url.handler.Execute(generateRuntimeCode(url.handler, string(eventJSON)))
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeFunctionURLResponse(w, r, result, cors)
+	fmt.Printf("Completed in %dms\n\n", time.Since(start).Milliseconds())
+}
+
+// relativePath is the path of a request as the function sees it, relative to
+// the root of the function URL.
+func (url functionURL) relativePath(path string) string {
+	relativePath := strings.TrimPrefix(path, url.config.Path)
+	if relativePath == "" {
+		return "/"
+	}
+
+	return relativePath
+}
+
+// functionURLIAMAuthorizer reads the access key from a request signed with
+// Signature Version 4. Signatures are not verified, as there are no local
+// credentials to verify them against.
+func functionURLIAMAuthorizer(r *http.Request) (map[string]interface{}, bool) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 ") {
+		return nil, false
+	}
+
+	var accessKey string
+	for _, part := range strings.Split(strings.TrimPrefix(authorization, "AWS4-HMAC-SHA256 "), ",") {
+		if credential, ok := strings.CutPrefix(strings.TrimSpace(part), "Credential="); ok {
+			accessKey = strings.SplitN(credential, "/", 2)[0]
+		}
+	}
+
+	if accessKey == "" {
+		return nil, false
+	}
+
+	return map[string]interface{}{
+		"iam": map[string]interface{}{
+			"accessKey":       accessKey,
+			"accountId":       "000000000000",
+			"callerId":        accessKey,
+			"cognitoIdentity": nil,
+			"principalOrgId":  nil,
+			"userArn":         "arn:aws:iam::000000000000:user/local",
+			"userId":          accessKey,
+		},
+	}, true
+}
+
+func writeFunctionURLPreflight(w http.ResponseWriter, r *http.Request, cors *config.CorsConfig) {
+	applyCORSResponseHeaders(w, r, cors)
+
+	if len(cors.AllowMethods) > 0 {
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(uniqueSortedUppercase(cors.AllowMethods), ", "))
+	}
+
+	if len(cors.AllowHeaders) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(cors.AllowHeaders, ", "))
+	}
+
+	if cors.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cors.MaxAge))
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// functionURLResponse is the part of a function's result that a function URL
+// turns into an HTTP response.
+type functionURLResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	Cookies         []string          `json:"cookies"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+// writeFunctionURLResponse responds with what the handler returned. The CORS
+// configuration of the URL takes precedence over CORS headers the handler set.
+func writeFunctionURLResponse(w http.ResponseWriter, r *http.Request, result *handlerResult, cors *config.CorsConfig) {
+	response := newFunctionURLResponse(result)
+
+	for key, value := range response.Headers {
+		w.Header().Set(key, value)
+	}
+
+	for _, cookie := range response.Cookies {
+		w.Header().Add("Set-Cookie", cookie)
+	}
+
+	if cors != nil {
+		applyCORSResponseHeaders(w, r, cors)
+	}
+
+	body := []byte(response.Body)
+	if response.IsBase64Encoded {
+		if decoded, err := base64.StdEncoding.DecodeString(response.Body); err == nil {
+			body = decoded
+		}
+	}
+
+	w.WriteHeader(response.StatusCode)
+	w.Write(body)
+}
+
+// newFunctionURLResponse reads the response from a handler's result. As in
+// Lambda, a result with a statusCode is a response, and any other value is
+// sent as a JSON body with status 200.
+func newFunctionURLResponse(result *handlerResult) functionURLResponse {
+	// Handlers that threw or timed out have no payload.
+	if len(result.Payload) == 0 {
+		return functionURLResponse{StatusCode: result.StatusCode, Headers: result.Headers, Body: result.Body}
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(result.Payload, &fields) == nil && fields["statusCode"] != nil {
+		var response functionURLResponse
+		json.Unmarshal(result.Payload, &response)
+
+		if response.StatusCode < 100 || response.StatusCode > 599 {
+			return functionURLResponse{StatusCode: http.StatusBadGateway}
+		}
+
+		return response
+	}
+
+	return functionURLResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(result.Payload),
+	}
+}
+
+// functionURLServer serves a function URL on a port of its own.
+type functionURLServer struct {
+	server *http.Server
+	url    atomic.Pointer[functionURL]
+}
+
+func startFunctionURLServer(port int, url functionURL) (*functionURLServer, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("could not serve the function URL of %s on port %d: %w", url.handler.handlerConfig.Name, port, err)
+	}
+
+	urlServer := &functionURLServer{}
+	urlServer.url.Store(&url)
+	urlServer.server = &http.Server{Handler: urlServer}
+
+	go urlServer.server.Serve(listener)
+
+	return urlServer, nil
+}
+
+func (urlServer *functionURLServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	urlServer.url.Load().ServeHTTP(w, r)
+}
+
+// Close stops listening and closes every connection.
+func (urlServer *functionURLServer) Close() {
+	urlServer.server.Close()
+}
+
+// syncFunctionURLServers listens on the port of every function URL that has
+// one. Listeners are kept across reloads while their port is still in use,
+// and pointed at the handler's current configuration.
+func syncFunctionURLServers(servers map[int]*functionURLServer, handlers map[string]*HandlerInstance) {
+	urls := make(map[int]functionURL)
+
+	names := make([]string, 0, len(handlers))
+	for name := range handlers {
+		names = append(names, name)
+	}
+
+	// Ports are checked when the configuration is validated, but if two
+	// handlers still share one the first by name keeps it.
+	sort.Strings(names)
+
+	for _, name := range names {
+		urlConfig := handlers[name].handlerConfig.FunctionURL
+		if urlConfig == nil || urlConfig.Port == 0 {
+			continue
+		}
+
+		if _, ok := urls[urlConfig.Port]; !ok {
+			urls[urlConfig.Port] = functionURL{handler: handlers[name], config: *urlConfig}
+		}
+	}
+
+	for port, urlServer := range servers {
+		if url, ok := urls[port]; ok {
+			urlServer.url.Store(&url)
+			continue
+		}
+
+		urlServer.Close()
+		delete(servers, port)
+	}
+
+	for port, url := range urls {
+		if _, ok := servers[port]; ok {
+			continue
+		}
+
+		urlServer, err := startFunctionURLServer(port, url)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		servers[port] = urlServer
+	}
+}
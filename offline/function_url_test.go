@@ -0,0 +1,207 @@
+package offline
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestFunctionURLRelativePath(t *testing.T) {
+	url := functionURL{config: config.FunctionURLConfig{Path: "/_url/Webhook"}}
+
+	tests := map[string]string{
+		"/_url/Webhook":               "/",
+		"/_url/Webhook/":              "/",
+		"/_url/Webhook/orders/42":     "/orders/42",
+		"/_url/Webhook/orders/42/":    "/orders/42/",
+		"/other-path-served-directly": "/other-path-served-directly",
+	}
+
+	for path, expected := range tests {
+		if relativePath := url.relativePath(path); relativePath != expected {
+			t.Errorf("expected %s to be %s relative to the URL, got %s", path, expected, relativePath)
+		}
+	}
+}
+
+func TestFunctionURLRejectsUnsignedRequestsWithIAMAuth(t *testing.T) {
+	url := functionURL{
+		handler: &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "Webhook"}},
+		config:  config.FunctionURLConfig{Path: "/_url/Webhook", AuthType: "AWS_IAM"},
+	}
+
+	recorder := httptest.NewRecorder()
+	url.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/_url/Webhook", nil))
+
+	if recorder.Code != http.StatusForbidden || recorder.Body.String() != `{"Message":"Forbidden"}` {
+		t.Errorf("expected an unsigned request to be forbidden, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestFunctionURLIAMAuthorizer(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=AKIALOCAL/20240101/eu-west-1/lambda/aws4_request, SignedHeaders=host;x-amz-date, Signature=abc")
+
+	authorizer, ok := functionURLIAMAuthorizer(request)
+	if !ok {
+		t.Fatal("expected a signed request to be authorised")
+	}
+
+	if iam := authorizer["iam"].(map[string]interface{}); iam["accessKey"] != "AKIALOCAL" {
+		t.Errorf("expected the access key of the signature, got %v", iam["accessKey"])
+	}
+
+	request.Header.Set("Authorization", "Bearer token")
+	if _, ok := functionURLIAMAuthorizer(request); ok {
+		t.Error("expected a request without a Signature Version 4 signature to be rejected")
+	}
+}
+
+func TestFunctionURLPreflightUsesItsOwnCORS(t *testing.T) {
+	url := functionURL{
+		handler: &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "Webhook"}},
+		config: config.FunctionURLConfig{
+			Path:     "/_url/Webhook",
+			AuthType: "AWS_IAM",
+			Cors: &config.CorsConfig{
+				AllowOrigins: []string{"https://example.com"},
+				AllowMethods: []string{"post", "GET"},
+				AllowHeaders: []string{"content-type"},
+				MaxAge:       300,
+			},
+		},
+	}
+
+	request := httptest.NewRequest(http.MethodOptions, "/_url/Webhook", nil)
+	request.Header.Set("Origin", "https://example.com")
+	request.Header.Set("Access-Control-Request-Method", "POST")
+
+	recorder := httptest.NewRecorder()
+	url.ServeHTTP(recorder, request)
+
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":  "https://example.com",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "content-type",
+		"Access-Control-Max-Age":       "300",
+	}
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected the preflight to be answered without authorisation, got %d", recorder.Code)
+	}
+
+	for header, value := range expected {
+		if recorder.Header().Get(header) != value {
+			t.Errorf("expected %s to be %q, got %q", header, value, recorder.Header().Get(header))
+		}
+	}
+}
+
+func TestNewFunctionURLResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   *handlerResult
+		expected functionURLResponse
+	}{
+		{
+			name:     "HTTP response",
+			result:   newHandlerResult(json.RawMessage(`{"statusCode":201,"body":"created","cookies":["a=1"]}`)),
+			expected: functionURLResponse{StatusCode: http.StatusCreated, Body: "created", Cookies: []string{"a=1"}},
+		},
+		{
+			name:     "response with other fields",
+			result:   newHandlerResult(json.RawMessage(`{"statusCode":200,"body":"x","extra":1}`)),
+			expected: functionURLResponse{StatusCode: http.StatusOK, Body: "x"},
+		},
+		{
+			name:     "result without a statusCode",
+			result:   newHandlerResult(json.RawMessage(`{"body":"x"}`)),
+			expected: functionURLResponse{StatusCode: http.StatusOK, Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"body":"x"}`},
+		},
+		{
+			name:     "string result",
+			result:   newHandlerResult(json.RawMessage(`"hello"`)),
+			expected: functionURLResponse{StatusCode: http.StatusOK, Headers: map[string]string{"Content-Type": "application/json"}, Body: `"hello"`},
+		},
+		{
+			name:     "invalid statusCode",
+			result:   newHandlerResult(json.RawMessage(`{"statusCode":null}`)),
+			expected: functionURLResponse{StatusCode: http.StatusBadGateway},
+		},
+		{
+			name:     "timeout",
+			result:   newTimeoutResult(),
+			expected: functionURLResponse{StatusCode: http.StatusGatewayTimeout},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := newFunctionURLResponse(test.result)
+
+			actual, _ := json.Marshal(response)
+			expected, _ := json.Marshal(test.expected)
+
+			if string(actual) != string(expected) {
+				t.Errorf("expected %s, got %s", expected, actual)
+			}
+		})
+	}
+}
+
+func TestSyncFunctionURLServers(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	servers := make(map[int]*functionURLServer)
+	t.Cleanup(func() {
+		for _, urlServer := range servers {
+			urlServer.Close()
+		}
+	})
+
+	handler := func(name string, authType string) *HandlerInstance {
+		return &HandlerInstance{handlerConfig: config.HandlerMapping{Name: name, FunctionURL: &config.FunctionURLConfig{Port: port, AuthType: authType}}}
+	}
+
+	syncFunctionURLServers(servers, map[string]*HandlerInstance{"Webhook": handler("Webhook", "AWS_IAM")})
+
+	first := servers[port]
+	if first == nil {
+		t.Fatalf("expected a server on port %d, got %v", port, servers)
+	}
+
+	response, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+	if err != nil {
+		t.Fatalf("expected the port to be served: %v", err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("expected the function URL to require a signature, got %d", response.StatusCode)
+	}
+
+	rebuilt := handler("Webhook", "NONE")
+	syncFunctionURLServers(servers, map[string]*HandlerInstance{"Webhook": rebuilt})
+
+	if servers[port] != first || first.url.Load().handler != rebuilt {
+		t.Error("expected the server to be kept and to serve the rebuilt handler")
+	}
+
+	syncFunctionURLServers(servers, map[string]*HandlerInstance{})
+
+	if len(servers) != 0 {
+		t.Errorf("expected servers without a function URL to be closed, got %v", servers)
+	}
+}
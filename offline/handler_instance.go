@@ -4,14 +4,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/evanw/esbuild/pkg/api"
 	"github.com/fatih/color"
-	"github.com/fsnotify/fsnotify"
 	"github.com/terrable-dev/terrable/config"
 )
 
@@ -20,11 +22,35 @@ type HandlerInstance struct {
 	handlerTranspiledPath string
 	inputFilePaths        []string
 	readCodeMutex         sync.RWMutex
-	recompileSyncLock     *sync.Once
 	envVars               map[string]string
+	debugPort             int
+	process               handlerRuntime
+	processBuildVersion   int
+	lifecycleMutex        sync.Mutex
+	closed                bool
+	buildContext          api.BuildContext
+	buildMutex            sync.Mutex
+	lastMetafile          string
+	lastBuildDuration     time.Duration
+	buildVersion          int
+	esModule              bool
+	// activeInvocations counts the invocations in progress, so that a
+	// replaced handler is only shut down once they have finished.
+	activeInvocations atomic.Int32
 }
 
+// retiredHandlerGracePeriod is how much longer than its timeout a replaced
+// handler is given to finish its in-flight invocations.
+const retiredHandlerGracePeriod = time.Second
+
+// idleHandlerPollInterval is how often a handler that is waiting to be closed
+// is checked for in-flight invocations.
+const idleHandlerPollInterval = 10 * time.Millisecond
+
 func (handlerInstance *HandlerInstance) GetExecutionPath() string {
+	handlerInstance.readCodeMutex.RLock()
+	defer handlerInstance.readCodeMutex.RUnlock()
+
 	return handlerInstance.handlerTranspiledPath
 }
 
@@ -49,38 +75,274 @@ func (handlerInstance *HandlerInstance) SetInputFiles(paths []string) {
 	handlerInstance.inputFilePaths = append([]string(nil), paths...)
 }
 
+// Execute runs code in the handler's own runtime process, starting it on first
+// use and restarting it if it has exited since the previous invocation.
+func (handlerInstance *HandlerInstance) Execute(code string) (*handlerResult, error) {
+	return handlerInstance.ExecuteWithLogs(code, nil)
+}
+
+// ExecuteWithLogs is Execute that also writes what the handler logs during the
+// invocation to logs.
+func (handlerInstance *HandlerInstance) ExecuteWithLogs(code string, logs io.Writer) (*handlerResult, error) {
+	handlerInstance.activeInvocations.Add(1)
+	defer handlerInstance.activeInvocations.Add(-1)
+
+	process, err := handlerInstance.getProcess()
+	if err != nil {
+		return nil, err
+	}
+
+	return process.Execute(code, logs)
+}
+
+func (handlerInstance *HandlerInstance) getProcess() (handlerRuntime, error) {
+	handlerInstance.lifecycleMutex.Lock()
+	defer handlerInstance.lifecycleMutex.Unlock()
+
+	if handlerInstance.closed {
+		return nil, fmt.Errorf("handler %q has been shut down", handlerInstance.handlerConfig.Name)
+	}
+
+	kind := handlerRuntimeKind(handlerInstance.handlerConfig)
+	buildVersion := handlerInstance.GetBuildVersion()
+
+	// Node.js and Python load the latest build on every invocation, but a
+	// bootstrap is the build, so it is restarted whenever it changes.
+	stale := kind == providedRuntimeKind && handlerInstance.processBuildVersion != buildVersion
+
+	if handlerInstance.process != nil && !handlerInstance.process.Exited() && !stale {
+		return handlerInstance.process, nil
+	}
+
+	if handlerInstance.process != nil {
+		handlerInstance.process.Close()
+		handlerInstance.process = nil
+	}
+
+	var process handlerRuntime
+	var err error
+
+	switch kind {
+	case pythonRuntimeKind:
+		process, err = startPythonProcess(handlerInstance.handlerConfig.Name, pythonInterpreter(handlerInstance.handlerConfig))
+	case providedRuntimeKind:
+		process, err = startProvidedRuntime(handlerInstance.handlerConfig.Name, handlerInstance.GetExecutionPath(), handlerEnvironment(handlerInstance))
+	default:
+		process, err = startNodeProcess(handlerInstance.handlerConfig.Name, handlerInstance.debugPort)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	handlerInstance.process = process
+	handlerInstance.processBuildVersion = buildVersion
+	return process, nil
+}
+
+// adoptBuild uses the compiled output of previous, which is replaced by this
+// instance because its routes, triggers, timeout or environment changed.
+// previous is left untouched, so it keeps serving if the replacement is
+// abandoned.
+func (handlerInstance *HandlerInstance) adoptBuild(previous *HandlerInstance) {
+	handlerInstance.SetExecutionPath(previous.GetExecutionPath())
+	handlerInstance.SetInputFiles(previous.GetInputFiles())
+	handlerInstance.setESModule(previous.IsESModule())
+	handlerInstance.buildVersion = previous.GetBuildVersion()
+}
+
+// adoptRuntime takes over the build context and runtime process of previous
+// once this instance has replaced it. Keeping the process alive preserves
+// debugger sessions.
+func (handlerInstance *HandlerInstance) adoptRuntime(previous *HandlerInstance) {
+	previous.buildMutex.Lock()
+	handlerInstance.buildContext = previous.buildContext
+	handlerInstance.lastMetafile = previous.lastMetafile
+	previous.buildContext = nil
+	previous.buildMutex.Unlock()
+
+	previous.lifecycleMutex.Lock()
+	defer previous.lifecycleMutex.Unlock()
+
+	handlerInstance.lifecycleMutex.Lock()
+	defer handlerInstance.lifecycleMutex.Unlock()
+
+	handlerInstance.debugPort = previous.debugPort
+	previous.closed = true
+
+	// A bootstrap reads its environment once when it starts, so it is left for
+	// previous to shut down and started again with the new configuration.
+	if handlerRuntimeKind(handlerInstance.handlerConfig) == providedRuntimeKind {
+		return
+	}
+
+	handlerInstance.process = previous.process
+	handlerInstance.processBuildVersion = previous.processBuildVersion
+	previous.process = nil
+}
+
+// Close disposes of the handler's build context and kills its runtime process,
+// preventing it from being restarted.
+func (handlerInstance *HandlerInstance) Close() {
+	handlerInstance.disposeBuildContext()
+
+	handlerInstance.lifecycleMutex.Lock()
+	defer handlerInstance.lifecycleMutex.Unlock()
+
+	handlerInstance.closed = true
+
+	if handlerInstance.process != nil {
+		handlerInstance.process.Close()
+		handlerInstance.process = nil
+	}
+}
+
+// closeWhenIdle closes the handler once its in-flight invocations have
+// finished. Invocations that are still running after the handler's timeout
+// and a grace period are killed with it.
+func (handlerInstance *HandlerInstance) closeWhenIdle() {
+	handlerInstance.closeWhenIdleBy(time.Now().Add(time.Duration(handlerInstance.handlerConfig.Timeout)*time.Second + retiredHandlerGracePeriod))
+}
+
+// closeWhenIdleBy closes the handler once its in-flight invocations have
+// finished, or at the deadline, killing any that are still running.
+func (handlerInstance *HandlerInstance) closeWhenIdleBy(deadline time.Time) {
+	for handlerInstance.activeInvocations.Load() > 0 && time.Now().Before(deadline) {
+		time.Sleep(idleHandlerPollInterval)
+	}
+
+	handlerInstance.Close()
+}
+
+// CompileHandler builds the handler with a persistent esbuild context, so that
+// every build after the first is an incremental rebuild.
 func (handlerInstance *HandlerInstance) CompileHandler() (inputFilePaths []string, err error) {
+	handlerInstance.buildMutex.Lock()
+	defer handlerInstance.buildMutex.Unlock()
+
 	if err := validateHandlerSourcePath(handlerInstance.handlerConfig); err != nil {
 		return nil, err
 	}
 
+	switch handlerRuntimeKind(handlerInstance.handlerConfig) {
+	case pythonRuntimeKind:
+		return handlerInstance.prepareUnbundledHandler(pythonInputFiles)
+	case providedRuntimeKind:
+		return handlerInstance.prepareUnbundledHandler(bootstrapInputFiles)
+	}
+
 	workingDirectory, err := os.Getwd()
 
 	if err != nil {
 		return nil, fmt.Errorf("error fetching executable location: %w", err)
 	}
 
-	result := api.Build(api.BuildOptions{
-		EntryPoints: []string{handlerInstance.handlerConfig.Source},
-		Bundle:      true,
-		Write:       true,
-		Format:      api.FormatCommonJS,
-		Platform:    api.PlatformNode,
-		Target:      api.ES2015,
-		Sourcemap:   api.SourceMapLinked,
-		Metafile:    true,
-		GlobalName:  "exports",
-		Outdir:      filepath.Join(workingDirectory, ".terrable", handlerInstance.handlerConfig.Name),
-	})
+	start := time.Now()
+
+	if handlerInstance.buildContext == nil {
+		buildOptions, err := handlerBuildOptions(handlerInstance.handlerConfig, filepath.Join(workingDirectory, buildOutputDirectoryName, handlerInstance.handlerConfig.Name))
+		if err != nil {
+			return nil, newHandlerBuildSettingsError(handlerInstance.handlerConfig, err)
+		}
+
+		buildContext, contextErr := api.Context(buildOptions)
+		handlerInstance.setESModule(buildOptions.Format == api.FormatESModule)
+
+		if contextErr != nil {
+			return nil, newHandlerCompileError(handlerInstance.handlerConfig, contextErr.Errors)
+		}
+
+		handlerInstance.buildContext = buildContext
+	}
+
+	result := handlerInstance.buildContext.Rebuild()
 
 	if len(result.Errors) > 0 {
 		return nil, newHandlerCompileError(handlerInstance.handlerConfig, result.Errors)
 	}
 
-	handlerInstance.SetExecutionPath(filepath.ToSlash(compiledHandlerPath(workingDirectory, handlerInstance.handlerConfig)))
-	inputFiles := extractMetafileInputs(result.Metafile)
-	handlerInstance.SetInputFiles(inputFiles)
-	return inputFiles, nil
+	handlerInstance.SetExecutionPath(filepath.ToSlash(compiledHandlerPath(workingDirectory, handlerInstance.handlerConfig, handlerInstance.IsESModule())))
+
+	// The input list only changes when the module graph does, so skip parsing
+	// the metafile again when it is identical to the previous build's.
+	if result.Metafile != handlerInstance.lastMetafile {
+		handlerInstance.SetInputFiles(extractMetafileInputs(result.Metafile))
+		handlerInstance.lastMetafile = result.Metafile
+	}
+
+	handlerInstance.setBuildDuration(time.Since(start))
+
+	return handlerInstance.GetInputFiles(), nil
+}
+
+// prepareUnbundledHandler stands in for a build for Python handlers and
+// bootstraps, which run straight from their source. Each call bumps the build
+// version so that the next invocation picks up the changed files.
+func (handlerInstance *HandlerInstance) prepareUnbundledHandler(inputFiles func(source string) ([]string, error)) ([]string, error) {
+	start := time.Now()
+
+	inputFilePaths, err := inputFiles(handlerInstance.handlerConfig.Source)
+	if err != nil {
+		return nil, newHandlerSourceError(handlerInstance.handlerConfig, err.Error())
+	}
+
+	handlerInstance.SetExecutionPath(handlerInstance.handlerConfig.Source)
+	handlerInstance.SetInputFiles(inputFilePaths)
+	handlerInstance.setBuildDuration(time.Since(start))
+
+	return handlerInstance.GetInputFiles(), nil
+}
+
+// GetBuildDuration reports how long the most recent successful build took.
+func (handlerInstance *HandlerInstance) GetBuildDuration() time.Duration {
+	handlerInstance.readCodeMutex.RLock()
+	defer handlerInstance.readCodeMutex.RUnlock()
+
+	return handlerInstance.lastBuildDuration
+}
+
+// setBuildDuration records a successful build, which also bumps the build
+// version used to bust the ES module cache.
+func (handlerInstance *HandlerInstance) setBuildDuration(duration time.Duration) {
+	handlerInstance.readCodeMutex.Lock()
+	defer handlerInstance.readCodeMutex.Unlock()
+
+	handlerInstance.lastBuildDuration = duration
+	handlerInstance.buildVersion++
+}
+
+// GetBuildVersion counts the successful builds of the handler.
+func (handlerInstance *HandlerInstance) GetBuildVersion() int {
+	handlerInstance.readCodeMutex.RLock()
+	defer handlerInstance.readCodeMutex.RUnlock()
+
+	return handlerInstance.buildVersion
+}
+
+// IsESModule reports whether the handler is bundled as an ES module and so must
+// be loaded with import() rather than require().
+func (handlerInstance *HandlerInstance) IsESModule() bool {
+	handlerInstance.readCodeMutex.RLock()
+	defer handlerInstance.readCodeMutex.RUnlock()
+
+	return handlerInstance.esModule
+}
+
+func (handlerInstance *HandlerInstance) setESModule(esModule bool) {
+	handlerInstance.readCodeMutex.Lock()
+	defer handlerInstance.readCodeMutex.Unlock()
+
+	handlerInstance.esModule = esModule
+}
+
+func (handlerInstance *HandlerInstance) disposeBuildContext() {
+	handlerInstance.buildMutex.Lock()
+	defer handlerInstance.buildMutex.Unlock()
+
+	if handlerInstance.buildContext != nil {
+		handlerInstance.buildContext.Dispose()
+		handlerInstance.buildContext = nil
+	}
 }
 
 func extractMetafileInputs(metafileContents string) []string {
@@ -124,9 +386,15 @@ func validateHandlerSourcePath(handlerConfig config.HandlerMapping) error {
 	return nil
 }
 
-func compiledHandlerPath(workingDirectory string, handlerConfig config.HandlerMapping) string {
-	outputFileName := strings.TrimSuffix(filepath.Base(handlerConfig.Source), filepath.Ext(handlerConfig.Source)) + ".js"
-	return filepath.Join(workingDirectory, ".terrable", handlerConfig.Name, outputFileName)
+func compiledHandlerPath(workingDirectory string, handlerConfig config.HandlerMapping, esModule bool) string {
+	format := api.FormatCommonJS
+	if esModule {
+		format = api.FormatESModule
+	}
+
+	extension := buildOutputExtension(handlerConfig, format)
+	outputFileName := strings.TrimSuffix(filepath.Base(handlerConfig.Source), filepath.Ext(handlerConfig.Source)) + extension
+	return filepath.Join(workingDirectory, buildOutputDirectoryName, handlerConfig.Name, outputFileName)
 }
 
 func newHandlerSourceError(handlerConfig config.HandlerMapping, problem string) error {
@@ -145,6 +413,22 @@ func newHandlerSourceError(handlerConfig config.HandlerMapping, problem string)
 	return errors.New(strings.Join(lines, "\n"))
 }
 
+func newHandlerBuildSettingsError(handlerConfig config.HandlerMapping, err error) error {
+	lines := []string{
+		fmt.Sprintf(`Handler %q could not be compiled.`, handlerConfig.Name),
+		"",
+	}
+
+	lines = append(lines, formatHandlerLocationLines(handlerConfig)...)
+	lines = append(lines,
+		formatHandlerDetailLine("Problem", err.Error(), false),
+		"",
+		`Check the "build" settings and try again.`,
+	)
+
+	return errors.New(strings.Join(lines, "\n"))
+}
+
 func newHandlerCompileError(handlerConfig config.HandlerMapping, result []api.Message) error {
 	lines := []string{
 		fmt.Sprintf(`Handler %q could not be compiled.`, handlerConfig.Name),
@@ -226,32 +510,3 @@ func formatBuildErrorLines(result []api.Message) []string {
 
 	return lines
 }
-
-func (handlerInstance *HandlerInstance) WatchForChanges(inputFiles []string) {
-	handlerInstance.recompileSyncLock = new(sync.Once)
-	var wg sync.WaitGroup
-	defer wg.Done()
-
-	watcher, _ := fsnotify.NewWatcher()
-	defer watcher.Close()
-
-	for _, file := range inputFiles {
-		watcher.Add(file)
-	}
-
-	go func() {
-		for event := range watcher.Events {
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				handlerInstance.recompileSyncLock.Do(func() {
-					if _, err := handlerInstance.CompileHandler(); err != nil {
-						fmt.Println(err)
-					}
-					handlerInstance.recompileSyncLock = new(sync.Once)
-				})
-			}
-		}
-	}()
-
-	wg.Add(1)
-	wg.Wait()
-}
@@ -80,3 +80,111 @@ func TestCompileHandlerReturnsHelpfulErrorForMalformedSourceFile(t *testing.T) {
 		}
 	}
 }
+
+func TestCompileHandlerRebuildsIncrementallyWithPersistentContext(t *testing.T) {
+	chdirForTest(t, t.TempDir())
+
+	sourceDir := t.TempDir()
+	sourcePath := writeHandlerSource(t, sourceDir, "handler.ts", `export const handler = async () => "first";`)
+
+	handler := &HandlerInstance{
+		handlerConfig: config.HandlerMapping{
+			Name:   "IncrementalHandler",
+			Source: sourcePath,
+		},
+	}
+	defer handler.Close()
+
+	if _, err := handler.CompileHandler(); err != nil {
+		t.Fatalf("expected first build to succeed, got %v", err)
+	}
+
+	buildContext := handler.buildContext
+	if buildContext == nil {
+		t.Fatal("expected the first build to create a build context")
+	}
+
+	writeHandlerSource(t, sourceDir, "handler.ts", `export const handler = async () => "second";`)
+
+	inputFiles, err := handler.CompileHandler()
+	if err != nil {
+		t.Fatalf("expected rebuild to succeed, got %v", err)
+	}
+
+	if handler.buildContext != buildContext {
+		t.Fatal("expected the rebuild to reuse the existing build context")
+	}
+
+	if len(inputFiles) != 1 {
+		t.Fatalf("expected one input file, got %v", inputFiles)
+	}
+
+	compiled, err := os.ReadFile(handler.GetExecutionPath())
+	if err != nil {
+		t.Fatalf("failed to read compiled handler: %v", err)
+	}
+
+	if !strings.Contains(string(compiled), "second") {
+		t.Fatalf("expected compiled output to contain the updated source, got %s", compiled)
+	}
+
+	handler.Close()
+
+	if handler.buildContext != nil {
+		t.Fatal("expected Close to dispose of the build context")
+	}
+}
+
+func TestGenerateHandlerLoaderCode(t *testing.T) {
+	commonJSHandler := &HandlerInstance{handlerTranspiledPath: "/out/handler.js"}
+
+	if code := generateHandlerLoaderCode(commonJSHandler); !strings.Contains(code, `require("/out/handler.js")`) {
+		t.Errorf("expected CommonJS handlers to be required, got %s", code)
+	}
+
+	esModuleHandler := &HandlerInstance{handlerTranspiledPath: "/out/handler.mjs", esModule: true, buildVersion: 3}
+
+	if code := generateHandlerLoaderCode(esModuleHandler); code != `importModule("/out/handler.mjs", 3)` {
+		t.Errorf("expected ES module handlers to be imported with their build version, got %s", code)
+	}
+}
+
+func TestExecuteWithLogsCapturesTheInvocationLogs(t *testing.T) {
+	chdirForTest(t, t.TempDir())
+
+	sourcePath := writeHandlerSource(t, t.TempDir(), "handler.ts", `export const handler = async (event) => { console.log("hello " + event.name); return { ok: true }; };`)
+
+	handler := &HandlerInstance{
+		handlerConfig: config.HandlerMapping{
+			Name:    "LoggingHandler",
+			Source:  sourcePath,
+			Timeout: 5,
+		},
+	}
+	defer handler.Close()
+
+	if _, err := handler.CompileHandler(); err != nil {
+		t.Fatalf("expected build to succeed, got %v", err)
+	}
+
+	var logs strings.Builder
+	result, err := handler.ExecuteWithLogs(generateRuntimeCode(handler, `{"name":"terrable"}`), &logs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The first invocation starts the runtime, so its startup output is
+	// captured too, as a cold start's is in Lambda.
+	if result.StatusCode != 200 || !strings.HasSuffix(logs.String(), "hello terrable\n") {
+		t.Errorf("expected the handler's log line, got %q (%+v)", logs.String(), result)
+	}
+
+	logs.Reset()
+	if _, err := handler.Execute(generateRuntimeCode(handler, `{"name":"again"}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if logs.Len() != 0 {
+		t.Errorf("expected later invocations not to be captured, got %q", logs.String())
+	}
+}
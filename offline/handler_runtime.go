@@ -0,0 +1,75 @@
+package offline
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+// handlerRuntime runs invocations of a single handler. The code passed to
+// Execute is whatever generateRuntimeCode produced for the runtime's kind, and
+// anything the handler logs during the invocation is also written to logs when
+// it is not nil.
+type handlerRuntime interface {
+	Execute(code string, logs io.Writer) (*handlerResult, error)
+	Exited() bool
+	Close()
+}
+
+type runtimeKind int
+
+const (
+	nodeRuntimeKind runtimeKind = iota
+	pythonRuntimeKind
+	// providedRuntimeKind handlers are bootstrap executables, such as Go or Rust
+	// binaries, which talk to terrable through the Lambda Runtime API.
+	providedRuntimeKind
+)
+
+// handlerRuntimeKind decides which runtime a handler runs in. An explicit
+// runtime wins, otherwise the source file decides.
+func handlerRuntimeKind(handlerConfig config.HandlerMapping) runtimeKind {
+	switch {
+	case strings.HasPrefix(handlerConfig.Runtime, "python"):
+		return pythonRuntimeKind
+	case strings.HasPrefix(handlerConfig.Runtime, "provided"):
+		return providedRuntimeKind
+	case handlerConfig.Runtime != "":
+		return nodeRuntimeKind
+	}
+
+	if strings.EqualFold(filepath.Ext(handlerConfig.Source), ".py") {
+		return pythonRuntimeKind
+	}
+
+	if filepath.Base(handlerConfig.Source) == "bootstrap" {
+		return providedRuntimeKind
+	}
+
+	return nodeRuntimeKind
+}
+
+// isBundledHandler reports whether a handler is bundled with esbuild before it
+// runs, which only Node.js handlers are.
+func isBundledHandler(handlerConfig config.HandlerMapping) bool {
+	return handlerRuntimeKind(handlerConfig) == nodeRuntimeKind
+}
+
+// validateRuntime accepts the Lambda runtime identifiers terrable can emulate,
+// such as "nodejs20.x", "python3.12" or "provided.al2023".
+func validateRuntime(runtime string) error {
+	if runtime == "" {
+		return nil
+	}
+
+	for _, prefix := range []string{"nodejs", "python3", "provided"} {
+		if strings.HasPrefix(runtime, prefix) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf(`unsupported runtime %q: expected a "nodejs", "python3" or "provided" runtime`, runtime)
+}
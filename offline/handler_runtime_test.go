@@ -0,0 +1,44 @@
+package offline
+
+import (
+	"testing"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestHandlerRuntimeKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  config.HandlerMapping
+		expected runtimeKind
+	}{
+		{name: "ts source", handler: config.HandlerMapping{Source: "/src/handler.ts"}, expected: nodeRuntimeKind},
+		{name: "py source", handler: config.HandlerMapping{Source: "/src/handler.py"}, expected: pythonRuntimeKind},
+		{name: "bootstrap source", handler: config.HandlerMapping{Source: "/build/bootstrap"}, expected: providedRuntimeKind},
+		{name: "python runtime", handler: config.HandlerMapping{Source: "/src/handler", Runtime: "python3.12"}, expected: pythonRuntimeKind},
+		{name: "provided runtime", handler: config.HandlerMapping{Source: "/build/handler", Runtime: "provided.al2023"}, expected: providedRuntimeKind},
+		{name: "node runtime wins over extension", handler: config.HandlerMapping{Source: "/src/handler.py", Runtime: "nodejs20.x"}, expected: nodeRuntimeKind},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := handlerRuntimeKind(tt.handler); actual != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateRuntime(t *testing.T) {
+	for _, runtime := range []string{"", "nodejs20.x", "python3.12", "provided", "provided.al2023"} {
+		if err := validateRuntime(runtime); err != nil {
+			t.Errorf("expected %q to be accepted, got %v", runtime, err)
+		}
+	}
+
+	for _, runtime := range []string{"ruby3.3", "java21", "python2.7"} {
+		if err := validateRuntime(runtime); err == nil {
+			t.Errorf("expected %q to be rejected", runtime)
+		}
+	}
+}
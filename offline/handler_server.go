@@ -1,60 +1,36 @@
 package offline
 
 import (
-	"bufio"
-	"crypto/md5"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/fatih/color"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
-var handlerExecutionMutex sync.Mutex
-
 type HandlerOutput struct {
 	handlerResult *handlerResult
 	err           error
 }
 
-func RegisterHandler(handlerInstance *HandlerInstance, r *mux.Router, np *NodeProcess) error {
+func RegisterHandler(handlerInstance *HandlerInstance, r *mux.Router) error {
 	if handlerInstance.GetExecutionPath() == "" {
 		return fmt.Errorf("handler %q has not been prepared for execution", handlerInstance.handlerConfig.Name)
 	}
 
-	inputFiles := handlerInstance.GetInputFiles()
-	if len(inputFiles) > 0 {
-		go handlerInstance.WatchForChanges(inputFiles)
-	}
-
 	handleRequestFunc := func(w http.ResponseWriter, r *http.Request, code string) {
-		handlerExecutionMutex.Lock()
-		defer handlerExecutionMutex.Unlock()
-
-		np.Execute(code)
-
-		outputChannel := make(chan HandlerOutput, 1)
-		errorChannel := make(chan error, 1)
-
 		fmt.Printf("%s %s (%s) \n", r.Method, r.URL.Path, handlerInstance.handlerConfig.Name)
 		start := time.Now()
 
-		go func() {
-			if err := processOutputStream(np, outputChannel); err != nil {
-				errorChannel <- err
-			}
-		}()
-
-		// Start error processing with done channel
-		go processErrorStream(np)
-		sendResult(start, w, outputChannel)
+		result, err := handlerInstance.Execute(code)
+		sendResult(start, w, HandlerOutput{
+			handlerResult: result,
+			err:           err,
+		})
 	}
 
 	for method, path := range handlerInstance.handlerConfig.Http {
@@ -64,13 +40,6 @@ func RegisterHandler(handlerInstance *HandlerInstance, r *mux.Router, np *NodePr
 		}).Methods(method)
 	}
 
-	for range handlerInstance.handlerConfig.Sqs {
-		r.HandleFunc(fmt.Sprintf("/_sqs/%s", handlerInstance.handlerConfig.Name), func(w http.ResponseWriter, r *http.Request) {
-			code := generateSqsHandlerRuntimeCode(handlerInstance, r)
-			handleRequestFunc(w, r, code)
-		}).Methods("POST")
-	}
-
 	if handlerInstance.handlerConfig.Schedule != nil {
 		r.HandleFunc(fmt.Sprintf("/_scheduled/%s", handlerInstance.handlerConfig.Name), func(w http.ResponseWriter, r *http.Request) {
 			code := generateScheduledHandlerRuntimeCode(handlerInstance)
@@ -81,10 +50,19 @@ func RegisterHandler(handlerInstance *HandlerInstance, r *mux.Router, np *NodePr
 	return nil
 }
 
-func sendResult(startTime time.Time, w http.ResponseWriter, outputChannel chan HandlerOutput) {
-	parsed := <-outputChannel
+func sendResult(startTime time.Time, w http.ResponseWriter, parsed HandlerOutput) {
 	if parsed.err != nil {
 		fmt.Println(parsed.err)
+		writeHandlerOutput(w, parsed)
+		return
+	}
+
+	writeHandlerOutput(w, parsed)
+	fmt.Printf("Completed in %.dms\n\n", time.Since(startTime).Milliseconds())
+}
+
+func writeHandlerOutput(w http.ResponseWriter, parsed HandlerOutput) {
+	if parsed.err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte{})
 		return
@@ -100,108 +78,26 @@ func sendResult(startTime time.Time, w http.ResponseWriter, outputChannel chan H
 
 	// Write the body
 	w.Write([]byte(parsed.handlerResult.Body))
-	fmt.Printf("Completed in %.dms\n\n", time.Since(startTime).Milliseconds())
-}
-
-func processOutputStream(np *NodeProcess, resultChan chan<- HandlerOutput) error {
-	scanner := bufio.NewReader(np.stdout)
-
-	for {
-		line, err := scanner.ReadString('\n')
-
-		if err != nil {
-			if err == io.EOF {
-				return nil
-			}
-			return err
-		}
-
-		if strings.HasPrefix(line, "TERRABLE_RESULT_START") {
-			extractedResult, err := extractResult(line)
-			resultChan <- HandlerOutput{
-				handlerResult: extractedResult,
-				err:           err,
-			}
-			return nil
-		}
-
-		if strings.HasPrefix(line, "CODE_EXECUTION_COMPLETE") {
-			continue
-		}
-
-		fmt.Println(line)
-	}
-}
-
-func processErrorStream(np *NodeProcess) {
-	scanner := bufio.NewReader(np.stderr)
-	errorColour := color.New(color.FgHiRed).SprintFunc()
-
-	line, _ := scanner.ReadString('\n')
-	fmt.Println(errorColour(line))
 }
 
 func generateHttpHandlerRuntimeCode(handler *HandlerInstance, r *http.Request) string {
 	body, _ := io.ReadAll(r.Body)
 	defer r.Body.Close()
 
-	queryParams := make(map[string]string)
-
-	for key, values := range r.URL.Query() {
-		queryParams[key] = values[len(values)-1] // Take the last value
-	}
-
-	headers := make(map[string]string)
-
-	for key, values := range r.Header {
-		headers[key] = values[0]
-	}
-
-	// Format for API Gateway behaviours
-	var bodyValue interface{}
-
-	// Set body
-	if len(body) > 0 {
-		bodyValue = string(body)
-	} else {
-		bodyValue = nil
-	}
-
-	if bodyValue == "" {
-		bodyValue = nil
-	}
-
-	// Set query string params
-	var queryParamsValue interface{}
-
-	if len(queryParams) > 0 {
-		queryParamsValue = queryParams
-	} else {
-		queryParamsValue = nil
-	}
-
-	// Set path parameters
-	pathParams := mux.Vars(r)
-
-	if len(pathParams) < 1 {
-		pathParams = nil
-	}
-
-	eventInput := map[string]interface{}{
-		"body":                  bodyValue,
-		"queryStringParameters": queryParamsValue,
-		"httpMethod":            r.Method,
-		"path":                  r.URL.Path,
-		"headers":               headers,
-		"pathParameters":        pathParams,
-	}
+	eventInput := newHttpEvent(newHttpEventRequest(r, body, mux.Vars(r)))
 
 	eventInputJSON, _ := json.Marshal(eventInput)
-	envVars := generateEnvVars(handler)
-	return generateJSCode(string(envVars), handler.GetExecutionPath(), string(eventInputJSON), handler.handlerConfig.Timeout)
+	return generateRuntimeCode(handler, string(eventInputJSON))
 }
 
 func generateEnvVars(handler *HandlerInstance) string {
+	mergedEnvVars, _ := json.Marshal(handlerEnvironment(handler))
+	return string(mergedEnvVars)
+}
+
+// handlerEnvironment is terrable's own environment overlaid with the handler's
+// configured and env file variables.
+func handlerEnvironment(handler *HandlerInstance) map[string]string {
 	envVars := make(map[string]string)
 	processEnvVars := os.Environ()
 
@@ -218,63 +114,56 @@ func generateEnvVars(handler *HandlerInstance) string {
 		envVars[key] = value
 	}
 
-	mergedEnvVars, _ := json.Marshal(envVars)
-	return string(mergedEnvVars)
+	return envVars
 }
 
-func generateSqsHandlerRuntimeCode(handler *HandlerInstance, r *http.Request) string {
-	body, _ := io.ReadAll(r.Body)
-	defer r.Body.Close()
-
-	// Create an SQS message
-	message := map[string]interface{}{
-		"messageId": uuid.New().String(),
-		"body":      string(body),
-		"attributes": map[string]interface{}{
-			"ApproximateReceiveCount":          "1",
-			"SentTimestamp":                    fmt.Sprintf("%d", time.Now().UnixNano()/1e6),
-			"SenderId":                         "SIMULATOR",
-			"ApproximateFirstReceiveTimestamp": fmt.Sprintf("%d", time.Now().UnixNano()/1e6),
-		},
-		"messageAttributes": map[string]interface{}{},
-		"md5OfBody":         fmt.Sprintf("%x", md5.Sum(body)),
-		"eventSource":       "aws:sqs",
-		"eventSourceARN":    fmt.Sprintf("arn:aws:sqs:eu-west-1:000000000000:%s", handler.handlerConfig.Name),
-		"awsRegion":         "eu-west-1",
-	}
-
-	// Create the SQS event structure
-	eventInput := map[string]interface{}{
-		"Records": []interface{}{message},
-	}
+func generateSqsHandlerRuntimeCode(handler *HandlerInstance, records []map[string]interface{}) string {
+	eventInput := newSqsEvent(records)
 
 	eventInputJSON, _ := json.Marshal(eventInput)
-	envVars := generateEnvVars(handler)
-	return generateJSCode(string(envVars), handler.GetExecutionPath(), string(eventInputJSON), handler.handlerConfig.Timeout)
+	return generateRuntimeCode(handler, string(eventInputJSON))
 }
 
 func generateScheduledHandlerRuntimeCode(handler *HandlerInstance) string {
-	ruleName := fmt.Sprintf("%s-scheduled", handler.handlerConfig.Name)
-	ruleArn := fmt.Sprintf("arn:aws:events:eu-west-1:000000000000:rule/%s", ruleName)
-
-	eventInput := map[string]interface{}{
-		"version":     "0",
-		"id":          uuid.New().String(),
-		"detail-type": "Scheduled Event",
-		"source":      "aws.events",
-		"account":     "000000000000",
-		"time":        time.Now().UTC().Format(time.RFC3339),
-		"region":      "eu-west-1",
-		"resources":   []string{ruleArn},
-		"detail":      map[string]interface{}{},
+	return generateRuntimeCode(handler, string(scheduledHandlerPayload(handler)))
+}
+
+// scheduledHandlerPayload is what a scheduled handler receives when its
+// schedule fires.
+func scheduledHandlerPayload(handler *HandlerInstance) []byte {
+	eventInput := newScheduledEvent(fmt.Sprintf("%s-scheduled", handler.handlerConfig.Name))
+
+	return scheduledHandlerInput(eventInput, *handler.handlerConfig.Schedule)
+}
+
+// generateRuntimeCode wraps an event in whatever the handler's runtime expects:
+// a script for Node.js, or an invocation message for Python and bootstraps.
+func generateRuntimeCode(handler *HandlerInstance, eventInputJSON string) string {
+	switch handlerRuntimeKind(handler.handlerConfig) {
+	case pythonRuntimeKind:
+		return generatePythonInvocation(generateEnvVars(handler), handler, eventInputJSON)
+	case providedRuntimeKind:
+		return generateProvidedInvocation(handler, eventInputJSON)
+	default:
+		return generateJSCode(generateEnvVars(handler), generateHandlerLoaderCode(handler), eventInputJSON, handler.handlerConfig.Timeout)
 	}
+}
 
-	eventInputJSON, _ := json.Marshal(eventInput)
-	envVars := generateEnvVars(handler)
-	return generateJSCode(string(envVars), handler.GetExecutionPath(), string(eventInputJSON), handler.handlerConfig.Timeout)
+// generateHandlerLoaderCode returns a JS expression that evaluates to the
+// handler's module, or a promise of it. CommonJS bundles are required afresh on
+// every invocation, while ES module bundles are imported with a cache-busting
+// version that only changes when the handler is rebuilt.
+func generateHandlerLoaderCode(handler *HandlerInstance) string {
+	executionPath, _ := json.Marshal(handler.GetExecutionPath())
+
+	if handler.IsESModule() {
+		return fmt.Sprintf(`importModule(%s, %d)`, executionPath, handler.GetBuildVersion())
+	}
+
+	return fmt.Sprintf(`(delete require.cache[require.resolve(%s)], require(%s))`, executionPath, executionPath)
 }
 
-func generateJSCode(envVars, executionPath, eventInputJSON string, timeoutSeconds int) string {
+func generateJSCode(envVars, loadHandlerCode, eventInputJSON string, timeoutSeconds int) string {
 	return fmt.Sprintf(`
         const env = %s;
         process.env = {};
@@ -283,8 +172,7 @@ func generateJSCode(envVars, executionPath, eventInputJSON string, timeoutSecond
             process.env[envKey] = env[envKey];
         }
 
-        delete require.cache[require.resolve('%s')];
-        var transpiledFunction = require('%s');
+        const loadHandler = () => %s;
 
         var eventInput = %s;
         const endTime = Date.now() + (%d * 1000);
@@ -306,14 +194,15 @@ func generateJSCode(envVars, executionPath, eventInputJSON string, timeoutSecond
     	};
 
         // Create a timeout promise
+        const timedOut = Symbol("timedOut");
         const timeoutPromise = new Promise((resolve) => {
             setTimeout(() => {
-				resolve({ statusCode: 504 })
+				resolve(timedOut)
             }, %d * 1000);
         });
 
 		// Main execution promise
-        const executionPromise = new Promise((resolve, reject) => {
+        const executionPromise = Promise.resolve().then(loadHandler).then((transpiledFunction) => new Promise((resolve, reject) => {
             const callback = (error, result) => {
                 if (error) {
                     reject(error);
@@ -331,32 +220,39 @@ func generateJSCode(envVars, executionPath, eventInputJSON string, timeoutSecond
             } else {
                 resolve(handlerResult);
             }
-        });
+        }));
+
+        const report = (outcome) => {
+            console.log("TERRABLE_RESULT_START:" + JSON.stringify(outcome) + ":TERRABLE_RESULT_END");
+        };
 
         // Race between execution and timeout
         Promise.race([executionPromise, timeoutPromise])
         .then(result => {
-			console.log("TERRABLE_RESULT_START:" + JSON.stringify({ statusCode: 200, ...result }) + ":TERRABLE_RESULT_END");
+            if (result === timedOut) {
+                report({ timedOut: true });
+            } else {
+                report({ result: result === undefined ? null : result });
+            }
         })
         .catch(error => {
             console.error(error);
-            console.log("TERRABLE_RESULT_START:" + JSON.stringify({
-                statusCode: error.message.includes('timed out') ? 408 : 500,
-                headers: {
-                    "Content-Type": "application/json",
+
+            // Handlers run in another realm, so errors are not instances of
+            // this context's Error.
+            const isError = error !== null && typeof error === "object" && "message" in error;
+            report({
+                error: {
+                    errorMessage: isError ? String(error.message) : String(error),
+                    errorType: isError && error.name ? String(error.name) : "Error",
+                    stackTrace: isError && typeof error.stack === "string" ? error.stack.split("\n") : [],
                 },
-                body: JSON.stringify({
-                    message: error.message.includes('timed out') ? "Function timed out" : "Internal server error",
-                    errorMessage: error.message,
-                    errorType: error.name,
-                    stackTrace: error.stack
-                })
-            }) + ":TERRABLE_RESULT_END");
+            });
         })
         .finally(() => {
             complete();
         });
-    `, envVars, executionPath, executionPath, eventInputJSON, timeoutSeconds, timeoutSeconds)
+    `, envVars, loadHandlerCode, eventInputJSON, timeoutSeconds, timeoutSeconds)
 }
 
 func extractResult(output string) (*handlerResult, error) {
@@ -371,19 +267,90 @@ func extractResult(output string) (*handlerResult, error) {
 		return nil, fmt.Errorf("no TERRABLE_RESULT markers found. Unable to parse result")
 	}
 
-	// Parse the JSON result
-	var handlerResult handlerResult
+	// The runtimes report what the handler returned apart from whether it
+	// threw or timed out, so that a returned value is never mistaken for a
+	// failure.
+	var outcome struct {
+		Result   json.RawMessage       `json:"result"`
+		Error    *runtimeErrorResponse `json:"error"`
+		TimedOut bool                  `json:"timedOut"`
+	}
 
-	if err := json.Unmarshal([]byte(result), &handlerResult); err != nil {
+	if err := json.Unmarshal([]byte(result), &outcome); err != nil {
 		return nil, err
 	}
 
-	// Extract statusCode and body
-	return &handlerResult, nil
+	switch {
+	case outcome.TimedOut:
+		return newTimeoutResult(), nil
+	case outcome.Error != nil:
+		return newHandlerErrorResult(*outcome.Error), nil
+	}
+
+	return newHandlerResult(outcome.Result), nil
 }
 
 type handlerResult struct {
+	// StatusCode, Headers and Body are the API Gateway proxy response the
+	// result is served as.
 	StatusCode int               `json:"statusCode"`
 	Headers    map[string]string `json:"headers"`
 	Body       string            `json:"body"`
+
+	// Payload is the JSON value the handler returned. It is empty when the
+	// handler threw or timed out.
+	Payload json.RawMessage `json:"-"`
+	// Error is what the handler threw.
+	Error *runtimeErrorResponse `json:"-"`
+	// TimedOut is set when the handler did not finish within its timeout.
+	TimedOut bool `json:"-"`
+}
+
+// newHandlerResult reads the proxy response from the JSON value a handler
+// returned. A value without a statusCode is served with 200.
+func newHandlerResult(payload json.RawMessage) *handlerResult {
+	if len(payload) == 0 {
+		payload = json.RawMessage("null")
+	}
+
+	result := handlerResult{StatusCode: http.StatusOK}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(payload, &fields) == nil {
+		json.Unmarshal(payload, &result)
+	}
+
+	result.Payload = payload
+
+	return &result
+}
+
+// newHandlerErrorResult is the result of a handler that threw, served as the
+// 500 response API Gateway returns for it.
+func newHandlerErrorResult(runtimeError runtimeErrorResponse) *handlerResult {
+	statusCode, message := http.StatusInternalServerError, "Internal server error"
+	if strings.Contains(runtimeError.ErrorMessage, "timed out") {
+		statusCode, message = http.StatusRequestTimeout, "Function timed out"
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"message":      message,
+		"errorMessage": runtimeError.ErrorMessage,
+		"errorType":    runtimeError.ErrorType,
+		"stackTrace":   runtimeError.StackTrace,
+	})
+
+	return &handlerResult{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body:  string(body),
+		Error: &runtimeError,
+	}
+}
+
+// newTimeoutResult is the result of a handler that ran out of time.
+func newTimeoutResult() *handlerResult {
+	return &handlerResult{StatusCode: http.StatusGatewayTimeout, TimedOut: true}
 }
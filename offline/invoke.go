@@ -0,0 +1,128 @@
+package offline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/terrable-dev/terrable/config"
+	"github.com/terrable-dev/terrable/utils"
+)
+
+// Invoke compiles a single handler and runs it once with event, without
+// starting an HTTP server. The handler's result is printed to stdout and its
+// logs to stderr. An error is returned when the handler throws or times out,
+// so that scripts can rely on the exit status.
+func Invoke(filePath string, moduleName string, handlerName string, envFile string, event []byte) error {
+	terrableConfig, err := utils.ParseTerraformFile(filePath, moduleName)
+	if err != nil {
+		return fmt.Errorf("could not load Terrable configuration: %w", err)
+	}
+
+	handler, err := findHandler(terrableConfig, handlerName)
+	if err != nil {
+		return err
+	}
+
+	if err := validateConfig(&config.TerrableConfig{Handlers: []config.HandlerMapping{handler}}); err != nil {
+		return fmt.Errorf(`error validating configuration: %s`, err.Error())
+	}
+
+	var fileEnvVars map[string]string
+	if envFile != "" {
+		fileEnvVars, err = readEnvFile(envFile)
+		if err != nil {
+			return fmt.Errorf("could not read env file: %w", err)
+		}
+	}
+
+	if !json.Valid(event) {
+		return errors.New("the event is not valid JSON")
+	}
+
+	handlerLogOutput = os.Stderr
+
+	handlerInstance := &HandlerInstance{
+		handlerConfig: handler,
+		envVars:       mergeEnvMaps(terrableConfig.EnvironmentVariables, fileEnvVars),
+	}
+	defer handlerInstance.Close()
+
+	if _, err := handlerInstance.CompileHandler(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	result, err := handlerInstance.Execute(generateRuntimeCode(handlerInstance, string(bytes.TrimSpace(event))))
+	if err != nil {
+		return fmt.Errorf("handler %q could not be invoked: %w", handlerName, err)
+	}
+
+	color.New(color.FgHiBlack).Fprintf(os.Stderr, "Completed in %dms\n", time.Since(start).Milliseconds())
+
+	if err := printInvokeResult(os.Stdout, result); err != nil {
+		return err
+	}
+
+	return invokeResultError(handler, result)
+}
+
+func findHandler(terrableConfig *config.TerrableConfig, handlerName string) (config.HandlerMapping, error) {
+	names := make([]string, 0, len(terrableConfig.Handlers))
+
+	for _, handler := range terrableConfig.Handlers {
+		if handler.Name == handlerName {
+			return handler, nil
+		}
+
+		names = append(names, handler.Name)
+	}
+
+	sort.Strings(names)
+	return config.HandlerMapping{}, fmt.Errorf("handler %q was not found. Available handlers: %s", handlerName, strings.Join(names, ", "))
+}
+
+// printInvokeResult writes the value the handler returned, or the error it
+// threw, as indented JSON.
+func printInvokeResult(w io.Writer, result *handlerResult) error {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, handlerResultPayload(result), "", "  "); err != nil {
+		return fmt.Errorf("could not print the handler result: %w", err)
+	}
+
+	_, err := fmt.Fprintln(w, indented.String())
+	return err
+}
+
+// handlerResultPayload returns the value the handler returned, the error it
+// threw, or null when it timed out.
+func handlerResultPayload(result *handlerResult) []byte {
+	if result.Error != nil {
+		payload, _ := json.Marshal(result.Error)
+		return payload
+	}
+
+	if len(result.Payload) == 0 {
+		return []byte("null")
+	}
+
+	return result.Payload
+}
+
+func invokeResultError(handler config.HandlerMapping, result *handlerResult) error {
+	switch {
+	case result.TimedOut:
+		return fmt.Errorf("handler %q timed out after %s", handler.Name, time.Duration(handler.Timeout)*time.Second)
+	case result.Error != nil:
+		return fmt.Errorf("handler %q failed: %s: %s", handler.Name, result.Error.ErrorType, result.Error.ErrorMessage)
+	}
+
+	return nil
+}
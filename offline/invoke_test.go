@@ -0,0 +1,85 @@
+package offline
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestInvokeResultError(t *testing.T) {
+	handler := config.HandlerMapping{Name: "Handler", Timeout: 3}
+
+	tests := []struct {
+		name        string
+		result      *handlerResult
+		expectedErr string
+	}{
+		{name: "success", result: newHandlerResult(json.RawMessage(`{"statusCode":200}`))},
+		{name: "a returned 5xx is a successful invocation", result: newHandlerResult(json.RawMessage(`{"statusCode":500}`))},
+		{name: "timeout", result: newTimeoutResult(), expectedErr: "timed out after 3s"},
+		{name: "handler error", result: newHandlerErrorResult(runtimeErrorResponse{ErrorMessage: "boom", ErrorType: "TypeError"}), expectedErr: "failed: TypeError: boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := invokeResultError(handler, tt.result)
+
+			if tt.expectedErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Errorf("expected error containing %q, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestPrintInvokeResultPrintsTheReturnedValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected string
+	}{
+		{
+			name:     "object",
+			output:   `TERRABLE_RESULT_START:{"result":{"batchItemFailures":[]}}:TERRABLE_RESULT_END`,
+			expected: "{\n  \"batchItemFailures\": []\n}\n",
+		},
+		{
+			name:     "string",
+			output:   `TERRABLE_RESULT_START:{"result":"hi"}:TERRABLE_RESULT_END`,
+			expected: "\"hi\"\n",
+		},
+		{
+			name:     "nothing",
+			output:   `TERRABLE_RESULT_START:{}:TERRABLE_RESULT_END`,
+			expected: "null\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+
+			result, err := extractResult(tt.output)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := printInvokeResult(&output, result); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if output.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output.String())
+			}
+		})
+	}
+}
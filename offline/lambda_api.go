@@ -0,0 +1,284 @@
+package offline
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/terrable-dev/terrable/config"
+)
+
+const (
+	lambdaAPIPrefix = "/2015-03-31/functions"
+	// maxLogResultBytes is how much of the end of an invocation's logs Lambda
+	// returns in X-Amz-Log-Result.
+	maxLogResultBytes = 4096
+)
+
+// lambdaAPIError is an error in the shape the Lambda REST API returns them.
+type lambdaAPIError struct {
+	statusCode int
+	code       string
+	message    string
+}
+
+func newLambdaValidationError(value string, field string, allowed string) *lambdaAPIError {
+	return &lambdaAPIError{
+		statusCode: http.StatusBadRequest,
+		code:       "ValidationException",
+		message:    fmt.Sprintf("1 validation error detected: Value '%s' at '%s' failed to satisfy constraint: Member must satisfy enum value set: [%s]", value, field, allowed),
+	}
+}
+
+// lambdaAPI invokes local handlers by function name.
+type lambdaAPI struct {
+	handlers map[string]*HandlerInstance
+	execute  func(handler *HandlerInstance, payload []byte, logs io.Writer) HandlerOutput
+	// executeAsync runs Event invocations, which are retried and sent to
+	// destinations like those of any other asynchronous trigger.
+	executeAsync func(handler *HandlerInstance, payload []byte) HandlerOutput
+}
+
+func newLambdaAPI(handlerInstances []*HandlerInstance, async *asyncQueue) *lambdaAPI {
+	api := &lambdaAPI{
+		handlers:     make(map[string]*HandlerInstance, len(handlerInstances)),
+		execute:      executeLambdaInvocation,
+		executeAsync: async.invoke,
+	}
+
+	for _, handlerInstance := range handlerInstances {
+		api.handlers[handlerInstance.handlerConfig.Name] = handlerInstance
+	}
+
+	return api
+}
+
+// registerLambdaAPIRoutes serves Invoke from the Lambda API, so that handlers
+// which invoke other functions with an AWS SDK reach the local handlers of the
+// same name.
+//
+// The route is registered ahead of handler routes so that catch-all handler
+// paths never shadow it.
+func registerLambdaAPIRoutes(r *mux.Router, api *lambdaAPI) {
+	r.HandleFunc(lambdaAPIPrefix+"/{function}/invocations", api.ServeHTTP).Methods(http.MethodPost)
+}
+
+func (api *lambdaAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	functionName := lambdaFunctionName(mux.Vars(r)["function"])
+
+	handler, ok := api.handlers[functionName]
+	if !ok {
+		writeLambdaAPIError(w, &lambdaAPIError{
+			statusCode: http.StatusNotFound,
+			code:       "ResourceNotFoundException",
+			message:    fmt.Sprintf("Function not found: %s", lambdaFunctionArn(functionName)),
+		})
+		return
+	}
+
+	invocationType := valueOrDefault(r.Header.Get("X-Amz-Invocation-Type"), "RequestResponse")
+	if invocationType != "RequestResponse" && invocationType != "Event" && invocationType != "DryRun" {
+		writeLambdaAPIError(w, newLambdaValidationError(invocationType, "invocationType", "Event, RequestResponse, DryRun"))
+		return
+	}
+
+	logType := valueOrDefault(r.Header.Get("X-Amz-Log-Type"), "None")
+	if logType != "None" && logType != "Tail" {
+		writeLambdaAPIError(w, newLambdaValidationError(logType, "logType", "None, Tail"))
+		return
+	}
+
+	payload, _ := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	// Lambda invokes a function with an empty object when there is no payload.
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+
+	if !json.Valid(payload) {
+		writeLambdaAPIError(w, &lambdaAPIError{
+			statusCode: http.StatusBadRequest,
+			code:       "InvalidRequestContentException",
+			message:    "Could not parse request body into json: the payload is not valid JSON",
+		})
+		return
+	}
+
+	fmt.Printf("Lambda API Invoke %s (%s)\n", functionName, invocationType)
+
+	switch invocationType {
+	case "DryRun":
+		w.WriteHeader(http.StatusNoContent)
+	case "Event":
+		go api.invokeAsync(handler, payload)
+
+		w.Header().Set("X-Amzn-RequestId", uuid.New().String())
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		api.invoke(w, handler, payload, logType == "Tail")
+	}
+}
+
+// invoke runs the handler and responds with what it returned, or with the
+// error it threw and the X-Amz-Function-Error header.
+func (api *lambdaAPI) invoke(w http.ResponseWriter, handler *HandlerInstance, payload []byte, tail bool) {
+	requestID := uuid.New().String()
+	start := time.Now()
+
+	var logs bytes.Buffer
+	output := api.execute(handler, payload, &logs)
+	duration := time.Since(start)
+
+	if output.err != nil {
+		fmt.Println(output.err)
+
+		writeLambdaAPIError(w, &lambdaAPIError{
+			statusCode: http.StatusInternalServerError,
+			code:       "ServiceException",
+			message:    fmt.Sprintf("Function %s could not be invoked: %s", handler.handlerConfig.Name, output.err),
+		})
+		return
+	}
+
+	body := handlerResultPayload(output.handlerResult)
+	functionError := lambdaFunctionError(handler.handlerConfig, output.handlerResult)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Amzn-RequestId", requestID)
+	w.Header().Set("X-Amz-Executed-Version", "$LATEST")
+
+	if tail {
+		w.Header().Set("X-Amz-Log-Result", lambdaLogResult(requestID, logs.Bytes(), duration))
+	}
+
+	if functionError != nil {
+		body = functionError
+		w.Header().Set("X-Amz-Function-Error", "Unhandled")
+		color.New(color.FgHiYellow).Printf("Lambda invocation of %s failed (%s) after %dms\n\n", handler.handlerConfig.Name, invocationFailure(output), duration.Milliseconds())
+	} else {
+		color.New(color.FgHiGreen).Printf("Lambda invocation of %s completed in %dms\n\n", handler.handlerConfig.Name, duration.Milliseconds())
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// invokeAsync runs the handler for an Event invocation, whose caller has
+// already been answered.
+func (api *lambdaAPI) invokeAsync(handler *HandlerInstance, payload []byte) {
+	start := time.Now()
+
+	output := api.executeAsync(handler, payload)
+	if output.err != nil {
+		fmt.Println(output.err)
+	}
+
+	if failure := invocationFailure(output); failure != "" {
+		color.New(color.FgHiYellow).Printf("Lambda async invocation of %s failed (%s) after %dms\n\n", handler.handlerConfig.Name, failure, time.Since(start).Milliseconds())
+	} else {
+		color.New(color.FgHiGreen).Printf("Lambda async invocation of %s completed in %dms\n\n", handler.handlerConfig.Name, time.Since(start).Milliseconds())
+	}
+}
+
+func executeLambdaInvocation(handler *HandlerInstance, payload []byte, logs io.Writer) HandlerOutput {
+	result, err := handler.ExecuteWithLogs(generateRuntimeCode(handler, string(payload)), logs)
+
+	return HandlerOutput{
+		handlerResult: result,
+		err:           err,
+	}
+}
+
+// lambdaFunctionName reads the function name from a name, a partial ARN such
+// as 000000000000:function:Name, or a full ARN. Any version or alias qualifier
+// is ignored, as every local function only has $LATEST.
+func lambdaFunctionName(function string) string {
+	parts := strings.Split(function, ":")
+
+	for i, part := range parts {
+		if part == "function" && i+1 < len(parts) {
+			return parts[i+1]
+		}
+	}
+
+	return parts[0]
+}
+
+func lambdaFunctionArn(name string) string {
+	return fmt.Sprintf("arn:aws:lambda:eu-west-1:000000000000:function:%s", name)
+}
+
+// lambdaFunctionError returns the error payload Lambda responds with when the
+// handler threw or timed out, or nil when it returned normally.
+func lambdaFunctionError(handler config.HandlerMapping, result *handlerResult) []byte {
+	if result.TimedOut {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"errorType":    "Sandbox.Timedout",
+			"errorMessage": fmt.Sprintf("Task timed out after %d.00 seconds", handler.Timeout),
+		})
+
+		return payload
+	}
+
+	if result.Error == nil {
+		return nil
+	}
+
+	trace := result.Error.StackTrace
+	if trace == nil {
+		trace = []string{}
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"errorType":    result.Error.ErrorType,
+		"errorMessage": result.Error.ErrorMessage,
+		"trace":        trace,
+	})
+
+	return payload
+}
+
+// lambdaLogResult frames the logs of an invocation the way Lambda writes them
+// to CloudWatch, and returns the last 4 KB of them base64 encoded.
+func lambdaLogResult(requestID string, logs []byte, duration time.Duration) string {
+	var framed bytes.Buffer
+
+	fmt.Fprintf(&framed, "START RequestId: %s Version: $LATEST\n", requestID)
+	framed.Write(logs)
+	fmt.Fprintf(&framed, "END RequestId: %s\n", requestID)
+	fmt.Fprintf(&framed, "REPORT RequestId: %s\tDuration: %.2f ms\tBilled Duration: %d ms\tMemory Size: 128 MB\n", requestID, float64(duration.Microseconds())/1000, duration.Milliseconds()+1)
+
+	tail := framed.Bytes()
+	if len(tail) > maxLogResultBytes {
+		tail = tail[len(tail)-maxLogResultBytes:]
+	}
+
+	return base64.StdEncoding.EncodeToString(tail)
+}
+
+func writeLambdaAPIError(w http.ResponseWriter, err *lambdaAPIError) {
+	errorType := "User"
+	if err.statusCode >= http.StatusInternalServerError {
+		errorType = "Service"
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"Type":    errorType,
+		"message": err.message,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Amzn-ErrorType", err.code)
+	w.WriteHeader(err.statusCode)
+	w.Write(body)
+}
@@ -0,0 +1,202 @@
+package offline
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func newTestLambdaAPI(t *testing.T) (*mux.Router, *recordedInvocations[string]) {
+	t.Helper()
+
+	api := newLambdaAPI([]*HandlerInstance{
+		{handlerConfig: config.HandlerMapping{Name: "Greeter", Timeout: 3}},
+		{handlerConfig: config.HandlerMapping{Name: "Failing", Timeout: 3}},
+		{handlerConfig: config.HandlerMapping{Name: "Slow", Timeout: 3}},
+		{handlerConfig: config.HandlerMapping{Name: "Proxy", Timeout: 3}},
+	}, nil)
+
+	recorded := newRecordedInvocations[string]()
+	api.execute = func(handler *HandlerInstance, payload []byte, logs io.Writer) HandlerOutput {
+		recorded.record(handler, string(payload))
+
+		if logs != nil {
+			io.WriteString(logs, "greeting someone\n")
+		}
+
+		switch handler.handlerConfig.Name {
+		case "Failing":
+			return HandlerOutput{handlerResult: newHandlerErrorResult(runtimeErrorResponse{
+				ErrorMessage: "boom",
+				ErrorType:    "TypeError",
+				StackTrace:   []string{"TypeError: boom", "    at handler"},
+			})}
+		case "Slow":
+			return HandlerOutput{handlerResult: newTimeoutResult()}
+		case "Proxy":
+			return HandlerOutput{handlerResult: newHandlerResult(json.RawMessage(`{"statusCode":504,"body":"upstream timed out"}`))}
+		}
+
+		return HandlerOutput{handlerResult: newHandlerResult(json.RawMessage(`{"greeting":"hello"}`))}
+	}
+
+	api.executeAsync = func(handler *HandlerInstance, payload []byte) HandlerOutput {
+		return api.execute(handler, payload, nil)
+	}
+
+	r := mux.NewRouter()
+	registerLambdaAPIRoutes(r, api)
+
+	return r, recorded
+}
+
+func callLambdaAPI(r http.Handler, function string, payload string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/2015-03-31/functions/"+function+"/invocations", strings.NewReader(payload))
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func TestLambdaAPIRequestResponse(t *testing.T) {
+	r, recorded := newTestLambdaAPI(t)
+
+	response := callLambdaAPI(r, "arn:aws:lambda:eu-west-1:000000000000:function:Greeter:$LATEST", `{"name":"terrable"}`, map[string]string{
+		"X-Amz-Log-Type": "Tail",
+	})
+
+	if response.Code != http.StatusOK || response.Body.String() != `{"greeting":"hello"}` {
+		t.Fatalf("unexpected response %d %s", response.Code, response.Body.String())
+	}
+
+	if response.Header().Get("X-Amz-Executed-Version") != "$LATEST" || response.Header().Get("X-Amz-Function-Error") != "" {
+		t.Errorf("unexpected headers %v", response.Header())
+	}
+
+	logs, err := base64.StdEncoding.DecodeString(response.Header().Get("X-Amz-Log-Result"))
+	if err != nil || !strings.HasPrefix(string(logs), "START RequestId: ") || !strings.Contains(string(logs), "greeting someone\nEND RequestId: ") {
+		t.Errorf("expected the framed invocation logs, got %q (%v)", logs, err)
+	}
+
+	if payloads := recorded.get("Greeter"); len(payloads) != 1 || payloads[0] != `{"name":"terrable"}` {
+		t.Errorf("expected the payload to be the event, got %v", payloads)
+	}
+
+	response = callLambdaAPI(r, "Greeter", "", nil)
+	if response.Header().Get("X-Amz-Log-Result") != "" {
+		t.Errorf("expected no logs without LogType Tail, got %v", response.Header())
+	}
+
+	if payloads := recorded.get("Greeter"); len(payloads) != 2 || payloads[1] != `{}` {
+		t.Errorf("expected an empty payload to be an empty object, got %v", payloads)
+	}
+}
+
+func TestLambdaAPIRespondsWithTheReturnedValue(t *testing.T) {
+	r, _ := newTestLambdaAPI(t)
+
+	// A returned status code is part of the value, not a function error.
+	response := callLambdaAPI(r, "Proxy", `{}`, nil)
+
+	if response.Body.String() != `{"statusCode":504,"body":"upstream timed out"}` || response.Header().Get("X-Amz-Function-Error") != "" {
+		t.Errorf("expected the returned value without a function error, got %s %v", response.Body.String(), response.Header())
+	}
+}
+
+func TestLambdaAPIReportsFunctionErrors(t *testing.T) {
+	r, _ := newTestLambdaAPI(t)
+
+	tests := []struct {
+		function string
+		expected string
+	}{
+		{"Failing", `{"errorType":"TypeError","errorMessage":"boom","trace":["TypeError: boom","    at handler"]}`},
+		{"Slow", `{"errorType":"Sandbox.Timedout","errorMessage":"Task timed out after 3.00 seconds"}`},
+	}
+
+	for _, test := range tests {
+		response := callLambdaAPI(r, test.function, `{}`, nil)
+
+		if response.Code != http.StatusOK || response.Header().Get("X-Amz-Function-Error") != "Unhandled" {
+			t.Errorf("expected %s to report a function error, got %d %v", test.function, response.Code, response.Header())
+		}
+
+		if !jsonEqual(t, response.Body.Bytes(), []byte(test.expected)) {
+			t.Errorf("expected %s, got %s", test.expected, response.Body.String())
+		}
+	}
+}
+
+func TestLambdaAPIInvocationTypes(t *testing.T) {
+	r, recorded := newTestLambdaAPI(t)
+
+	response := callLambdaAPI(r, "Greeter", `{"dry":true}`, map[string]string{"X-Amz-Invocation-Type": "DryRun"})
+	if response.Code != http.StatusNoContent {
+		t.Errorf("expected DryRun to respond 204, got %d", response.Code)
+	}
+
+	response = callLambdaAPI(r, "000000000000:function:Greeter", `{"async":true}`, map[string]string{"X-Amz-Invocation-Type": "Event"})
+	if response.Code != http.StatusAccepted || response.Body.Len() != 0 {
+		t.Errorf("expected Event to respond 202, got %d %s", response.Code, response.Body.String())
+	}
+
+	waitFor(t, func() bool { return len(recorded.get("Greeter")) == 1 })
+
+	if payloads := recorded.get("Greeter"); payloads[0] != `{"async":true}` {
+		t.Errorf("expected only the Event invocation to run, got %v", payloads)
+	}
+}
+
+func TestLambdaAPIErrors(t *testing.T) {
+	r, _ := newTestLambdaAPI(t)
+
+	tests := []struct {
+		function string
+		payload  string
+		headers  map[string]string
+		status   int
+		code     string
+	}{
+		{"Missing", `{}`, nil, http.StatusNotFound, "ResourceNotFoundException"},
+		{"Greeter", `not json`, nil, http.StatusBadRequest, "InvalidRequestContentException"},
+		{"Greeter", `{}`, map[string]string{"X-Amz-Invocation-Type": "Later"}, http.StatusBadRequest, "ValidationException"},
+		{"Greeter", `{}`, map[string]string{"X-Amz-Log-Type": "Full"}, http.StatusBadRequest, "ValidationException"},
+	}
+
+	for _, test := range tests {
+		response := callLambdaAPI(r, test.function, test.payload, test.headers)
+
+		if response.Code != test.status || response.Header().Get("X-Amzn-ErrorType") != test.code {
+			t.Errorf("expected %d %s for %s %s, got %d %v", test.status, test.code, test.function, test.payload, response.Code, response.Header())
+		}
+	}
+
+	response := callLambdaAPI(r, "Missing", `{}`, nil)
+	if !strings.Contains(response.Body.String(), "Function not found: arn:aws:lambda:eu-west-1:000000000000:function:Missing") {
+		t.Errorf("unexpected error body %s", response.Body.String())
+	}
+}
+
+func TestLambdaLogResultKeepsTheEndOfLongLogs(t *testing.T) {
+	logs := strings.Repeat("x", maxLogResultBytes*2)
+
+	decoded, err := base64.StdEncoding.DecodeString(lambdaLogResult("request", []byte(logs), 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded) != maxLogResultBytes || !strings.Contains(string(decoded), "REPORT RequestId: request") {
+		t.Errorf("expected the last %d bytes of the logs, got %d bytes", maxLogResultBytes, len(decoded))
+	}
+}
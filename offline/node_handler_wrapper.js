@@ -1,4 +1,5 @@
 const vm = require('vm');
+const { pathToFileURL } = require('url');
 
 process.stdin.setEncoding('utf8');
 
@@ -36,6 +37,10 @@ function createContext() {
         console: consoleProxy,
         require: require,
         process: process,
+        // Dynamic import() is unavailable inside vm contexts, so ES module
+        // handlers are imported from the main context instead. The version
+        // busts the module cache whenever the handler is rebuilt.
+        importModule: (path, version) => import(`${pathToFileURL(path).href}?version=${version}`),
         complete: () => {
             consoleProxy.log("CODE_EXECUTION_COMPLETE");
             buffer = "";
@@ -2,16 +2,20 @@ package offline
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/fatih/color"
-	"github.com/gorilla/mux"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/terrable-dev/terrable/config"
 	"github.com/terrable-dev/terrable/utils"
@@ -19,7 +23,7 @@ import (
 
 var DebugConfig config.DebugConfig
 
-func Run(filePath string, moduleName string, port string, debugConfig config.DebugConfig, envFile string) error {
+func Run(filePath string, moduleName string, port string, debugConfig config.DebugConfig, envFile string, shutdownConfig config.ShutdownConfig, runSchedules bool) error {
 	DebugConfig = debugConfig
 	terrableConfig, err := utils.ParseTerraformFile(filePath, moduleName)
 
@@ -42,12 +46,12 @@ func Run(filePath string, moduleName string, port string, debugConfig config.Deb
 		}
 	}
 
-	mergedEnvVars := mergeEnvMaps(terrableConfig.EnvironmentVariables, fileEnvVars)
-	handlerInstances, err := prepareHandlers(terrableConfig.Handlers, mergedEnvVars)
-	if err != nil {
-		return err
+	if shutdownConfig.CleanBuildOutput {
+		defer removeBuildOutput()
 	}
 
+	// The port is chosen before the handlers are prepared so that their
+	// environment can point at the local service endpoints.
 	listener, activePort, err := getListener(port)
 
 	if err != nil {
@@ -56,43 +60,42 @@ func Run(filePath string, moduleName string, port string, debugConfig config.Deb
 
 	defer listener.Close()
 
-	r := mux.NewRouter()
-	registerCORSMiddleware(r, terrableConfig)
-	registerImplicitOptionsRoutes(r, terrableConfig)
+	// Signals are handled before the handlers are built, so that stopping
+	// during the first build still cleans up.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Not Found handlers
-	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(`{"message": "Not Found"}`))
-	})
+	// Restore default signal handling once shutdown starts so that a second
+	// Ctrl-C exits immediately instead of waiting out the grace period.
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(`{"message": "Not Found"}`))
-	})
+	offlineServer := newOfflineServer(filePath, moduleName, fileEnvVars)
+	offlineServer.serviceEnvVars = localServiceEnvVars(activePort)
+	offlineServer.runSchedules = runSchedules
+	defer offlineServer.Close()
 
-	np, err := GetNodeProcess()
-	if err != nil {
+	if err := offlineServer.start(terrableConfig); err != nil {
 		return err
 	}
-	defer np.Close()
 
-	// Register each prepared handler before serving requests.
-	for _, handlerInstance := range handlerInstances {
-		if err := RegisterHandler(handlerInstance, r, np); err != nil {
-			return err
-		}
+	if ctx.Err() != nil {
+		return nil
 	}
 
-	printConfig(*terrableConfig, activePort)
+	if err := offlineServer.watchConfigFile(); err != nil {
+		return err
+	}
+
+	printConfig(*terrableConfig, activePort, offlineServer.nextScheduledRuns())
 
 	server := &http.Server{
-		Handler: r,
+		Handler: offlineServer,
 	}
 
-	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+	if err := serve(ctx, server, listener, shutdownConfig.GracePeriod, offlineServer.closeBy); err != nil {
 		return fmt.Errorf("could not start server on port %d. Error: %w", activePort, err)
 	}
 
@@ -101,18 +104,32 @@ func Run(filePath string, moduleName string, port string, debugConfig config.Deb
 
 func prepareHandlers(handlers []config.HandlerMapping, envVars map[string]string) ([]*HandlerInstance, error) {
 	handlerInstances := make([]*HandlerInstance, len(handlers))
-	compileErrors := make([]error, len(handlers))
-
-	var wg sync.WaitGroup
+	debugPorts := assignDebugPorts(handlers, DebugConfig.NodeJsDebugPort)
 
 	for i, handler := range handlers {
-		handlerInstance := &HandlerInstance{
+		handlerInstances[i] = &HandlerInstance{
 			handlerConfig: handler,
 			envVars:       envVars,
+			debugPort:     debugPorts[handler.Name],
 		}
+	}
+
+	if compileErrors := compileHandlers(handlerInstances); compileErrors != nil {
+		return nil, combineHandlerPreparationErrors(compileErrors)
+	}
 
-		handlerInstances[i] = handlerInstance
+	return handlerInstances, nil
+}
+
+// compileHandlers compiles every handler concurrently. It returns nil when all
+// of them succeed, otherwise one entry per handler in the same order.
+func compileHandlers(handlerInstances []*HandlerInstance) []error {
+	compileErrors := make([]error, len(handlerInstances))
+	failed := false
+
+	var wg sync.WaitGroup
 
+	for i, handlerInstance := range handlerInstances {
 		wg.Add(1)
 		go func(index int, instance *HandlerInstance) {
 			defer wg.Done()
@@ -124,14 +141,48 @@ func prepareHandlers(handlers []config.HandlerMapping, envVars map[string]string
 
 	wg.Wait()
 
-	if err := combineHandlerPreparationErrors(compileErrors); err != nil {
-		return nil, err
+	for _, err := range compileErrors {
+		if err != nil {
+			failed = true
+		}
 	}
 
-	return handlerInstances, nil
+	if !failed {
+		return nil
+	}
+
+	return compileErrors
+}
+
+// assignDebugPorts gives every handler's Node.js process its own inspector port,
+// counting up from the base port in handler name order so that ports stay stable
+// between runs. A base port of 0 lets every process pick a random free port.
+func assignDebugPorts(handlers []config.HandlerMapping, basePort int) map[string]int {
+	names := make([]string, 0, len(handlers))
+	for _, handler := range handlers {
+		names = append(names, handler.Name)
+	}
+
+	sort.Strings(names)
+
+	ports := make(map[string]int, len(names))
+	for i, name := range names {
+		if basePort == 0 {
+			ports[name] = 0
+			continue
+		}
+
+		ports[name] = basePort + i
+	}
+
+	return ports
 }
 
 func combineHandlerPreparationErrors(compileErrors []error) error {
+	return combineHandlerErrors("Terrable could not start because one or more handlers failed to prepare.", compileErrors)
+}
+
+func combineHandlerErrors(heading string, compileErrors []error) error {
 	var lines []string
 	errorCount := 0
 
@@ -141,7 +192,7 @@ func combineHandlerPreparationErrors(compileErrors []error) error {
 		}
 
 		if errorCount == 0 {
-			lines = append(lines, "Terrable could not start because one or more handlers failed to prepare.", "")
+			lines = append(lines, heading, "")
 		} else {
 			lines = append(lines, "")
 		}
@@ -160,14 +211,162 @@ func combineHandlerPreparationErrors(compileErrors []error) error {
 func validateConfig(config *config.TerrableConfig) error {
 	var errs []string
 
+	// Handlers notified by the same bucket must agree on its directory.
+	bucketDirectories := make(map[string]map[string]bool)
+
+	handlerNames := make(map[string]bool, len(config.Handlers))
+	// Function URLs take over every request below their path, and each port
+	// serves a single function URL.
+	functionURLPaths := make(map[string][]string)
+	functionURLPorts := make(map[int][]string)
+	// Each WebSocket route invokes a single handler.
+	webSocketRoutes := make(map[string][]string)
+
 	for _, handler := range config.Handlers {
+		handlerNames[handler.Name] = true
+
+		if handler.WebSocket != nil {
+			for _, route := range handler.WebSocket.Routes {
+				webSocketRoutes[route] = append(webSocketRoutes[route], handler.Name)
+			}
+		}
+
+		if handler.FunctionURL != nil && handler.FunctionURL.Path != "" {
+			functionURLPaths[handler.FunctionURL.Path] = append(functionURLPaths[handler.FunctionURL.Path], handler.Name)
+		}
+
+		if handler.FunctionURL != nil && handler.FunctionURL.Port != 0 {
+			functionURLPorts[handler.FunctionURL.Port] = append(functionURLPorts[handler.FunctionURL.Port], handler.Name)
+		}
+	}
+
+	for _, handler := range config.Handlers {
+		if handler.S3 != nil {
+			bucket := handler.S3.BucketName()
+			if bucketDirectories[bucket] == nil {
+				bucketDirectories[bucket] = make(map[string]bool)
+			}
+
+			bucketDirectories[bucket][handler.S3.Directory] = true
+		}
+
 		for method, path := range handler.Http {
 			if !strings.HasPrefix(path, "/") {
 				errs = append(errs, fmt.Sprintf("Handler '%s' does not have a '/' prefix for the HTTP route %s '%s'.", handler.Name, method, path))
 			}
+
+			for urlPath := range functionURLPaths {
+				if path == urlPath || strings.HasPrefix(path, urlPath+"/") {
+					errs = append(errs, fmt.Sprintf("Handler '%s' has the HTTP route %s '%s', which is below the function URL path '%s'.", handler.Name, method, path, urlPath))
+				}
+			}
+		}
+
+		if handler.WebSocket != nil {
+			for _, route := range handler.WebSocket.Routes {
+				if strings.HasPrefix(route, "$") && route != "$connect" && route != "$disconnect" && route != "$default" {
+					errs = append(errs, fmt.Sprintf("Handler '%s' has the WebSocket route '%s', but only $connect, $disconnect and $default can start with $.", handler.Name, route))
+				}
+			}
+		}
+
+		if handler.EventPattern != "" {
+			if _, err := newEventPattern(handler.EventPattern); err != nil {
+				errs = append(errs, fmt.Sprintf("Handler '%s' has an invalid event_pattern: %s.", handler.Name, err))
+			}
+		}
+
+		if handler.Sns != nil && handler.Sns.FilterPolicy != "" {
+			if _, err := newEventPattern(handler.Sns.FilterPolicy); err != nil {
+				errs = append(errs, fmt.Sprintf("Handler '%s' has an invalid sns filter_policy: %s.", handler.Name, err))
+			}
+		}
+
+		if handler.Sqs != nil && handler.Sqs.Sns != nil && handler.Sqs.Sns.FilterPolicy != "" {
+			if _, err := newEventPattern(handler.Sqs.Sns.FilterPolicy); err != nil {
+				errs = append(errs, fmt.Sprintf("Handler '%s' has an invalid sqs sns filter_policy: %s.", handler.Name, err))
+			}
+		}
+
+		if handler.Async != nil {
+			destinations := [][2]string{{"on_success", handler.Async.OnSuccess}, {"on_failure", handler.Async.OnFailure}}
+
+			for _, destination := range destinations {
+				if name, ok := asyncDestinationHandler(destination[1]); ok && destination[1] != "" && !handlerNames[name] {
+					errs = append(errs, fmt.Sprintf("Handler '%s' has an async %s destination '%s', which is not a handler.", handler.Name, destination[0], destination[1]))
+				}
+			}
+		}
+
+		if err := validateRuntime(handler.Runtime); err != nil {
+			errs = append(errs, fmt.Sprintf("Handler '%s' has an %s.", handler.Name, err))
+			continue
+		}
+
+		if !isBundledHandler(handler) {
+			continue
+		}
+
+		if _, err := handlerBuildOptions(handler, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("Handler '%s' has invalid build settings: %s.", handler.Name, err))
 		}
 	}
 
+	buckets := make([]string, 0, len(bucketDirectories))
+	for bucket, directories := range bucketDirectories {
+		if len(directories) > 1 {
+			buckets = append(buckets, bucket)
+		}
+	}
+
+	sort.Strings(buckets)
+
+	for _, bucket := range buckets {
+		errs = append(errs, fmt.Sprintf("Bucket '%s' is watched in more than one s3 directory; every handler it notifies must use the same directory.", bucket))
+	}
+
+	urlPaths := make([]string, 0, len(functionURLPaths))
+	for path, names := range functionURLPaths {
+		if len(names) > 1 {
+			urlPaths = append(urlPaths, path)
+		}
+	}
+
+	sort.Strings(urlPaths)
+
+	for _, path := range urlPaths {
+		sort.Strings(functionURLPaths[path])
+		errs = append(errs, fmt.Sprintf("Function URL path '%s' is used by more than one handler: %s.", path, strings.Join(functionURLPaths[path], ", ")))
+	}
+
+	urlPorts := make([]int, 0, len(functionURLPorts))
+	for port, names := range functionURLPorts {
+		if len(names) > 1 {
+			urlPorts = append(urlPorts, port)
+		}
+	}
+
+	sort.Ints(urlPorts)
+
+	for _, port := range urlPorts {
+		sort.Strings(functionURLPorts[port])
+		errs = append(errs, fmt.Sprintf("Function URL port %d is used by more than one handler: %s.", port, strings.Join(functionURLPorts[port], ", ")))
+	}
+
+	routes := make([]string, 0, len(webSocketRoutes))
+	for route, names := range webSocketRoutes {
+		if len(names) > 1 {
+			routes = append(routes, route)
+		}
+	}
+
+	sort.Strings(routes)
+
+	for _, route := range routes {
+		sort.Strings(webSocketRoutes[route])
+		errs = append(errs, fmt.Sprintf("WebSocket route '%s' is used by more than one handler: %s.", route, strings.Join(webSocketRoutes[route], ", ")))
+	}
+
 	if len(errs) > 0 {
 		return errors.New(strings.Join(errs, "\n"))
 	}
@@ -199,7 +398,9 @@ func getListener(port string) (net.Listener, int, error) {
 	return listener, listener.Addr().(*net.TCPAddr).Port, nil
 }
 
-func printConfig(config config.TerrableConfig, port int) {
+// printConfig lists the local endpoints. nextScheduledRuns holds the next fire
+// time of each scheduled handler when schedules are running.
+func printConfig(config config.TerrableConfig, port int, nextScheduledRuns map[string]time.Time) {
 	totalEndpoints := 0
 
 	t := table.NewWriter()
@@ -208,14 +409,38 @@ func printConfig(config config.TerrableConfig, port int) {
 
 	var hasSqsQueues bool
 	var hasScheduledHandlers bool
+	var hasEventPatterns bool
+	snsTopicHandlers := make(map[string][]string)
+	s3BucketHandlers := make(map[string][]string)
+	s3BucketDirectories := make(map[string]string)
 	for _, handler := range config.Handlers {
-		if len(handler.Sqs) > 0 {
+		if handler.Sqs != nil {
 			hasSqsQueues = true
 		}
 
 		if handler.Schedule != nil {
 			hasScheduledHandlers = true
 		}
+
+		if handler.EventPattern != "" {
+			hasEventPatterns = true
+		}
+
+		if handler.Sns != nil {
+			topic := handler.Sns.TopicName()
+			snsTopicHandlers[topic] = append(snsTopicHandlers[topic], handler.Name)
+		}
+
+		if handler.Sqs != nil && handler.Sqs.Sns != nil {
+			topic := handler.Sqs.Sns.TopicName()
+			snsTopicHandlers[topic] = append(snsTopicHandlers[topic], handler.Name+" queue")
+		}
+
+		if handler.S3 != nil {
+			bucket := handler.S3.BucketName()
+			s3BucketHandlers[bucket] = append(s3BucketHandlers[bucket], handler.Name)
+			s3BucketDirectories[bucket] = handler.S3.Directory
+		}
 	}
 
 	methodColor := color.New(color.FgHiBlue).SprintFunc()
@@ -253,6 +478,97 @@ func printConfig(config config.TerrableConfig, port int) {
 		})
 	}
 
+	// Handlers are listed by name, by way of their index in the configuration.
+	functionURLIndexes := make(map[string]int)
+	var functionURLNames []string
+	for i, handler := range config.Handlers {
+		if handler.FunctionURL != nil {
+			functionURLIndexes[handler.Name] = i
+			functionURLNames = append(functionURLNames, handler.Name)
+		}
+	}
+
+	sort.Strings(functionURLNames)
+
+	if len(functionURLNames) > 0 {
+		t.AppendRow(table.Row{
+			"\nFunction URLs\n",
+			"",
+			"",
+		})
+	}
+
+	for _, name := range functionURLNames {
+		handler := config.Handlers[functionURLIndexes[name]]
+		totalEndpoints++
+
+		url := fmt.Sprintf("%s%s",
+			hostColor(fmt.Sprintf("http://localhost:%d", port)),
+			pathColor(handler.FunctionURL.Path+"/"))
+
+		if handler.FunctionURL.Port != 0 {
+			url = hostColor(fmt.Sprintf("http://localhost:%d/", handler.FunctionURL.Port))
+		}
+
+		t.AppendRow(table.Row{
+			"ANY",
+			url,
+			handlerNameColor(fmt.Sprintf("(%s, %s)", handler.Name, handler.FunctionURL.AuthType)),
+		})
+	}
+
+	webSocketHandlers := make(map[string]string)
+	var webSocketRouteKeys []string
+	for _, handler := range config.Handlers {
+		if handler.WebSocket == nil {
+			continue
+		}
+
+		for _, route := range handler.WebSocket.Routes {
+			if _, ok := webSocketHandlers[route]; !ok {
+				webSocketRouteKeys = append(webSocketRouteKeys, route)
+			}
+
+			webSocketHandlers[route] = handler.Name
+		}
+	}
+
+	sort.Strings(webSocketRouteKeys)
+
+	if len(webSocketRouteKeys) > 0 || config.WebSocketApi != nil {
+		webSocketPath := webSocketAPIPath(config)
+
+		t.AppendRow(table.Row{
+			"\nWebSocket API\n",
+			"",
+			"",
+		})
+
+		for _, route := range webSocketRouteKeys {
+			totalEndpoints++
+
+			url := fmt.Sprintf("%s%s",
+				hostColor(fmt.Sprintf("ws://localhost:%d", port)),
+				pathColor(webSocketPath))
+
+			t.AppendRow(table.Row{
+				methodColor(route),
+				url,
+				handlerNameColor(fmt.Sprintf("(%s)", webSocketHandlers[route])),
+			})
+		}
+
+		url := fmt.Sprintf("%s%s",
+			hostColor(fmt.Sprintf("http://localhost:%d/@connections/", port)),
+			pathColor("{connectionId}"))
+
+		t.AppendRow(table.Row{
+			"POST, GET, DELETE",
+			url,
+			handlerNameColor("(@connections)"),
+		})
+	}
+
 	if hasSqsQueues {
 		t.AppendRow(table.Row{
 			"\nSQS Handlers\n",
@@ -262,7 +578,7 @@ func printConfig(config config.TerrableConfig, port int) {
 	}
 
 	for _, handler := range config.Handlers {
-		for range handler.Sqs {
+		if handler.Sqs != nil {
 			handlerNameColor := color.New(color.FgHiBlack).SprintFunc()
 
 			url := fmt.Sprintf("%s%s",
@@ -277,6 +593,14 @@ func printConfig(config config.TerrableConfig, port int) {
 		}
 	}
 
+	if hasSqsQueues {
+		t.AppendRow(table.Row{
+			"GET",
+			fmt.Sprintf("%s%s", hostColor(fmt.Sprintf("http://localhost:%d", port)), pathColor("/_sqs")),
+			handlerNameColor("(queue state)"),
+		})
+	}
+
 	if hasScheduledHandlers {
 		t.AppendRow(table.Row{
 			"\nScheduled\n",
@@ -296,11 +620,93 @@ func printConfig(config config.TerrableConfig, port int) {
 			hostColor(fmt.Sprintf("http://localhost:%d/_scheduled/", port)),
 			pathColor(handler.Name))
 
+		description := fmt.Sprintf("(%s)", handler.Name)
+		if next, ok := nextScheduledRuns[handler.Name]; ok {
+			description = fmt.Sprintf("(%s, next %s)", handler.Name, formatScheduledTime(next))
+		}
+
 		t.AppendRow(table.Row{
 			"POST",
 			url,
-			handlerNameColor(fmt.Sprintf("(%s)", handler.Name)),
+			handlerNameColor(description),
+		})
+	}
+
+	if hasEventPatterns {
+		var names []string
+		for _, handler := range config.Handlers {
+			if handler.EventPattern != "" {
+				names = append(names, handler.Name)
+			}
+		}
+
+		sort.Strings(names)
+
+		t.AppendRow(table.Row{
+			"\nEventBridge\n",
+			"",
+			"",
+		})
+
+		t.AppendRow(table.Row{
+			"POST",
+			fmt.Sprintf("%s%s", hostColor(fmt.Sprintf("http://localhost:%d", port)), pathColor("/_eventbridge")),
+			handlerNameColor(fmt.Sprintf("(%s)", strings.Join(names, ", "))),
+		})
+	}
+
+	if len(snsTopicHandlers) > 0 {
+		t.AppendRow(table.Row{
+			"\nSNS Topics\n",
+			"",
+			"",
 		})
+
+		topics := make([]string, 0, len(snsTopicHandlers))
+		for topic := range snsTopicHandlers {
+			topics = append(topics, topic)
+		}
+
+		sort.Strings(topics)
+
+		for _, topic := range topics {
+			sort.Strings(snsTopicHandlers[topic])
+
+			url := fmt.Sprintf("%s%s",
+				hostColor(fmt.Sprintf("http://localhost:%d/_sns/", port)),
+				pathColor(topic))
+
+			t.AppendRow(table.Row{
+				"POST",
+				url,
+				handlerNameColor(fmt.Sprintf("(%s)", strings.Join(snsTopicHandlers[topic], ", "))),
+			})
+		}
+	}
+
+	if len(s3BucketHandlers) > 0 {
+		t.AppendRow(table.Row{
+			"\nS3 Buckets\n",
+			"",
+			"",
+		})
+
+		buckets := make([]string, 0, len(s3BucketHandlers))
+		for bucket := range s3BucketHandlers {
+			buckets = append(buckets, bucket)
+		}
+
+		sort.Strings(buckets)
+
+		for _, bucket := range buckets {
+			sort.Strings(s3BucketHandlers[bucket])
+
+			t.AppendRow(table.Row{
+				bucket,
+				pathColor(s3BucketDirectories[bucket]),
+				handlerNameColor(fmt.Sprintf("(%s)", strings.Join(s3BucketHandlers[bucket], ", "))),
+			})
+		}
 	}
 
 	color.New(color.FgHiGreen, color.Bold).Println("Starting terrable local server...")
@@ -323,6 +729,38 @@ func printConfig(config config.TerrableConfig, port int) {
 	color.New(color.FgHiGreen, color.Bold).Printf("\nServer started on :%d\n\n", port)
 }
 
+func printBuildTimings(handlerInstances []*HandlerInstance) {
+	if len(handlerInstances) == 0 {
+		return
+	}
+
+	sorted := append([]*HandlerInstance(nil), handlerInstances...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].handlerConfig.Name < sorted[j].handlerConfig.Name
+	})
+
+	handlerMessage := "handler"
+	if len(sorted) != 1 {
+		handlerMessage = "handlers"
+	}
+
+	color.New(color.FgHiBlue, color.Bold).Printf("Compiled %d %s\n", len(sorted), handlerMessage)
+
+	handlerNameColor := color.New(color.FgHiBlack).SprintFunc()
+
+	for _, handlerInstance := range sorted {
+		fmt.Printf("  %s %s\n",
+			handlerNameColor(fmt.Sprintf("%-30s", handlerInstance.handlerConfig.Name)),
+			formatBuildDuration(handlerInstance.GetBuildDuration()))
+	}
+
+	fmt.Println()
+}
+
+func formatBuildDuration(duration time.Duration) string {
+	return fmt.Sprintf("%dms", duration.Milliseconds())
+}
+
 func mergeEnvMaps(global, local map[string]string) map[string]string {
 	merged := make(map[string]string, len(global)+len(local))
 
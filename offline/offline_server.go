@@ -0,0 +1,583 @@
+package offline
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/fsnotify/fsnotify"
+	"github.com/gorilla/mux"
+	"github.com/terrable-dev/terrable/config"
+	"github.com/terrable-dev/terrable/utils"
+)
+
+const configWatcherDebounce = 200 * time.Millisecond
+
+// offlineServer owns the handlers built from the Terraform configuration and
+// the router that serves them. When the Terraform file changes the
+// configuration is parsed again, only the affected handlers are rebuilt, and
+// the router is swapped atomically. Replaced handlers are shut down once their
+// in-flight invocations finish, so in-flight requests are not dropped unless
+// they outlast the handler's timeout.
+type offlineServer struct {
+	filePath    string
+	moduleName  string
+	fileEnvVars map[string]string
+	// serviceEnvVars point the AWS SDK at the services terrable emulates.
+	// Handlers can override them with their own environment variables.
+	serviceEnvVars map[string]string
+
+	router        atomic.Pointer[mux.Router]
+	sourceWatcher *sourceWatcher
+	configWatcher *fsnotify.Watcher
+	// reloadTimer debounces reloads after the Terraform file changes.
+	reloadMutex sync.Mutex
+	reloadTimer *time.Timer
+
+	mutex sync.Mutex
+	// closed is set once the server has been closed, after which reloads
+	// that were already pending do nothing.
+	closed         bool
+	terrableConfig *config.TerrableConfig
+	handlers       map[string]*HandlerInstance
+	debugPorts     map[string]int
+	// queues holds the local queue of each SQS-triggered handler by handler
+	// name. Queues are kept across reloads so that pending messages survive,
+	// but each reload replaces the map rather than modifying the one the
+	// current router reads.
+	queues map[string]*sqsQueue
+	// runSchedules enables invoking scheduled handlers on their schedule, and
+	// schedules holds each of those schedules by handler name.
+	runSchedules bool
+	schedules    map[string]*scheduledRun
+	// buckets watches the local directory of each bucket that notifies a
+	// handler, by bucket name.
+	buckets map[string]*s3Bucket
+	// functionURLs serves each function URL that has a port of its own, by
+	// port.
+	functionURLs map[int]*functionURLServer
+	// websockets holds the connections to the WebSocket API, which are kept
+	// across reloads.
+	websockets *webSocketAPI
+	// async retries asynchronous invocations and sends their outcome to
+	// destinations. It is kept across reloads so that pending retries still
+	// happen.
+	async *asyncQueue
+	// retiring tracks the replaced handlers that are waiting for their
+	// in-flight invocations to finish before they are shut down.
+	retiring sync.WaitGroup
+}
+
+func newOfflineServer(filePath string, moduleName string, fileEnvVars map[string]string) *offlineServer {
+	return &offlineServer{
+		filePath:     filePath,
+		moduleName:   moduleName,
+		fileEnvVars:  fileEnvVars,
+		handlers:     make(map[string]*HandlerInstance),
+		queues:       make(map[string]*sqsQueue),
+		schedules:    make(map[string]*scheduledRun),
+		buckets:      make(map[string]*s3Bucket),
+		functionURLs: make(map[int]*functionURLServer),
+		websockets:   newWebSocketAPI(),
+		async:        newAsyncQueue(filepath.Join(buildOutputDirectoryName, asyncDestinationLogName)),
+	}
+}
+
+// start prepares every handler in terrableConfig and builds the initial router.
+func (s *offlineServer) start(terrableConfig *config.TerrableConfig) error {
+	mergedEnvVars := s.handlerEnvVars(terrableConfig)
+	handlerInstances, err := prepareHandlers(terrableConfig.Handlers, mergedEnvVars)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.debugPorts = make(map[string]int, len(handlerInstances))
+	for _, handlerInstance := range handlerInstances {
+		s.handlers[handlerInstance.handlerConfig.Name] = handlerInstance
+		s.debugPorts[handlerInstance.handlerConfig.Name] = handlerInstance.debugPort
+	}
+
+	s.sourceWatcher, err = newSourceWatcher(func(handlerInstance *HandlerInstance) ([]string, error) {
+		return handlerInstance.CompileHandler()
+	})
+	if err != nil {
+		return err
+	}
+
+	queues := nextSqsQueues(s.queues, s.handlers)
+	socketRoutes := newWebSocketRoutes(terrableConfig, s.handlers)
+	router, err := buildRouter(terrableConfig, handlerInstances, queues, s.async, s.websockets, socketRoutes)
+	if err != nil {
+		return err
+	}
+
+	s.async.setHandlers(s.handlers)
+	s.websockets.setRoutes(socketRoutes)
+	syncSqsQueues(s.queues, queues, s.handlers)
+	s.queues = queues
+	syncS3Buckets(s.buckets, s.handlers, s.async)
+	syncFunctionURLServers(s.functionURLs, s.handlers)
+	if s.runSchedules {
+		syncScheduledRuns(s.schedules, s.handlers, s.async)
+	}
+
+	for _, handlerInstance := range handlerInstances {
+		s.sourceWatcher.Watch(handlerInstance, handlerInstance.GetInputFiles())
+	}
+
+	s.terrableConfig = terrableConfig
+	s.router.Store(router)
+
+	printBuildTimings(handlerInstances)
+
+	return nil
+}
+
+func (s *offlineServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.Load().ServeHTTP(w, r)
+}
+
+// Close stops watching for changes and shuts down every handler.
+func (s *offlineServer) Close() {
+	s.closeBy(time.Now())
+}
+
+// closeBy stops watching for changes and stops every trigger, then shuts down
+// each handler once its in-flight invocations have finished, or at the
+// deadline.
+func (s *offlineServer) closeBy(deadline time.Time) {
+	s.reloadMutex.Lock()
+	if s.reloadTimer != nil {
+		s.reloadTimer.Stop()
+	}
+	s.reloadMutex.Unlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	s.closed = true
+
+	if s.configWatcher != nil {
+		s.configWatcher.Close()
+	}
+
+	if s.sourceWatcher != nil {
+		s.sourceWatcher.Close()
+	}
+
+	for _, queue := range s.queues {
+		queue.Close()
+	}
+
+	for _, run := range s.schedules {
+		run.Close()
+	}
+
+	for _, bucket := range s.buckets {
+		bucket.Close()
+	}
+
+	for _, urlServer := range s.functionURLs {
+		urlServer.Close()
+	}
+
+	s.websockets.Close()
+
+	s.async.Close()
+
+	for _, handlerInstance := range s.handlers {
+		handlerInstance.closeWhenIdleBy(deadline)
+	}
+
+	s.retiring.Wait()
+}
+
+// watchConfigFile reloads the configuration whenever the Terraform file or its
+// terrable.json changes.
+// The containing directory is watched so that editors which save by
+// replacing the file are still noticed.
+func (s *offlineServer) watchConfigFile() error {
+	absoluteFilePath, err := filepath.Abs(s.filePath)
+	if err != nil {
+		return fmt.Errorf("error watching Terraform file for changes: %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error watching Terraform file for changes: %w", err)
+	}
+
+	// terrable.json sits alongside the Terraform file, so the same directory
+	// watch covers both of them.
+	absoluteConfigFilePath := utils.TerrableConfigFilePath(absoluteFilePath)
+
+	if err := watcher.Add(filepath.Dir(absoluteFilePath)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("error watching Terraform file for changes: %w", err)
+	}
+
+	s.mutex.Lock()
+	s.configWatcher = watcher
+	s.mutex.Unlock()
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if (event.Name != absoluteFilePath && event.Name != absoluteConfigFilePath) || event.Op == fsnotify.Chmod {
+					continue
+				}
+
+				s.reloadMutex.Lock()
+				if s.reloadTimer != nil {
+					s.reloadTimer.Stop()
+				}
+
+				s.reloadTimer = time.AfterFunc(configWatcherDebounce, s.reload)
+				s.reloadMutex.Unlock()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				fmt.Println(fmt.Errorf("error watching Terraform file for changes: %w", err))
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reload parses the Terraform file again and applies the differences to the
+// running server. If anything fails the last good configuration keeps serving.
+func (s *offlineServer) reload() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	terrableConfig, err := utils.ParseTerraformFile(s.filePath, s.moduleName)
+	if err == nil {
+		err = validateConfig(terrableConfig)
+	}
+
+	if err != nil {
+		printReloadError(fmt.Errorf("could not load Terrable configuration: %w", err))
+		return
+	}
+
+	if err := s.applyConfig(terrableConfig); err != nil {
+		printReloadError(err)
+	}
+}
+
+func (s *offlineServer) applyConfig(terrableConfig *config.TerrableConfig) error {
+	mergedEnvVars := s.handlerEnvVars(terrableConfig)
+	changes := diffHandlers(s.handlers, terrableConfig.Handlers, mergedEnvVars)
+
+	nextHandlers := make(map[string]*HandlerInstance, len(terrableConfig.Handlers))
+	var compiled []*HandlerInstance
+
+	for _, handler := range terrableConfig.Handlers {
+		previous := s.handlers[handler.Name]
+
+		switch changes[handler.Name] {
+		case handlerUnchanged:
+			nextHandlers[handler.Name] = previous
+		case handlerReconfigured:
+			nextHandlers[handler.Name] = &HandlerInstance{
+				handlerConfig: handler,
+				envVars:       mergedEnvVars,
+			}
+		default:
+			handlerInstance := &HandlerInstance{
+				handlerConfig: handler,
+				envVars:       mergedEnvVars,
+				debugPort:     s.debugPortFor(handler.Name),
+			}
+
+			nextHandlers[handler.Name] = handlerInstance
+			compiled = append(compiled, handlerInstance)
+		}
+	}
+
+	if err := compileHandlers(compiled); err != nil {
+		for _, handlerInstance := range compiled {
+			handlerInstance.Close()
+		}
+
+		return combineHandlerErrors("Terrable could not reload the configuration because one or more handlers failed to prepare.", err)
+	}
+
+	handlerInstances := make([]*HandlerInstance, 0, len(nextHandlers))
+	for name, handlerInstance := range nextHandlers {
+		if changes[name] == handlerReconfigured {
+			handlerInstance.adoptBuild(s.handlers[name])
+		}
+
+		handlerInstances = append(handlerInstances, handlerInstance)
+	}
+
+	// Nothing is changed until the router has been built, so that the last
+	// good configuration keeps serving if it cannot be.
+	queues := nextSqsQueues(s.queues, nextHandlers)
+	socketRoutes := newWebSocketRoutes(terrableConfig, nextHandlers)
+	router, err := buildRouter(terrableConfig, handlerInstances, queues, s.async, s.websockets, socketRoutes)
+	if err != nil {
+		for _, handlerInstance := range compiled {
+			handlerInstance.Close()
+		}
+
+		return err
+	}
+
+	for name, change := range changes {
+		if change == handlerReconfigured {
+			nextHandlers[name].adoptRuntime(s.handlers[name])
+		}
+	}
+
+	s.async.setHandlers(nextHandlers)
+	s.websockets.setRoutes(socketRoutes)
+	syncSqsQueues(s.queues, queues, nextHandlers)
+	s.queues = queues
+	syncS3Buckets(s.buckets, nextHandlers, s.async)
+	syncFunctionURLServers(s.functionURLs, nextHandlers)
+	if s.runSchedules {
+		syncScheduledRuns(s.schedules, nextHandlers, s.async)
+	}
+
+	s.router.Store(router)
+
+	for name, previous := range s.handlers {
+		if nextHandlers[name] == previous {
+			continue
+		}
+
+		s.sourceWatcher.Unwatch(previous)
+
+		s.retiring.Add(1)
+		go func(previous *HandlerInstance) {
+			defer s.retiring.Done()
+			previous.closeWhenIdle()
+		}(previous)
+	}
+
+	for name, handlerInstance := range nextHandlers {
+		if changes[name] != handlerUnchanged {
+			s.sourceWatcher.Watch(handlerInstance, handlerInstance.GetInputFiles())
+		}
+	}
+
+	s.handlers = nextHandlers
+	s.terrableConfig = terrableConfig
+
+	printReloadSummary(changes)
+	printBuildTimings(compiled)
+
+	return nil
+}
+
+// nextScheduledRuns returns when each running schedule next invokes its
+// handler, by handler name.
+func (s *offlineServer) nextScheduledRuns() map[string]time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	nextRuns := make(map[string]time.Time, len(s.schedules))
+	for name, run := range s.schedules {
+		nextRuns[name] = run.Next()
+	}
+
+	return nextRuns
+}
+
+// handlerEnvVars layers the configured environment variables and those from
+// the env file over the local service endpoints.
+func (s *offlineServer) handlerEnvVars(terrableConfig *config.TerrableConfig) map[string]string {
+	return mergeEnvMaps(mergeEnvMaps(s.serviceEnvVars, terrableConfig.EnvironmentVariables), s.fileEnvVars)
+}
+
+// localServiceEnvVars returns the endpoint variables that send AWS SDK calls
+// for emulated services to the offline server listening on port.
+func localServiceEnvVars(port int) map[string]string {
+	endpoint := fmt.Sprintf("http://localhost:%d", port)
+
+	return map[string]string{
+		"AWS_ENDPOINT_URL_SQS":         endpoint,
+		"AWS_ENDPOINT_URL_EVENTBRIDGE": endpoint,
+		"AWS_ENDPOINT_URL_SNS":         endpoint,
+		"AWS_ENDPOINT_URL_LAMBDA":      endpoint,
+		// The @connections API of the WebSocket API.
+		"AWS_ENDPOINT_URL_APIGATEWAYMANAGEMENTAPI": endpoint,
+	}
+}
+
+// debugPortFor keeps the inspector port of a handler stable across reloads and
+// gives new handlers the next unused port.
+func (s *offlineServer) debugPortFor(name string) int {
+	if port, ok := s.debugPorts[name]; ok {
+		return port
+	}
+
+	if DebugConfig.NodeJsDebugPort == 0 {
+		s.debugPorts[name] = 0
+		return 0
+	}
+
+	port := DebugConfig.NodeJsDebugPort
+	for _, usedPort := range s.debugPorts {
+		if usedPort >= port {
+			port = usedPort + 1
+		}
+	}
+
+	s.debugPorts[name] = port
+	return port
+}
+
+type handlerChange int
+
+const (
+	handlerUnchanged handlerChange = iota
+	// handlerReconfigured handlers keep their compiled output and runtime
+	// process because only their routes, triggers, timeout or environment
+	// changed. Source, runtime or build setting changes recompile the handler
+	// instead.
+	handlerReconfigured
+	handlerRecompiled
+	handlerAdded
+	handlerRemoved
+)
+
+func diffHandlers(current map[string]*HandlerInstance, handlers []config.HandlerMapping, envVars map[string]string) map[string]handlerChange {
+	changes := make(map[string]handlerChange, len(handlers))
+
+	for _, handler := range handlers {
+		previous, ok := current[handler.Name]
+
+		switch {
+		case !ok:
+			changes[handler.Name] = handlerAdded
+		case previous.handlerConfig.Source != handler.Source || previous.handlerConfig.Runtime != handler.Runtime || !reflect.DeepEqual(previous.handlerConfig.Build, handler.Build):
+			changes[handler.Name] = handlerRecompiled
+		case !reflect.DeepEqual(previous.handlerConfig, handler) || !reflect.DeepEqual(previous.envVars, envVars):
+			changes[handler.Name] = handlerReconfigured
+		default:
+			changes[handler.Name] = handlerUnchanged
+		}
+	}
+
+	for name := range current {
+		if _, ok := changes[name]; !ok {
+			changes[name] = handlerRemoved
+		}
+	}
+
+	return changes
+}
+
+func buildRouter(terrableConfig *config.TerrableConfig, handlerInstances []*HandlerInstance, queues map[string]*sqsQueue, async *asyncQueue, websockets *webSocketAPI, socketRoutes webSocketRoutes) (*mux.Router, error) {
+	root := mux.NewRouter()
+
+	// WebSocket connections and function URLs are matched ahead of
+	// everything else, and the API Gateway routes sit in a subrouter of their
+	// own, so that neither handler routes nor the API Gateway CORS
+	// configuration apply to them.
+	registerWebSocketRoutes(root, websockets, socketRoutes)
+	registerFunctionURLRoutes(root, handlerInstances)
+	r := root.NewRoute().Subrouter()
+
+	bus := newEventBus(handlerInstances, async)
+	topics := newSnsTopics(handlerInstances, queues, async)
+	registerCORSMiddleware(r, terrableConfig)
+	registerSqsAPIRoutes(r, queues)
+	registerEventBridgeAPIRoutes(r, bus)
+	registerSnsAPIRoutes(r, topics)
+	registerLambdaAPIRoutes(r, newLambdaAPI(handlerInstances, async))
+	registerConnectionsAPIRoutes(r, websockets, socketRoutes)
+	registerImplicitOptionsRoutes(r, terrableConfig)
+
+	// Not Found handlers
+	root.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "Not Found"}`))
+	})
+
+	root.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "Not Found"}`))
+	})
+
+	for _, handlerInstance := range handlerInstances {
+		if err := RegisterHandler(handlerInstance, r); err != nil {
+			return nil, err
+		}
+	}
+
+	registerSqsRoutes(r, queues)
+	registerEventBridgeRoutes(r, bus)
+	registerSnsRoutes(r, topics)
+
+	return root, nil
+}
+
+func printReloadError(err error) {
+	color.New(color.FgHiRed, color.Bold).Println("Terraform file changed but the configuration could not be reloaded.")
+	fmt.Println(err)
+	color.New(color.FgHiYellow).Println("Still serving the last good configuration.")
+	fmt.Println()
+}
+
+func printReloadSummary(changes map[string]handlerChange) {
+	names := make([]string, 0, len(changes))
+	for name, change := range changes {
+		if change != handlerUnchanged {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	color.New(color.FgHiGreen, color.Bold).Println("Reloaded Terraform configuration")
+
+	if len(names) == 0 {
+		color.New(color.FgHiBlack).Println("  No handler changes")
+	}
+
+	for _, name := range names {
+		switch changes[name] {
+		case handlerAdded:
+			color.New(color.FgHiGreen).Printf("  + %s\n", name)
+		case handlerRemoved:
+			color.New(color.FgHiRed).Printf("  - %s\n", name)
+		case handlerRecompiled:
+			color.New(color.FgHiBlue).Printf("  ~ %s (recompiled)\n", name)
+		case handlerReconfigured:
+			color.New(color.FgHiBlue).Printf("  ~ %s\n", name)
+		}
+	}
+
+	fmt.Println()
+}
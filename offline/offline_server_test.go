@@ -0,0 +1,321 @@
+package offline
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestDiffHandlers(t *testing.T) {
+	current := map[string]*HandlerInstance{
+		"Unchanged": {
+			handlerConfig: config.HandlerMapping{Name: "Unchanged", Source: "/src/a.ts", Http: map[string]string{"GET": "/a"}},
+			envVars:       map[string]string{"KEY": "value"},
+		},
+		"NewRoute": {
+			handlerConfig: config.HandlerMapping{Name: "NewRoute", Source: "/src/b.ts", Http: map[string]string{"GET": "/b"}},
+			envVars:       map[string]string{"KEY": "value"},
+		},
+		"NewSource": {
+			handlerConfig: config.HandlerMapping{Name: "NewSource", Source: "/src/c.ts"},
+			envVars:       map[string]string{"KEY": "value"},
+		},
+		"Removed": {
+			handlerConfig: config.HandlerMapping{Name: "Removed", Source: "/src/d.ts"},
+			envVars:       map[string]string{"KEY": "value"},
+		},
+	}
+
+	handlers := []config.HandlerMapping{
+		{Name: "Unchanged", Source: "/src/a.ts", Http: map[string]string{"GET": "/a"}},
+		{Name: "NewRoute", Source: "/src/b.ts", Http: map[string]string{"POST": "/b"}},
+		{Name: "NewSource", Source: "/src/c2.ts"},
+		{Name: "Added", Source: "/src/e.ts"},
+	}
+
+	changes := diffHandlers(current, handlers, map[string]string{"KEY": "value"})
+
+	expectedChanges := map[string]handlerChange{
+		"Unchanged": handlerUnchanged,
+		"NewRoute":  handlerReconfigured,
+		"NewSource": handlerRecompiled,
+		"Removed":   handlerRemoved,
+		"Added":     handlerAdded,
+	}
+
+	for name, expected := range expectedChanges {
+		if changes[name] != expected {
+			t.Errorf("expected handler %s to have change %d, got %d", name, expected, changes[name])
+		}
+	}
+
+	envChanges := diffHandlers(current, handlers[:1], map[string]string{"KEY": "other"})
+	if envChanges["Unchanged"] != handlerReconfigured {
+		t.Errorf("expected environment changes to reconfigure the handler, got %d", envChanges["Unchanged"])
+	}
+}
+
+func TestOfflineServerApplyConfigSwapsRoutes(t *testing.T) {
+	sourceDir := t.TempDir()
+	chdirForTest(t, t.TempDir())
+
+	firstSource := writeHandlerSource(t, sourceDir, "first.ts", "export const handler = async () => ({ statusCode: 200 });")
+	secondSource := writeHandlerSource(t, sourceDir, "second.ts", "export const handler = async () => ({ statusCode: 200 });")
+	brokenSource := writeHandlerSource(t, sourceDir, "broken.ts", "export const handler = () => {\n")
+
+	server := newOfflineServer("offline.tf", "test", nil)
+	t.Cleanup(server.Close)
+
+	err := server.start(&config.TerrableConfig{
+		Handlers: []config.HandlerMapping{
+			{Name: "First", Source: firstSource, Http: map[string]string{"GET": "/first"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	originalFirst := server.handlers["First"]
+
+	err = server.applyConfig(&config.TerrableConfig{
+		Handlers: []config.HandlerMapping{
+			{Name: "First", Source: firstSource, Http: map[string]string{"GET": "/first-moved"}},
+			{Name: "Second", Source: secondSource, Http: map[string]string{"GET": "/second"}, WebSocket: &config.WebSocketConfig{Routes: []string{"$default"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	assertRouteMatches(t, server.router.Load(), "/first-moved", true)
+	assertRouteMatches(t, server.router.Load(), "/second", true)
+	assertRouteMatches(t, server.router.Load(), "/first", false)
+	// The WebSocket API is served once a handler has a route on it.
+	assertRouteMatches(t, server.router.Load(), "/@connections/abc", true)
+
+	if server.handlers["First"] == originalFirst {
+		t.Fatal("expected reconfigured handler to be replaced")
+	}
+
+	if server.handlers["First"].GetExecutionPath() != originalFirst.GetExecutionPath() {
+		t.Fatal("expected reconfigured handler to keep its compiled output")
+	}
+
+	err = server.applyConfig(&config.TerrableConfig{
+		Handlers: []config.HandlerMapping{
+			{Name: "Broken", Source: brokenSource, Http: map[string]string{"GET": "/broken"}},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "could not reload the configuration") {
+		t.Fatalf("expected reload error for broken handler, got %v", err)
+	}
+
+	assertRouteMatches(t, server.router.Load(), "/first-moved", true)
+	assertRouteMatches(t, server.router.Load(), "/broken", false)
+}
+
+func TestOfflineServerApplyConfigLetsInFlightInvocationsFinish(t *testing.T) {
+	sourceDir := t.TempDir()
+	chdirForTest(t, t.TempDir())
+
+	slowSource := writeHandlerSource(t, sourceDir, "slow.ts", "export const handler = async () => { await new Promise((resolve) => setTimeout(resolve, 500)); return { statusCode: 200, body: 'slow' }; };")
+	fastSource := writeHandlerSource(t, sourceDir, "fast.ts", "export const handler = async () => ({ statusCode: 200, body: 'fast' });")
+
+	server := newOfflineServer("offline.tf", "test", nil)
+	t.Cleanup(server.Close)
+
+	err := server.start(&config.TerrableConfig{
+		Handlers: []config.HandlerMapping{
+			{Name: "Handler", Source: slowSource, Timeout: 5, Http: map[string]string{"GET": "/handler"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	slow := server.handlers["Handler"]
+	type invocation struct {
+		result *handlerResult
+		err    error
+	}
+
+	done := make(chan invocation, 1)
+	go func() {
+		result, err := slow.Execute(generateRuntimeCode(slow, "{}"))
+		done <- invocation{result, err}
+	}()
+
+	waitFor(t, func() bool { return slow.activeInvocations.Load() == 1 })
+
+	err = server.applyConfig(&config.TerrableConfig{
+		Handlers: []config.HandlerMapping{
+			{Name: "Handler", Source: fastSource, Timeout: 5, Http: map[string]string{"GET": "/handler"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	if outcome := <-done; outcome.err != nil || outcome.result.Body != "slow" {
+		t.Fatalf("expected the in-flight invocation to finish on the replaced handler, got %+v %v", outcome.result, outcome.err)
+	}
+
+	server.retiring.Wait()
+
+	if _, err := slow.Execute(generateRuntimeCode(slow, "{}")); err == nil {
+		t.Error("expected the replaced handler to be shut down once it was idle")
+	}
+}
+
+func TestOfflineServerApplyConfigLeavesEverythingUnchangedWhenTheRouterFails(t *testing.T) {
+	sourceDir := t.TempDir()
+	chdirForTest(t, t.TempDir())
+
+	firstSource := writeHandlerSource(t, sourceDir, "first.ts", "export const handler = async () => ({ statusCode: 200 });")
+	workerSource := writeHandlerSource(t, sourceDir, "worker.ts", "export const handler = async () => ({});")
+
+	server := newOfflineServer("offline.tf", "test", nil)
+	t.Cleanup(server.Close)
+
+	err := server.start(&config.TerrableConfig{
+		Handlers: []config.HandlerMapping{
+			{Name: "First", Source: firstSource, Http: map[string]string{"GET": "/first"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	// A handler without compiled output cannot be routed to.
+	first := server.handlers["First"]
+	executionPath := first.GetExecutionPath()
+	first.SetExecutionPath("")
+
+	router := server.router.Load()
+	err = server.applyConfig(&config.TerrableConfig{
+		Handlers: []config.HandlerMapping{
+			{Name: "First", Source: firstSource, Http: map[string]string{"GET": "/first-moved"}},
+			{Name: "Worker", Source: workerSource, Sqs: &config.SqsConfig{Queue: "orders"}},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected the router to fail to build")
+	}
+
+	if server.router.Load() != router || server.handlers["First"] != first || len(server.queues) != 0 {
+		t.Error("expected the last good configuration to keep serving")
+	}
+
+	first.SetExecutionPath(executionPath)
+	if _, err := first.Execute(generateRuntimeCode(first, "{}")); err != nil {
+		t.Errorf("expected the handler to keep its runtime, got %v", err)
+	}
+}
+
+func TestOfflineServerCloseLetsInFlightInvocationsFinish(t *testing.T) {
+	sourceDir := t.TempDir()
+	chdirForTest(t, t.TempDir())
+
+	slowSource := writeHandlerSource(t, sourceDir, "slow.ts", "export const handler = async () => { await new Promise((resolve) => setTimeout(resolve, 300)); return { statusCode: 200, body: 'slow' }; };")
+
+	server := newOfflineServer("offline.tf", "test", nil)
+	err := server.start(&config.TerrableConfig{
+		Handlers: []config.HandlerMapping{
+			{Name: "Worker", Source: slowSource, Timeout: 5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	worker := server.handlers["Worker"]
+	done := make(chan error, 1)
+	go func() {
+		_, err := worker.Execute(generateRuntimeCode(worker, "{}"))
+		done <- err
+	}()
+
+	waitFor(t, func() bool { return worker.activeInvocations.Load() == 1 })
+
+	server.closeBy(time.Now().Add(5 * time.Second))
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected the in-flight invocation to finish before the handler was closed, got %v", err)
+	}
+}
+
+func TestOfflineServerIgnoresReloadsAfterClose(t *testing.T) {
+	dir := t.TempDir()
+	chdirForTest(t, dir)
+
+	source := writeHandlerSource(t, dir, "handler.ts", "export const handler = async () => ({ statusCode: 200 });")
+	terraform := fmt.Sprintf("module \"test\" {\n  handlers = {\n    Handler = {\n      source = %q\n      http = {\n        GET = \"/handler\"\n      }\n    }\n  }\n}\n", source)
+	filePath := writeHandlerSource(t, dir, "offline.tf", terraform)
+
+	server := newOfflineServer(filePath, "test", nil)
+	if err := server.start(&config.TerrableConfig{}); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	server.Close()
+
+	// A reload whose debounce fired just before shutdown runs afterwards.
+	server.reload()
+
+	if len(server.handlers) != 0 {
+		t.Error("expected a reload after closing to leave the server closed")
+	}
+
+	assertRouteMatches(t, server.router.Load(), "/handler", false)
+}
+
+func assertRouteMatches(t *testing.T, router *mux.Router, path string, expected bool) {
+	t.Helper()
+
+	var match mux.RouteMatch
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+
+	if matched := router.Match(request, &match) && match.MatchErr == nil; matched != expected {
+		t.Fatalf("expected route %s matched=%v, got %v", path, expected, matched)
+	}
+}
+
+func writeHandlerSource(t *testing.T, dir string, name string, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create handler source directory: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("failed to write handler source: %v", err)
+	}
+
+	return path
+}
+
+func chdirForTest(t *testing.T, dir string) {
+	t.Helper()
+
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+
+	t.Cleanup(func() {
+		os.Chdir(previous)
+	})
+}
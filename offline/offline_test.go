@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/terrable-dev/terrable/config"
 )
@@ -37,8 +38,8 @@ func TestPrintConfig(t *testing.T) {
 			{
 				Name:   "SqsHandler",
 				Source: "source3",
-				Sqs: map[string]interface{}{
-					"queue": "arn:aws:sqs:region:account:queue",
+				Sqs: &config.SqsConfig{
+					Queue: "arn:aws:sqs:region:account:queue",
 				},
 			},
 			{
@@ -48,6 +49,29 @@ func TestPrintConfig(t *testing.T) {
 					Expression: "rate(5 minutes)",
 				},
 			},
+			{
+				Name:         "EventHandler",
+				Source:       "source5",
+				EventPattern: `{"source": ["com.example.orders"]}`,
+			},
+			{
+				Name:   "SnsHandler",
+				Source: "source6",
+				Sns:    &config.SnsConfig{Topic: "arn:aws:sns:eu-west-1:000000000000:orders"},
+			},
+			{
+				Name:   "SnsQueueHandler",
+				Source: "source7",
+				Sqs: &config.SqsConfig{
+					Queue: "arn:aws:sqs:region:account:fulfilment",
+					Sns:   &config.SnsConfig{Topic: "orders"},
+				},
+			},
+			{
+				Name:   "ThumbnailHandler",
+				Source: "source8",
+				S3:     &config.S3Config{Bucket: "arn:aws:s3:::uploads", Directory: "/srv/buckets/uploads"},
+			},
 		},
 	}
 
@@ -57,7 +81,9 @@ func TestPrintConfig(t *testing.T) {
 	os.Stdout = w
 
 	// Call the function
-	printConfig(testConfig, 1234)
+	printConfig(testConfig, 1234, map[string]time.Time{
+		"ScheduledHandler": time.Date(2026, time.October, 19, 12, 5, 0, 0, time.UTC),
+	})
 
 	// Restore stdout
 	w.Close()
@@ -76,10 +102,20 @@ func TestPrintConfig(t *testing.T) {
 		"(Handler1)",
 		"(Handler2)",
 		"(SqsHandler)",
-		"(ScheduledHandler)",
+		"(ScheduledHandler, next 2026-10-19 12:05 UTC)",
 		"(CORS)",
+		"(queue state)",
 		"SQS Handlers",
 		"Scheduled",
+		"EventBridge",
+		"http://localhost:1234/_eventbridge",
+		"(EventHandler)",
+		"SNS Topics",
+		"http://localhost:1234/_sns/orders",
+		"(SnsHandler, SnsQueueHandler queue)",
+		"S3 Buckets",
+		"/srv/buckets/uploads",
+		"(ThumbnailHandler)",
 	}
 
 	for _, fragment := range expectedFragments {
@@ -142,6 +178,162 @@ func TestValidateConfig(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "PythonRuntime",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{
+						Name:    "Handler1",
+						Source:  "handler.py",
+						Runtime: "python3.12",
+						Http: map[string]string{
+							"GET": "/path1",
+						},
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "UnsupportedRuntime",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{
+						Name:    "Handler1",
+						Source:  "handler.rb",
+						Runtime: "ruby3.3",
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "InvalidEventPattern",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{
+						Name:         "Handler1",
+						Source:       "source1",
+						EventPattern: `{"source": [{"wildcard": "com.**"}]}`,
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "InvalidSnsFilterPolicy",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{
+						Name:   "Handler1",
+						Source: "source1",
+						Sqs: &config.SqsConfig{
+							Queue: "orders",
+							Sns:   &config.SnsConfig{Topic: "orders", FilterPolicy: `{"channel": "web"}`},
+						},
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "SharedS3BucketDirectory",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{Name: "Handler1", Source: "source1", S3: &config.S3Config{Bucket: "uploads", Directory: "/srv/uploads"}},
+					{Name: "Handler2", Source: "source2", S3: &config.S3Config{Bucket: "arn:aws:s3:::uploads", Directory: "/srv/uploads"}},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "ConflictingS3BucketDirectories",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{Name: "Handler1", Source: "source1", S3: &config.S3Config{Bucket: "uploads", Directory: "/srv/uploads"}},
+					{Name: "Handler2", Source: "source2", S3: &config.S3Config{Bucket: "uploads", Directory: "/srv/other"}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "AsyncDestinations",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{Name: "Handler1", Source: "source1", Async: &config.AsyncConfig{OnSuccess: "Handler2", OnFailure: "arn:aws:sqs:eu-west-1:000000000000:failures"}},
+					{Name: "Handler2", Source: "source2", Async: &config.AsyncConfig{OnFailure: "arn:aws:lambda:eu-west-1:000000000000:function:Handler1"}},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "UnknownAsyncDestinationHandler",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{Name: "Handler1", Source: "source1", Async: &config.AsyncConfig{OnFailure: "arn:aws:lambda:eu-west-1:000000000000:function:Missing"}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "FunctionURLs",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{Name: "Handler1", Source: "source1", Http: map[string]string{"GET": "/hooks"}, FunctionURL: &config.FunctionURLConfig{Path: "/_url/Handler1", AuthType: "NONE"}},
+					{Name: "Handler2", Source: "source2", FunctionURL: &config.FunctionURLConfig{Port: 9100, AuthType: "AWS_IAM"}},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "HttpRouteBelowFunctionURL",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{Name: "Handler1", Source: "source1", FunctionURL: &config.FunctionURLConfig{Path: "/hooks", AuthType: "NONE"}},
+					{Name: "Handler2", Source: "source2", Http: map[string]string{"POST": "/hooks/stripe"}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "WebSocketRoutes",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{Name: "Handler1", Source: "source1", WebSocket: &config.WebSocketConfig{Routes: []string{"$connect", "$disconnect", "$default"}}},
+					{Name: "Handler2", Source: "source2", WebSocket: &config.WebSocketConfig{Routes: []string{"sendMessage"}}},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "SharedWebSocketRoute",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{Name: "Handler1", Source: "source1", WebSocket: &config.WebSocketConfig{Routes: []string{"$default"}}},
+					{Name: "Handler2", Source: "source2", WebSocket: &config.WebSocketConfig{Routes: []string{"$default"}}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "ReservedWebSocketRoute",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{Name: "Handler1", Source: "source1", WebSocket: &config.WebSocketConfig{Routes: []string{"$message"}}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "SharedFunctionURLPort",
+			config: &config.TerrableConfig{
+				Handlers: []config.HandlerMapping{
+					{Name: "Handler1", Source: "source1", FunctionURL: &config.FunctionURLConfig{Port: 9100, AuthType: "NONE"}},
+					{Name: "Handler2", Source: "source2", FunctionURL: &config.FunctionURLConfig{Port: 9100, AuthType: "NONE"}},
+				},
+			},
+			expectErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -179,3 +371,32 @@ func TestCombineHandlerPreparationErrors(t *testing.T) {
 		t.Fatalf("expected combined errors to preserve handler order, got %q", err.Error())
 	}
 }
+
+func TestAssignDebugPorts(t *testing.T) {
+	handlers := []config.HandlerMapping{
+		{Name: "Charlie"},
+		{Name: "Alpha"},
+		{Name: "Bravo"},
+	}
+
+	ports := assignDebugPorts(handlers, 9229)
+
+	expectedPorts := map[string]int{
+		"Alpha":   9229,
+		"Bravo":   9230,
+		"Charlie": 9231,
+	}
+
+	for name, expectedPort := range expectedPorts {
+		if ports[name] != expectedPort {
+			t.Errorf("expected handler %s to use debug port %d, got %d", name, expectedPort, ports[name])
+		}
+	}
+
+	randomPorts := assignDebugPorts(handlers, 0)
+	for name, port := range randomPorts {
+		if port != 0 {
+			t.Errorf("expected handler %s to use a random debug port, got %d", name, port)
+		}
+	}
+}
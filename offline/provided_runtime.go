@@ -0,0 +1,328 @@
+package offline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const runtimeAPIPrefix = "/2018-06-01/runtime"
+
+// providedRuntime hosts the Lambda Runtime API for a handler's bootstrap
+// executable, which polls it for invocations exactly as it would inside Lambda.
+// Each handler gets its own API on its own port, so a bootstrap only ever sees
+// its own invocations.
+type providedRuntime struct {
+	name        string
+	process     *runtimeProcess
+	server      *http.Server
+	invocations chan *runtimeInvocation
+
+	// executeMutex allows one invocation at a time, as Lambda does for a
+	// single execution environment.
+	executeMutex sync.Mutex
+
+	pendingMutex sync.Mutex
+	pending      *runtimeInvocation
+}
+
+type runtimeInvocation struct {
+	requestID string
+	event     json.RawMessage
+	deadline  time.Time
+	result    chan HandlerOutput
+}
+
+type providedInvocation struct {
+	Event   json.RawMessage `json:"event"`
+	Timeout int             `json:"timeout"`
+}
+
+type runtimeErrorResponse struct {
+	ErrorMessage string   `json:"errorMessage"`
+	ErrorType    string   `json:"errorType"`
+	StackTrace   []string `json:"stackTrace,omitempty"`
+}
+
+func startProvidedRuntime(name string, bootstrapPath string, envVars map[string]string) (*providedRuntime, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("could not start the Lambda Runtime API for handler %q: %w", name, err)
+	}
+
+	rt := &providedRuntime{
+		name:        name,
+		invocations: make(chan *runtimeInvocation),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc(runtimeAPIPrefix+"/invocation/next", rt.handleNext).Methods(http.MethodGet)
+	router.HandleFunc(runtimeAPIPrefix+"/invocation/{requestId}/response", rt.handleResponse).Methods(http.MethodPost)
+	router.HandleFunc(runtimeAPIPrefix+"/invocation/{requestId}/error", rt.handleError).Methods(http.MethodPost)
+	router.HandleFunc(runtimeAPIPrefix+"/init/error", rt.handleInitError).Methods(http.MethodPost)
+
+	rt.server = &http.Server{Handler: router}
+	go rt.server.Serve(listener)
+
+	cmd := exec.Command(bootstrapPath)
+	cmd.Dir = filepath.Dir(bootstrapPath)
+	cmd.Env = providedRuntimeEnvironment(name, bootstrapPath, listener.Addr().String(), envVars)
+
+	process, err := startRuntimeProcess(name, cmd)
+	if err != nil {
+		rt.server.Close()
+		return nil, err
+	}
+
+	rt.process = process
+	return rt, nil
+}
+
+// providedRuntimeEnvironment is the environment a bootstrap starts with. Unlike
+// the Node.js and Python runtimes it is fixed for the life of the process, as
+// it is in Lambda.
+func providedRuntimeEnvironment(name string, bootstrapPath string, runtimeAPI string, envVars map[string]string) []string {
+	environment := make(map[string]string, len(envVars)+8)
+
+	for key, value := range envVars {
+		environment[key] = value
+	}
+
+	environment["AWS_LAMBDA_RUNTIME_API"] = runtimeAPI
+	environment["AWS_LAMBDA_FUNCTION_NAME"] = name
+	environment["AWS_LAMBDA_FUNCTION_VERSION"] = "$LATEST"
+	environment["AWS_LAMBDA_FUNCTION_MEMORY_SIZE"] = "128"
+	environment["AWS_LAMBDA_LOG_GROUP_NAME"] = "/aws/lambda/" + name
+	environment["AWS_LAMBDA_LOG_STREAM_NAME"] = "local-stream"
+	environment["LAMBDA_TASK_ROOT"] = filepath.Dir(bootstrapPath)
+	environment["_HANDLER"] = filepath.Base(bootstrapPath)
+
+	if _, ok := environment["AWS_REGION"]; !ok {
+		environment["AWS_REGION"] = "eu-west-1"
+	}
+
+	pairs := make([]string, 0, len(environment))
+	for key, value := range environment {
+		pairs = append(pairs, key+"="+value)
+	}
+
+	return pairs
+}
+
+// Execute hands the invocation to the bootstrap's next poll and waits for it to
+// post a response or an error. A bootstrap that runs past the timeout is killed
+// and started again for the next invocation, as Lambda does.
+func (rt *providedRuntime) Execute(code string, logs io.Writer) (*handlerResult, error) {
+	rt.executeMutex.Lock()
+	defer rt.executeMutex.Unlock()
+
+	rt.process.setLogs(logs)
+	defer rt.process.setLogs(nil)
+
+	if rt.Exited() {
+		return nil, errRuntimeProcessExited
+	}
+
+	var invocation providedInvocation
+	if err := json.Unmarshal([]byte(code), &invocation); err != nil {
+		return nil, fmt.Errorf("could not read invocation for handler %q: %w", rt.name, err)
+	}
+
+	timeout := time.Duration(invocation.Timeout) * time.Second
+	pending := &runtimeInvocation{
+		requestID: uuid.New().String(),
+		event:     invocation.Event,
+		deadline:  time.Now().Add(timeout),
+		result:    make(chan HandlerOutput, 1),
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case rt.invocations <- pending:
+	case <-rt.process.exited:
+		return nil, errRuntimeProcessExited
+	case <-timer.C:
+		rt.Close()
+		return newTimeoutResult(), nil
+	}
+
+	select {
+	case output := <-pending.result:
+		return output.handlerResult, output.err
+	case <-rt.process.exited:
+		select {
+		case output := <-pending.result:
+			return output.handlerResult, output.err
+		default:
+			return nil, errRuntimeProcessExited
+		}
+	case <-timer.C:
+		rt.Close()
+		return newTimeoutResult(), nil
+	}
+}
+
+func (rt *providedRuntime) Exited() bool {
+	return rt.process.Exited()
+}
+
+func (rt *providedRuntime) Close() {
+	rt.process.Close()
+	rt.server.Close()
+}
+
+func (rt *providedRuntime) handleNext(w http.ResponseWriter, r *http.Request) {
+	select {
+	case invocation := <-rt.invocations:
+		rt.pendingMutex.Lock()
+		rt.pending = invocation
+		rt.pendingMutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Lambda-Runtime-Aws-Request-Id", invocation.requestID)
+		w.Header().Set("Lambda-Runtime-Deadline-Ms", strconv.FormatInt(invocation.deadline.UnixMilli(), 10))
+		w.Header().Set("Lambda-Runtime-Invoked-Function-Arn", lambdaFunctionArn(rt.name))
+		w.WriteHeader(http.StatusOK)
+		w.Write(invocation.event)
+	case <-r.Context().Done():
+	}
+}
+
+func (rt *providedRuntime) handleResponse(w http.ResponseWriter, r *http.Request) {
+	invocation, ok := rt.takePending(mux.Vars(r)["requestId"])
+	if !ok {
+		writeRuntimeAPIError(w, http.StatusBadRequest, "InvalidRequestID", "Invalid request ID")
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	invocation.result <- HandlerOutput{handlerResult: parseRuntimeResponse(body)}
+
+	writeRuntimeAPIAccepted(w)
+}
+
+func (rt *providedRuntime) handleError(w http.ResponseWriter, r *http.Request) {
+	invocation, ok := rt.takePending(mux.Vars(r)["requestId"])
+	if !ok {
+		writeRuntimeAPIError(w, http.StatusBadRequest, "InvalidRequestID", "Invalid request ID")
+		return
+	}
+
+	runtimeError := readRuntimeError(r)
+	rt.printRuntimeError(runtimeError)
+	invocation.result <- HandlerOutput{handlerResult: newHandlerErrorResult(runtimeError)}
+
+	writeRuntimeAPIAccepted(w)
+}
+
+// handleInitError reports a bootstrap that failed to start. The bootstrap is
+// expected to exit afterwards, which fails the invocation that is waiting.
+func (rt *providedRuntime) handleInitError(w http.ResponseWriter, r *http.Request) {
+	rt.printRuntimeError(readRuntimeError(r))
+	writeRuntimeAPIAccepted(w)
+}
+
+func (rt *providedRuntime) takePending(requestID string) (*runtimeInvocation, bool) {
+	rt.pendingMutex.Lock()
+	defer rt.pendingMutex.Unlock()
+
+	if rt.pending == nil || rt.pending.requestID != requestID {
+		return nil, false
+	}
+
+	invocation := rt.pending
+	rt.pending = nil
+
+	return invocation, true
+}
+
+// parseRuntimeResponse reads the payload a bootstrap posted. A payload that
+// is not JSON is kept as a string.
+func parseRuntimeResponse(body []byte) *handlerResult {
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+
+	return newHandlerResult(body)
+}
+
+func readRuntimeError(r *http.Request) runtimeErrorResponse {
+	runtimeError := runtimeErrorResponse{
+		ErrorType: r.Header.Get("Lambda-Runtime-Function-Error-Type"),
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	json.Unmarshal(body, &runtimeError)
+
+	if runtimeError.ErrorType == "" {
+		runtimeError.ErrorType = "Unhandled"
+	}
+
+	return runtimeError
+}
+
+func (rt *providedRuntime) printRuntimeError(runtimeError runtimeErrorResponse) {
+	errorColour := color.New(color.FgHiRed).SprintFunc()
+	lines := append([]string{fmt.Sprintf("%s: %s", runtimeError.ErrorType, runtimeError.ErrorMessage)}, runtimeError.StackTrace...)
+
+	for _, line := range lines {
+		fmt.Fprintln(handlerLogOutput, errorColour(line))
+		rt.process.copyLog(line + "\n")
+	}
+}
+
+func writeRuntimeAPIAccepted(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"status":"OK"}`))
+}
+
+func writeRuntimeAPIError(w http.ResponseWriter, statusCode int, errorType string, errorMessage string) {
+	body, _ := json.Marshal(runtimeErrorResponse{
+		ErrorMessage: errorMessage,
+		ErrorType:    errorType,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// bootstrapInputFiles checks that a bootstrap can be run. It is the only file
+// that needs watching, because it is already a complete build.
+func bootstrapInputFiles(source string) ([]string, error) {
+	fileInfo, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if fileInfo.Mode()&0o111 == 0 {
+		return nil, errors.New("the bootstrap is not executable")
+	}
+
+	return []string{source}, nil
+}
+
+func generateProvidedInvocation(handler *HandlerInstance, eventInputJSON string) string {
+	invocationJSON, _ := json.Marshal(providedInvocation{
+		Event:   json.RawMessage(eventInputJSON),
+		Timeout: handler.handlerConfig.Timeout,
+	})
+
+	return string(invocationJSON)
+}
@@ -0,0 +1,134 @@
+package offline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+// TestProvidedRuntimeHelperBootstrap is not a real test. It is run as the
+// bootstrap of the provided runtime tests, polling the Runtime API like a Go or
+// Rust Lambda would.
+func TestProvidedRuntimeHelperBootstrap(t *testing.T) {
+	if os.Getenv("TERRABLE_TEST_BOOTSTRAP") != "1" {
+		t.Skip("only runs as a bootstrap for the provided runtime tests")
+	}
+
+	runtimeAPI := "http://" + os.Getenv("AWS_LAMBDA_RUNTIME_API") + runtimeAPIPrefix
+
+	for {
+		response, err := http.Get(runtimeAPI + "/invocation/next")
+		if err != nil {
+			os.Exit(1)
+		}
+
+		requestID := response.Header.Get("Lambda-Runtime-Aws-Request-Id")
+
+		var event map[string]string
+		json.NewDecoder(response.Body).Decode(&event)
+		response.Body.Close()
+
+		switch event["action"] {
+		case "fail":
+			errorBody, _ := json.Marshal(runtimeErrorResponse{ErrorMessage: "bootstrap failed", ErrorType: "BootstrapError"})
+			http.Post(runtimeAPI+"/invocation/"+requestID+"/error", "application/json", bytes.NewReader(errorBody))
+		case "hang":
+			time.Sleep(time.Minute)
+		default:
+			result, _ := json.Marshal(handlerResult{
+				StatusCode: http.StatusCreated,
+				Body:       fmt.Sprintf("%s from %s", event["message"], os.Getenv("AWS_LAMBDA_FUNCTION_NAME")),
+			})
+			http.Post(runtimeAPI+"/invocation/"+requestID+"/response", "application/json", bytes.NewReader(result))
+		}
+	}
+}
+
+func TestProvidedRuntimeInvocations(t *testing.T) {
+	testBinary, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to find test binary: %v", err)
+	}
+
+	bootstrapPath := writeHandlerSource(t, t.TempDir(), "bootstrap", fmt.Sprintf("#!/bin/sh\nexec %q -test.run=TestProvidedRuntimeHelperBootstrap\n", testBinary))
+	if err := os.Chmod(bootstrapPath, 0o755); err != nil {
+		t.Fatalf("failed to make bootstrap executable: %v", err)
+	}
+
+	rt, err := startProvidedRuntime("BootstrapHandler", bootstrapPath, map[string]string{"TERRABLE_TEST_BOOTSTRAP": "1"})
+	if err != nil {
+		t.Fatalf("failed to start provided runtime: %v", err)
+	}
+	defer rt.Close()
+
+	invoke := func(rt *providedRuntime, event string, timeout int) *handlerResult {
+		t.Helper()
+
+		code := generateProvidedInvocation(&HandlerInstance{handlerConfig: config.HandlerMapping{Timeout: timeout}}, event)
+		result, err := rt.Execute(code, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return result
+	}
+
+	result := invoke(rt, `{"message":"hello"}`, 5)
+	if result.StatusCode != http.StatusCreated || result.Body != "hello from BootstrapHandler" {
+		t.Errorf("unexpected response: %+v", result)
+	}
+
+	result = invoke(rt, `{"action":"fail"}`, 5)
+	if result.Error == nil || result.Error.ErrorType != "BootstrapError" || result.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected the posted error to become a 500, got %+v", result)
+	}
+
+	result = invoke(rt, `{"action":"hang"}`, 1)
+	if !result.TimedOut || result.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("expected a timed out invocation to return 504, got %+v", result)
+	}
+
+	if !rt.Exited() {
+		t.Errorf("expected a timed out bootstrap to be stopped")
+	}
+}
+
+func TestParseRuntimeResponse(t *testing.T) {
+	result := parseRuntimeResponse([]byte(`{"statusCode":404,"headers":{"X-Test":"yes"},"body":"missing"}`))
+	if result.StatusCode != http.StatusNotFound || result.Headers["X-Test"] != "yes" || result.Body != "missing" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	result = parseRuntimeResponse([]byte(`"plain string"`))
+	if result.StatusCode != http.StatusOK || result.Body != "" {
+		t.Errorf("expected non proxy responses to become an empty 200, got %+v", result)
+	}
+}
+
+func TestBootstrapInputFilesRequiresExecutable(t *testing.T) {
+	bootstrapPath := writeHandlerSource(t, t.TempDir(), "bootstrap", "#!/bin/sh\n")
+
+	if _, err := bootstrapInputFiles(bootstrapPath); err == nil {
+		t.Fatal("expected a bootstrap without execute permission to be rejected")
+	}
+
+	if err := os.Chmod(bootstrapPath, 0o755); err != nil {
+		t.Fatalf("failed to make bootstrap executable: %v", err)
+	}
+
+	inputFiles, err := bootstrapInputFiles(bootstrapPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(inputFiles) != 1 || inputFiles[0] != filepath.Clean(bootstrapPath) {
+		t.Errorf("expected only the bootstrap to be watched, got %v", inputFiles)
+	}
+}
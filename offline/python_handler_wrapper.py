@@ -0,0 +1,122 @@
+import importlib.util
+import json
+import os
+import sys
+import threading
+import time
+import traceback
+
+RESULT_START = "TERRABLE_RESULT_START:"
+RESULT_END = ":TERRABLE_RESULT_END"
+RUNTIME_EXITING = "TERRABLE_RUNTIME_EXITING"
+
+loaded_handlers = {}
+
+
+class LambdaContext:
+    def __init__(self, timeout_seconds):
+        self.function_name = "local-function"
+        self.function_version = "$LATEST"
+        self.invoked_function_arn = "local:lambda"
+        self.memory_limit_in_mb = "128"
+        self.aws_request_id = "local-%d" % int(time.time() * 1000)
+        self.log_group_name = "local-group"
+        self.log_stream_name = "local-stream"
+        self._end_time = time.time() + timeout_seconds
+
+    def get_remaining_time_in_millis(self):
+        return max(int((self._end_time - time.time()) * 1000), 0)
+
+
+def report(result):
+    sys.stdout.write(RESULT_START + json.dumps(result, default=str) + RESULT_END + "\n")
+    sys.stdout.flush()
+
+
+def unload_modules(root):
+    # Modules imported from the handler's directory are dropped so that a
+    # rebuilt handler picks up changes to everything it imports.
+    for name, module in list(sys.modules.items()):
+        module_file = getattr(module, "__file__", None)
+        if module_file and os.path.abspath(module_file).startswith(root + os.sep):
+            del sys.modules[name]
+
+
+def load_handler(path, version):
+    cached = loaded_handlers.get(path)
+    if cached and cached[0] == version:
+        return cached[1]
+
+    root = os.path.dirname(os.path.abspath(path))
+    unload_modules(root)
+
+    if root not in sys.path:
+        sys.path.insert(0, root)
+
+    module_name = os.path.splitext(os.path.basename(path))[0]
+    spec = importlib.util.spec_from_file_location(module_name, path)
+    module = importlib.util.module_from_spec(spec)
+    sys.modules[module_name] = module
+    spec.loader.exec_module(module)
+
+    function = getattr(module, "handler", None) or getattr(module, "lambda_handler", None)
+    if function is None:
+        raise AttributeError("%s does not define a 'handler' or 'lambda_handler' function" % path)
+
+    loaded_handlers[path] = (version, function)
+    return function
+
+
+def error_outcome(error):
+    return {
+        "error": {
+            "errorMessage": str(error),
+            "errorType": type(error).__name__,
+            "stackTrace": [
+                line.rstrip("\n") for line in traceback.format_exception(type(error), error, error.__traceback__)
+            ],
+        },
+    }
+
+
+def invoke(invocation):
+    os.environ.clear()
+    os.environ.update(invocation["env"])
+
+    outcome = {}
+
+    def run():
+        try:
+            function = load_handler(invocation["handlerPath"], invocation["version"])
+            outcome["result"] = function(invocation["event"], LambdaContext(invocation["timeout"]))
+        except BaseException as error:
+            traceback.print_exc()
+            outcome["error"] = error
+
+    worker = threading.Thread(target=run, daemon=True)
+    worker.start()
+    worker.join(invocation["timeout"])
+
+    if worker.is_alive():
+        # A Python thread cannot be stopped, so the whole runtime is discarded
+        # and started again for the next invocation, as Lambda does.
+        sys.stdout.write(RUNTIME_EXITING + "\n")
+        report({"timedOut": True})
+        os._exit(0)
+
+    if "error" in outcome:
+        report(error_outcome(outcome["error"]))
+        return
+
+    report({"result": outcome.get("result")})
+
+
+for line in sys.stdin:
+    if not line.strip():
+        continue
+
+    try:
+        invoke(json.loads(line))
+    except Exception as error:
+        traceback.print_exc()
+        report(error_outcome(error))
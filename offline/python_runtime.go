@@ -0,0 +1,93 @@
+package offline
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+const defaultPythonInterpreter = "python3"
+
+var usableInterpreters sync.Map
+
+// pythonInterpreter prefers the interpreter matching the configured runtime,
+// such as python3.12, and falls back to python3 when it isn't installed.
+func pythonInterpreter(handlerConfig config.HandlerMapping) string {
+	if strings.HasPrefix(handlerConfig.Runtime, "python3.") && isUsableInterpreter(handlerConfig.Runtime) {
+		return handlerConfig.Runtime
+	}
+
+	return defaultPythonInterpreter
+}
+
+// isUsableInterpreter runs the interpreter rather than only looking it up,
+// because version manager shims exist on the PATH for versions that are not
+// actually installed.
+func isUsableInterpreter(name string) bool {
+	if usable, ok := usableInterpreters.Load(name); ok {
+		return usable.(bool)
+	}
+
+	usable := exec.Command(name, "--version").Run() == nil
+	usableInterpreters.Store(name, usable)
+
+	return usable
+}
+
+// pythonInputFiles lists the Python files next to and below the handler, which
+// are the modules it can import without packaging. Hidden directories, caches
+// and virtual environments are skipped.
+func pythonInputFiles(source string) ([]string, error) {
+	var inputFiles []string
+	root := filepath.Dir(source)
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if path != root && isIgnoredPythonDirectory(path, entry.Name()) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if filepath.Ext(path) == ".py" {
+			inputFiles = append(inputFiles, path)
+		}
+
+		return nil
+	})
+
+	return inputFiles, err
+}
+
+func isIgnoredPythonDirectory(path string, name string) bool {
+	if strings.HasPrefix(name, ".") || name == "__pycache__" || name == "node_modules" || name == "site-packages" {
+		return true
+	}
+
+	_, err := os.Stat(filepath.Join(path, "pyvenv.cfg"))
+	return err == nil
+}
+
+func generatePythonInvocation(envVars string, handler *HandlerInstance, eventInputJSON string) string {
+	invocation := map[string]interface{}{
+		"env":         json.RawMessage(envVars),
+		"handlerPath": handler.GetExecutionPath(),
+		"version":     handler.GetBuildVersion(),
+		"event":       json.RawMessage(eventInputJSON),
+		"timeout":     handler.handlerConfig.Timeout,
+	}
+
+	invocationJSON, _ := json.Marshal(invocation)
+	return string(invocationJSON)
+}
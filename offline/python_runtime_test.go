@@ -0,0 +1,78 @@
+package offline
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestPythonInputFilesSkipsCachesAndVirtualEnvironments(t *testing.T) {
+	dir := t.TempDir()
+
+	writeHandlerSource(t, dir, "handler.py", "def handler(event, context):\n    pass\n")
+	writeHandlerSource(t, dir, "lib/helpers.py", "")
+	writeHandlerSource(t, dir, "lib/__pycache__/helpers.cpython-312.py", "")
+	writeHandlerSource(t, dir, ".venv/lib/site.py", "")
+	writeHandlerSource(t, dir, "env/pyvenv.cfg", "")
+	writeHandlerSource(t, dir, "env/lib/site.py", "")
+	writeHandlerSource(t, dir, "README.md", "")
+
+	inputFiles, err := pythonInputFiles(filepath.Join(dir, "handler.py"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sort.Strings(inputFiles)
+	expected := []string{
+		filepath.Join(dir, "handler.py"),
+		filepath.Join(dir, "lib", "helpers.py"),
+	}
+
+	if len(inputFiles) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, inputFiles)
+	}
+
+	for i := range expected {
+		if inputFiles[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, inputFiles)
+		}
+	}
+}
+
+func TestCompileHandlerPreparesPythonHandlers(t *testing.T) {
+	dir := t.TempDir()
+	writeHandlerSource(t, dir, "handler.py", "def handler(event, context):\n    pass\n")
+
+	handlerInstance := &HandlerInstance{
+		handlerConfig: config.HandlerMapping{
+			Name:   "PythonHandler",
+			Source: filepath.Join(dir, "handler.py"),
+		},
+	}
+	defer handlerInstance.Close()
+
+	if _, err := handlerInstance.CompileHandler(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if handlerInstance.GetExecutionPath() != filepath.Join(dir, "handler.py") {
+		t.Errorf("expected Python handlers to run from their source, got %s", handlerInstance.GetExecutionPath())
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, buildOutputDirectoryName)); !os.IsNotExist(err) {
+		t.Errorf("expected no build output for Python handlers")
+	}
+
+	firstVersion := handlerInstance.GetBuildVersion()
+
+	if _, err := handlerInstance.CompileHandler(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if handlerInstance.GetBuildVersion() == firstVersion {
+		t.Errorf("expected recompiling to bump the build version so the worker reloads modules")
+	}
+}
@@ -0,0 +1,224 @@
+package offline
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fatih/color"
+)
+
+// runtimeProcess is a dedicated language runtime owned by a single
+// HandlerInstance. Each handler gets its own process so that globals,
+// environment variables and the module cache are never shared between
+// handlers, mirroring Lambda's sandbox model.
+type runtimeProcess struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	results chan HandlerOutput
+	exited  chan struct{}
+	exiting atomic.Bool
+	mutex   sync.Mutex
+
+	// logs receives a plain copy of what the handler logs during the current
+	// invocation, for callers that return logs with the result.
+	logsMutex sync.Mutex
+	logs      io.Writer
+}
+
+//go:embed node_handler_wrapper.js
+var NODE_HANDLER_WRAPPER string
+
+//go:embed python_handler_wrapper.py
+var PYTHON_HANDLER_WRAPPER string
+
+// runtimeExitingMarker is written by a runtime before it reports its final
+// result and exits, so that the next invocation starts a new process instead
+// of racing the old one's exit.
+const runtimeExitingMarker = "TERRABLE_RUNTIME_EXITING"
+
+// handlerLogOutput receives everything handlers log. One-shot invocations send
+// it to stderr so that stdout only carries the handler's result.
+var handlerLogOutput io.Writer = os.Stdout
+
+var errRuntimeProcessExited = errors.New("handler process exited unexpectedly")
+
+func startNodeProcess(name string, debugPort int) (*runtimeProcess, error) {
+	cmd := exec.Command("node", fmt.Sprintf("--inspect=%d", debugPort), "-e", NODE_HANDLER_WRAPPER)
+	cmd.Env = []string{}
+
+	return startRuntimeProcess(name, cmd)
+}
+
+func startPythonProcess(name string, interpreter string) (*runtimeProcess, error) {
+	// -u keeps print() output unbuffered so that logs appear as they happen.
+	cmd := exec.Command(interpreter, "-u", "-c", PYTHON_HANDLER_WRAPPER)
+	// Interpreter shims such as pyenv's need the environment to find the real
+	// interpreter. The wrapper replaces it with the handler's own on every
+	// invocation, so handlers never see anything else.
+	cmd.Env = os.Environ()
+
+	return startRuntimeProcess(name, cmd)
+}
+
+func startRuntimeProcess(name string, cmd *exec.Cmd) (*runtimeProcess, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("could not start %s process for handler %q: %w", cmd.Path, name, err)
+	}
+
+	rp := &runtimeProcess{
+		name:    name,
+		cmd:     cmd,
+		stdin:   stdin,
+		results: make(chan HandlerOutput, 1),
+		exited:  make(chan struct{}),
+	}
+
+	var streams sync.WaitGroup
+	streams.Add(2)
+
+	go func() {
+		defer streams.Done()
+		rp.processOutputStream(stdout)
+	}()
+
+	go func() {
+		defer streams.Done()
+		rp.processErrorStream(stderr)
+	}()
+
+	go func() {
+		streams.Wait()
+		cmd.Wait()
+		close(rp.exited)
+	}()
+
+	return rp, nil
+}
+
+// Execute sends code to the process and waits for the handler result it reports.
+func (rp *runtimeProcess) Execute(code string, logs io.Writer) (*handlerResult, error) {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+
+	rp.setLogs(logs)
+	defer rp.setLogs(nil)
+
+	if rp.Exited() {
+		return nil, errRuntimeProcessExited
+	}
+
+	_, err := rp.stdin.Write([]byte(code + "\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case output := <-rp.results:
+		return output.handlerResult, output.err
+	case <-rp.exited:
+		// A process may report its result and exit straight away, as the Python
+		// runtime does after a timeout, so prefer a result that is already waiting.
+		select {
+		case output := <-rp.results:
+			return output.handlerResult, output.err
+		default:
+			return nil, errRuntimeProcessExited
+		}
+	}
+}
+
+// Exited reports whether the process has exited or announced that it is about to.
+func (rp *runtimeProcess) Exited() bool {
+	if rp.exiting.Load() {
+		return true
+	}
+
+	select {
+	case <-rp.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+func (rp *runtimeProcess) processOutputStream(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+
+	for {
+		line, err := reader.ReadString('\n')
+
+		if strings.HasPrefix(line, runtimeExitingMarker) {
+			rp.exiting.Store(true)
+		} else if strings.HasPrefix(line, "TERRABLE_RESULT_START") {
+			extractedResult, extractErr := extractResult(line)
+			rp.results <- HandlerOutput{
+				handlerResult: extractedResult,
+				err:           extractErr,
+			}
+		} else if line != "" && !strings.HasPrefix(line, "CODE_EXECUTION_COMPLETE") {
+			fmt.Fprint(handlerLogOutput, line)
+			rp.copyLog(line)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (rp *runtimeProcess) processErrorStream(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	errorColour := color.New(color.FgHiRed).SprintFunc()
+
+	for scanner.Scan() {
+		fmt.Fprintln(handlerLogOutput, errorColour(scanner.Text()))
+		rp.copyLog(scanner.Text() + "\n")
+	}
+}
+
+func (rp *runtimeProcess) setLogs(logs io.Writer) {
+	rp.logsMutex.Lock()
+	rp.logs = logs
+	rp.logsMutex.Unlock()
+}
+
+// copyLog writes a line the handler logged to the logs of the current
+// invocation, if they are wanted.
+func (rp *runtimeProcess) copyLog(line string) {
+	rp.logsMutex.Lock()
+	defer rp.logsMutex.Unlock()
+
+	if rp.logs != nil {
+		io.WriteString(rp.logs, line)
+	}
+}
+
+func (rp *runtimeProcess) Close() {
+	rp.cmd.Process.Kill()
+	<-rp.exited
+}
@@ -0,0 +1,405 @@
+package offline
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/fsnotify/fsnotify"
+	"github.com/terrable-dev/terrable/config"
+)
+
+const s3WatcherDebounce = 100 * time.Millisecond
+
+// s3Object is a file in the directory that stands in for a bucket.
+type s3Object struct {
+	Size int64
+	ETag string
+}
+
+// s3Notification sends the object changes of a bucket that match its
+// configuration to a handler.
+type s3Notification struct {
+	handler *HandlerInstance
+	config  config.S3Config
+}
+
+// matches reports whether an object change, named like ObjectCreated:Put, is
+// one of the configured event types and its key passes the filters.
+func (notification s3Notification) matches(eventName string, key string) bool {
+	if !strings.HasPrefix(key, notification.config.FilterPrefix) || !strings.HasSuffix(key, notification.config.FilterSuffix) {
+		return false
+	}
+
+	for _, event := range notification.config.Events {
+		event = strings.TrimPrefix(event, "s3:")
+
+		if event == eventName || (strings.HasSuffix(event, ":*") && strings.HasPrefix(eventName, strings.TrimSuffix(event, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// s3Bucket watches the local directory of a bucket and notifies handlers when
+// files are created or removed in it. Each file is an object keyed by its path
+// relative to the directory. Changes are debounced so that a file is notified
+// once it has been written rather than on every write.
+type s3Bucket struct {
+	name      string
+	directory string
+	watcher   *fsnotify.Watcher
+	debounce  time.Duration
+	execute   func(handler *HandlerInstance, record map[string]interface{}) HandlerOutput
+
+	mutex         sync.Mutex
+	notifications []s3Notification
+	objects       map[string]s3Object
+	pending       map[string]struct{}
+	timer         *time.Timer
+	sequence      int64
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newS3Bucket(name string, directory string, async *asyncQueue) *s3Bucket {
+	return &s3Bucket{
+		name:      name,
+		directory: directory,
+		debounce:  s3WatcherDebounce,
+		execute: func(handler *HandlerInstance, record map[string]interface{}) HandlerOutput {
+			return async.invokeEvent(handler, newS3Event(record))
+		},
+		objects: make(map[string]s3Object),
+		pending: make(map[string]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// start creates the directory of the bucket if it doesn't exist, records the
+// files already in it so that only later changes are notified, and begins
+// watching it.
+func (bucket *s3Bucket) start() error {
+	if err := os.MkdirAll(bucket.directory, 0o755); err != nil {
+		return fmt.Errorf("error creating the directory of bucket %s: %w", bucket.name, err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error watching the directory of bucket %s: %w", bucket.name, err)
+	}
+
+	bucket.watcher = watcher
+
+	if err := bucket.watchDirectory(bucket.directory, false); err != nil {
+		watcher.Close()
+		bucket.watcher = nil
+		return fmt.Errorf("error watching the directory of bucket %s: %w", bucket.name, err)
+	}
+
+	go bucket.processEvents()
+
+	return nil
+}
+
+// setNotifications replaces the handlers the bucket notifies.
+func (bucket *s3Bucket) setNotifications(notifications []s3Notification) {
+	bucket.mutex.Lock()
+	bucket.notifications = notifications
+	bucket.mutex.Unlock()
+}
+
+// Close stops watching the directory. Notifications that are already being
+// delivered finish.
+func (bucket *s3Bucket) Close() {
+	bucket.closeOnce.Do(func() {
+		close(bucket.done)
+
+		if bucket.watcher != nil {
+			bucket.watcher.Close()
+		}
+
+		bucket.mutex.Lock()
+		if bucket.timer != nil {
+			bucket.timer.Stop()
+		}
+		bucket.mutex.Unlock()
+	})
+}
+
+// watchDirectory watches dir and every directory below it, as fsnotify does
+// not watch recursively. The files found are recorded as objects, or marked
+// as changed when the directory appeared after the bucket started.
+func (bucket *s3Bucket) watchDirectory(dir string, changed bool) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return bucket.watcher.Add(path)
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		key, ok := bucket.key(path)
+		if !ok {
+			return nil
+		}
+
+		bucket.mutex.Lock()
+		defer bucket.mutex.Unlock()
+
+		if changed {
+			bucket.pending[key] = struct{}{}
+		} else if object, err := readS3Object(path); err == nil {
+			bucket.objects[key] = object
+		}
+
+		return nil
+	})
+}
+
+// key returns the object key of a path in the bucket directory.
+func (bucket *s3Bucket) key(path string) (string, bool) {
+	relativePath, err := filepath.Rel(bucket.directory, path)
+	if err != nil || relativePath == "." || strings.HasPrefix(relativePath, "..") {
+		return "", false
+	}
+
+	return filepath.ToSlash(relativePath), true
+}
+
+func (bucket *s3Bucket) processEvents() {
+	for {
+		select {
+		case <-bucket.done:
+			return
+		case event, ok := <-bucket.watcher.Events:
+			if !ok {
+				return
+			}
+
+			bucket.handleEvent(event)
+		case err, ok := <-bucket.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			fmt.Println(fmt.Errorf("error watching the directory of bucket %s: %w", bucket.name, err))
+		}
+	}
+}
+
+func (bucket *s3Bucket) handleEvent(event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+
+	key, ok := bucket.key(event.Name)
+	if !ok {
+		return
+	}
+
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := bucket.watchDirectory(event.Name, true); err != nil {
+				fmt.Println(fmt.Errorf("error watching the directory of bucket %s: %w", bucket.name, err))
+			}
+
+			bucket.scheduleFlush()
+			return
+		}
+	}
+
+	bucket.mutex.Lock()
+	bucket.pending[key] = struct{}{}
+
+	// A removed or renamed directory takes every object below it with it.
+	for objectKey := range bucket.objects {
+		if strings.HasPrefix(objectKey, key+"/") {
+			bucket.pending[objectKey] = struct{}{}
+		}
+	}
+	bucket.mutex.Unlock()
+
+	bucket.scheduleFlush()
+}
+
+func (bucket *s3Bucket) scheduleFlush() {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	if bucket.timer != nil {
+		bucket.timer.Stop()
+	}
+
+	bucket.timer = time.AfterFunc(bucket.debounce, bucket.flush)
+}
+
+// flush works out what happened to each changed key: a file that exists was
+// created or overwritten, and a known object that no longer exists was
+// removed. Every change is then delivered to the matching handlers in key
+// order.
+func (bucket *s3Bucket) flush() {
+	bucket.mutex.Lock()
+
+	keys := make([]string, 0, len(bucket.pending))
+	for key := range bucket.pending {
+		keys = append(keys, key)
+	}
+
+	bucket.pending = make(map[string]struct{})
+	sort.Strings(keys)
+
+	var records []s3EventRecord
+
+	for _, key := range keys {
+		path := filepath.Join(bucket.directory, filepath.FromSlash(key))
+		record := s3EventRecord{Bucket: bucket.name, Key: key, Time: time.Now()}
+
+		info, err := os.Stat(path)
+		_, known := bucket.objects[key]
+
+		switch {
+		case err == nil && info.Mode().IsRegular():
+			object, err := readS3Object(path)
+			if err != nil {
+				continue
+			}
+
+			bucket.objects[key] = object
+			record.EventName = "ObjectCreated:Put"
+			record.Size = object.Size
+			record.ETag = object.ETag
+		case os.IsNotExist(err) && known:
+			delete(bucket.objects, key)
+			record.EventName = "ObjectRemoved:Delete"
+		default:
+			continue
+		}
+
+		bucket.sequence++
+		record.Sequencer = fmt.Sprintf("%016X", bucket.sequence)
+		records = append(records, record)
+	}
+
+	notifications := bucket.notifications
+	bucket.mutex.Unlock()
+
+	for _, record := range records {
+		bucket.deliver(record, notifications)
+	}
+}
+
+func (bucket *s3Bucket) deliver(record s3EventRecord, notifications []s3Notification) {
+	var matched []s3Notification
+	for _, notification := range notifications {
+		if notification.matches(record.EventName, record.Key) {
+			matched = append(matched, notification)
+		}
+	}
+
+	printMatches(fmt.Sprintf("S3 %s %s/%s", record.EventName, record.Bucket, record.Key), matched, func(notification s3Notification) string {
+		return notification.handler.handlerConfig.Name
+	}, "no handlers")
+
+	for _, notification := range matched {
+		name := notification.handler.handlerConfig.Name
+		record.ConfigurationID = name
+
+		start := time.Now()
+
+		output := bucket.execute(notification.handler, newS3Record(record))
+		if output.err != nil {
+			fmt.Println(output.err)
+		}
+
+		if failure := invocationFailure(output); failure != "" {
+			color.New(color.FgHiYellow).Printf("S3 event %s %s failed in %s (%s) after %dms\n\n", record.EventName, record.Key, name, failure, time.Since(start).Milliseconds())
+		} else {
+			color.New(color.FgHiGreen).Printf("S3 event %s %s delivered to %s in %dms\n\n", record.EventName, record.Key, name, time.Since(start).Milliseconds())
+		}
+	}
+}
+
+// readS3Object reads the size of a file and its ETag, which for objects that
+// were not uploaded in parts is the MD5 digest of their content.
+func readS3Object(path string) (s3Object, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return s3Object{}, err
+	}
+
+	defer file.Close()
+
+	hash := md5.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return s3Object{}, err
+	}
+
+	return s3Object{Size: size, ETag: fmt.Sprintf("%x", hash.Sum(nil))}, nil
+}
+
+// syncS3Buckets watches the directory of every bucket that notifies a handler,
+// keeping the watch on buckets whose directory is unchanged so that the
+// objects already seen are not notified again, and stops watching buckets
+// that no longer notify any handler.
+func syncS3Buckets(buckets map[string]*s3Bucket, handlers map[string]*HandlerInstance, async *asyncQueue) {
+	notifications := make(map[string][]s3Notification)
+	directories := make(map[string]string)
+
+	for _, handler := range handlers {
+		s3Config := handler.handlerConfig.S3
+		if s3Config == nil {
+			continue
+		}
+
+		name := s3Config.BucketName()
+		notifications[name] = append(notifications[name], s3Notification{handler: handler, config: *s3Config})
+		directories[name] = s3Config.Directory
+	}
+
+	for name, bucket := range buckets {
+		if directory, ok := directories[name]; ok && directory == bucket.directory {
+			continue
+		}
+
+		bucket.Close()
+		delete(buckets, name)
+	}
+
+	for name, bucketNotifications := range notifications {
+		sort.Slice(bucketNotifications, func(i, j int) bool {
+			return bucketNotifications[i].handler.handlerConfig.Name < bucketNotifications[j].handler.handlerConfig.Name
+		})
+
+		if bucket, ok := buckets[name]; ok {
+			bucket.setNotifications(bucketNotifications)
+			continue
+		}
+
+		bucket := newS3Bucket(name, directories[name], async)
+		bucket.setNotifications(bucketNotifications)
+
+		if err := bucket.start(); err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		buckets[name] = bucket
+	}
+}
@@ -0,0 +1,204 @@
+package offline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestS3NotificationMatches(t *testing.T) {
+	notification := s3Notification{config: config.S3Config{
+		Events:       []string{"s3:ObjectCreated:*", "s3:ObjectRemoved:Delete"},
+		FilterPrefix: "images/",
+		FilterSuffix: ".jpg",
+	}}
+
+	tests := []struct {
+		eventName string
+		key       string
+		expected  bool
+	}{
+		{"ObjectCreated:Put", "images/cat.jpg", true},
+		{"ObjectRemoved:Delete", "images/cat.jpg", true},
+		{"ObjectRemoved:DeleteMarkerCreated", "images/cat.jpg", false},
+		{"ObjectCreated:Put", "documents/cat.jpg", false},
+		{"ObjectCreated:Put", "images/cat.png", false},
+	}
+
+	for _, test := range tests {
+		if matched := notification.matches(test.eventName, test.key); matched != test.expected {
+			t.Errorf("expected %s %s to match: %v, got %v", test.eventName, test.key, test.expected, matched)
+		}
+	}
+}
+
+func newTestS3Bucket(t *testing.T, directory string) *recordedInvocations[map[string]interface{}] {
+	t.Helper()
+
+	bucket := newS3Bucket("uploads", directory, nil)
+	bucket.debounce = 20 * time.Millisecond
+	bucket.setNotifications([]s3Notification{
+		{
+			handler: &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "Thumbnails"}},
+			config:  config.S3Config{Bucket: "uploads", Directory: directory, Events: []string{"s3:ObjectCreated:*"}, FilterSuffix: ".jpg"},
+		},
+		{
+			handler: &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "Cleanup"}},
+			config:  config.S3Config{Bucket: "uploads", Directory: directory, Events: []string{"s3:ObjectRemoved:*"}},
+		},
+	})
+
+	recorded := newRecordedInvocations[map[string]interface{}]()
+	bucket.execute = func(handler *HandlerInstance, record map[string]interface{}) HandlerOutput {
+		recorded.record(handler, record)
+
+		return HandlerOutput{handlerResult: &handlerResult{StatusCode: 200}}
+	}
+
+	if err := bucket.start(); err != nil {
+		t.Fatalf("failed to watch bucket: %v", err)
+	}
+
+	t.Cleanup(bucket.Close)
+
+	return recorded
+}
+
+func s3RecordObject(record map[string]interface{}) map[string]interface{} {
+	return record["s3"].(map[string]interface{})["object"].(map[string]interface{})
+}
+
+func TestS3BucketNotifiesCreatedAndRemovedFiles(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "uploads")
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	existing := filepath.Join(directory, "existing.jpg")
+	if err := os.WriteFile(existing, []byte("before"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := newTestS3Bucket(t, directory)
+
+	if err := os.MkdirAll(filepath.Join(directory, "photos"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Give the watcher a moment to start watching the new directory before
+	// writing into it.
+	time.Sleep(50 * time.Millisecond)
+
+	if err := os.WriteFile(filepath.Join(directory, "photos", "my cat.jpg"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(directory, "notes.txt"), []byte("ignored"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return len(recorded.get("Thumbnails")) == 1 })
+
+	record := recorded.get("Thumbnails")[0]
+	if record["eventName"] != "ObjectCreated:Put" || record["eventSource"] != "aws:s3" {
+		t.Errorf("unexpected record %v", record)
+	}
+
+	object := s3RecordObject(record)
+	if object["key"] != "photos/my+cat.jpg" || object["size"] != int64(5) || object["eTag"] != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("unexpected object %v", object)
+	}
+
+	if err := os.Remove(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return len(recorded.get("Cleanup")) == 1 })
+
+	removed := recorded.get("Cleanup")[0]
+	removedObject := s3RecordObject(removed)
+	if removed["eventName"] != "ObjectRemoved:Delete" || removedObject["key"] != "existing.jpg" || removedObject["eTag"] != nil {
+		t.Errorf("unexpected removal record %v", removed)
+	}
+
+	// Let any stray notifications arrive before checking none were sent.
+	time.Sleep(100 * time.Millisecond)
+
+	if len(recorded.get("Thumbnails")) != 1 || len(recorded.get("Cleanup")) != 1 {
+		t.Errorf("expected only the matching changes to be notified, got %v", recorded.events)
+	}
+}
+
+func TestS3BucketNotifiesObjectsBelowRemovedDirectories(t *testing.T) {
+	directory := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(directory, "archive"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if err := os.WriteFile(filepath.Join(directory, "archive", name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorded := newTestS3Bucket(t, directory)
+
+	if err := os.RemoveAll(filepath.Join(directory, "archive")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return len(recorded.get("Cleanup")) == 2 })
+
+	for i, key := range []string{"archive/a.jpg", "archive/b.jpg"} {
+		if object := s3RecordObject(recorded.get("Cleanup")[i]); object["key"] != key {
+			t.Errorf("expected removal %d to be %s, got %v", i, key, object)
+		}
+	}
+}
+
+func TestSyncS3BucketsKeepsUnchangedDirectories(t *testing.T) {
+	directory := t.TempDir()
+	buckets := make(map[string]*s3Bucket)
+
+	handler := func(name string, directory string) *HandlerInstance {
+		return &HandlerInstance{handlerConfig: config.HandlerMapping{Name: name, S3: &config.S3Config{Bucket: "arn:aws:s3:::uploads", Directory: directory}}}
+	}
+
+	syncS3Buckets(buckets, map[string]*HandlerInstance{"Thumbnails": handler("Thumbnails", directory)}, nil)
+	defer func() {
+		for _, bucket := range buckets {
+			bucket.Close()
+		}
+	}()
+
+	first := buckets["uploads"]
+	if first == nil {
+		t.Fatalf("expected the uploads bucket to be watched, got %v", buckets)
+	}
+
+	syncS3Buckets(buckets, map[string]*HandlerInstance{"Thumbnails": handler("Thumbnails", directory), "Cleanup": handler("Cleanup", directory)}, nil)
+
+	if buckets["uploads"] != first || len(first.notifications) != 2 || first.notifications[0].handler.handlerConfig.Name != "Cleanup" {
+		t.Errorf("expected the bucket to be kept with both notifications, got %v", first.notifications)
+	}
+
+	moved := filepath.Join(t.TempDir(), "moved")
+	syncS3Buckets(buckets, map[string]*HandlerInstance{"Thumbnails": handler("Thumbnails", moved)}, nil)
+
+	if buckets["uploads"] == first || buckets["uploads"].directory != moved {
+		t.Errorf("expected the bucket to be watched in its new directory")
+	}
+
+	if _, err := os.Stat(moved); err != nil {
+		t.Errorf("expected the new directory to be created: %v", err)
+	}
+
+	syncS3Buckets(buckets, map[string]*HandlerInstance{}, nil)
+
+	if len(buckets) != 0 {
+		t.Errorf("expected buckets without notifications to stop being watched, got %v", buckets)
+	}
+}
@@ -0,0 +1,66 @@
+package offline
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/terrable-dev/terrable/config"
+	"github.com/terrable-dev/terrable/utils"
+)
+
+// PrintSchedule lists the next count times a scheduled handler would be
+// invoked, so that schedule expressions can be checked without waiting for
+// them to fire.
+func PrintSchedule(filePath string, moduleName string, handlerName string, count int) error {
+	terrableConfig, err := utils.ParseTerraformFile(filePath, moduleName)
+	if err != nil {
+		return fmt.Errorf("could not load Terrable configuration: %w", err)
+	}
+
+	handler, err := findHandler(terrableConfig, handlerName)
+	if err != nil {
+		return err
+	}
+
+	if handler.Schedule == nil {
+		return fmt.Errorf("handler %q does not have a schedule trigger", handlerName)
+	}
+
+	if count < 1 {
+		return fmt.Errorf("--next must be at least 1")
+	}
+
+	return printUpcomingRuns(os.Stdout, handler.Name, *handler.Schedule, time.Now(), count)
+}
+
+// printUpcomingRuns writes the fire times that follow from, in the schedule's
+// time zone and in UTC. Rate schedules are counted from from, as they are when
+// offline mode starts.
+func printUpcomingRuns(w io.Writer, handlerName string, scheduleConfig config.ScheduleConfig, from time.Time, count int) error {
+	schedule, err := utils.ParseScheduleExpression(scheduleConfig.Expression, scheduleConfig.Timezone)
+	if err != nil {
+		return err
+	}
+
+	timezone := scheduleConfig.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	fmt.Fprintf(w, "%s: %s (%s)\n", handlerName, scheduleConfig.Expression, timezone)
+
+	next := from
+	for i := 1; i <= count; i++ {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			fmt.Fprintln(w, "  The schedule does not fire again.")
+			break
+		}
+
+		fmt.Fprintf(w, "  %2d. %s  (%s)\n", i, next.Format("Mon 2006-01-02 15:04 MST"), next.UTC().Format("2006-01-02 15:04 UTC"))
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package offline
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/terrable-dev/terrable/config"
+	"github.com/terrable-dev/terrable/utils"
+)
+
+// scheduledHandlerInput returns what a scheduled handler receives for event:
+// the event itself, or the constant input, the part selected by the input path
+// or the rendered input template, as EventBridge delivers to its targets.
+func scheduledHandlerInput(event map[string]interface{}, scheduleConfig config.ScheduleConfig) json.RawMessage {
+	eventJSON, _ := json.Marshal(event)
+
+	switch {
+	case scheduleConfig.Input != "":
+		return json.RawMessage(scheduleConfig.Input)
+	case scheduleConfig.InputPath != "":
+		selected, _ := selectInputPath(eventJSON, scheduleConfig.InputPath)
+		input, _ := json.Marshal(selected)
+		return input
+	case scheduleConfig.InputTransformer != nil:
+		return transformInput(eventJSON, *scheduleConfig.InputTransformer)
+	default:
+		return eventJSON
+	}
+}
+
+// selectInputPath returns the part of the event the path selects, and whether
+// it exists. Paths are checked when the configuration is parsed.
+func selectInputPath(eventJSON []byte, inputPath string) (interface{}, bool) {
+	var decoded interface{}
+	json.Unmarshal(eventJSON, &decoded)
+
+	path, err := utils.ParseJSONPath(inputPath)
+	if err != nil {
+		return nil, false
+	}
+
+	return path.Select(decoded)
+}
+
+// transformInput renders the input template with the values selected by the
+// input paths and the predefined aws.events variables. The result is passed on
+// as JSON when it is valid JSON, and as a JSON string otherwise.
+func transformInput(eventJSON []byte, transformer config.InputTransformerConfig) json.RawMessage {
+	var event map[string]interface{}
+	json.Unmarshal(eventJSON, &event)
+
+	values := map[string]interface{}{
+		"aws.events.event":                eventWithoutDetail(event),
+		"aws.events.event.json":           event,
+		"aws.events.event.ingestion-time": event["time"],
+	}
+
+	if resources, ok := event["resources"].([]interface{}); ok && len(resources) > 0 {
+		ruleArn, _ := resources[0].(string)
+		values["aws.events.rule-arn"] = ruleArn
+		values["aws.events.rule-name"] = ruleArn[strings.LastIndex(ruleArn, "/")+1:]
+	}
+
+	for name, inputPath := range transformer.InputPaths {
+		values[name], _ = selectInputPath(eventJSON, inputPath)
+	}
+
+	rendered := renderInputTemplate(transformer.InputTemplate, values)
+	if json.Valid([]byte(rendered)) {
+		return json.RawMessage(rendered)
+	}
+
+	input, _ := json.Marshal(rendered)
+	return input
+}
+
+func eventWithoutDetail(event map[string]interface{}) map[string]interface{} {
+	withoutDetail := make(map[string]interface{}, len(event))
+	for key, value := range event {
+		if key != "detail" {
+			withoutDetail[key] = value
+		}
+	}
+
+	return withoutDetail
+}
+
+// renderInputTemplate replaces each <name> placeholder that has a value.
+// Placeholders inside a JSON string are replaced with the value's text, escaped
+// for the string, while anywhere else the value is written as JSON. Missing
+// values are empty inside strings and null elsewhere.
+func renderInputTemplate(template string, values map[string]interface{}) string {
+	var rendered strings.Builder
+	inString := false
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+
+		switch {
+		case inString && c == '\\' && i+1 < len(template):
+			rendered.WriteString(template[i : i+2])
+			i++
+			continue
+		case c == '"':
+			inString = !inString
+		case c == '<':
+			end := strings.IndexByte(template[i:], '>')
+			if end == -1 {
+				break
+			}
+
+			value, ok := values[template[i+1:i+end]]
+			if !ok {
+				break
+			}
+
+			rendered.WriteString(renderInputValue(value, inString))
+			i += end
+			continue
+		}
+
+		rendered.WriteByte(c)
+	}
+
+	return rendered.String()
+}
+
+func renderInputValue(value interface{}, inString bool) string {
+	if !inString {
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	}
+
+	text, isString := value.(string)
+	if !isString {
+		if value == nil {
+			return ""
+		}
+
+		encoded, _ := json.Marshal(value)
+		text = string(encoded)
+	}
+
+	escaped, _ := json.Marshal(text)
+	return string(escaped[1 : len(escaped)-1])
+}
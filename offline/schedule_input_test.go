@@ -0,0 +1,117 @@
+package offline
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestScheduledHandlerInput(t *testing.T) {
+	event := map[string]interface{}{
+		"version":     "0",
+		"id":          "event-id",
+		"detail-type": "Scheduled Event",
+		"source":      "aws.events",
+		"time":        "2026-10-19T12:00:00Z",
+		"resources":   []string{"arn:aws:events:eu-west-1:000000000000:rule/Nightly-scheduled"},
+		"detail":      map[string]interface{}{},
+	}
+
+	tests := []struct {
+		name     string
+		schedule config.ScheduleConfig
+		expected string
+	}{
+		{
+			name:     "constant input",
+			schedule: config.ScheduleConfig{Input: `{"report":"daily","limit":10}`},
+			expected: `{"report":"daily","limit":10}`,
+		},
+		{
+			name:     "input path",
+			schedule: config.ScheduleConfig{InputPath: "$.resources[0]"},
+			expected: `"arn:aws:events:eu-west-1:000000000000:rule/Nightly-scheduled"`,
+		},
+		{
+			name:     "missing input path",
+			schedule: config.ScheduleConfig{InputPath: "$.detail.missing"},
+			expected: `null`,
+		},
+		{
+			name: "JSON template",
+			schedule: config.ScheduleConfig{InputTransformer: &config.InputTransformerConfig{
+				InputPaths: map[string]string{
+					"source": "$.source",
+					"detail": "$.detail",
+					"time":   "$.time",
+				},
+				InputTemplate: `{"from": "<source>", "detail": <detail>, "at": <time>, "message": "fired at <time> by <aws.events.rule-name>"}`,
+			}},
+			expected: `{"from":"aws.events","detail":{},"at":"2026-10-19T12:00:00Z","message":"fired at 2026-10-19T12:00:00Z by Nightly-scheduled"}`,
+		},
+		{
+			name: "values are escaped inside strings",
+			schedule: config.ScheduleConfig{InputTransformer: &config.InputTransformerConfig{
+				InputPaths:    map[string]string{"detail": "$.detail", "missing": "$.detail.missing"},
+				InputTemplate: `{"text": "<detail>", "missingText": "<missing>", "missing": <missing>}`,
+			}},
+			expected: `{"text":"{}","missingText":"","missing":null}`,
+		},
+		{
+			name: "string template",
+			schedule: config.ScheduleConfig{InputTransformer: &config.InputTransformerConfig{
+				InputPaths:    map[string]string{"type": "$.detail-type"},
+				InputTemplate: `"<type> from <aws.events.rule-arn>"`,
+			}},
+			expected: `"Scheduled Event from arn:aws:events:eu-west-1:000000000000:rule/Nightly-scheduled"`,
+		},
+		{
+			name: "plain text template",
+			schedule: config.ScheduleConfig{InputTransformer: &config.InputTransformerConfig{
+				InputTemplate: `Rule <aws.events.rule-name> fired`,
+			}},
+			expected: `"Rule \"Nightly-scheduled\" fired"`,
+		},
+		{
+			name: "full event",
+			schedule: config.ScheduleConfig{InputTransformer: &config.InputTransformerConfig{
+				InputTemplate: `{"event": <aws.events.event.json>, "time": <aws.events.event.ingestion-time>}`,
+			}},
+			expected: `{"event":{"version":"0","id":"event-id","detail-type":"Scheduled Event","source":"aws.events","time":"2026-10-19T12:00:00Z","resources":["arn:aws:events:eu-west-1:000000000000:rule/Nightly-scheduled"],"detail":{}},"time":"2026-10-19T12:00:00Z"}`,
+		},
+		{
+			name:     "no input settings",
+			schedule: config.ScheduleConfig{},
+			expected: `{"version":"0","id":"event-id","detail-type":"Scheduled Event","source":"aws.events","time":"2026-10-19T12:00:00Z","resources":["arn:aws:events:eu-west-1:000000000000:rule/Nightly-scheduled"],"detail":{}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := scheduledHandlerInput(event, test.schedule)
+
+			if !jsonEqual(t, input, []byte(test.expected)) {
+				t.Errorf("expected %s, got %s", test.expected, input)
+			}
+		})
+	}
+}
+
+func jsonEqual(t *testing.T, actual []byte, expected []byte) bool {
+	t.Helper()
+
+	var actualValue, expectedValue interface{}
+	if err := json.Unmarshal(actual, &actualValue); err != nil {
+		t.Fatalf("expected valid JSON, got %s: %v", actual, err)
+	}
+
+	if err := json.Unmarshal(expected, &expectedValue); err != nil {
+		t.Fatalf("invalid expected JSON %s: %v", expected, err)
+	}
+
+	actualJSON, _ := json.Marshal(actualValue)
+	expectedJSON, _ := json.Marshal(expectedValue)
+
+	return string(actualJSON) == string(expectedJSON)
+}
@@ -0,0 +1,51 @@
+package offline
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestPrintUpcomingRuns(t *testing.T) {
+	var output bytes.Buffer
+
+	from := time.Date(2026, time.October, 23, 12, 0, 0, 0, time.UTC)
+	err := printUpcomingRuns(&output, "NightlyHandler", config.ScheduleConfig{
+		Expression: "cron(0 2 ? * MON-FRI *)",
+		Timezone:   "Europe/London",
+	}, from, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "NightlyHandler: cron(0 2 ? * MON-FRI *) (Europe/London)\n" +
+		"   1. Mon 2026-10-26 02:00 GMT  (2026-10-26 02:00 UTC)\n" +
+		"   2. Tue 2026-10-27 02:00 GMT  (2026-10-27 02:00 UTC)\n" +
+		"   3. Wed 2026-10-28 02:00 GMT  (2026-10-28 02:00 UTC)\n"
+
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output.String())
+	}
+}
+
+func TestPrintUpcomingRunsStopsWhenTheScheduleEnds(t *testing.T) {
+	var output bytes.Buffer
+
+	from := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	err := printUpcomingRuns(&output, "YearlyHandler", config.ScheduleConfig{
+		Expression: "cron(0 0 1 1 ? 2027)",
+	}, from, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "YearlyHandler: cron(0 0 1 1 ? 2027) (UTC)\n" +
+		"   1. Fri 2027-01-01 00:00 UTC  (2027-01-01 00:00 UTC)\n" +
+		"  The schedule does not fire again.\n"
+
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output.String())
+	}
+}
@@ -0,0 +1,180 @@
+package offline
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/terrable-dev/terrable/config"
+	"github.com/terrable-dev/terrable/utils"
+)
+
+// scheduledRun invokes a scheduled handler each time its schedule expression
+// fires. Invocations never overlap: fire times that pass while the handler is
+// still running are skipped.
+type scheduledRun struct {
+	mutex    sync.Mutex
+	handler  *HandlerInstance
+	config   config.ScheduleConfig
+	schedule *utils.ScheduleExpression
+	next     time.Time
+
+	execute func(handler *HandlerInstance) HandlerOutput
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newScheduledRun(handler *HandlerInstance, async *asyncQueue) (*scheduledRun, error) {
+	scheduleConfig := *handler.handlerConfig.Schedule
+
+	schedule, err := utils.ParseScheduleExpression(scheduleConfig.Expression, scheduleConfig.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scheduledRun{
+		handler:  handler,
+		config:   scheduleConfig,
+		schedule: schedule,
+		execute: func(handler *HandlerInstance) HandlerOutput {
+			return async.invoke(handler, scheduledHandlerPayload(handler))
+		},
+		done: make(chan struct{}),
+	}, nil
+}
+
+// start works out the first fire time and begins waiting for it.
+func (run *scheduledRun) start() {
+	run.mutex.Lock()
+	run.next = run.schedule.Next(time.Now())
+	run.mutex.Unlock()
+
+	go run.loop()
+}
+
+// setHandler points the schedule at a rebuilt handler without changing when it
+// next fires.
+func (run *scheduledRun) setHandler(handler *HandlerInstance) {
+	run.mutex.Lock()
+	run.handler = handler
+	run.mutex.Unlock()
+}
+
+// Next is the time the handler is next invoked, or the zero time if its
+// schedule never fires again.
+func (run *scheduledRun) Next() time.Time {
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+
+	return run.next
+}
+
+// Close stops the schedule. An invocation that is already running finishes.
+func (run *scheduledRun) Close() {
+	run.closeOnce.Do(func() {
+		close(run.done)
+	})
+}
+
+func (run *scheduledRun) loop() {
+	for {
+		run.mutex.Lock()
+		next := run.next
+		run.mutex.Unlock()
+
+		if next.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-run.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		run.fire(next)
+	}
+}
+
+// fire invokes the handler for the schedule's fire time and then moves on to
+// the first fire time that is still in the future.
+func (run *scheduledRun) fire(firedAt time.Time) {
+	run.mutex.Lock()
+	handler := run.handler
+	run.mutex.Unlock()
+
+	fmt.Printf("Schedule %s (%s) fired at %s\n", run.config.Expression, handler.handlerConfig.Name, firedAt.Format(time.RFC3339))
+	start := time.Now()
+
+	output := run.execute(handler)
+
+	if output.err != nil {
+		fmt.Println(output.err)
+	}
+
+	if failure := invocationFailure(output); failure != "" {
+		color.New(color.FgHiYellow).Printf("  %s\n", failure)
+	}
+
+	next := run.schedule.Next(firedAt)
+	for !next.IsZero() && !next.After(time.Now()) {
+		next = run.schedule.Next(next)
+	}
+
+	run.mutex.Lock()
+	run.next = next
+	run.mutex.Unlock()
+
+	fmt.Printf("Completed in %dms, next run at %s\n\n", time.Since(start).Milliseconds(), formatScheduledTime(next))
+}
+
+// syncScheduledRuns starts a schedule for every scheduled handler, keeps the
+// schedules of handlers whose expression is unchanged, and stops those that
+// are no longer configured.
+func syncScheduledRuns(runs map[string]*scheduledRun, handlers map[string]*HandlerInstance, async *asyncQueue) {
+	for name, run := range runs {
+		handler, ok := handlers[name]
+		if ok && handler.handlerConfig.Schedule != nil && reflect.DeepEqual(*handler.handlerConfig.Schedule, run.config) {
+			continue
+		}
+
+		run.Close()
+		delete(runs, name)
+	}
+
+	for name, handler := range handlers {
+		if handler.handlerConfig.Schedule == nil {
+			continue
+		}
+
+		if run, ok := runs[name]; ok {
+			run.setHandler(handler)
+			continue
+		}
+
+		// Expressions are checked when the configuration is parsed.
+		run, err := newScheduledRun(handler, async)
+		if err != nil {
+			fmt.Println(fmt.Errorf("could not schedule handler %s: %w", name, err))
+			continue
+		}
+
+		run.start()
+		runs[name] = run
+	}
+}
+
+// formatScheduledTime shows a fire time in the time zone of its schedule.
+func formatScheduledTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	return t.Format("2006-01-02 15:04 MST")
+}
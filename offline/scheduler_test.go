@@ -0,0 +1,87 @@
+package offline
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+func newScheduledTestHandler(name string, expression string) *HandlerInstance {
+	return &HandlerInstance{handlerConfig: config.HandlerMapping{
+		Name:     name,
+		Schedule: &config.ScheduleConfig{Expression: expression},
+	}}
+}
+
+func TestScheduledRunFireSkipsMissedFireTimes(t *testing.T) {
+	run, err := newScheduledRun(newScheduledTestHandler("ScheduledHandler", "rate(1 minute)"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var invoked []string
+	run.execute = func(handler *HandlerInstance) HandlerOutput {
+		invoked = append(invoked, handler.handlerConfig.Name)
+		return HandlerOutput{handlerResult: &handlerResult{StatusCode: http.StatusOK}}
+	}
+
+	firedAt := time.Now().Add(-150 * time.Second)
+	run.fire(firedAt)
+
+	if len(invoked) != 1 {
+		t.Fatalf("expected one invocation, got %d", len(invoked))
+	}
+
+	next := run.Next()
+	if !next.After(time.Now()) || next.Sub(firedAt) != 3*time.Minute {
+		t.Errorf("expected the next fire time to be the first one in the future, got %s after the fire time", next.Sub(firedAt))
+	}
+}
+
+func TestSyncScheduledRuns(t *testing.T) {
+	runs := make(map[string]*scheduledRun)
+	t.Cleanup(func() {
+		for _, run := range runs {
+			run.Close()
+		}
+	})
+
+	syncScheduledRuns(runs, map[string]*HandlerInstance{
+		"Kept":    newScheduledTestHandler("Kept", "rate(5 minutes)"),
+		"Changed": newScheduledTestHandler("Changed", "rate(5 minutes)"),
+		"Removed": newScheduledTestHandler("Removed", "rate(5 minutes)"),
+		"Http":    {handlerConfig: config.HandlerMapping{Name: "Http"}},
+	}, nil)
+
+	if len(runs) != 3 {
+		t.Fatalf("expected a schedule per scheduled handler, got %d", len(runs))
+	}
+
+	kept, changed, removed := runs["Kept"], runs["Changed"], runs["Removed"]
+	rebuilt := newScheduledTestHandler("Kept", "rate(5 minutes)")
+
+	syncScheduledRuns(runs, map[string]*HandlerInstance{
+		"Kept":    rebuilt,
+		"Changed": newScheduledTestHandler("Changed", "cron(0 10 * * ? *)"),
+	}, nil)
+
+	if runs["Kept"] != kept || kept.handler != rebuilt {
+		t.Error("expected an unchanged schedule to be kept and to invoke the rebuilt handler")
+	}
+
+	if runs["Changed"] == changed || runs["Changed"].config.Expression != "cron(0 10 * * ? *)" {
+		t.Error("expected a changed schedule to be replaced")
+	}
+
+	if _, ok := runs["Removed"]; ok {
+		t.Error("expected the schedule of a removed handler to be stopped")
+	}
+
+	select {
+	case <-removed.done:
+	default:
+		t.Error("expected the removed schedule to be closed")
+	}
+}
@@ -0,0 +1,74 @@
+package offline
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const buildOutputDirectoryName = ".terrable"
+
+// serve handles requests until ctx is cancelled, then stops accepting new
+// connections and gives in-flight invocations up to gracePeriod to finish
+// before any remaining connections are closed. drain, when set, is called
+// with the end of the grace period to wait for invocations that did not come
+// in over HTTP, and serve returns once it has.
+func serve(ctx context.Context, server *http.Server, listener net.Listener, gracePeriod time.Duration, drain func(deadline time.Time)) error {
+	serveErr := make(chan error, 1)
+
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && err != http.ErrServerClosed {
+			return err
+		}
+
+		return nil
+	case <-ctx.Done():
+	}
+
+	color.New(color.FgHiYellow, color.Bold).Println("\nShutting down terrable local server...")
+
+	deadline := time.Now().Add(gracePeriod)
+	shutdownCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+
+		if drain != nil {
+			drain(deadline)
+		}
+	}()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("In-flight invocations did not finish within %s, closing remaining connections\n", gracePeriod)
+		server.Close()
+	}
+
+	<-drained
+
+	return nil
+}
+
+func removeBuildOutput() {
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		fmt.Println(fmt.Errorf("error fetching working directory: %w", err))
+		return
+	}
+
+	if err := os.RemoveAll(filepath.Join(workingDirectory, buildOutputDirectoryName)); err != nil {
+		fmt.Println(fmt.Errorf("error removing build output: %w", err))
+	}
+}
@@ -0,0 +1,133 @@
+package offline
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeDrainsInFlightRequestsOnShutdown(t *testing.T) {
+	requestStarted := make(chan struct{})
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(requestStarted)
+			time.Sleep(200 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveDone := make(chan error, 1)
+
+	go func() {
+		serveDone <- serve(ctx, server, listener, 5*time.Second, nil)
+	}()
+
+	responseStatus := make(chan int, 1)
+	go func() {
+		response, err := http.Get(fmt.Sprintf("http://%s/", listener.Addr().String()))
+		if err != nil {
+			responseStatus <- 0
+			return
+		}
+		response.Body.Close()
+		responseStatus <- response.StatusCode
+	}()
+
+	<-requestStarted
+	cancel()
+
+	if status := <-responseStatus; status != http.StatusOK {
+		t.Fatalf("expected in-flight request to complete with 200, got %d", status)
+	}
+
+	if err := <-serveDone; err != nil {
+		t.Fatalf("expected serve to shut down cleanly, got %v", err)
+	}
+
+	if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Fatal("expected server to stop accepting connections after shutdown")
+	}
+}
+
+func TestServeClosesConnectionsAfterGracePeriod(t *testing.T) {
+	requestStarted := make(chan struct{})
+	releaseRequest := make(chan struct{})
+	defer close(releaseRequest)
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(requestStarted)
+			<-releaseRequest
+		}),
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveDone := make(chan error, 1)
+
+	go func() {
+		serveDone <- serve(ctx, server, listener, 100*time.Millisecond, nil)
+	}()
+
+	go http.Get(fmt.Sprintf("http://%s/", listener.Addr().String()))
+
+	<-requestStarted
+	cancel()
+
+	select {
+	case err := <-serveDone:
+		if err != nil {
+			t.Fatalf("expected serve to shut down cleanly, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected serve to give up waiting after the grace period")
+	}
+}
+
+func TestServeWaitsToDrainOtherInvocations(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveDone := make(chan error, 1)
+	drained := make(chan time.Time, 1)
+
+	go func() {
+		serveDone <- serve(ctx, &http.Server{Handler: http.NotFoundHandler()}, listener, 5*time.Second, func(deadline time.Time) {
+			time.Sleep(100 * time.Millisecond)
+			drained <- deadline
+		})
+	}()
+
+	shutdownStarted := time.Now()
+	cancel()
+
+	if err := <-serveDone; err != nil {
+		t.Fatalf("expected serve to shut down cleanly, got %v", err)
+	}
+
+	select {
+	case deadline := <-drained:
+		if deadline.Before(shutdownStarted.Add(5 * time.Second)) {
+			t.Errorf("expected the drain to be given the grace period, got a deadline %s after shutdown", deadline.Sub(shutdownStarted))
+		}
+	default:
+		t.Fatal("expected serve to wait for the drain to finish")
+	}
+}
@@ -0,0 +1,382 @@
+package offline
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/terrable-dev/terrable/config"
+)
+
+// snsSubscription delivers the messages published to a topic to a handler, or
+// to the queue of an SQS-triggered handler.
+type snsSubscription struct {
+	arn     string
+	handler *HandlerInstance
+	// queue is set for queue subscriptions, which send messages to the queue
+	// rather than invoking the handler.
+	queue  *sqsQueue
+	config config.SnsConfig
+	filter *eventPattern
+}
+
+func (subscription snsSubscription) name() string {
+	return subscription.handler.handlerConfig.Name
+}
+
+func (subscription snsSubscription) protocol() string {
+	if subscription.queue != nil {
+		return "sqs"
+	}
+
+	return "lambda"
+}
+
+// snsTopics holds the subscriptions of every local topic. Topics are known by
+// name, whichever account and region their ARN names.
+type snsTopics struct {
+	subscriptions map[string][]snsSubscription
+	execute       func(handler *HandlerInstance, record map[string]interface{}) HandlerOutput
+}
+
+type snsDelivery struct {
+	Handler  string `json:"handler"`
+	Protocol string `json:"protocol"`
+	Outcome  string `json:"outcome"`
+}
+
+// newSnsTopics subscribes every handler with an sns trigger, and the queue of
+// every SQS trigger with an sns subscription, in handler name order. Filter
+// policies are checked when the configuration is validated.
+func newSnsTopics(handlerInstances []*HandlerInstance, queues map[string]*sqsQueue, async *asyncQueue) *snsTopics {
+	topics := &snsTopics{
+		subscriptions: make(map[string][]snsSubscription),
+		execute: func(handler *HandlerInstance, record map[string]interface{}) HandlerOutput {
+			return async.invokeEvent(handler, newSnsEvent(record))
+		},
+	}
+
+	subscribe := func(subscription snsSubscription) {
+		if subscription.config.FilterPolicy != "" {
+			filter, err := newEventPattern(subscription.config.FilterPolicy)
+			if err != nil {
+				return
+			}
+
+			subscription.filter = filter
+		}
+
+		topicName := subscription.config.TopicName()
+		subscription.arn = fmt.Sprintf("%s:%s", snsTopicArn(subscription.config.Topic), subscription.name())
+		topics.subscriptions[topicName] = append(topics.subscriptions[topicName], subscription)
+	}
+
+	for _, handler := range handlerInstances {
+		if handler.handlerConfig.Sns != nil {
+			subscribe(snsSubscription{handler: handler, config: *handler.handlerConfig.Sns})
+		}
+
+		if sqs := handler.handlerConfig.Sqs; sqs != nil && sqs.Sns != nil {
+			if queue, ok := queues[handler.handlerConfig.Name]; ok {
+				subscribe(snsSubscription{handler: handler, queue: queue, config: *sqs.Sns})
+			}
+		}
+	}
+
+	for _, subscriptions := range topics.subscriptions {
+		sort.Slice(subscriptions, func(i, j int) bool {
+			if subscriptions[i].name() != subscriptions[j].name() {
+				return subscriptions[i].name() < subscriptions[j].name()
+			}
+
+			return subscriptions[i].protocol() < subscriptions[j].protocol()
+		})
+	}
+
+	return topics
+}
+
+// topicName returns the name of the topic an ARN or name refers to.
+func (topics *snsTopics) topicName(topic string) string {
+	return config.SnsConfig{Topic: topic}.TopicName()
+}
+
+// publish delivers a message to the subscriptions of its topic whose filter
+// policy matches it. Messages are sent to queues straight away. Handlers are
+// invoked in the background unless wait is set, as SNS invokes Lambda
+// functions asynchronously.
+func (topics *snsTopics) publish(message snsMessage, wait bool) []snsDelivery {
+	var matched []snsSubscription
+	for _, subscription := range topics.subscriptions[topics.topicName(message.TopicArn)] {
+		if subscription.matches(message) {
+			matched = append(matched, subscription)
+		}
+	}
+
+	printMatches(fmt.Sprintf("SNS %s message %s", message.TopicArn, message.ID), matched, func(subscription snsSubscription) string {
+		return fmt.Sprintf("%s (%s)", subscription.name(), subscription.protocol())
+	}, "no subscriptions")
+
+	deliveries := make([]snsDelivery, len(matched))
+
+	var wg sync.WaitGroup
+	for i, subscription := range matched {
+		if subscription.queue != nil {
+			deliveries[i] = subscription.sendToQueue(message)
+			continue
+		}
+
+		if !wait {
+			go topics.invoke(subscription, message)
+			continue
+		}
+
+		wg.Add(1)
+		go func(index int, subscription snsSubscription) {
+			defer wg.Done()
+			deliveries[index] = topics.invoke(subscription, message)
+		}(i, subscription)
+	}
+
+	wg.Wait()
+
+	return deliveries
+}
+
+func (topics *snsTopics) invoke(subscription snsSubscription, message snsMessage) snsDelivery {
+	start := time.Now()
+
+	output := topics.execute(subscription.handler, newSnsRecord(subscription.arn, message.forProtocol("lambda")))
+	if output.err != nil {
+		fmt.Println(output.err)
+	}
+
+	delivery := snsDelivery{Handler: subscription.name(), Protocol: "lambda", Outcome: "succeeded"}
+
+	if failure := invocationFailure(output); failure != "" {
+		delivery.Outcome = "failed: " + failure
+		color.New(color.FgHiYellow).Printf("SNS message %s failed in %s (%s) after %dms\n\n", message.ID, subscription.name(), failure, time.Since(start).Milliseconds())
+	} else {
+		color.New(color.FgHiGreen).Printf("SNS message %s delivered to %s in %dms\n\n", message.ID, subscription.name(), time.Since(start).Milliseconds())
+	}
+
+	return delivery
+}
+
+// sendToQueue sends the SNS notification for a message to the subscribed
+// queue, or the message itself with raw message delivery.
+func (subscription snsSubscription) sendToQueue(message snsMessage) snsDelivery {
+	message = message.forProtocol("sqs")
+
+	input := sqsMessageInput{
+		Body:            message.Message,
+		GroupID:         message.GroupID,
+		DeduplicationID: message.DeduplicationID,
+	}
+
+	if subscription.config.RawMessageDelivery {
+		input.Attributes = message.MessageAttributes
+	} else {
+		notification := newSnsNotification(subscription.arn, message, "SigningCertURL", "UnsubscribeURL")
+		if message.Subject == "" {
+			delete(notification, "Subject")
+		}
+
+		body, _ := json.Marshal(notification)
+		input.Body = string(body)
+	}
+
+	result, err := subscription.queue.Send(input)
+	if err != nil {
+		return snsDelivery{Handler: subscription.name(), Protocol: "sqs", Outcome: "failed: " + err.Error()}
+	}
+
+	delivery := snsDelivery{Handler: subscription.name(), Protocol: "sqs", Outcome: "queued as " + result.MessageID}
+	if result.Duplicate {
+		delivery.Outcome = "deduplicated"
+	}
+
+	fmt.Printf("SNS message %s sent to the %s queue of %s\n", message.ID, subscription.queue.QueueName(), subscription.name())
+
+	return delivery
+}
+
+// matches applies the subscription's filter policy to the message attributes,
+// or to the message body when its scope is MessageBody. Bodies that are not
+// JSON objects never match a body filter policy.
+func (subscription snsSubscription) matches(message snsMessage) bool {
+	if subscription.filter == nil {
+		return true
+	}
+
+	if subscription.config.FilterPolicyScope == "MessageBody" {
+		var body map[string]interface{}
+		if err := json.Unmarshal([]byte(message.forProtocol(subscription.protocol()).Message), &body); err != nil {
+			return false
+		}
+
+		return subscription.filter.Matches(body)
+	}
+
+	return subscription.filter.Matches(snsFilterAttributes(message.MessageAttributes))
+}
+
+// snsFilterAttributes returns the values filter policies see for message
+// attributes. Numbers are compared as numbers, String.Array values match when
+// any of their elements does, and binary attributes are ignored.
+func snsFilterAttributes(attributes map[string]sqsMessageAttribute) map[string]interface{} {
+	values := make(map[string]interface{}, len(attributes))
+
+	for name, attribute := range attributes {
+		if attribute.StringValue == nil {
+			continue
+		}
+
+		value := *attribute.StringValue
+
+		switch {
+		case strings.HasPrefix(attribute.DataType, "Number"):
+			if number, err := strconv.ParseFloat(value, 64); err == nil {
+				values[name] = number
+				continue
+			}
+		case attribute.DataType == "String.Array":
+			var elements []interface{}
+			if err := json.Unmarshal([]byte(value), &elements); err == nil {
+				values[name] = elements
+				continue
+			}
+		}
+
+		values[name] = value
+	}
+
+	return values
+}
+
+// forProtocol returns the message a subscription with the given protocol
+// receives. Messages published with a JSON message structure hold a message
+// for each protocol and a default one.
+func (message snsMessage) forProtocol(protocol string) snsMessage {
+	if !message.Structured {
+		return message
+	}
+
+	var messages map[string]string
+	json.Unmarshal([]byte(message.Message), &messages)
+
+	if protocolMessage, ok := messages[protocol]; ok {
+		message.Message = protocolMessage
+	} else {
+		message.Message = messages["default"]
+	}
+
+	message.Structured = false
+	return message
+}
+
+// registerSnsRoutes adds the endpoints for publishing messages by hand and
+// listing the topics.
+//
+// POST /_sns/<topic> publishes a message given as a JSON object with a Message,
+// which may also be a JSON value, and optionally a Subject, MessageAttributes,
+// MessageGroupId and MessageDeduplicationId. It responds once every subscribed
+// handler has finished with the outcome of each delivery. GET /_sns lists the
+// topics and their subscriptions.
+func registerSnsRoutes(r *mux.Router, topics *snsTopics) {
+	r.HandleFunc("/_sns", func(w http.ResponseWriter, r *http.Request) {
+		names := make([]string, 0, len(topics.subscriptions))
+		for name := range topics.subscriptions {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		states := make([]map[string]interface{}, 0, len(names))
+		for _, name := range names {
+			subscriptions := make([]map[string]interface{}, 0, len(topics.subscriptions[name]))
+
+			for _, subscription := range topics.subscriptions[name] {
+				state := map[string]interface{}{
+					"handler":         subscription.name(),
+					"protocol":        subscription.protocol(),
+					"subscriptionArn": subscription.arn,
+				}
+
+				if subscription.config.FilterPolicy != "" {
+					state["filterPolicy"] = json.RawMessage(subscription.config.FilterPolicy)
+					state["filterPolicyScope"] = valueOrDefault(subscription.config.FilterPolicyScope, "MessageAttributes")
+				}
+
+				subscriptions = append(subscriptions, state)
+			}
+
+			states = append(states, map[string]interface{}{
+				"topic":         name,
+				"subscriptions": subscriptions,
+			})
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"topics": states})
+	}).Methods(http.MethodGet)
+
+	r.HandleFunc("/_sns/{topic}", func(w http.ResponseWriter, r *http.Request) {
+		topicName := mux.Vars(r)["topic"]
+
+		if _, ok := topics.subscriptions[topicName]; !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": fmt.Sprintf("No handlers or queues subscribe to topic %s.", topicName)})
+			return
+		}
+
+		var entry struct {
+			Message                json.RawMessage
+			Subject                string
+			MessageAttributes      map[string]sqsMessageAttribute
+			MessageGroupId         string
+			MessageDeduplicationId string
+		}
+
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": fmt.Sprintf("The request body is not a valid message: %s", err)})
+			return
+		}
+
+		messageText := string(entry.Message)
+		json.Unmarshal(entry.Message, &messageText)
+
+		message := snsMessage{
+			ID:                uuid.New().String(),
+			TopicArn:          snsTopicArn(topicName),
+			Subject:           entry.Subject,
+			Message:           messageText,
+			MessageAttributes: entry.MessageAttributes,
+			GroupID:           entry.MessageGroupId,
+			DeduplicationID:   entry.MessageDeduplicationId,
+			Timestamp:         time.Now(),
+		}
+
+		if err := validateSnsMessage(message); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+			return
+		}
+
+		deliveries := topics.publish(message, true)
+		if deliveries == nil {
+			deliveries = []snsDelivery{}
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"messageId":  message.ID,
+			"deliveries": deliveries,
+		})
+	}).Methods(http.MethodPost)
+}
@@ -0,0 +1,369 @@
+package offline
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// snsAPIVersion is the version AWS SDKs send with every SNS query protocol
+	// request.
+	snsAPIVersion          = "2010-03-31"
+	snsAPINamespace        = "http://sns.amazonaws.com/doc/2010-03-31/"
+	maxPublishBatchEntries = 10
+)
+
+// snsAPIError is an error in the shape the AWS query protocol returns them.
+type snsAPIError struct {
+	statusCode int
+	code       string
+	message    string
+}
+
+func (err *snsAPIError) Error() string {
+	return err.message
+}
+
+func newSnsInvalidParameterError(format string, args ...interface{}) *snsAPIError {
+	return &snsAPIError{
+		statusCode: http.StatusBadRequest,
+		code:       "InvalidParameter",
+		message:    "Invalid parameter: " + fmt.Sprintf(format, args...),
+	}
+}
+
+// registerSnsAPIRoutes serves Publish and PublishBatch from the SNS API, which
+// AWS SDKs call with the query protocol, so that messages published with an
+// AWS SDK reach subscribed handlers and queues.
+//
+// Requests are form-encoded POSTs to the root path, so the route is registered
+// ahead of handler routes and only matches requests for the SNS API version.
+func registerSnsAPIRoutes(r *mux.Router, topics *snsTopics) {
+	api := &snsAPI{topics: topics}
+
+	r.HandleFunc("/", api.ServeHTTP).
+		Methods(http.MethodPost).
+		MatcherFunc(isSnsAPIRequest)
+}
+
+// isSnsAPIRequest reads the form of a request to check its API version, and
+// leaves the body to be read again.
+func isSnsAPIRequest(r *http.Request, _ *mux.RouteMatch) bool {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return false
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return false
+	}
+
+	values, err := url.ParseQuery(string(body))
+	return err == nil && values.Get("Version") == snsAPIVersion && values.Get("Action") != ""
+}
+
+type snsAPI struct {
+	topics *snsTopics
+}
+
+func (api *snsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	values, _ := url.ParseQuery(string(body))
+	action := values.Get("Action")
+
+	var result interface{}
+	var err error
+
+	switch action {
+	case "Publish":
+		result, err = api.publish(values)
+	case "PublishBatch":
+		result, err = api.publishBatch(values)
+	default:
+		err = &snsAPIError{
+			statusCode: http.StatusBadRequest,
+			code:       "InvalidAction",
+			message:    fmt.Sprintf("terrable does not support the SNS %s action.", action),
+		}
+	}
+
+	if err != nil {
+		writeSnsAPIError(w, err)
+		return
+	}
+
+	fmt.Printf("SNS API %s\n", action)
+
+	writeSnsAPIResponse(w, action, result)
+}
+
+type snsPublishResult struct {
+	MessageId string
+}
+
+func (api *snsAPI) publish(values url.Values) (interface{}, error) {
+	message, err := newSnsAPIMessage(values)
+	if err != nil {
+		return nil, err
+	}
+
+	api.topics.publish(message, false)
+
+	return snsPublishResult{MessageId: message.ID}, nil
+}
+
+func (api *snsAPI) publishBatch(values url.Values) (interface{}, error) {
+	topicArn := values.Get("TopicArn")
+	if topicArn == "" {
+		return nil, newSnsInvalidParameterError("TopicArn Reason: no value for required parameter")
+	}
+
+	var prefixes []string
+	for i := 1; values.Has(fmt.Sprintf("PublishBatchRequestEntries.member.%d.Id", i)); i++ {
+		prefixes = append(prefixes, fmt.Sprintf("PublishBatchRequestEntries.member.%d.", i))
+	}
+
+	if len(prefixes) == 0 {
+		return nil, &snsAPIError{statusCode: http.StatusBadRequest, code: "EmptyBatchRequest", message: "The batch request doesn't contain any entries."}
+	}
+
+	if len(prefixes) > maxPublishBatchEntries {
+		return nil, &snsAPIError{statusCode: http.StatusBadRequest, code: "TooManyEntriesInBatchRequest", message: fmt.Sprintf("The batch request contains more entries than permissible (%d).", maxPublishBatchEntries)}
+	}
+
+	ids := make(map[string]bool, len(prefixes))
+	for _, prefix := range prefixes {
+		id := values.Get(prefix + "Id")
+		if ids[id] {
+			return nil, &snsAPIError{statusCode: http.StatusBadRequest, code: "BatchEntryIdsNotDistinct", message: "Two or more batch entries in the request have the same Id."}
+		}
+
+		ids[id] = true
+	}
+
+	type successfulEntry struct {
+		Id        string
+		MessageId string
+	}
+
+	type failedEntry struct {
+		Id          string
+		Code        string
+		Message     string
+		SenderFault bool
+	}
+
+	var result struct {
+		Successful []successfulEntry `xml:"Successful>member"`
+		Failed     []failedEntry     `xml:"Failed>member"`
+	}
+
+	var messages []snsMessage
+
+	for _, prefix := range prefixes {
+		entry := url.Values{"TopicArn": {topicArn}}
+		for key, value := range values {
+			if name, ok := strings.CutPrefix(key, prefix); ok {
+				entry[name] = value
+			}
+		}
+
+		message, err := newSnsAPIMessage(entry)
+		if err != nil {
+			apiError := err.(*snsAPIError)
+			result.Failed = append(result.Failed, failedEntry{Id: entry.Get("Id"), Code: apiError.code, Message: apiError.message, SenderFault: true})
+			continue
+		}
+
+		messages = append(messages, message)
+		result.Successful = append(result.Successful, successfulEntry{Id: entry.Get("Id"), MessageId: message.ID})
+	}
+
+	for _, message := range messages {
+		api.topics.publish(message, false)
+	}
+
+	return result, nil
+}
+
+// newSnsAPIMessage reads a message from the parameters of a Publish request,
+// or of a PublishBatch entry once its prefix is removed.
+func newSnsAPIMessage(values url.Values) (snsMessage, error) {
+	topicArn := values.Get("TopicArn")
+	if topicArn == "" {
+		topicArn = values.Get("TargetArn")
+	}
+
+	if topicArn == "" {
+		return snsMessage{}, newSnsInvalidParameterError("TopicArn or TargetArn Reason: no value for required parameter")
+	}
+
+	attributes := make(map[string]sqsMessageAttribute)
+
+	for i := 1; values.Has(fmt.Sprintf("MessageAttributes.entry.%d.Name", i)); i++ {
+		prefix := fmt.Sprintf("MessageAttributes.entry.%d.", i)
+		attribute := sqsMessageAttribute{DataType: values.Get(prefix + "Value.DataType")}
+
+		if values.Has(prefix + "Value.StringValue") {
+			stringValue := values.Get(prefix + "Value.StringValue")
+			attribute.StringValue = &stringValue
+		}
+
+		if values.Has(prefix + "Value.BinaryValue") {
+			binaryValue, err := base64.StdEncoding.DecodeString(values.Get(prefix + "Value.BinaryValue"))
+			if err != nil {
+				return snsMessage{}, newSnsInvalidParameterError("Message attribute %s has an invalid binary value", values.Get(prefix+"Name"))
+			}
+
+			attribute.BinaryValue = binaryValue
+		}
+
+		attributes[values.Get(prefix+"Name")] = attribute
+	}
+
+	if len(attributes) == 0 {
+		attributes = nil
+	}
+
+	message := snsMessage{
+		ID:                uuid.New().String(),
+		TopicArn:          snsTopicArn(topicArn),
+		Subject:           values.Get("Subject"),
+		Message:           values.Get("Message"),
+		MessageAttributes: attributes,
+		GroupID:           values.Get("MessageGroupId"),
+		DeduplicationID:   values.Get("MessageDeduplicationId"),
+		Timestamp:         time.Now(),
+		Structured:        values.Get("MessageStructure") == "json",
+	}
+
+	if err := validateSnsMessage(message); err != nil {
+		return snsMessage{}, err
+	}
+
+	return message, nil
+}
+
+// validateSnsMessage checks a message the way Publish does.
+func validateSnsMessage(message snsMessage) error {
+	if message.Message == "" {
+		return newSnsInvalidParameterError("Empty message")
+	}
+
+	if message.Structured {
+		var messages map[string]interface{}
+		if err := json.Unmarshal([]byte(message.Message), &messages); err != nil {
+			return newSnsInvalidParameterError("Message Structure - JSON message body failed to parse")
+		}
+
+		if _, ok := messages["default"]; !ok {
+			return newSnsInvalidParameterError("Message Structure - No default entry in JSON message body")
+		}
+
+		for protocol, protocolMessage := range messages {
+			if _, ok := protocolMessage.(string); !ok {
+				return newSnsInvalidParameterError("Message Structure - the %s message must be a string", protocol)
+			}
+		}
+	}
+
+	if strings.HasSuffix(message.TopicArn, ".fifo") && message.GroupID == "" {
+		return newSnsInvalidParameterError("The MessageGroupId parameter is required for FIFO topics")
+	}
+
+	for name, attribute := range message.MessageAttributes {
+		switch {
+		case attribute.DataType == "":
+			return newSnsInvalidParameterError("The message attribute '%s' must contain non-empty message attribute type.", name)
+		case attribute.StringValue == nil && attribute.BinaryValue == nil:
+			return newSnsInvalidParameterError("The message attribute '%s' must contain non-empty message attribute value.", name)
+		case strings.HasPrefix(attribute.DataType, "Number") && attribute.StringValue != nil:
+			if _, err := strconv.ParseFloat(*attribute.StringValue, 64); err != nil {
+				return newSnsInvalidParameterError("The message attribute '%s' with type 'Number' must be a valid number.", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeSnsAPIResponse(w http.ResponseWriter, action string, result interface{}) {
+	response := struct {
+		XMLName          xml.Name
+		Namespace        string `xml:"xmlns,attr"`
+		ResultElement    resultElement
+		ResponseMetadata struct {
+			RequestId string
+		}
+	}{
+		XMLName:       xml.Name{Local: action + "Response"},
+		Namespace:     snsAPINamespace,
+		ResultElement: resultElement{XMLName: xml.Name{Local: action + "Result"}, Value: result},
+	}
+
+	response.ResponseMetadata.RequestId = uuid.New().String()
+
+	body, _ := xml.Marshal(response)
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// resultElement names the element a result is written in.
+type resultElement struct {
+	XMLName xml.Name
+	Value   interface{}
+}
+
+func (element resultElement) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	return encoder.EncodeElement(element.Value, xml.StartElement{Name: element.XMLName})
+}
+
+func writeSnsAPIError(w http.ResponseWriter, err error) {
+	apiError, ok := err.(*snsAPIError)
+	if !ok {
+		apiError = &snsAPIError{statusCode: http.StatusInternalServerError, code: "InternalError", message: err.Error()}
+	}
+
+	response := struct {
+		XMLName   xml.Name `xml:"ErrorResponse"`
+		Namespace string   `xml:"xmlns,attr"`
+		Error     struct {
+			Type    string
+			Code    string
+			Message string
+		}
+		RequestId string
+	}{
+		Namespace: snsAPINamespace,
+		RequestId: uuid.New().String(),
+	}
+
+	response.Error.Type = "Sender"
+	response.Error.Code = apiError.code
+	response.Error.Message = apiError.message
+
+	body, _ := xml.Marshal(response)
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(apiError.statusCode)
+	w.Write(body)
+}
@@ -0,0 +1,185 @@
+package offline
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func callSnsAPI(t *testing.T, r http.Handler, values url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	values.Set("Version", snsAPIVersion)
+
+	request := httptest.NewRequest(http.MethodPost, "http://localhost:3000/", strings.NewReader(values.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func TestSnsAPIPublish(t *testing.T) {
+	topics, fulfilment, archive, _ := newTestSnsTopics(t)
+
+	r := mux.NewRouter()
+	registerSnsAPIRoutes(r, topics)
+
+	recorder := callSnsAPI(t, r, url.Values{
+		"Action":                         {"Publish"},
+		"TopicArn":                       {"arn:aws:sns:eu-west-1:123456789012:orders"},
+		"Message":                        {"order placed"},
+		"Subject":                        {"New order"},
+		"MessageAttributes.entry.1.Name": {"channel"},
+		"MessageAttributes.entry.1.Value.DataType":    {"String"},
+		"MessageAttributes.entry.1.Value.StringValue": {"web"},
+	})
+
+	var response struct {
+		XMLName       xml.Name `xml:"PublishResponse"`
+		PublishResult struct {
+			MessageId string
+		}
+		ResponseMetadata struct {
+			RequestId string
+		}
+	}
+
+	if err := xml.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected Publish response %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if response.PublishResult.MessageId == "" || response.ResponseMetadata.RequestId == "" {
+		t.Errorf("expected a message ID and request ID, got %s", recorder.Body.String())
+	}
+
+	raw := archive.Receive(10, 0)
+	if len(raw) != 1 || raw[0].body != "order placed" || *raw[0].attributes["channel"].StringValue != "web" {
+		t.Fatalf("expected the message on the archive queue, got %v", raw)
+	}
+
+	received := fulfilment.Receive(10, 0)
+	if len(received) != 1 || !strings.Contains(received[0].body, `"MessageId":"`+response.PublishResult.MessageId+`"`) {
+		t.Errorf("expected the notification for the published message, got %v", received)
+	}
+}
+
+func TestSnsAPIPublishBatch(t *testing.T) {
+	topics, _, archive, _ := newTestSnsTopics(t)
+
+	r := mux.NewRouter()
+	registerSnsAPIRoutes(r, topics)
+
+	recorder := callSnsAPI(t, r, url.Values{
+		"Action":                                 {"PublishBatch"},
+		"TopicArn":                               {"arn:aws:sns:eu-west-1:000000000000:orders"},
+		"PublishBatchRequestEntries.member.1.Id": {"first"},
+		"PublishBatchRequestEntries.member.1.Message":                                     {"one"},
+		"PublishBatchRequestEntries.member.2.Id":                                          {"second"},
+		"PublishBatchRequestEntries.member.3.Id":                                          {"third"},
+		"PublishBatchRequestEntries.member.3.Message":                                     {"three"},
+		"PublishBatchRequestEntries.member.3.MessageAttributes.entry.1.Name":              {"total"},
+		"PublishBatchRequestEntries.member.3.MessageAttributes.entry.1.Value.DataType":    {"Number"},
+		"PublishBatchRequestEntries.member.3.MessageAttributes.entry.1.Value.StringValue": {"12"},
+	})
+
+	var response struct {
+		PublishBatchResult struct {
+			Successful []struct {
+				Id        string
+				MessageId string
+			} `xml:"Successful>member"`
+			Failed []struct {
+				Id          string
+				Code        string
+				Message     string
+				SenderFault bool
+			} `xml:"Failed>member"`
+		}
+	}
+
+	if err := xml.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected PublishBatch response %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	result := response.PublishBatchResult
+	if len(result.Successful) != 2 || result.Successful[0].Id != "first" || result.Successful[1].Id != "third" {
+		t.Errorf("unexpected successful entries %v", result.Successful)
+	}
+
+	if len(result.Failed) != 1 || result.Failed[0].Id != "second" || result.Failed[0].Code != "InvalidParameter" || !result.Failed[0].SenderFault {
+		t.Errorf("unexpected failed entries %v", result.Failed)
+	}
+
+	received := archive.Receive(10, 0)
+	if len(received) != 2 || received[1].body != "three" || *received[1].attributes["total"].StringValue != "12" {
+		t.Errorf("expected both messages on the archive queue, got %v", received)
+	}
+}
+
+func TestSnsAPIErrors(t *testing.T) {
+	topics, _, _, _ := newTestSnsTopics(t)
+
+	r := mux.NewRouter()
+	registerSnsAPIRoutes(r, topics)
+
+	tests := []struct {
+		values url.Values
+		code   string
+	}{
+		{url.Values{"Action": {"CreateTopic"}, "Name": {"orders"}}, "InvalidAction"},
+		{url.Values{"Action": {"Publish"}, "Message": {"no topic"}}, "InvalidParameter"},
+		{url.Values{"Action": {"Publish"}, "TopicArn": {"orders"}}, "InvalidParameter"},
+		{url.Values{"Action": {"Publish"}, "TopicArn": {"orders"}, "Message": {`{"sqs": "no default"}`}, "MessageStructure": {"json"}}, "InvalidParameter"},
+		{url.Values{"Action": {"Publish"}, "TopicArn": {"orders.fifo"}, "Message": {"no group"}}, "InvalidParameter"},
+		{url.Values{"Action": {"PublishBatch"}, "TopicArn": {"orders"}}, "EmptyBatchRequest"},
+		{url.Values{
+			"Action":                                 {"PublishBatch"},
+			"TopicArn":                               {"orders"},
+			"PublishBatchRequestEntries.member.1.Id": {"same"},
+			"PublishBatchRequestEntries.member.2.Id": {"same"},
+		}, "BatchEntryIdsNotDistinct"},
+	}
+
+	for _, test := range tests {
+		recorder := callSnsAPI(t, r, test.values)
+
+		var response struct {
+			Error struct {
+				Type string
+				Code string
+			}
+		}
+
+		if err := xml.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusBadRequest || response.Error.Code != test.code {
+			t.Errorf("expected %s for %v, got %d %s", test.code, test.values, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestSnsAPIOnlyMatchesSnsRequests(t *testing.T) {
+	topics, _, _, _ := newTestSnsTopics(t)
+
+	r := mux.NewRouter()
+	registerSnsAPIRoutes(r, topics)
+	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Write([]byte("handler saw " + r.PostForm.Get("Action")))
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("Action=Checkout"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+
+	if recorder.Body.String() != "handler saw Checkout" {
+		t.Errorf("expected other form posts to reach the handler with their body, got %q", recorder.Body.String())
+	}
+}
@@ -0,0 +1,315 @@
+package offline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func newTestSnsTopics(t *testing.T) (*snsTopics, *sqsQueue, *sqsQueue, *recordedInvocations[map[string]interface{}]) {
+	t.Helper()
+
+	ordersTopic := "arn:aws:sns:eu-west-1:000000000000:orders"
+
+	handlers := []*HandlerInstance{
+		{handlerConfig: config.HandlerMapping{Name: "Notify", Sns: &config.SnsConfig{Topic: ordersTopic}}},
+		{handlerConfig: config.HandlerMapping{Name: "LargeOrders", Sns: &config.SnsConfig{
+			Topic:        ordersTopic,
+			FilterPolicy: `{"total": [{"numeric": [">=", 100]}], "channel": ["web", "mobile"]}`,
+		}}},
+		{handlerConfig: config.HandlerMapping{Name: "Refunds", Sns: &config.SnsConfig{
+			Topic:             "orders",
+			FilterPolicy:      `{"type": ["refund"]}`,
+			FilterPolicyScope: "MessageBody",
+		}}},
+		{handlerConfig: config.HandlerMapping{Name: "Fulfilment", Sqs: &config.SqsConfig{
+			Queue: "fulfilment",
+			Sns:   &config.SnsConfig{Topic: ordersTopic},
+		}}},
+		{handlerConfig: config.HandlerMapping{Name: "Archive", Sqs: &config.SqsConfig{
+			Queue: "archive",
+			Sns:   &config.SnsConfig{Topic: ordersTopic, RawMessageDelivery: true},
+		}}},
+	}
+
+	// The queues aren't started, so messages wait to be received
+	fulfilment := newSqsQueue(handlers[3], newSqsQueueSettings(*handlers[3].handlerConfig.Sqs))
+	archive := newSqsQueue(handlers[4], newSqsQueueSettings(*handlers[4].handlerConfig.Sqs))
+	t.Cleanup(fulfilment.Close)
+	t.Cleanup(archive.Close)
+
+	topics := newSnsTopics(handlers, map[string]*sqsQueue{"Fulfilment": fulfilment, "Archive": archive}, nil)
+
+	recorded := newRecordedInvocations[map[string]interface{}]()
+	topics.execute = func(handler *HandlerInstance, record map[string]interface{}) HandlerOutput {
+		recorded.record(handler, record)
+
+		return HandlerOutput{handlerResult: &handlerResult{StatusCode: 200}}
+	}
+
+	return topics, fulfilment, archive, recorded
+}
+
+func stringAttribute(dataType string, value string) sqsMessageAttribute {
+	return sqsMessageAttribute{DataType: dataType, StringValue: &value}
+}
+
+func deliveredHandlers(deliveries []snsDelivery) []string {
+	names := make([]string, len(deliveries))
+	for i, delivery := range deliveries {
+		names[i] = delivery.Handler + "/" + delivery.Protocol
+	}
+
+	return names
+}
+
+func TestSnsFilterPolicies(t *testing.T) {
+	tests := []struct {
+		name       string
+		message    string
+		attributes map[string]sqsMessageAttribute
+		expected   string
+	}{
+		{
+			name:     "no attributes",
+			message:  "order placed",
+			expected: "Archive/sqs,Fulfilment/sqs,Notify/lambda",
+		},
+		{
+			name:    "matching attributes",
+			message: "order placed",
+			attributes: map[string]sqsMessageAttribute{
+				"total":   stringAttribute("Number", "250"),
+				"channel": stringAttribute("String", "web"),
+			},
+			expected: "Archive/sqs,Fulfilment/sqs,LargeOrders/lambda,Notify/lambda",
+		},
+		{
+			name:    "number below the threshold",
+			message: "order placed",
+			attributes: map[string]sqsMessageAttribute{
+				"total":   stringAttribute("Number", "99.5"),
+				"channel": stringAttribute("String", "web"),
+			},
+			expected: "Archive/sqs,Fulfilment/sqs,Notify/lambda",
+		},
+		{
+			name:    "string array attribute",
+			message: "order placed",
+			attributes: map[string]sqsMessageAttribute{
+				"total":   stringAttribute("Number", "100"),
+				"channel": stringAttribute("String.Array", `["store", "mobile"]`),
+			},
+			expected: "Archive/sqs,Fulfilment/sqs,LargeOrders/lambda,Notify/lambda",
+		},
+		{
+			name:     "message body scope",
+			message:  `{"type": "refund", "total": 10}`,
+			expected: "Archive/sqs,Fulfilment/sqs,Notify/lambda,Refunds/lambda",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topics, _, _, _ := newTestSnsTopics(t)
+
+			deliveries := topics.publish(snsMessage{
+				ID:                "message-id",
+				TopicArn:          "arn:aws:sns:us-east-1:123456789012:orders",
+				Message:           test.message,
+				MessageAttributes: test.attributes,
+				Timestamp:         time.Now(),
+			}, true)
+
+			if names := strings.Join(deliveredHandlers(deliveries), ","); names != test.expected {
+				t.Errorf("expected deliveries to %s, got %s", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestSnsDeliversRecordsToHandlers(t *testing.T) {
+	topics, _, _, recorded := newTestSnsTopics(t)
+
+	deliveries := topics.publish(snsMessage{
+		ID:                "message-id",
+		TopicArn:          snsTopicArn("orders"),
+		Subject:           "Order",
+		Message:           "order placed",
+		MessageAttributes: map[string]sqsMessageAttribute{"channel": stringAttribute("String", "web")},
+		Timestamp:         time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC),
+	}, true)
+
+	if deliveries[2].Outcome != "succeeded" {
+		t.Errorf("expected the Notify delivery to succeed, got %v", deliveries[2])
+	}
+
+	records := recorded.get("Notify")
+	if len(records) != 1 {
+		t.Fatalf("expected one record, got %v", records)
+	}
+
+	record, _ := json.Marshal(records[0])
+	expected := `{
+		"EventSource": "aws:sns",
+		"EventVersion": "1.0",
+		"EventSubscriptionArn": "arn:aws:sns:eu-west-1:000000000000:orders:Notify",
+		"Sns": {
+			"Type": "Notification",
+			"MessageId": "message-id",
+			"TopicArn": "arn:aws:sns:eu-west-1:000000000000:orders",
+			"Subject": "Order",
+			"Message": "order placed",
+			"Timestamp": "2026-10-19T12:00:00.000Z",
+			"SignatureVersion": "1",
+			"Signature": "EXAMPLE",
+			"SigningCertUrl": "EXAMPLE",
+			"UnsubscribeUrl": "http://localhost/?Action=Unsubscribe&SubscriptionArn=arn:aws:sns:eu-west-1:000000000000:orders:Notify",
+			"MessageAttributes": {"channel": {"Type": "String", "Value": "web"}}
+		}
+	}`
+
+	if !jsonEqual(t, record, []byte(expected)) {
+		t.Errorf("expected %s, got %s", expected, record)
+	}
+}
+
+func TestSnsFansOutToQueues(t *testing.T) {
+	topics, fulfilment, archive, _ := newTestSnsTopics(t)
+
+	topics.publish(snsMessage{
+		ID:                "message-id",
+		TopicArn:          snsTopicArn("orders"),
+		Message:           "order placed",
+		MessageAttributes: map[string]sqsMessageAttribute{"channel": stringAttribute("String", "web")},
+		Timestamp:         time.Now(),
+	}, false)
+
+	received := fulfilment.Receive(10, time.Minute)
+	if len(received) != 1 {
+		t.Fatalf("expected one message on the fulfilment queue, got %v", received)
+	}
+
+	var notification map[string]interface{}
+	if err := json.Unmarshal([]byte(received[0].body), &notification); err != nil {
+		t.Fatalf("expected the SNS notification as the message body, got %q", received[0].body)
+	}
+
+	if notification["Type"] != "Notification" || notification["Message"] != "order placed" || notification["UnsubscribeURL"] == nil {
+		t.Errorf("unexpected notification %v", notification)
+	}
+
+	if _, ok := notification["Subject"]; ok {
+		t.Errorf("expected no Subject without a subject, got %v", notification["Subject"])
+	}
+
+	if len(received[0].attributes) != 0 {
+		t.Errorf("expected message attributes only inside the notification, got %v", received[0].attributes)
+	}
+
+	raw := archive.Receive(10, time.Minute)
+	if len(raw) != 1 || raw[0].body != "order placed" {
+		t.Fatalf("expected the raw message on the archive queue, got %v", raw)
+	}
+
+	if value := raw[0].attributes["channel"].StringValue; value == nil || *value != "web" {
+		t.Errorf("expected raw delivery to keep the message attributes, got %v", raw[0].attributes)
+	}
+}
+
+func TestSnsStructuredMessages(t *testing.T) {
+	topics, fulfilment, _, recorded := newTestSnsTopics(t)
+
+	topics.publish(snsMessage{
+		ID:         "message-id",
+		TopicArn:   snsTopicArn("orders"),
+		Message:    `{"default": "for everyone", "sqs": "for queues"}`,
+		Timestamp:  time.Now(),
+		Structured: true,
+	}, true)
+
+	record := recorded.get("Notify")[0]["Sns"].(map[string]interface{})
+	if record["Message"] != "for everyone" {
+		t.Errorf("expected handlers to receive the default message, got %v", record["Message"])
+	}
+
+	received := fulfilment.Receive(10, time.Minute)
+	if len(received) != 1 || !strings.Contains(received[0].body, `"Message":"for queues"`) {
+		t.Errorf("expected queues to receive the sqs message, got %v", received)
+	}
+}
+
+func TestSnsEndpoints(t *testing.T) {
+	topics, _, _, recorded := newTestSnsTopics(t)
+
+	r := mux.NewRouter()
+	registerSnsRoutes(r, topics)
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/_sns/orders", strings.NewReader(
+		`{"Message": {"type": "refund"}, "MessageAttributes": {"total": {"DataType": "Number", "StringValue": "120"}, "channel": {"DataType": "String", "StringValue": "mobile"}}}`,
+	)))
+
+	var response struct {
+		MessageId  string        `json:"messageId"`
+		Deliveries []snsDelivery `json:"deliveries"`
+	}
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if names := strings.Join(deliveredHandlers(response.Deliveries), ","); names != "Archive/sqs,Fulfilment/sqs,LargeOrders/lambda,Notify/lambda,Refunds/lambda" {
+		t.Errorf("unexpected deliveries %s", names)
+	}
+
+	if !strings.HasPrefix(response.Deliveries[0].Outcome, "queued as ") || response.Deliveries[2].Outcome != "succeeded" {
+		t.Errorf("unexpected outcomes %v", response.Deliveries)
+	}
+
+	if message := recorded.get("Refunds")[0]["Sns"].(map[string]interface{})["Message"]; message != `{"type": "refund"}` {
+		t.Errorf("expected a JSON message to be passed on as text, got %v", message)
+	}
+
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/_sns/payments", strings.NewReader(`{"Message": "paid"}`)))
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected topics without subscriptions to be rejected, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/_sns/orders", strings.NewReader(`{"Subject": "empty"}`)))
+
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "Empty message") {
+		t.Errorf("expected an empty message to be rejected, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/_sns", nil))
+
+	var list struct {
+		Topics []struct {
+			Topic         string                   `json:"topic"`
+			Subscriptions []map[string]interface{} `json:"subscriptions"`
+		} `json:"topics"`
+	}
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse %s: %v", recorder.Body.String(), err)
+	}
+
+	if len(list.Topics) != 1 || list.Topics[0].Topic != "orders" || len(list.Topics[0].Subscriptions) != 5 {
+		t.Fatalf("unexpected topics %s", recorder.Body.String())
+	}
+
+	if list.Topics[0].Subscriptions[4]["filterPolicyScope"] != "MessageBody" {
+		t.Errorf("expected the filter policy scope of Refunds, got %v", list.Topics[0].Subscriptions[4])
+	}
+}
@@ -0,0 +1,256 @@
+package offline
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/fsnotify/fsnotify"
+)
+
+const sourceWatcherDebounce = 100 * time.Millisecond
+
+// sourceWatcher rebuilds handlers when any of the files they were compiled from
+// change. It watches the directories that contain those files rather than the
+// files themselves, so editors that save by renaming or replacing a file still
+// trigger rebuilds, and it re-derives the watched files from every new build so
+// that newly imported modules are picked up.
+type sourceWatcher struct {
+	watcher  *fsnotify.Watcher
+	debounce time.Duration
+	compile  func(handler *HandlerInstance) ([]string, error)
+
+	mutex         sync.Mutex
+	handlerInputs map[*HandlerInstance][]string
+	dependents    map[string]map[*HandlerInstance]struct{}
+	watchedDirs   map[string]struct{}
+	pending       map[*HandlerInstance]struct{}
+	timer         *time.Timer
+	done          chan struct{}
+}
+
+func newSourceWatcher(compile func(handler *HandlerInstance) ([]string, error)) (*sourceWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error watching handlers for changes: %w", err)
+	}
+
+	sw := &sourceWatcher{
+		watcher:       watcher,
+		debounce:      sourceWatcherDebounce,
+		compile:       compile,
+		handlerInputs: make(map[*HandlerInstance][]string),
+		dependents:    make(map[string]map[*HandlerInstance]struct{}),
+		watchedDirs:   make(map[string]struct{}),
+		pending:       make(map[*HandlerInstance]struct{}),
+		done:          make(chan struct{}),
+	}
+
+	go sw.processEvents()
+
+	return sw, nil
+}
+
+// Watch replaces the set of files that trigger a rebuild of handler.
+func (sw *sourceWatcher) Watch(handler *HandlerInstance, inputFiles []string) {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	sw.watchLocked(handler, inputFiles)
+}
+
+func (sw *sourceWatcher) watchLocked(handler *HandlerInstance, inputFiles []string) {
+	sw.unwatchLocked(handler)
+
+	absoluteInputs := make([]string, 0, len(inputFiles))
+
+	for _, inputFile := range inputFiles {
+		absolutePath, err := filepath.Abs(inputFile)
+		if err != nil {
+			continue
+		}
+
+		absoluteInputs = append(absoluteInputs, absolutePath)
+
+		if _, ok := sw.dependents[absolutePath]; !ok {
+			sw.dependents[absolutePath] = make(map[*HandlerInstance]struct{})
+		}
+
+		sw.dependents[absolutePath][handler] = struct{}{}
+
+		dir := filepath.Dir(absolutePath)
+		if _, ok := sw.watchedDirs[dir]; ok {
+			continue
+		}
+
+		if err := sw.watcher.Add(dir); err == nil {
+			sw.watchedDirs[dir] = struct{}{}
+		}
+	}
+
+	sw.handlerInputs[handler] = absoluteInputs
+	sw.unwatchUnusedDirsLocked()
+}
+
+// Unwatch stops rebuilding handler when its files change.
+func (sw *sourceWatcher) Unwatch(handler *HandlerInstance) {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	sw.unwatchLocked(handler)
+	sw.unwatchUnusedDirsLocked()
+	delete(sw.pending, handler)
+}
+
+func (sw *sourceWatcher) unwatchLocked(handler *HandlerInstance) {
+	for _, inputFile := range sw.handlerInputs[handler] {
+		delete(sw.dependents[inputFile], handler)
+
+		if len(sw.dependents[inputFile]) == 0 {
+			delete(sw.dependents, inputFile)
+		}
+	}
+
+	delete(sw.handlerInputs, handler)
+}
+
+// unwatchUnusedDirsLocked stops watching directories that no longer contain
+// a file that any handler depends on, such as the directory of an import that
+// was removed.
+func (sw *sourceWatcher) unwatchUnusedDirsLocked() {
+	used := make(map[string]struct{}, len(sw.watchedDirs))
+	for inputFile := range sw.dependents {
+		used[filepath.Dir(inputFile)] = struct{}{}
+	}
+
+	for dir := range sw.watchedDirs {
+		if _, ok := used[dir]; ok {
+			continue
+		}
+
+		// The directory may already have been removed, along with its watch.
+		sw.watcher.Remove(dir)
+		delete(sw.watchedDirs, dir)
+	}
+}
+
+func (sw *sourceWatcher) Close() {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	select {
+	case <-sw.done:
+		return
+	default:
+	}
+
+	close(sw.done)
+
+	if sw.timer != nil {
+		sw.timer.Stop()
+	}
+
+	sw.watcher.Close()
+}
+
+func (sw *sourceWatcher) processEvents() {
+	for {
+		select {
+		case event, ok := <-sw.watcher.Events:
+			if !ok {
+				return
+			}
+
+			sw.handleEvent(event)
+		case err, ok := <-sw.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			fmt.Println(fmt.Errorf("error watching handlers for changes: %w", err))
+		}
+	}
+}
+
+func (sw *sourceWatcher) handleEvent(event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	// A removed or renamed directory is no longer watched by fsnotify, so forget
+	// it and let the next build add it again if it still contains inputs.
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		delete(sw.watchedDirs, event.Name)
+	}
+
+	handlers, ok := sw.dependents[event.Name]
+	if !ok {
+		return
+	}
+
+	for handler := range handlers {
+		sw.pending[handler] = struct{}{}
+	}
+
+	sw.scheduleRebuildLocked()
+}
+
+func (sw *sourceWatcher) scheduleRebuildLocked() {
+	select {
+	case <-sw.done:
+		return
+	default:
+	}
+
+	if sw.timer != nil {
+		sw.timer.Stop()
+	}
+
+	sw.timer = time.AfterFunc(sw.debounce, sw.rebuildPending)
+}
+
+func (sw *sourceWatcher) rebuildPending() {
+	sw.mutex.Lock()
+	handlers := make([]*HandlerInstance, 0, len(sw.pending))
+	for handler := range sw.pending {
+		handlers = append(handlers, handler)
+	}
+	sw.pending = make(map[*HandlerInstance]struct{})
+	sw.mutex.Unlock()
+
+	var wg sync.WaitGroup
+
+	for _, handler := range handlers {
+		wg.Add(1)
+		go func(handler *HandlerInstance) {
+			defer wg.Done()
+			sw.rebuild(handler)
+		}(handler)
+	}
+
+	wg.Wait()
+}
+
+func (sw *sourceWatcher) rebuild(handler *HandlerInstance) {
+	inputFiles, err := sw.compile(handler)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	// The handler may have been unwatched while it was being rebuilt.
+	if _, ok := sw.handlerInputs[handler]; !ok {
+		return
+	}
+
+	sw.watchLocked(handler, inputFiles)
+	color.New(color.FgHiBlack).Printf("Rebuilt handler %s in %s\n", handler.handlerConfig.Name, formatBuildDuration(handler.GetBuildDuration()))
+}
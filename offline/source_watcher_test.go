@@ -0,0 +1,233 @@
+package offline
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+type recordingCompiler struct {
+	mutex  sync.Mutex
+	counts map[string]int
+	inputs map[string][]string
+}
+
+func newRecordingCompiler() *recordingCompiler {
+	return &recordingCompiler{
+		counts: make(map[string]int),
+		inputs: make(map[string][]string),
+	}
+}
+
+func (c *recordingCompiler) compile(handler *HandlerInstance) ([]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.counts[handler.handlerConfig.Name]++
+	return c.inputs[handler.handlerConfig.Name], nil
+}
+
+func (c *recordingCompiler) setInputs(name string, inputs ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.inputs[name] = inputs
+}
+
+func (c *recordingCompiler) count(name string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.counts[name]
+}
+
+func newTestSourceWatcher(t *testing.T, compiler *recordingCompiler) *sourceWatcher {
+	t.Helper()
+
+	watcher, err := newSourceWatcher(compiler.compile)
+	if err != nil {
+		t.Fatalf("failed to create source watcher: %v", err)
+	}
+
+	watcher.debounce = 20 * time.Millisecond
+	t.Cleanup(watcher.Close)
+
+	return watcher
+}
+
+func writeTestFile(t *testing.T, path string, contents string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func waitForCount(t *testing.T, compiler *recordingCompiler, name string, expected int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if compiler.count(name) >= expected {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected handler %s to be rebuilt %d time(s), got %d", name, expected, compiler.count(name))
+}
+
+func TestSourceWatcherRebuildsEveryHandlerSharingAModule(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared.ts")
+	first := filepath.Join(dir, "first.ts")
+	second := filepath.Join(dir, "second.ts")
+
+	for _, path := range []string{shared, first, second} {
+		writeTestFile(t, path, "export {}")
+	}
+
+	compiler := newRecordingCompiler()
+	compiler.setInputs("First", first, shared)
+	compiler.setInputs("Second", second, shared)
+
+	watcher := newTestSourceWatcher(t, compiler)
+	firstHandler := &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "First"}}
+	secondHandler := &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "Second"}}
+	watcher.Watch(firstHandler, []string{first, shared})
+	watcher.Watch(secondHandler, []string{second, shared})
+
+	// A burst of writes should be debounced into a single rebuild per handler.
+	for i := 0; i < 5; i++ {
+		writeTestFile(t, shared, "export const value = 1")
+	}
+
+	waitForCount(t, compiler, "First", 1)
+	waitForCount(t, compiler, "Second", 1)
+	time.Sleep(100 * time.Millisecond)
+
+	if compiler.count("First") != 1 || compiler.count("Second") != 1 {
+		t.Fatalf("expected one rebuild per handler, got First=%d Second=%d", compiler.count("First"), compiler.count("Second"))
+	}
+}
+
+func TestSourceWatcherFollowsFilesReplacedByRename(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "handler.ts")
+	writeTestFile(t, source, "export {}")
+
+	compiler := newRecordingCompiler()
+	compiler.setInputs("Handler", source)
+
+	watcher := newTestSourceWatcher(t, compiler)
+	watcher.Watch(&HandlerInstance{handlerConfig: config.HandlerMapping{Name: "Handler"}}, []string{source})
+
+	for i := 1; i <= 2; i++ {
+		temporary := filepath.Join(dir, "handler.ts.tmp")
+		writeTestFile(t, temporary, "export const value = 1")
+
+		if err := os.Rename(temporary, source); err != nil {
+			t.Fatalf("failed to replace source file: %v", err)
+		}
+
+		waitForCount(t, compiler, "Handler", i)
+	}
+}
+
+func TestSourceWatcherWatchesNewlyImportedFiles(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "handler.ts")
+	writeTestFile(t, source, "export {}")
+
+	importedDir := filepath.Join(dir, "lib")
+	if err := os.Mkdir(importedDir, 0o755); err != nil {
+		t.Fatalf("failed to create imported directory: %v", err)
+	}
+
+	imported := filepath.Join(importedDir, "imported.ts")
+	writeTestFile(t, imported, "export {}")
+
+	compiler := newRecordingCompiler()
+	compiler.setInputs("Handler", source, imported)
+
+	watcher := newTestSourceWatcher(t, compiler)
+	watcher.Watch(&HandlerInstance{handlerConfig: config.HandlerMapping{Name: "Handler"}}, []string{source})
+
+	writeTestFile(t, source, `import "./lib/imported"`)
+	waitForCount(t, compiler, "Handler", 1)
+
+	writeTestFile(t, imported, "export const value = 1")
+	waitForCount(t, compiler, "Handler", 2)
+}
+
+func TestSourceWatcherIgnoresUnwatchedHandlers(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "handler.ts")
+	writeTestFile(t, source, "export {}")
+
+	compiler := newRecordingCompiler()
+	watcher := newTestSourceWatcher(t, compiler)
+	handler := &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "Handler"}}
+	watcher.Watch(handler, []string{source})
+	watcher.Unwatch(handler)
+
+	writeTestFile(t, source, "export const value = 1")
+	time.Sleep(100 * time.Millisecond)
+
+	if count := compiler.count("Handler"); count != 0 {
+		t.Fatalf("expected unwatched handler not to be rebuilt, got %d rebuild(s)", count)
+	}
+}
+
+func TestSourceWatcherStopsWatchingDirectoriesNoLongerImported(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "handler.ts")
+	writeTestFile(t, source, `import "./lib/imported"`)
+
+	importedDir := filepath.Join(dir, "lib")
+	if err := os.Mkdir(importedDir, 0o755); err != nil {
+		t.Fatalf("failed to create imported directory: %v", err)
+	}
+
+	imported := filepath.Join(importedDir, "imported.ts")
+	writeTestFile(t, imported, "export {}")
+
+	compiler := newRecordingCompiler()
+	compiler.setInputs("Handler", source)
+
+	watcher := newTestSourceWatcher(t, compiler)
+	handler := &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "Handler"}}
+	watcher.Watch(handler, []string{source, imported})
+
+	writeTestFile(t, source, "export {}")
+	waitForCount(t, compiler, "Handler", 1)
+
+	// The watched files are replaced once the rebuild has finished.
+	waitFor(t, func() bool {
+		watcher.mutex.Lock()
+		defer watcher.mutex.Unlock()
+
+		_, watched := watcher.watchedDirs[importedDir]
+		_, depended := watcher.dependents[imported]
+
+		return !watched && !depended
+	})
+
+	writeTestFile(t, imported, "export const value = 1")
+	time.Sleep(100 * time.Millisecond)
+
+	if count := compiler.count("Handler"); count != 1 {
+		t.Errorf("expected changes to the removed import not to rebuild the handler, got %d rebuild(s)", count)
+	}
+
+	watcher.Unwatch(handler)
+
+	if watchList := watcher.watcher.WatchList(); len(watchList) != 0 {
+		t.Errorf("expected no directories to be watched once no handler is, got %v", watchList)
+	}
+}
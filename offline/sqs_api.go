@@ -0,0 +1,502 @@
+package offline
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	sqsAPITargetPrefix = "AmazonSQS."
+	sqsAPIContentType  = "application/x-amz-json-1.0"
+	// sqsAccountID is the account that local queue URLs belong to.
+	sqsAccountID = "000000000000"
+	// sqsMaxReceiveWait is the longest a ReceiveMessage call may wait for
+	// messages to arrive.
+	sqsMaxReceiveWait   = 20 * time.Second
+	sqsReceivePollDelay = 100 * time.Millisecond
+)
+
+// sqsAPIError is an error in the shape the AWS JSON protocol returns them.
+type sqsAPIError struct {
+	statusCode int
+	code       string
+	queryCode  string
+	message    string
+}
+
+func (err *sqsAPIError) Error() string {
+	return err.message
+}
+
+func newSqsInvalidParameterError(format string, args ...interface{}) *sqsAPIError {
+	return &sqsAPIError{
+		statusCode: http.StatusBadRequest,
+		code:       "InvalidParameterValue",
+		queryCode:  "InvalidParameterValue",
+		message:    fmt.Sprintf(format, args...),
+	}
+}
+
+func newSqsQueueDoesNotExistError(queueName string) *sqsAPIError {
+	return &sqsAPIError{
+		statusCode: http.StatusBadRequest,
+		code:       "QueueDoesNotExist",
+		queryCode:  "AWS.SimpleQueueService.NonExistentQueue",
+		message:    fmt.Sprintf("The specified queue %s does not exist.", queueName),
+	}
+}
+
+// registerSqsAPIRoutes serves the subset of the SQS API that application code
+// uses to send messages, using the AWS JSON protocol. It is backed by the
+// local queues, so messages sent with an AWS SDK reach SQS-triggered handlers.
+//
+// SQS API requests are POSTed to the root path and identified by their
+// X-Amz-Target header, so the route is registered ahead of handler routes.
+func registerSqsAPIRoutes(r *mux.Router, queues map[string]*sqsQueue) {
+	api := &sqsAPI{queues: queues}
+
+	r.HandleFunc("/", api.ServeHTTP).
+		Methods(http.MethodPost).
+		HeadersRegexp("X-Amz-Target", "^"+strings.ReplaceAll(sqsAPITargetPrefix, ".", `\.`))
+}
+
+type sqsAPI struct {
+	// queues is the map nextSqsQueues returned for the router, which a reload
+	// replaces instead of modifying, so it is read without locking.
+	queues map[string]*sqsQueue
+}
+
+func (api *sqsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), sqsAPITargetPrefix)
+
+	var response interface{}
+	var err error
+
+	switch action {
+	case "GetQueueUrl":
+		response, err = api.getQueueUrl(r)
+	case "SendMessage":
+		response, err = api.sendMessage(r)
+	case "SendMessageBatch":
+		response, err = api.sendMessageBatch(r)
+	case "ReceiveMessage":
+		response, err = api.receiveMessage(r)
+	case "DeleteMessage":
+		response, err = api.deleteMessage(r)
+	default:
+		err = &sqsAPIError{
+			statusCode: http.StatusBadRequest,
+			code:       "UnsupportedOperation",
+			queryCode:  "AWS.SimpleQueueService.UnsupportedOperation",
+			message:    fmt.Sprintf("terrable does not support the SQS %s action.", action),
+		}
+	}
+
+	if err != nil {
+		writeSqsAPIError(w, err)
+		return
+	}
+
+	fmt.Printf("SQS API %s\n", action)
+
+	body, _ := json.Marshal(response)
+
+	w.Header().Set("Content-Type", sqsAPIContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func writeSqsAPIError(w http.ResponseWriter, err error) {
+	apiError, ok := err.(*sqsAPIError)
+	if !ok {
+		apiError = &sqsAPIError{
+			statusCode: http.StatusInternalServerError,
+			code:       "InternalError",
+			queryCode:  "InternalError",
+			message:    err.Error(),
+		}
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"__type":  "com.amazonaws.sqs#" + apiError.code,
+		"message": apiError.message,
+	})
+
+	w.Header().Set("Content-Type", sqsAPIContentType)
+	w.Header().Set("x-amzn-query-error", apiError.queryCode+";Sender")
+	w.WriteHeader(apiError.statusCode)
+	w.Write(body)
+}
+
+func decodeSqsAPIRequest(r *http.Request, request interface{}) error {
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		return newSqsInvalidParameterError("The request body is not valid JSON: %s", err)
+	}
+
+	return nil
+}
+
+// queueByName finds the local queue with the given name. Queues are searched in
+// handler name order, so the same queue is found when several handlers are
+// triggered by it.
+func (api *sqsAPI) queueByName(queueName string) (*sqsQueue, error) {
+	handlerNames := make([]string, 0, len(api.queues))
+	for name := range api.queues {
+		handlerNames = append(handlerNames, name)
+	}
+
+	sort.Strings(handlerNames)
+
+	for _, name := range handlerNames {
+		if queue := api.queues[name]; queue.QueueName() == queueName {
+			return queue, nil
+		}
+	}
+
+	return nil, newSqsQueueDoesNotExistError(queueName)
+}
+
+// queueByUrl finds a queue by the last segment of its URL, so that URLs built
+// for real AWS accounts also resolve to local queues.
+func (api *sqsAPI) queueByUrl(queueUrl string) (*sqsQueue, error) {
+	if queueUrl == "" {
+		return nil, &sqsAPIError{
+			statusCode: http.StatusBadRequest,
+			code:       "MissingParameter",
+			queryCode:  "MissingParameter",
+			message:    "The request must contain the parameter QueueUrl.",
+		}
+	}
+
+	parsedUrl, err := url.Parse(queueUrl)
+	if err != nil {
+		return nil, newSqsInvalidParameterError("Invalid QueueUrl %s.", queueUrl)
+	}
+
+	return api.queueByName(path.Base(parsedUrl.Path))
+}
+
+func sqsQueueUrl(r *http.Request, queueName string) string {
+	return fmt.Sprintf("http://%s/%s/%s", r.Host, sqsAccountID, queueName)
+}
+
+func (api *sqsAPI) getQueueUrl(r *http.Request) (interface{}, error) {
+	var request struct {
+		QueueName string
+	}
+
+	if err := decodeSqsAPIRequest(r, &request); err != nil {
+		return nil, err
+	}
+
+	if _, err := api.queueByName(request.QueueName); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"QueueUrl": sqsQueueUrl(r, request.QueueName)}, nil
+}
+
+type sqsSendMessageEntry struct {
+	Id                     string
+	MessageBody            string
+	DelaySeconds           int
+	MessageAttributes      map[string]sqsMessageAttribute
+	MessageGroupId         string
+	MessageDeduplicationId string
+}
+
+type sqsSendMessageResult struct {
+	Id                     string `json:",omitempty"`
+	MessageId              string
+	MD5OfMessageBody       string
+	MD5OfMessageAttributes string `json:",omitempty"`
+	SequenceNumber         string `json:",omitempty"`
+}
+
+func (api *sqsAPI) sendMessage(r *http.Request) (interface{}, error) {
+	var request struct {
+		QueueUrl string
+		sqsSendMessageEntry
+	}
+
+	if err := decodeSqsAPIRequest(r, &request); err != nil {
+		return nil, err
+	}
+
+	queue, err := api.queueByUrl(request.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return sendSqsMessageEntry(queue, request.sqsSendMessageEntry)
+}
+
+func (api *sqsAPI) sendMessageBatch(r *http.Request) (interface{}, error) {
+	var request struct {
+		QueueUrl string
+		Entries  []sqsSendMessageEntry
+	}
+
+	if err := decodeSqsAPIRequest(r, &request); err != nil {
+		return nil, err
+	}
+
+	queue, err := api.queueByUrl(request.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(request.Entries) == 0 || len(request.Entries) > 10 {
+		return nil, newSqsInvalidParameterError("A batch must contain between 1 and 10 entries.")
+	}
+
+	type failedEntry struct {
+		Id          string
+		SenderFault bool
+		Code        string
+		Message     string
+	}
+
+	successful := []sqsSendMessageResult{}
+	failed := []failedEntry{}
+
+	for _, entry := range request.Entries {
+		result, err := sendSqsMessageEntry(queue, entry)
+		if err != nil {
+			failed = append(failed, failedEntry{Id: entry.Id, SenderFault: true, Code: "InvalidParameterValue", Message: err.Error()})
+			continue
+		}
+
+		result.Id = entry.Id
+		successful = append(successful, *result)
+	}
+
+	return map[string]interface{}{
+		"Successful": successful,
+		"Failed":     failed,
+	}, nil
+}
+
+func sendSqsMessageEntry(queue *sqsQueue, entry sqsSendMessageEntry) (*sqsSendMessageResult, error) {
+	if entry.MessageBody == "" {
+		return nil, newSqsInvalidParameterError("The message body must not be empty.")
+	}
+
+	if entry.DelaySeconds < 0 || entry.DelaySeconds > 900 {
+		return nil, newSqsInvalidParameterError("DelaySeconds must be between 0 and 900.")
+	}
+
+	if queue.IsFifo() {
+		if entry.MessageGroupId == "" {
+			return nil, &sqsAPIError{
+				statusCode: http.StatusBadRequest,
+				code:       "MissingParameter",
+				queryCode:  "MissingParameter",
+				message:    "The request must contain the parameter MessageGroupId.",
+			}
+		}
+
+		if entry.DelaySeconds != 0 {
+			return nil, newSqsInvalidParameterError("DelaySeconds is not supported on messages sent to FIFO queues.")
+		}
+	}
+
+	result, err := queue.Send(sqsMessageInput{
+		Body:            entry.MessageBody,
+		Attributes:      entry.MessageAttributes,
+		Delay:           time.Duration(entry.DelaySeconds) * time.Second,
+		GroupID:         entry.MessageGroupId,
+		DeduplicationID: entry.MessageDeduplicationId,
+	})
+	if err != nil {
+		return nil, newSqsInvalidParameterError("The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly.")
+	}
+
+	return &sqsSendMessageResult{
+		MessageId:              result.MessageID,
+		MD5OfMessageBody:       fmt.Sprintf("%x", md5.Sum([]byte(entry.MessageBody))),
+		MD5OfMessageAttributes: md5OfMessageAttributes(entry.MessageAttributes),
+		SequenceNumber:         result.SequenceNumber,
+	}, nil
+}
+
+func (api *sqsAPI) receiveMessage(r *http.Request) (interface{}, error) {
+	var request struct {
+		QueueUrl              string
+		MaxNumberOfMessages   int
+		VisibilityTimeout     *int
+		WaitTimeSeconds       int
+		MessageAttributeNames []string
+	}
+
+	if err := decodeSqsAPIRequest(r, &request); err != nil {
+		return nil, err
+	}
+
+	queue, err := api.queueByUrl(request.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.MaxNumberOfMessages == 0 {
+		request.MaxNumberOfMessages = 1
+	}
+
+	if request.MaxNumberOfMessages < 1 || request.MaxNumberOfMessages > 10 {
+		return nil, newSqsInvalidParameterError("MaxNumberOfMessages must be between 1 and 10.")
+	}
+
+	visibilityTimeout := time.Duration(-1)
+	if request.VisibilityTimeout != nil {
+		visibilityTimeout = time.Duration(*request.VisibilityTimeout) * time.Second
+	}
+
+	wait := time.Duration(request.WaitTimeSeconds) * time.Second
+	if wait > sqsMaxReceiveWait {
+		return nil, newSqsInvalidParameterError("WaitTimeSeconds must be between 0 and 20.")
+	}
+
+	// Long polling checks the queue until messages arrive or the wait is over
+	deadline := time.Now().Add(wait)
+	received := queue.Receive(request.MaxNumberOfMessages, visibilityTimeout)
+
+	for len(received) == 0 && time.Now().Before(deadline) {
+		select {
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		case <-queue.done:
+			return nil, newSqsQueueDoesNotExistError(queue.QueueName())
+		case <-time.After(sqsReceivePollDelay):
+		}
+
+		received = queue.Receive(request.MaxNumberOfMessages, visibilityTimeout)
+	}
+
+	messages := make([]map[string]interface{}, len(received))
+	for i, message := range received {
+		attributes := filterSqsMessageAttributes(message.attributes, request.MessageAttributeNames)
+
+		systemAttributes := map[string]string{
+			"SenderId":                         "SIMULATOR",
+			"SentTimestamp":                    fmt.Sprintf("%d", message.sentAt.UnixMilli()),
+			"ApproximateReceiveCount":          fmt.Sprintf("%d", message.receiveCount),
+			"ApproximateFirstReceiveTimestamp": fmt.Sprintf("%d", message.firstReceivedAt.UnixMilli()),
+		}
+
+		if message.sequenceNumber != "" {
+			systemAttributes["MessageGroupId"] = message.groupID
+			systemAttributes["MessageDeduplicationId"] = message.deduplicationID
+			systemAttributes["SequenceNumber"] = message.sequenceNumber
+		}
+
+		messages[i] = map[string]interface{}{
+			"MessageId":     message.id,
+			"ReceiptHandle": message.receiptHandle,
+			"MD5OfBody":     fmt.Sprintf("%x", md5.Sum([]byte(message.body))),
+			"Body":          message.body,
+			"Attributes":    systemAttributes,
+		}
+
+		if len(attributes) > 0 {
+			messages[i]["MessageAttributes"] = attributes
+			messages[i]["MD5OfMessageAttributes"] = md5OfMessageAttributes(attributes)
+		}
+	}
+
+	return map[string]interface{}{"Messages": messages}, nil
+}
+
+func (api *sqsAPI) deleteMessage(r *http.Request) (interface{}, error) {
+	var request struct {
+		QueueUrl      string
+		ReceiptHandle string
+	}
+
+	if err := decodeSqsAPIRequest(r, &request); err != nil {
+		return nil, err
+	}
+
+	queue, err := api.queueByUrl(request.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.ReceiptHandle == "" {
+		return nil, newSqsInvalidParameterError("The receipt handle must not be empty.")
+	}
+
+	queue.Delete(request.ReceiptHandle)
+
+	return map[string]interface{}{}, nil
+}
+
+// filterSqsMessageAttributes returns the attributes a ReceiveMessage call asked
+// for by name, by "All" or ".*", or by a prefix such as "trace.*".
+func filterSqsMessageAttributes(attributes map[string]sqsMessageAttribute, names []string) map[string]sqsMessageAttribute {
+	filtered := make(map[string]sqsMessageAttribute)
+
+	for attributeName, attribute := range attributes {
+		for _, name := range names {
+			prefix, isPrefix := strings.CutSuffix(name, ".*")
+
+			if name == "All" || name == ".*" || name == attributeName || (isPrefix && strings.HasPrefix(attributeName, prefix+".")) {
+				filtered[attributeName] = attribute
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+// md5OfMessageAttributes computes the digest SQS returns for message
+// attributes, which SDKs use to verify them.
+func md5OfMessageAttributes(attributes map[string]sqsMessageAttribute) string {
+	if len(attributes) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+
+	writeValue := func(value []byte) {
+		binary.Write(&buffer, binary.BigEndian, uint32(len(value)))
+		buffer.Write(value)
+	}
+
+	for _, name := range names {
+		attribute := attributes[name]
+
+		writeValue([]byte(name))
+		writeValue([]byte(attribute.DataType))
+
+		if attribute.StringValue != nil {
+			buffer.WriteByte(1)
+			writeValue([]byte(*attribute.StringValue))
+		} else {
+			buffer.WriteByte(2)
+			writeValue(attribute.BinaryValue)
+		}
+	}
+
+	return fmt.Sprintf("%x", md5.Sum(buffer.Bytes()))
+}
@@ -0,0 +1,226 @@
+package offline
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func newTestSqsAPI(t *testing.T) (*mux.Router, *sqsQueue) {
+	t.Helper()
+
+	handler := &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "OrderHandler"}}
+
+	// The queue isn't started, so messages wait for ReceiveMessage
+	queue := newSqsQueue(handler, newSqsQueueSettings(config.SqsConfig{Queue: "arn:aws:sqs:eu-west-1:000000000000:orders"}))
+	t.Cleanup(queue.Close)
+
+	r := mux.NewRouter()
+	registerSqsAPIRoutes(r, map[string]*sqsQueue{"OrderHandler": queue})
+
+	return r, queue
+}
+
+func callSqsAPI(t *testing.T, r http.Handler, action string, request string) (int, map[string]interface{}) {
+	t.Helper()
+
+	httpRequest := httptest.NewRequest(http.MethodPost, "http://localhost:3000/", strings.NewReader(request))
+	httpRequest.Header.Set("Content-Type", sqsAPIContentType)
+	httpRequest.Header.Set("X-Amz-Target", sqsAPITargetPrefix+action)
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httpRequest)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse %s response %q: %v", action, recorder.Body.String(), err)
+	}
+
+	return recorder.Code, response
+}
+
+func TestSqsAPISendReceiveDelete(t *testing.T) {
+	r, queue := newTestSqsAPI(t)
+
+	status, response := callSqsAPI(t, r, "GetQueueUrl", `{"QueueName":"orders"}`)
+	if status != http.StatusOK || response["QueueUrl"] != "http://localhost:3000/000000000000/orders" {
+		t.Fatalf("unexpected GetQueueUrl response %d %v", status, response)
+	}
+
+	status, response = callSqsAPI(t, r, "SendMessage", `{
+		"QueueUrl": "https://sqs.eu-west-1.amazonaws.com/123456789012/orders",
+		"MessageBody": "order placed",
+		"MessageAttributes": {"type": {"DataType": "String", "StringValue": "placed"}}
+	}`)
+	if status != http.StatusOK || response["MessageId"] == "" || response["MD5OfMessageBody"] != fmt.Sprintf("%x", md5.Sum([]byte("order placed"))) {
+		t.Fatalf("unexpected SendMessage response %d %v", status, response)
+	}
+
+	sentMessageID := response["MessageId"]
+	sentAttributesMD5 := response["MD5OfMessageAttributes"]
+
+	status, response = callSqsAPI(t, r, "ReceiveMessage", `{
+		"QueueUrl": "http://localhost:3000/000000000000/orders",
+		"MaxNumberOfMessages": 10,
+		"MessageAttributeNames": ["All"]
+	}`)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected ReceiveMessage status %d %v", status, response)
+	}
+
+	messages := response["Messages"].([]interface{})
+	if len(messages) != 1 {
+		t.Fatalf("expected one message, got %v", messages)
+	}
+
+	message := messages[0].(map[string]interface{})
+	if message["MessageId"] != sentMessageID || message["Body"] != "order placed" {
+		t.Errorf("unexpected message %v", message)
+	}
+
+	if message["MD5OfMessageAttributes"] != sentAttributesMD5 || sentAttributesMD5 == "" {
+		t.Errorf("expected matching attribute digests, sent %v and received %v", sentAttributesMD5, message["MD5OfMessageAttributes"])
+	}
+
+	if attributes := message["Attributes"].(map[string]interface{}); attributes["ApproximateReceiveCount"] != "1" {
+		t.Errorf("expected the first receive to be counted, got %v", attributes)
+	}
+
+	if state := queue.State(); len(state.InFlight) != 1 {
+		t.Errorf("expected the received message to be in flight, got %+v", state)
+	}
+
+	status, _ = callSqsAPI(t, r, "DeleteMessage", `{
+		"QueueUrl": "http://localhost:3000/000000000000/orders",
+		"ReceiptHandle": "`+message["ReceiptHandle"].(string)+`"
+	}`)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected DeleteMessage status %d", status)
+	}
+
+	if state := queue.State(); len(state.InFlight)+len(state.Available) != 0 {
+		t.Errorf("expected the deleted message to be gone, got %+v", state)
+	}
+}
+
+func TestSqsAPIReceiveHonoursVisibilityTimeout(t *testing.T) {
+	r, queue := newTestSqsAPI(t)
+	queue.Send(sqsMessageInput{Body: "hidden"})
+
+	receive := func() int {
+		_, response := callSqsAPI(t, r, "ReceiveMessage", `{"QueueUrl":"http://localhost:3000/000000000000/orders","VisibilityTimeout":0}`)
+		return len(response["Messages"].([]interface{}))
+	}
+
+	if receive() != 1 || receive() != 1 {
+		t.Fatal("expected a zero visibility timeout to leave the message visible")
+	}
+
+	state := queue.State()
+	if len(state.Available) != 1 || state.Available[0].ReceiveCount != 2 {
+		t.Errorf("expected the message to have been received twice, got %+v", state)
+	}
+}
+
+func TestSqsAPIReceiveWaitsForMessages(t *testing.T) {
+	r, queue := newTestSqsAPI(t)
+
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		queue.Send(sqsMessageInput{Body: "late"})
+	}()
+
+	_, response := callSqsAPI(t, r, "ReceiveMessage", `{"QueueUrl":"http://localhost:3000/000000000000/orders","WaitTimeSeconds":2}`)
+	if messages := response["Messages"].([]interface{}); len(messages) != 1 {
+		t.Fatalf("expected long polling to return the late message, got %v", messages)
+	}
+}
+
+func TestSqsAPIErrors(t *testing.T) {
+	r, _ := newTestSqsAPI(t)
+
+	status, response := callSqsAPI(t, r, "GetQueueUrl", `{"QueueName":"missing"}`)
+	if status != http.StatusBadRequest || response["__type"] != "com.amazonaws.sqs#QueueDoesNotExist" {
+		t.Errorf("unexpected response for a missing queue %d %v", status, response)
+	}
+
+	status, response = callSqsAPI(t, r, "PurgeQueue", `{"QueueUrl":"http://localhost:3000/000000000000/orders"}`)
+	if status != http.StatusBadRequest || response["__type"] != "com.amazonaws.sqs#UnsupportedOperation" {
+		t.Errorf("unexpected response for an unsupported action %d %v", status, response)
+	}
+
+	status, response = callSqsAPI(t, r, "SendMessageBatch", `{
+		"QueueUrl": "http://localhost:3000/000000000000/orders",
+		"Entries": [{"Id": "ok", "MessageBody": "fine"}, {"Id": "empty", "MessageBody": ""}]
+	}`)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected SendMessageBatch status %d %v", status, response)
+	}
+
+	if successful, failed := response["Successful"].([]interface{}), response["Failed"].([]interface{}); len(successful) != 1 || len(failed) != 1 {
+		t.Errorf("expected one successful and one failed entry, got %v", response)
+	}
+}
+
+func TestSqsAPIFifoDeduplicationID(t *testing.T) {
+	handler := &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "OrderHandler"}}
+	queue := newSqsQueue(handler, newSqsQueueSettings(config.SqsConfig{Queue: "arn:aws:sqs:eu-west-1:000000000000:orders.fifo"}))
+	t.Cleanup(queue.Close)
+
+	r := mux.NewRouter()
+	registerSqsAPIRoutes(r, map[string]*sqsQueue{"OrderHandler": queue})
+
+	status, response := callSqsAPI(t, r, "SendMessage", `{
+		"QueueUrl": "http://localhost:3000/000000000000/orders.fifo",
+		"MessageBody": "order placed",
+		"MessageGroupId": "orders"
+	}`)
+	if status != http.StatusBadRequest || response["__type"] != "com.amazonaws.sqs#InvalidParameterValue" {
+		t.Errorf("expected a message without a deduplication ID to be rejected, got %d %v", status, response)
+	}
+
+	status, response = callSqsAPI(t, r, "SendMessage", `{
+		"QueueUrl": "http://localhost:3000/000000000000/orders.fifo",
+		"MessageBody": "order placed",
+		"MessageGroupId": "orders",
+		"MessageDeduplicationId": "order-1"
+	}`)
+	if status != http.StatusOK || response["SequenceNumber"] == nil {
+		t.Errorf("expected a message with a deduplication ID to be sent, got %d %v", status, response)
+	}
+}
+
+func TestSqsAPIDuringReload(t *testing.T) {
+	serveDuringSqsReloads(t, func() *http.Request {
+		request := httptest.NewRequest(http.MethodPost, "http://localhost:3000/", strings.NewReader(`{"QueueName":"orders"}`))
+		request.Header.Set("Content-Type", sqsAPIContentType)
+		request.Header.Set("X-Amz-Target", sqsAPITargetPrefix+"GetQueueUrl")
+
+		return request
+	})
+}
+
+func TestMd5OfMessageAttributes(t *testing.T) {
+	value := "placed"
+
+	first := md5OfMessageAttributes(map[string]sqsMessageAttribute{
+		"type":  {DataType: "String", StringValue: &value},
+		"image": {DataType: "Binary", BinaryValue: []byte{1, 2, 3}},
+	})
+
+	if len(first) != 32 {
+		t.Fatalf("expected a hex MD5 digest, got %q", first)
+	}
+
+	if md5OfMessageAttributes(nil) != "" {
+		t.Error("expected no digest without attributes")
+	}
+}
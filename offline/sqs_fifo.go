@@ -0,0 +1,60 @@
+package offline
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// sqsDeduplicationWindow is how long a FIFO queue remembers a deduplication ID.
+const sqsDeduplicationWindow = 5 * time.Minute
+
+type sqsDeduplicationEntry struct {
+	messageID      string
+	sequenceNumber string
+	expiresAt      time.Time
+}
+
+// deduplicated returns the message previously sent with deduplicationID, if it
+// was sent within the deduplication window. Expired entries are forgotten.
+// The caller must hold the queue's mutex.
+func (queue *sqsQueue) deduplicated(deduplicationID string, now time.Time) (sqsDeduplicationEntry, bool) {
+	for id, entry := range queue.deduplication {
+		if !entry.expiresAt.After(now) {
+			delete(queue.deduplication, id)
+		}
+	}
+
+	entry, ok := queue.deduplication[deduplicationID]
+	return entry, ok
+}
+
+// errSqsMissingDeduplicationID is returned when a message without a
+// deduplication ID is sent to a FIFO queue that does not use content-based
+// deduplication.
+var errSqsMissingDeduplicationID = errors.New("the queue should either have content-based deduplication enabled or a deduplication ID provided explicitly")
+
+// contentDeduplicationID is the deduplication ID SQS derives from a message's
+// body when content-based deduplication is enabled.
+func contentDeduplicationID(body string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(body)))
+}
+
+// failLaterGroupMessages fails every message that follows a failed message of
+// the same group in a FIFO batch, so that a group is never processed out of
+// order.
+func failLaterGroupMessages(batch []*sqsMessage, failures map[string]string) {
+	failedGroups := make(map[string]bool)
+
+	for _, message := range batch {
+		if failures[message.id] != "" {
+			failedGroups[message.groupID] = true
+			continue
+		}
+
+		if failedGroups[message.groupID] {
+			failures[message.id] = "an earlier message in its group failed"
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package offline
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+func newTestFifoQueue(t *testing.T, settings sqsQueueSettings, execute func(records []map[string]interface{}) int) (*sqsQueue, chan sqsTestBatch) {
+	t.Helper()
+
+	settings.queueArn = sqsQueueArn("orders.fifo")
+	settings.fifo = true
+
+	batches := make(chan sqsTestBatch, 10)
+	handler := &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "FifoHandler"}}
+
+	queue := newSqsQueue(handler, settings)
+	queue.execute = func(handler *HandlerInstance, records []map[string]interface{}) HandlerOutput {
+		statusCode := execute(records)
+		batches <- sqsTestBatch{records: records}
+		return sqsTestOutput(statusCode)
+	}
+
+	queue.start()
+	t.Cleanup(queue.Close)
+
+	return queue, batches
+}
+
+func TestFifoQueueBlocksGroupsWhileMessagesAreInFlight(t *testing.T) {
+	var mutex sync.Mutex
+	failedOnce := false
+
+	queue, batches := newTestFifoQueue(t, sqsQueueSettings{
+		batchSize:                 1,
+		visibilityTimeout:         150 * time.Millisecond,
+		contentBasedDeduplication: true,
+	}, func(records []map[string]interface{}) int {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if records[0]["body"] == "a1" && !failedOnce {
+			failedOnce = true
+			return http.StatusInternalServerError
+		}
+
+		return http.StatusOK
+	})
+
+	queue.Send(sqsMessageInput{Body: "a1", GroupID: "a"})
+	queue.Send(sqsMessageInput{Body: "a2", GroupID: "a"})
+	queue.Send(sqsMessageInput{Body: "b1", GroupID: "b"})
+
+	var delivered []interface{}
+	for range 4 {
+		delivered = append(delivered, waitForSqsBatch(t, batches).records[0]["body"])
+	}
+
+	if expected := []interface{}{"a1", "b1", "a1", "a2"}; !reflect.DeepEqual(delivered, expected) {
+		t.Errorf("expected deliveries %v, got %v", expected, delivered)
+	}
+}
+
+func TestFifoQueueDeduplicatesMessages(t *testing.T) {
+	queue, _ := newTestFifoQueue(t, sqsQueueSettings{
+		batchSize:                 10,
+		batchingWindow:            time.Minute,
+		visibilityTimeout:         time.Minute,
+		contentBasedDeduplication: true,
+	}, func(records []map[string]interface{}) int {
+		return http.StatusOK
+	})
+
+	first, _ := queue.Send(sqsMessageInput{Body: "order 1", GroupID: "orders"})
+	contentDuplicate, _ := queue.Send(sqsMessageInput{Body: "order 1", GroupID: "orders"})
+
+	if !contentDuplicate.Duplicate || contentDuplicate.MessageID != first.MessageID || contentDuplicate.Delivered != nil {
+		t.Errorf("expected the same body to be deduplicated, got %+v", contentDuplicate)
+	}
+
+	explicit, _ := queue.Send(sqsMessageInput{Body: "order 1", GroupID: "orders", DeduplicationID: "retry-1"})
+	explicitDuplicate, _ := queue.Send(sqsMessageInput{Body: "order 2", GroupID: "orders", DeduplicationID: "retry-1"})
+
+	if explicit.Duplicate || !explicitDuplicate.Duplicate || explicitDuplicate.MessageID != explicit.MessageID {
+		t.Errorf("expected explicit deduplication IDs to take precedence, got %+v and %+v", explicit, explicitDuplicate)
+	}
+
+	if explicit.SequenceNumber <= first.SequenceNumber {
+		t.Errorf("expected increasing sequence numbers, got %s then %s", first.SequenceNumber, explicit.SequenceNumber)
+	}
+
+	if state := queue.State(); len(state.Available) != 2 {
+		t.Errorf("expected two messages on the queue, got %+v", state.Available)
+	}
+}
+
+func TestFifoQueueRequiresADeduplicationIDWithoutContentBasedDeduplication(t *testing.T) {
+	queue := newSqsQueue(&HandlerInstance{}, sqsQueueSettings{fifo: true})
+
+	if _, err := queue.Send(sqsMessageInput{Body: "order 1", GroupID: "orders"}); err != errSqsMissingDeduplicationID {
+		t.Errorf("expected a message without a deduplication ID to be rejected, got %v", err)
+	}
+
+	if _, err := queue.Send(sqsMessageInput{Body: "order 1", GroupID: "orders", DeduplicationID: "order-1"}); err != nil {
+		t.Errorf("expected a message with a deduplication ID to be sent, got %v", err)
+	}
+}
+
+func TestFifoQueueDeduplicationWindowExpires(t *testing.T) {
+	queue := newSqsQueue(&HandlerInstance{}, sqsQueueSettings{fifo: true})
+
+	queue.deduplication["expired"] = sqsDeduplicationEntry{messageID: "old", expiresAt: time.Now().Add(-time.Second)}
+
+	if _, ok := queue.deduplicated("expired", time.Now()); ok {
+		t.Error("expected expired deduplication IDs to be forgotten")
+	}
+}
+
+func TestFifoQueueRecordsCarryOrderingAttributes(t *testing.T) {
+	queue, batches := newTestFifoQueue(t, sqsQueueSettings{
+		batchSize:         10,
+		visibilityTimeout: time.Minute,
+	}, func(records []map[string]interface{}) int {
+		return http.StatusOK
+	})
+
+	sent, _ := queue.Send(sqsMessageInput{Body: "order", GroupID: "orders", DeduplicationID: "order-1"})
+
+	attributes := waitForSqsBatch(t, batches).records[0]["attributes"].(map[string]interface{})
+
+	if attributes["MessageGroupId"] != "orders" || attributes["MessageDeduplicationId"] != "order-1" || attributes["SequenceNumber"] != sent.SequenceNumber {
+		t.Errorf("unexpected FIFO attributes %v", attributes)
+	}
+}
+
+func TestFailLaterGroupMessages(t *testing.T) {
+	batch := []*sqsMessage{
+		{id: "a1", groupID: "a"},
+		{id: "b1", groupID: "b"},
+		{id: "a2", groupID: "a"},
+	}
+
+	failures := map[string]string{"a1": "handler error"}
+	failLaterGroupMessages(batch, failures)
+
+	expected := map[string]string{
+		"a1": "handler error",
+		"a2": "an earlier message in its group failed",
+	}
+
+	if !reflect.DeepEqual(failures, expected) {
+		t.Errorf("expected %v, got %v", expected, failures)
+	}
+}
@@ -0,0 +1,811 @@
+package offline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/terrable-dev/terrable/config"
+)
+
+const (
+	defaultSqsBatchSize         = 10
+	defaultSqsVisibilityTimeout = 30 * time.Second
+)
+
+// sqsQueueSettings mirror the event source mapping and redrive policy of an SQS
+// trigger.
+type sqsQueueSettings struct {
+	queueArn          string
+	batchSize         int
+	batchingWindow    time.Duration
+	visibilityTimeout time.Duration
+	// maxReceiveCount is the number of receives after which a message moves to
+	// the dead-letter queue. Zero keeps retrying it forever.
+	maxReceiveCount int
+	// fifo queues deliver each message group in order and deduplicate
+	// messages.
+	fifo bool
+	// contentBasedDeduplication deduplicates messages sent to a FIFO queue
+	// without a deduplication ID by their body.
+	contentBasedDeduplication bool
+}
+
+func newSqsQueueSettings(sqs config.SqsConfig) sqsQueueSettings {
+	settings := sqsQueueSettings{
+		queueArn:                  sqsQueueArn(sqs.Queue),
+		batchSize:                 sqs.BatchSize,
+		batchingWindow:            time.Duration(sqs.MaximumBatchingWindowSeconds) * time.Second,
+		visibilityTimeout:         time.Duration(sqs.VisibilityTimeoutSeconds) * time.Second,
+		maxReceiveCount:           sqs.MaxReceiveCount,
+		fifo:                      strings.HasSuffix(sqs.QueueName(), ".fifo"),
+		contentBasedDeduplication: sqs.ContentBasedDeduplication,
+	}
+
+	if settings.batchSize == 0 {
+		settings.batchSize = defaultSqsBatchSize
+	}
+
+	if settings.visibilityTimeout == 0 {
+		settings.visibilityTimeout = defaultSqsVisibilityTimeout
+	}
+
+	return settings
+}
+
+type sqsMessage struct {
+	id              string
+	body            string
+	attributes      map[string]sqsMessageAttribute
+	receiptHandle   string
+	groupID         string
+	deduplicationID string
+	sequenceNumber  string
+	sentAt          time.Time
+	firstReceivedAt time.Time
+	receiveCount    int
+	visibleAt       time.Time
+	// lastFailure explains why the most recent delivery failed.
+	lastFailure string
+	// delivered receives the outcome of the first delivery, for senders that
+	// wait for it.
+	delivered chan sqsDelivery
+}
+
+// sqsDelivery is the outcome of delivering one message.
+type sqsDelivery struct {
+	messageID string
+	output    HandlerOutput
+	// failure is empty when the message was processed successfully.
+	failure string
+}
+
+// sqsQueue is the local queue in front of an SQS-triggered handler. Messages
+// are polled in batches and stay on the queue until the handler succeeds. A
+// failed batch becomes visible again once the visibility timeout expires.
+// Queues outlive handler instances so that messages survive reloads.
+type sqsQueue struct {
+	mutex       sync.Mutex
+	handler     *HandlerInstance
+	settings    sqsQueueSettings
+	messages    []*sqsMessage
+	deadLetters []*sqsMessage
+
+	// deduplication remembers the messages recently sent to a FIFO queue by
+	// deduplication ID.
+	deduplication  map[string]sqsDeduplicationEntry
+	sequenceNumber uint64
+
+	// execute runs a batch of records on the handler.
+	execute func(handler *HandlerInstance, records []map[string]interface{}) HandlerOutput
+
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSqsQueue(handler *HandlerInstance, settings sqsQueueSettings) *sqsQueue {
+	return &sqsQueue{
+		handler:       handler,
+		settings:      settings,
+		deduplication: make(map[string]sqsDeduplicationEntry),
+		execute:       executeSqsBatch,
+		wake:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+}
+
+// start begins polling the queue.
+func (queue *sqsQueue) start() {
+	go queue.poll()
+}
+
+// setHandler points the queue at a new instance of its handler, picking up any
+// changed settings.
+func (queue *sqsQueue) setHandler(handler *HandlerInstance, settings sqsQueueSettings) {
+	queue.mutex.Lock()
+	queue.handler = handler
+	queue.settings = settings
+	queue.mutex.Unlock()
+
+	queue.notify()
+}
+
+// sqsMessageInput is a message being sent to a queue. GroupID and
+// DeduplicationID only apply to FIFO queues.
+type sqsMessageInput struct {
+	Body            string
+	Attributes      map[string]sqsMessageAttribute
+	Delay           time.Duration
+	GroupID         string
+	DeduplicationID string
+}
+
+// sqsSendResult describes a message that was sent to a queue.
+type sqsSendResult struct {
+	MessageID      string
+	SequenceNumber string
+	// Duplicate is set when a FIFO queue dropped the message because one with
+	// the same deduplication ID was sent within the deduplication window.
+	Duplicate bool
+	// Delivered receives the outcome of the message's first delivery. It is
+	// nil for duplicates.
+	Delivered <-chan sqsDelivery
+}
+
+// Send adds a message to the queue. Messages sent to a FIFO queue need a
+// deduplication ID unless the queue uses content-based deduplication.
+func (queue *sqsQueue) Send(input sqsMessageInput) (sqsSendResult, error) {
+	now := time.Now()
+
+	queue.mutex.Lock()
+	defer queue.notify()
+	defer queue.mutex.Unlock()
+
+	message := &sqsMessage{
+		id:         uuid.New().String(),
+		body:       input.Body,
+		attributes: input.Attributes,
+		sentAt:     now,
+		visibleAt:  now.Add(input.Delay),
+		delivered:  make(chan sqsDelivery, 1),
+	}
+
+	if queue.settings.fifo {
+		message.groupID = input.GroupID
+		message.deduplicationID = input.DeduplicationID
+		if message.deduplicationID == "" {
+			if !queue.settings.contentBasedDeduplication {
+				return sqsSendResult{}, errSqsMissingDeduplicationID
+			}
+
+			message.deduplicationID = contentDeduplicationID(input.Body)
+		}
+
+		if previous, ok := queue.deduplicated(message.deduplicationID, now); ok {
+			return sqsSendResult{MessageID: previous.messageID, SequenceNumber: previous.sequenceNumber, Duplicate: true}, nil
+		}
+
+		queue.sequenceNumber++
+		message.sequenceNumber = fmt.Sprintf("%020d", queue.sequenceNumber)
+
+		queue.deduplication[message.deduplicationID] = sqsDeduplicationEntry{
+			messageID:      message.id,
+			sequenceNumber: message.sequenceNumber,
+			expiresAt:      now.Add(sqsDeduplicationWindow),
+		}
+	}
+
+	queue.messages = append(queue.messages, message)
+
+	return sqsSendResult{MessageID: message.id, SequenceNumber: message.sequenceNumber, Delivered: message.delivered}, nil
+}
+
+// Receive takes up to max visible messages off the queue for an SQS API
+// consumer and hides them for visibilityTimeout, or the queue's own
+// visibility timeout when it is negative. Received messages are copies, so they
+// can be read without holding the queue's mutex.
+func (queue *sqsQueue) Receive(max int, visibilityTimeout time.Duration) []sqsMessage {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	now := time.Now()
+	visible, _ := queue.visibleMessages(now)
+
+	if len(visible) > max {
+		visible = visible[:max]
+	}
+
+	if visibilityTimeout < 0 {
+		visibilityTimeout = queue.settings.visibilityTimeout
+	}
+
+	markReceived(visible, now, visibilityTimeout)
+
+	received := make([]sqsMessage, len(visible))
+	for i, message := range visible {
+		received[i] = *message
+		received[i].delivered = nil
+	}
+
+	return received
+}
+
+// Delete removes the message last received with receiptHandle. Unknown or
+// outdated receipt handles are ignored, as they are by SQS.
+func (queue *sqsQueue) Delete(receiptHandle string) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	for _, message := range queue.messages {
+		if message.receiptHandle == receiptHandle {
+			queue.remove([]*sqsMessage{message})
+			return
+		}
+	}
+}
+
+// IsFifo reports whether the queue is a FIFO queue.
+func (queue *sqsQueue) IsFifo() bool {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	return queue.settings.fifo
+}
+
+// QueueName returns the name of the queue, which is the last segment of its ARN.
+func (queue *sqsQueue) QueueName() string {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	return config.SqsConfig{Queue: queue.settings.queueArn}.QueueName()
+}
+
+func (queue *sqsQueue) Close() {
+	queue.closeOnce.Do(func() {
+		close(queue.done)
+	})
+}
+
+func (queue *sqsQueue) notify() {
+	select {
+	case queue.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (queue *sqsQueue) poll() {
+	for {
+		batch, handler, settings, wait := queue.receive(time.Now())
+
+		if len(batch) > 0 {
+			queue.deliver(batch, handler, settings)
+			continue
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+
+		select {
+		case <-queue.wake:
+		case <-timeout:
+		case <-queue.done:
+			return
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// receive takes the next batch off the queue and hides it for the visibility
+// timeout. When there is nothing to deliver yet it returns how long to wait
+// before trying again, or zero to wait until a message is sent.
+func (queue *sqsQueue) receive(now time.Time) ([]*sqsMessage, *HandlerInstance, sqsQueueSettings, time.Duration) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	settings := queue.settings
+	visible, nextVisibleAt := queue.visibleMessages(now)
+
+	if len(visible) == 0 {
+		if nextVisibleAt.IsZero() {
+			return nil, nil, settings, 0
+		}
+
+		return nil, nil, settings, nextVisibleAt.Sub(now)
+	}
+
+	// Wait for a full batch until the oldest visible message has waited for
+	// the whole batching window.
+	if len(visible) < settings.batchSize && settings.batchingWindow > 0 {
+		windowEnd := visible[0].visibleAt.Add(settings.batchingWindow)
+		for _, message := range visible[1:] {
+			if end := message.visibleAt.Add(settings.batchingWindow); end.Before(windowEnd) {
+				windowEnd = end
+			}
+		}
+
+		if windowEnd.After(now) {
+			wait := windowEnd.Sub(now)
+			if !nextVisibleAt.IsZero() && nextVisibleAt.Sub(now) < wait {
+				wait = nextVisibleAt.Sub(now)
+			}
+
+			return nil, nil, settings, wait
+		}
+	}
+
+	if len(visible) > settings.batchSize {
+		visible = visible[:settings.batchSize]
+	}
+
+	markReceived(visible, now, settings.visibilityTimeout)
+
+	return visible, queue.handler, settings, 0
+}
+
+// visibleMessages returns the messages that can be received at now, moving
+// those that have been received too often to the dead-letter queue. When none
+// are visible it also returns when the next one becomes visible, if any.
+// The caller must hold the queue's mutex.
+func (queue *sqsQueue) visibleMessages(now time.Time) ([]*sqsMessage, time.Time) {
+	settings := queue.settings
+
+	var visible []*sqsMessage
+	var nextVisibleAt time.Time
+
+	// A FIFO message group is blocked while any of its messages is in flight,
+	// so that later messages wait for earlier ones to succeed.
+	blockedGroups := make(map[string]bool)
+
+	remaining := queue.messages[:0]
+	for _, message := range queue.messages {
+		if message.visibleAt.After(now) {
+			remaining = append(remaining, message)
+
+			if nextVisibleAt.IsZero() || message.visibleAt.Before(nextVisibleAt) {
+				nextVisibleAt = message.visibleAt
+			}
+
+			if settings.fifo {
+				blockedGroups[message.groupID] = true
+			}
+
+			continue
+		}
+
+		if settings.maxReceiveCount > 0 && message.receiveCount >= settings.maxReceiveCount {
+			queue.deadLetters = append(queue.deadLetters, message)
+			printSqsDeadLetter(queue.handler, message)
+			continue
+		}
+
+		remaining = append(remaining, message)
+
+		if settings.fifo && blockedGroups[message.groupID] {
+			continue
+		}
+
+		visible = append(visible, message)
+	}
+
+	queue.messages = remaining
+
+	return visible, nextVisibleAt
+}
+
+// markReceived hides messages for the visibility timeout and counts the
+// receive. The caller must hold the queue's mutex.
+func markReceived(messages []*sqsMessage, now time.Time, visibilityTimeout time.Duration) {
+	for _, message := range messages {
+		message.receiveCount++
+		if message.firstReceivedAt.IsZero() {
+			message.firstReceivedAt = now
+		}
+
+		message.receiptHandle = uuid.New().String()
+		message.visibleAt = now.Add(visibilityTimeout)
+	}
+}
+
+func (queue *sqsQueue) deliver(batch []*sqsMessage, handler *HandlerInstance, settings sqsQueueSettings) {
+	records := make([]map[string]interface{}, len(batch))
+
+	queue.mutex.Lock()
+	for i, message := range batch {
+		records[i] = newSqsRecord(sqsRecord{
+			MessageID:             message.id,
+			Body:                  message.body,
+			MessageAttributes:     message.attributes,
+			GroupID:               message.groupID,
+			DeduplicationID:       message.deduplicationID,
+			SequenceNumber:        message.sequenceNumber,
+			QueueArn:              settings.queueArn,
+			ReceiveCount:          message.receiveCount,
+			SentTimestamp:         message.sentAt,
+			FirstReceiveTimestamp: message.firstReceivedAt,
+		})
+	}
+	queue.mutex.Unlock()
+
+	fmt.Printf("SQS %s (%s) batch of %d\n", config.SqsConfig{Queue: settings.queueArn}.QueueName(), handler.handlerConfig.Name, len(batch))
+	start := time.Now()
+
+	output := queue.execute(handler, records)
+	failures := sqsBatchFailures(output, batch)
+	if settings.fifo {
+		failLaterGroupMessages(batch, failures)
+	}
+
+	if output.err != nil {
+		fmt.Println(output.err)
+	}
+
+	var succeeded []*sqsMessage
+
+	queue.mutex.Lock()
+	for _, message := range batch {
+		failure := failures[message.id]
+
+		if failure == "" {
+			succeeded = append(succeeded, message)
+			color.New(color.FgHiGreen).Printf("  %s succeeded\n", message.id)
+		} else {
+			message.lastFailure = failure
+			color.New(color.FgHiYellow).Printf("  %s failed (%s), visible again in %s\n", message.id, failure, settings.visibilityTimeout)
+		}
+
+		if message.delivered != nil {
+			message.delivered <- sqsDelivery{messageID: message.id, output: output, failure: failure}
+			message.delivered = nil
+		}
+	}
+
+	queue.remove(succeeded)
+	queue.mutex.Unlock()
+
+	fmt.Printf("Completed in %dms\n\n", time.Since(start).Milliseconds())
+}
+
+// remove deletes delivered messages from the queue.
+func (queue *sqsQueue) remove(batch []*sqsMessage) {
+	delivered := make(map[*sqsMessage]bool, len(batch))
+	for _, message := range batch {
+		delivered[message] = true
+	}
+
+	remaining := queue.messages[:0]
+	for _, message := range queue.messages {
+		if !delivered[message] {
+			remaining = append(remaining, message)
+		}
+	}
+
+	queue.messages = remaining
+}
+
+// sqsBatchFailures interprets a handler's result the way an event source
+// mapping does and returns why each failed message failed, by message ID.
+//
+// A handler that throws or times out fails the whole batch. Otherwise only the
+// messages listed in batchItemFailures fail, unless the list is malformed or
+// names a message that isn't in the batch, which also fails the whole batch.
+func sqsBatchFailures(output HandlerOutput, batch []*sqsMessage) map[string]string {
+	failures := make(map[string]string)
+
+	failAll := func(reason string) map[string]string {
+		for _, message := range batch {
+			failures[message.id] = reason
+		}
+
+		return failures
+	}
+
+	if failure := invocationFailure(output); failure != "" {
+		return failAll(failure)
+	}
+
+	result := output.handlerResult
+
+	var response struct {
+		BatchItemFailures []struct {
+			ItemIdentifier *string `json:"itemIdentifier"`
+		} `json:"batchItemFailures"`
+	}
+
+	// Only an object can report batchItemFailures, and anything else the
+	// handler returns is a success.
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(result.Payload, &fields) != nil {
+		return failures
+	}
+
+	if err := json.Unmarshal(result.Payload, &response); err != nil {
+		return failAll("invalid batchItemFailures response")
+	}
+
+	inBatch := make(map[string]bool, len(batch))
+	for _, message := range batch {
+		inBatch[message.id] = true
+	}
+
+	for _, failure := range response.BatchItemFailures {
+		if failure.ItemIdentifier == nil || !inBatch[*failure.ItemIdentifier] {
+			return failAll("batchItemFailures named a message that is not in the batch")
+		}
+
+		failures[*failure.ItemIdentifier] = "reported in batchItemFailures"
+	}
+
+	return failures
+}
+
+// invocationFailure describes why an invocation failed, or returns an empty
+// string when the handler returned normally.
+func invocationFailure(output HandlerOutput) string {
+	if output.err != nil {
+		return "handler could not be invoked"
+	}
+
+	switch {
+	case output.handlerResult.TimedOut:
+		return "handler timed out"
+	case output.handlerResult.Error != nil:
+		return "handler error" + handlerErrorMessage(output.handlerResult)
+	}
+
+	return ""
+}
+
+// handlerErrorMessage returns the message of the error a handler threw,
+// prefixed for appending to a failure reason.
+func handlerErrorMessage(result *handlerResult) string {
+	if result.Error == nil || result.Error.ErrorMessage == "" {
+		return ""
+	}
+
+	return ": " + result.Error.ErrorMessage
+}
+
+func executeSqsBatch(handler *HandlerInstance, records []map[string]interface{}) HandlerOutput {
+	result, err := handler.Execute(generateSqsHandlerRuntimeCode(handler, records))
+
+	return HandlerOutput{
+		handlerResult: result,
+		err:           err,
+	}
+}
+
+func printSqsDeadLetter(handler *HandlerInstance, message *sqsMessage) {
+	color.New(color.FgHiRed).Printf("SQS message %s for %s moved to the dead-letter queue after %d receives\n\n", message.id, handler.handlerConfig.Name, message.receiveCount)
+}
+
+type sqsQueueState struct {
+	Handler                        string            `json:"handler"`
+	QueueArn                       string            `json:"queueArn"`
+	BatchSize                      int               `json:"batchSize"`
+	MaximumBatchingWindowInSeconds float64           `json:"maximumBatchingWindowInSeconds"`
+	VisibilityTimeoutSeconds       float64           `json:"visibilityTimeoutSeconds"`
+	MaxReceiveCount                int               `json:"maxReceiveCount"`
+	Available                      []sqsMessageState `json:"available"`
+	InFlight                       []sqsMessageState `json:"inFlight"`
+	DeadLetter                     []sqsMessageState `json:"deadLetter"`
+}
+
+type sqsMessageState struct {
+	MessageID             string     `json:"messageId"`
+	Body                  string     `json:"body"`
+	ReceiveCount          int        `json:"receiveCount"`
+	SentTimestamp         time.Time  `json:"sentTimestamp"`
+	FirstReceiveTimestamp *time.Time `json:"firstReceiveTimestamp,omitempty"`
+	VisibleAt             *time.Time `json:"visibleAt,omitempty"`
+	LastFailure           string     `json:"lastFailure,omitempty"`
+	MessageGroupID        string     `json:"messageGroupId,omitempty"`
+	SequenceNumber        string     `json:"sequenceNumber,omitempty"`
+}
+
+// State describes every message on the queue and its dead-letter queue.
+func (queue *sqsQueue) State() sqsQueueState {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	now := time.Now()
+
+	state := sqsQueueState{
+		Handler:                        queue.handler.handlerConfig.Name,
+		QueueArn:                       queue.settings.queueArn,
+		BatchSize:                      queue.settings.batchSize,
+		MaximumBatchingWindowInSeconds: queue.settings.batchingWindow.Seconds(),
+		VisibilityTimeoutSeconds:       queue.settings.visibilityTimeout.Seconds(),
+		MaxReceiveCount:                queue.settings.maxReceiveCount,
+		Available:                      []sqsMessageState{},
+		InFlight:                       []sqsMessageState{},
+		DeadLetter:                     []sqsMessageState{},
+	}
+
+	for _, message := range queue.messages {
+		if message.visibleAt.After(now) {
+			messageState := newSqsMessageState(message)
+			visibleAt := message.visibleAt
+			messageState.VisibleAt = &visibleAt
+
+			state.InFlight = append(state.InFlight, messageState)
+			continue
+		}
+
+		state.Available = append(state.Available, newSqsMessageState(message))
+	}
+
+	for _, message := range queue.deadLetters {
+		state.DeadLetter = append(state.DeadLetter, newSqsMessageState(message))
+	}
+
+	return state
+}
+
+func newSqsMessageState(message *sqsMessage) sqsMessageState {
+	state := sqsMessageState{
+		MessageID:     message.id,
+		Body:          message.body,
+		ReceiveCount:  message.receiveCount,
+		SentTimestamp: message.sentAt,
+		LastFailure:   message.lastFailure,
+	}
+
+	if message.sequenceNumber != "" {
+		state.MessageGroupID = message.groupID
+		state.SequenceNumber = message.sequenceNumber
+	}
+
+	if !message.firstReceivedAt.IsZero() {
+		firstReceivedAt := message.firstReceivedAt
+		state.FirstReceiveTimestamp = &firstReceivedAt
+	}
+
+	return state
+}
+
+// nextSqsQueues returns a queue for every SQS-triggered handler, keeping the
+// existing queue of handlers that already have one. New queues are not started
+// until syncSqsQueues applies the result, so it can be discarded. The returned
+// map is a new one that is never modified afterwards, so the router built from
+// it can read it while a later reload replaces it.
+func nextSqsQueues(queues map[string]*sqsQueue, handlers map[string]*HandlerInstance) map[string]*sqsQueue {
+	next := make(map[string]*sqsQueue, len(queues))
+
+	for name, handler := range handlers {
+		if handler.handlerConfig.Sqs == nil {
+			continue
+		}
+
+		if queue, ok := queues[name]; ok {
+			next[name] = queue
+			continue
+		}
+
+		next[name] = newSqsQueue(handler, newSqsQueueSettings(*handler.handlerConfig.Sqs))
+	}
+
+	return next
+}
+
+// syncSqsQueues starts the new queues in next, points the existing ones at
+// the current handler instances and closes the queues in queues that next no
+// longer has.
+func syncSqsQueues(queues map[string]*sqsQueue, next map[string]*sqsQueue, handlers map[string]*HandlerInstance) {
+	for name, queue := range next {
+		if _, ok := queues[name]; !ok {
+			queue.start()
+			continue
+		}
+
+		queue.setHandler(handlers[name], newSqsQueueSettings(*handlers[name].handlerConfig.Sqs))
+	}
+
+	for name, queue := range queues {
+		if _, ok := next[name]; !ok {
+			queue.Close()
+		}
+	}
+}
+
+// registerSqsRoutes adds the endpoints that send messages to the local queues
+// and let their state be inspected.
+//
+// POST /_sqs/<handler> sends the request body as a message and, unless the
+// async query parameter is set, responds with the result of the batch it was
+// first delivered in. Messages for FIFO queues are sent to the group named by
+// the group query parameter, or "default", and are deduplicated by their
+// deduplicationId query parameter or their body. GET /_sqs lists every queue and GET /_sqs/<handler>
+// shows one of them.
+func registerSqsRoutes(r *mux.Router, queues map[string]*sqsQueue) {
+	r.HandleFunc("/_sqs", func(w http.ResponseWriter, r *http.Request) {
+		names := make([]string, 0, len(queues))
+		for name := range queues {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		states := make([]sqsQueueState, 0, len(names))
+		for _, name := range names {
+			states = append(states, queues[name].State())
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"queues": states})
+	}).Methods(http.MethodGet)
+
+	for name, queue := range queues {
+		queue := queue
+		path := fmt.Sprintf("/_sqs/%s", name)
+
+		r.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, queue.State())
+		}).Methods(http.MethodGet)
+
+		r.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			defer r.Body.Close()
+
+			result, err := queue.Send(sqsMessageInput{
+				Body:            string(body),
+				GroupID:         valueOrDefault(r.URL.Query().Get("group"), "default"),
+				DeduplicationID: r.URL.Query().Get("deduplicationId"),
+			})
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+				return
+			}
+
+			if result.Duplicate {
+				w.Header().Set("X-Terrable-Message-Id", result.MessageID)
+				w.Header().Set("X-Terrable-Message-Outcome", "deduplicated")
+				writeJSON(w, http.StatusAccepted, map[string]string{"messageId": result.MessageID})
+				return
+			}
+
+			if r.URL.Query().Has("async") {
+				writeJSON(w, http.StatusAccepted, map[string]string{"messageId": result.MessageID})
+				return
+			}
+
+			select {
+			case delivery := <-result.Delivered:
+				w.Header().Set("X-Terrable-Message-Id", delivery.messageID)
+
+				if delivery.failure == "" {
+					w.Header().Set("X-Terrable-Message-Outcome", "succeeded")
+				} else {
+					w.Header().Set("X-Terrable-Message-Outcome", "failed: "+delivery.failure)
+				}
+
+				writeHandlerOutput(w, delivery.output)
+			case <-r.Context().Done():
+			case <-queue.done:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}).Methods(http.MethodPost)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	body, _ := json.Marshal(value)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
@@ -0,0 +1,371 @@
+package offline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+type sqsTestBatch struct {
+	records []map[string]interface{}
+}
+
+// newTestSqsQueue starts a queue whose batches are recorded and answered with
+// the status codes in statusCodes, one per batch, repeating the last one.
+func newTestSqsQueue(t *testing.T, settings sqsQueueSettings, statusCodes ...int) (*sqsQueue, chan sqsTestBatch) {
+	t.Helper()
+
+	batches := make(chan sqsTestBatch, 10)
+	handler := &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "QueueHandler"}}
+
+	queue := newSqsQueue(handler, settings)
+	queue.execute = func(handler *HandlerInstance, records []map[string]interface{}) HandlerOutput {
+		statusCode := statusCodes[0]
+		if len(statusCodes) > 1 {
+			statusCodes = statusCodes[1:]
+		}
+
+		batches <- sqsTestBatch{records: records}
+		return sqsTestOutput(statusCode)
+	}
+
+	queue.start()
+	t.Cleanup(queue.Close)
+
+	return queue, batches
+}
+
+// sqsTestOutput is the output of a handler that returns statusCode, or that
+// throws when statusCode is a 5xx.
+func sqsTestOutput(statusCode int) HandlerOutput {
+	if statusCode >= http.StatusInternalServerError {
+		return HandlerOutput{handlerResult: newHandlerErrorResult(runtimeErrorResponse{ErrorType: "Error"})}
+	}
+
+	return HandlerOutput{handlerResult: &handlerResult{StatusCode: statusCode}}
+}
+
+func waitForSqsBatch(t *testing.T, batches chan sqsTestBatch) sqsTestBatch {
+	t.Helper()
+
+	select {
+	case batch := <-batches:
+		return batch
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a batch")
+		return sqsTestBatch{}
+	}
+}
+
+func TestSqsQueueBatchSize(t *testing.T) {
+	queue, batches := newTestSqsQueue(t, sqsQueueSettings{
+		queueArn:          sqsQueueArn("test-queue"),
+		batchSize:         2,
+		batchingWindow:    50 * time.Millisecond,
+		visibilityTimeout: time.Minute,
+	}, http.StatusOK)
+
+	for _, body := range []string{"one", "two", "three"} {
+		queue.Send(sqsMessageInput{Body: body})
+	}
+
+	first := waitForSqsBatch(t, batches)
+	second := waitForSqsBatch(t, batches)
+
+	if len(first.records) != 2 || len(second.records) != 1 {
+		t.Fatalf("expected batches of 2 and 1 records, got %d and %d", len(first.records), len(second.records))
+	}
+
+	if first.records[0]["body"] != "one" || second.records[0]["body"] != "three" {
+		t.Errorf("expected messages in the order they were sent, got %v and %v", first.records[0]["body"], second.records[0]["body"])
+	}
+
+	if first.records[0]["eventSourceARN"] != "arn:aws:sqs:eu-west-1:000000000000:test-queue" {
+		t.Errorf("expected the queue ARN as the event source, got %v", first.records[0]["eventSourceARN"])
+	}
+}
+
+func TestSqsQueueBatchingWindowCollectsMessages(t *testing.T) {
+	queue, batches := newTestSqsQueue(t, sqsQueueSettings{
+		batchSize:         10,
+		batchingWindow:    200 * time.Millisecond,
+		visibilityTimeout: time.Minute,
+	}, http.StatusOK)
+
+	queue.Send(sqsMessageInput{Body: "one"})
+	time.Sleep(50 * time.Millisecond)
+	queue.Send(sqsMessageInput{Body: "two"})
+
+	if batch := waitForSqsBatch(t, batches); len(batch.records) != 2 {
+		t.Fatalf("expected both messages in one batch, got %d", len(batch.records))
+	}
+}
+
+func TestSqsQueueRetriesFailedBatchesAfterVisibilityTimeout(t *testing.T) {
+	queue, batches := newTestSqsQueue(t, sqsQueueSettings{
+		batchSize:         10,
+		visibilityTimeout: 100 * time.Millisecond,
+	}, http.StatusInternalServerError, http.StatusOK)
+
+	sent, _ := queue.Send(sqsMessageInput{Body: "retry me"})
+	delivered := sent.Delivered
+
+	first := waitForSqsBatch(t, batches)
+	if delivery := <-delivered; delivery.output.handlerResult.StatusCode != http.StatusInternalServerError || delivery.failure != "handler error" {
+		t.Errorf("expected the sender to receive the first delivery's failure, got %+v", delivery)
+	}
+
+	if state := queue.State(); len(state.InFlight) != 1 || len(state.Available) != 0 {
+		t.Errorf("expected the failed message to be in flight, got %+v", state)
+	}
+
+	second := waitForSqsBatch(t, batches)
+
+	receiveCount := func(batch sqsTestBatch) interface{} {
+		return batch.records[0]["attributes"].(map[string]interface{})["ApproximateReceiveCount"]
+	}
+
+	if receiveCount(first) != "1" || receiveCount(second) != "2" {
+		t.Errorf("expected receive counts 1 and 2, got %v and %v", receiveCount(first), receiveCount(second))
+	}
+
+	if first.records[0]["messageId"] != second.records[0]["messageId"] {
+		t.Error("expected the same message to be redelivered")
+	}
+
+	waitFor(t, func() bool {
+		state := queue.State()
+		return len(state.Available)+len(state.InFlight)+len(state.DeadLetter) == 0
+	})
+}
+
+func TestSqsQueueMovesMessagesToDeadLetterQueue(t *testing.T) {
+	queue, batches := newTestSqsQueue(t, sqsQueueSettings{
+		batchSize:         10,
+		visibilityTimeout: 50 * time.Millisecond,
+		maxReceiveCount:   2,
+	}, http.StatusInternalServerError)
+
+	queue.Send(sqsMessageInput{Body: "poison"})
+
+	waitForSqsBatch(t, batches)
+	waitForSqsBatch(t, batches)
+
+	waitFor(t, func() bool {
+		return len(queue.State().DeadLetter) == 1
+	})
+
+	state := queue.State()
+	if state.DeadLetter[0].Body != "poison" || state.DeadLetter[0].ReceiveCount != 2 {
+		t.Errorf("unexpected dead-letter message: %+v", state.DeadLetter[0])
+	}
+
+	select {
+	case <-batches:
+		t.Fatal("expected the dead-lettered message not to be delivered again")
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+func TestSqsQueueRetriesOnlyReportedBatchItemFailures(t *testing.T) {
+	batches := make(chan sqsTestBatch, 10)
+	handler := &HandlerInstance{handlerConfig: config.HandlerMapping{Name: "QueueHandler"}}
+
+	queue := newSqsQueue(handler, sqsQueueSettings{
+		batchSize:         10,
+		batchingWindow:    50 * time.Millisecond,
+		visibilityTimeout: 100 * time.Millisecond,
+	})
+	queue.execute = func(handler *HandlerInstance, records []map[string]interface{}) HandlerOutput {
+		batches <- sqsTestBatch{records: records}
+
+		var failures []map[string]interface{}
+		for _, record := range records {
+			if record["body"] == "fail" {
+				failures = append(failures, map[string]interface{}{"itemIdentifier": record["messageId"]})
+			}
+		}
+
+		payload, _ := json.Marshal(map[string]interface{}{"batchItemFailures": failures})
+		return HandlerOutput{handlerResult: &handlerResult{StatusCode: http.StatusOK, Payload: payload}}
+	}
+
+	queue.start()
+	t.Cleanup(queue.Close)
+
+	succeededSend, _ := queue.Send(sqsMessageInput{Body: "ok"})
+	failedSend, _ := queue.Send(sqsMessageInput{Body: "fail"})
+	succeeded, failedID, failed := succeededSend.Delivered, failedSend.MessageID, failedSend.Delivered
+
+	if batch := waitForSqsBatch(t, batches); len(batch.records) != 2 {
+		t.Fatalf("expected both messages in the first batch, got %d", len(batch.records))
+	}
+
+	if delivery := <-succeeded; delivery.failure != "" {
+		t.Errorf("expected the first message to succeed, got %q", delivery.failure)
+	}
+
+	if delivery := <-failed; delivery.failure != "reported in batchItemFailures" {
+		t.Errorf("expected the second message to fail, got %q", delivery.failure)
+	}
+
+	retry := waitForSqsBatch(t, batches)
+	if len(retry.records) != 1 || retry.records[0]["messageId"] != failedID {
+		t.Fatalf("expected only the failed message to be retried, got %v", retry.records)
+	}
+}
+
+func TestSqsBatchFailures(t *testing.T) {
+	batch := []*sqsMessage{{id: "one"}, {id: "two"}}
+
+	tests := []struct {
+		name     string
+		output   HandlerOutput
+		expected map[string]string
+	}{
+		{
+			name:     "success without a batch response",
+			output:   HandlerOutput{handlerResult: &handlerResult{StatusCode: 200, Payload: []byte(`{"statusCode":200}`)}},
+			expected: map[string]string{},
+		},
+		{
+			name:     "empty batchItemFailures",
+			output:   HandlerOutput{handlerResult: &handlerResult{StatusCode: 200, Payload: []byte(`{"batchItemFailures":[]}`)}},
+			expected: map[string]string{},
+		},
+		{
+			name:     "partial failure",
+			output:   HandlerOutput{handlerResult: &handlerResult{StatusCode: 200, Payload: []byte(`{"batchItemFailures":[{"itemIdentifier":"two"}]}`)}},
+			expected: map[string]string{"two": "reported in batchItemFailures"},
+		},
+		{
+			name:   "unknown item identifier",
+			output: HandlerOutput{handlerResult: &handlerResult{StatusCode: 200, Payload: []byte(`{"batchItemFailures":[{"itemIdentifier":"three"}]}`)}},
+			expected: map[string]string{
+				"one": "batchItemFailures named a message that is not in the batch",
+				"two": "batchItemFailures named a message that is not in the batch",
+			},
+		},
+		{
+			name:   "thrown error",
+			output: HandlerOutput{handlerResult: newHandlerErrorResult(runtimeErrorResponse{ErrorMessage: "boom", ErrorType: "Error"})},
+			expected: map[string]string{
+				"one": "handler error: boom",
+				"two": "handler error: boom",
+			},
+		},
+		{
+			name:   "timeout",
+			output: HandlerOutput{handlerResult: newTimeoutResult()},
+			expected: map[string]string{
+				"one": "handler timed out",
+				"two": "handler timed out",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if failures := sqsBatchFailures(test.output, batch); !reflect.DeepEqual(failures, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, failures)
+			}
+		})
+	}
+}
+
+func TestNewSqsQueueSettingsDefaults(t *testing.T) {
+	settings := newSqsQueueSettings(config.SqsConfig{Queue: "arn:aws:sqs:us-east-1:123456789012:orders"})
+
+	if settings.batchSize != defaultSqsBatchSize || settings.visibilityTimeout != defaultSqsVisibilityTimeout {
+		t.Errorf("expected default batch size and visibility timeout, got %+v", settings)
+	}
+
+	if settings.queueArn != "arn:aws:sqs:us-east-1:123456789012:orders" {
+		t.Errorf("expected the configured ARN to be kept, got %s", settings.queueArn)
+	}
+
+	if settings.fifo || !newSqsQueueSettings(config.SqsConfig{Queue: "orders.fifo"}).fifo {
+		t.Error("expected only queues named .fifo to be FIFO queues")
+	}
+}
+
+func TestSqsRoutesDuringReload(t *testing.T) {
+	serveDuringSqsReloads(t, func() *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/_sqs", nil)
+	})
+}
+
+// serveDuringSqsReloads sends the requests built by request to an offline
+// server while it is reloaded over and over, adding and removing an
+// SQS-triggered handler each time, and fails unless every one succeeds.
+func serveDuringSqsReloads(t *testing.T, request func() *http.Request) {
+	t.Helper()
+
+	sourceDir := t.TempDir()
+	chdirForTest(t, t.TempDir())
+
+	source := writeHandlerSource(t, sourceDir, "worker.ts", "export const handler = async () => ({});")
+	orders := config.HandlerMapping{Name: "Orders", Source: source, Sqs: &config.SqsConfig{Queue: "orders"}}
+	refunds := config.HandlerMapping{Name: "Refunds", Source: source, Sqs: &config.SqsConfig{Queue: "refunds"}}
+
+	configs := []*config.TerrableConfig{
+		{Handlers: []config.HandlerMapping{orders}},
+		{Handlers: []config.HandlerMapping{orders, refunds}},
+	}
+
+	server := newOfflineServer("offline.tf", "test", nil)
+	t.Cleanup(server.Close)
+
+	if err := server.start(configs[0]); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+
+		for i := 1; i <= 20; i++ {
+			server.mutex.Lock()
+			err := server.applyConfig(configs[i%len(configs)])
+			server.mutex.Unlock()
+
+			if err != nil {
+				t.Errorf("failed to apply config: %v", err)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-reloaded:
+			return
+		default:
+		}
+
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request())
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected requests to succeed during a reload, got %d %s", recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,538 @@
+package offline
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/terrable-dev/terrable/config"
+	"github.com/terrable-dev/terrable/utils"
+)
+
+const (
+	// webSocketStage is the stage WebSocket events report and that the
+	// @connections API may be called under.
+	webSocketStage = "$default"
+	// maxConnectionMessageBytes is the most data API Gateway sends to a
+	// connection in one message.
+	maxConnectionMessageBytes = 128 * 1024
+	webSocketWriteTimeout     = 10 * time.Second
+)
+
+// webSocketAPI emulates an API Gateway WebSocket API. Clients connect at the
+// API's path, each message is sent to the handler of the route its route
+// selection expression selects, and handlers reach clients through the
+// @connections API. Connections are kept across reloads and routed with the
+// routes of the current configuration.
+type webSocketAPI struct {
+	mutex       sync.Mutex
+	routes      webSocketRoutes
+	connections map[string]*webSocketConnection
+	closed      bool
+
+	execute  func(handler *HandlerInstance, event []byte) HandlerOutput
+	upgrader websocket.Upgrader
+}
+
+// webSocketRoutes is the routing of the WebSocket API in one configuration.
+type webSocketRoutes struct {
+	settings  config.WebSocketAPIConfig
+	selection utils.JSONPath
+	// handlers holds the handler of each route key.
+	handlers map[string]*HandlerInstance
+	enabled  bool
+}
+
+// webSocketConnection is a client connected to the WebSocket API.
+type webSocketConnection struct {
+	id          string
+	conn        *websocket.Conn
+	request     webSocketEventRequest
+	connectedAt time.Time
+	writeMutex  sync.Mutex
+
+	// lastActiveAt and closeReason are guarded by the mutex of the API.
+	lastActiveAt time.Time
+	// closeReason is set when terrable closes the connection rather than the
+	// client.
+	closeReason string
+}
+
+func newWebSocketAPI() *webSocketAPI {
+	return &webSocketAPI{
+		routes: webSocketRoutes{
+			settings: config.DefaultWebSocketAPIConfig(),
+			handlers: make(map[string]*HandlerInstance),
+		},
+		connections: make(map[string]*webSocketConnection),
+		execute:     executeWebSocketEvent,
+		upgrader: websocket.Upgrader{
+			// Browsers connect from whatever origin the app under
+			// development is served on.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// newWebSocketRoutes works out the routing of the WebSocket API for a
+// configuration. The API is served when the module has a websocket_api or any
+// handler has websocket routes.
+func newWebSocketRoutes(terrableConfig *config.TerrableConfig, handlers map[string]*HandlerInstance) webSocketRoutes {
+	settings := config.DefaultWebSocketAPIConfig()
+	if terrableConfig.WebSocketApi != nil {
+		settings = *terrableConfig.WebSocketApi
+	}
+
+	selection, _ := utils.ParseJSONPath("$" + strings.TrimPrefix(settings.RouteSelectionExpression, "$request.body"))
+
+	names := make([]string, 0, len(handlers))
+	for name := range handlers {
+		names = append(names, name)
+	}
+
+	// Map order would let a reload move a duplicated route key, such as a
+	// second $connect, to another handler, so handlers claim keys by name.
+	sort.Strings(names)
+
+	routes := make(map[string]*HandlerInstance)
+	for _, name := range names {
+		webSocket := handlers[name].handlerConfig.WebSocket
+		if webSocket == nil {
+			continue
+		}
+
+		for _, route := range webSocket.Routes {
+			if _, ok := routes[route]; !ok {
+				routes[route] = handlers[name]
+			}
+		}
+	}
+
+	return webSocketRoutes{
+		settings:  settings,
+		selection: selection,
+		handlers:  routes,
+		enabled:   terrableConfig.WebSocketApi != nil || len(routes) > 0,
+	}
+}
+
+// setRoutes replaces the routing that connections are served with.
+func (api *webSocketAPI) setRoutes(routes webSocketRoutes) {
+	api.mutex.Lock()
+	api.routes = routes
+	api.mutex.Unlock()
+}
+
+// registerWebSocketRoutes accepts connections to the WebSocket API. Only
+// upgrade requests are matched, so the API can share its path with HTTP
+// routes.
+func registerWebSocketRoutes(r *mux.Router, api *webSocketAPI, routes webSocketRoutes) {
+	if !routes.enabled {
+		return
+	}
+
+	r.Path(routes.settings.Path).HeadersRegexp("Upgrade", "(?i)^websocket$").Handler(api)
+}
+
+// registerConnectionsAPIRoutes serves the @connections API, with or without a
+// stage in the path, so that handlers can send messages to clients, look them
+// up and disconnect them with an AWS SDK.
+func registerConnectionsAPIRoutes(r *mux.Router, api *webSocketAPI, routes webSocketRoutes) {
+	if !routes.enabled {
+		return
+	}
+
+	methods := []string{http.MethodPost, http.MethodGet, http.MethodDelete}
+
+	r.HandleFunc("/@connections/{connectionId}", api.serveConnection).Methods(methods...)
+	r.HandleFunc("/{stage}/@connections/{connectionId}", api.serveConnection).Methods(methods...)
+}
+
+// ServeHTTP invokes the $connect route and upgrades the request when it
+// allows the connection, then routes messages until the connection closes.
+func (api *webSocketAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIP = r.RemoteAddr
+	}
+
+	connection := &webSocketConnection{
+		id:          newWebSocketConnectionID(),
+		connectedAt: time.Now(),
+	}
+
+	connection.lastActiveAt = connection.connectedAt
+	connection.request = webSocketEventRequest{
+		ConnectionID:    connection.id,
+		ConnectedAt:     connection.connectedAt,
+		DomainName:      r.Host,
+		SourceIP:        sourceIP,
+		UserAgent:       r.UserAgent(),
+		Headers:         r.Header.Clone(),
+		QueryParameters: r.URL.Query(),
+	}
+
+	if handler := api.route("$connect"); handler != nil {
+		fmt.Printf("WebSocket $connect %s (%s)\n", connection.id, handler.handlerConfig.Name)
+		start := time.Now()
+
+		output := api.execute(handler, connection.event("$connect", "CONNECT"))
+		status := webSocketConnectStatus(output)
+		fmt.Printf("Completed in %dms\n\n", time.Since(start).Milliseconds())
+
+		if status != http.StatusOK {
+			color.New(color.FgHiYellow).Printf("WebSocket connection %s rejected with status %d\n\n", connection.id, status)
+
+			body, _ := json.Marshal(map[string]string{"message": http.StatusText(status)})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write(body)
+			return
+		}
+	}
+
+	// The upgrader responds to the request itself when it fails.
+	conn, err := api.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	connection.conn = conn
+
+	api.mutex.Lock()
+	api.connections[connection.id] = connection
+	api.mutex.Unlock()
+
+	fmt.Printf("WebSocket %s connected\n\n", connection.id)
+
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			api.disconnect(connection, err)
+			return
+		}
+
+		api.mutex.Lock()
+		connection.lastActiveAt = time.Now()
+		api.mutex.Unlock()
+
+		api.handleMessage(connection, message, messageType == websocket.BinaryMessage)
+	}
+}
+
+// handleMessage invokes the handler of the message's route. Like a route
+// with a route response, whatever body the handler returns is sent back to
+// the client.
+func (api *webSocketAPI) handleMessage(connection *webSocketConnection, message []byte, isBinary bool) {
+	requestID := uuid.New().String()
+	routeKey, handler := api.selectRoute(message, isBinary)
+
+	if handler == nil {
+		color.New(color.FgHiYellow).Printf("WebSocket %s sent a message that matches no route\n\n", connection.id)
+		connection.writeJSON(map[string]string{"message": "Forbidden", "connectionId": connection.id, "requestId": requestID})
+		return
+	}
+
+	request := connection.request
+	request.RouteKey = routeKey
+	request.EventType = "MESSAGE"
+	request.RequestID = requestID
+	request.MessageID = newWebSocketConnectionID()
+	request.Body = message
+	request.IsBinary = isBinary
+
+	event, _ := json.Marshal(newWebSocketEvent(request))
+
+	fmt.Printf("WebSocket %s %s (%s)\n", routeKey, connection.id, handler.handlerConfig.Name)
+	start := time.Now()
+
+	output := api.execute(handler, event)
+
+	if failure := invocationFailure(output); failure != "" {
+		if output.err != nil {
+			fmt.Println(output.err)
+		}
+
+		color.New(color.FgHiRed).Printf("WebSocket %s failed (%s)\n", routeKey, failure)
+		connection.writeJSON(map[string]string{"message": "Internal server error", "connectionId": connection.id, "requestId": requestID})
+	} else if output.handlerResult.Body != "" {
+		connection.write([]byte(output.handlerResult.Body))
+	}
+
+	fmt.Printf("Completed in %dms\n\n", time.Since(start).Milliseconds())
+}
+
+// disconnect forgets a connection that has closed and invokes the
+// $disconnect route, unless the server is shutting down.
+func (api *webSocketAPI) disconnect(connection *webSocketConnection, readErr error) {
+	connection.conn.Close()
+
+	api.mutex.Lock()
+	delete(api.connections, connection.id)
+	closeReason, closed := connection.closeReason, api.closed
+	api.mutex.Unlock()
+
+	statusCode := websocket.CloseAbnormalClosure
+	reason := "Connection closed without a close frame"
+
+	var closeErr *websocket.CloseError
+	switch {
+	case closeReason != "":
+		statusCode = websocket.CloseNormalClosure
+		reason = closeReason
+	case errors.As(readErr, &closeErr):
+		statusCode = closeErr.Code
+		reason = fmt.Sprintf("Client-side close frame status code '%d' and reason '%s'", closeErr.Code, closeErr.Text)
+	}
+
+	fmt.Printf("WebSocket %s disconnected (%s)\n\n", connection.id, reason)
+
+	if closed {
+		return
+	}
+
+	handler := api.route("$disconnect")
+	if handler == nil {
+		return
+	}
+
+	request := connection.request
+	request.RouteKey = "$disconnect"
+	request.EventType = "DISCONNECT"
+	request.RequestID = uuid.New().String()
+	request.DisconnectStatusCode = statusCode
+	request.DisconnectReason = reason
+
+	event, _ := json.Marshal(newWebSocketEvent(request))
+
+	fmt.Printf("WebSocket $disconnect %s (%s)\n", connection.id, handler.handlerConfig.Name)
+	start := time.Now()
+
+	output := api.execute(handler, event)
+	if failure := invocationFailure(output); failure != "" {
+		color.New(color.FgHiRed).Printf("WebSocket $disconnect failed (%s)\n", failure)
+	}
+
+	fmt.Printf("Completed in %dms\n\n", time.Since(start).Milliseconds())
+}
+
+// serveConnection handles the @connections API's PostToConnection,
+// GetConnection and DeleteConnection.
+func (api *webSocketAPI) serveConnection(w http.ResponseWriter, r *http.Request) {
+	connectionID := mux.Vars(r)["connectionId"]
+
+	api.mutex.Lock()
+	connection, ok := api.connections[connectionID]
+	var lastActiveAt time.Time
+	if ok {
+		lastActiveAt = connection.lastActiveAt
+	}
+	api.mutex.Unlock()
+
+	if !ok {
+		writeConnectionsAPIError(w, http.StatusGone, "GoneException", "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		data, _ := io.ReadAll(io.LimitReader(r.Body, maxConnectionMessageBytes+1))
+		defer r.Body.Close()
+
+		if len(data) > maxConnectionMessageBytes {
+			writeConnectionsAPIError(w, http.StatusRequestEntityTooLarge, "PayloadTooLargeException", "Message too long")
+			return
+		}
+
+		if err := connection.write(data); err != nil {
+			writeConnectionsAPIError(w, http.StatusGone, "GoneException", "")
+			return
+		}
+
+		fmt.Printf("WebSocket @connections sent %d bytes to %s\n\n", len(data), connectionID)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		body, _ := json.Marshal(map[string]interface{}{
+			"connectedAt": connection.connectedAt.UTC().Format("2006-01-02T15:04:05.000Z"),
+			"identity": map[string]string{
+				"sourceIp":  connection.request.SourceIP,
+				"userAgent": connection.request.UserAgent,
+			},
+			"lastActiveAt": lastActiveAt.UTC().Format("2006-01-02T15:04:05.000Z"),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	case http.MethodDelete:
+		api.close(connection, "Connection deleted through the @connections API", websocket.CloseNormalClosure)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Close disconnects every client without invoking $disconnect.
+func (api *webSocketAPI) Close() {
+	api.mutex.Lock()
+	api.closed = true
+	connections := make([]*webSocketConnection, 0, len(api.connections))
+	for _, connection := range api.connections {
+		connections = append(connections, connection)
+	}
+	api.mutex.Unlock()
+
+	for _, connection := range connections {
+		api.close(connection, "Server shutting down", websocket.CloseGoingAway)
+	}
+}
+
+// close sends the client a close frame and closes the connection, which ends
+// its read loop.
+func (api *webSocketAPI) close(connection *webSocketConnection, reason string, code int) {
+	api.mutex.Lock()
+	connection.closeReason = reason
+	api.mutex.Unlock()
+
+	connection.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(webSocketWriteTimeout))
+	connection.conn.Close()
+}
+
+func (api *webSocketAPI) route(routeKey string) *HandlerInstance {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	return api.routes.handlers[routeKey]
+}
+
+// selectRoute returns the route the route selection expression selects for a
+// message, falling back to $default. Binary messages and messages that are not
+// JSON always go to $default.
+func (api *webSocketAPI) selectRoute(message []byte, isBinary bool) (string, *HandlerInstance) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	var body interface{}
+	if !isBinary && json.Unmarshal(message, &body) == nil {
+		if value, ok := api.routes.selection.Select(body); ok {
+			routeKey, isString := value.(string)
+			if !isString {
+				encoded, _ := json.Marshal(value)
+				routeKey = string(encoded)
+			}
+
+			// Route keys starting with $ are reserved for the predefined routes.
+			if handler, ok := api.routes.handlers[routeKey]; ok && !strings.HasPrefix(routeKey, "$") {
+				return routeKey, handler
+			}
+		}
+	}
+
+	if handler, ok := api.routes.handlers["$default"]; ok {
+		return "$default", handler
+	}
+
+	return "", nil
+}
+
+func (connection *webSocketConnection) event(routeKey string, eventType string) []byte {
+	request := connection.request
+	request.RouteKey = routeKey
+	request.EventType = eventType
+	request.RequestID = uuid.New().String()
+
+	event, _ := json.Marshal(newWebSocketEvent(request))
+	return event
+}
+
+// write sends data as a text message when it is valid UTF-8, and as a binary
+// message otherwise.
+func (connection *webSocketConnection) write(data []byte) error {
+	messageType := websocket.TextMessage
+	if !utf8.Valid(data) {
+		messageType = websocket.BinaryMessage
+	}
+
+	connection.writeMutex.Lock()
+	defer connection.writeMutex.Unlock()
+
+	connection.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+	return connection.conn.WriteMessage(messageType, data)
+}
+
+func (connection *webSocketConnection) writeJSON(value interface{}) {
+	data, _ := json.Marshal(value)
+	connection.write(data)
+}
+
+// webSocketAPIPath returns where clients connect to the WebSocket API of the
+// configuration.
+func webSocketAPIPath(terrableConfig config.TerrableConfig) string {
+	if terrableConfig.WebSocketApi != nil {
+		return terrableConfig.WebSocketApi.Path
+	}
+
+	return config.DefaultWebSocketAPIConfig().Path
+}
+
+// webSocketConnectStatus is the status the connection request is answered
+// with. A $connect handler rejects the connection by failing or by returning
+// a status code outside 2xx. A code that isn't a valid HTTP status, including
+// a missing one, is answered with 500.
+func webSocketConnectStatus(output HandlerOutput) int {
+	if output.err != nil {
+		return http.StatusInternalServerError
+	}
+
+	statusCode := output.handlerResult.StatusCode
+	if statusCode < 100 || statusCode > 599 {
+		return http.StatusInternalServerError
+	}
+
+	if statusCode < 200 || statusCode > 299 {
+		return statusCode
+	}
+
+	return http.StatusOK
+}
+
+// newWebSocketConnectionID returns an ID in the format of API Gateway
+// connection IDs, which is safe to use in a URL path.
+func newWebSocketConnectionID() string {
+	id := make([]byte, 11)
+	rand.Read(id)
+
+	return base64.URLEncoding.EncodeToString(id)
+}
+
+func writeConnectionsAPIError(w http.ResponseWriter, statusCode int, code string, message string) {
+	body, _ := json.Marshal(map[string]interface{}{"message": nil})
+	if message != "" {
+		body, _ = json.Marshal(map[string]string{"message": message})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Amzn-ErrorType", code)
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+func executeWebSocketEvent(handler *HandlerInstance, event []byte) HandlerOutput {
+	result, err := handler.Execute(generateRuntimeCode(handler, string(event)))
+
+	return HandlerOutput{
+		handlerResult: result,
+		err:           err,
+	}
+}
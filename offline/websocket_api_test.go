@@ -0,0 +1,290 @@
+package offline
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func newTestWebSocketAPI(t *testing.T, terrableConfig *config.TerrableConfig) (*httptest.Server, *recordedInvocations[string]) {
+	t.Helper()
+
+	handlers := make(map[string]*HandlerInstance, len(terrableConfig.Handlers))
+	for _, handler := range terrableConfig.Handlers {
+		handlers[handler.Name] = &HandlerInstance{handlerConfig: handler}
+	}
+
+	routes := newWebSocketRoutes(terrableConfig, handlers)
+	api := newWebSocketAPI()
+	api.setRoutes(routes)
+
+	recorded := newRecordedInvocations[string]()
+	api.execute = func(handler *HandlerInstance, event []byte) HandlerOutput {
+		recorded.record(handler, string(event))
+
+		switch handler.handlerConfig.Name {
+		case "Unauthorised":
+			return HandlerOutput{handlerResult: &handlerResult{StatusCode: http.StatusUnauthorized}}
+		case "Failing":
+			return HandlerOutput{handlerResult: newHandlerErrorResult(runtimeErrorResponse{ErrorMessage: "boom", ErrorType: "Error"})}
+		case "Joiner":
+			return HandlerOutput{handlerResult: &handlerResult{StatusCode: http.StatusOK, Body: "joined"}}
+		}
+
+		return HandlerOutput{handlerResult: &handlerResult{StatusCode: http.StatusOK}}
+	}
+
+	root := mux.NewRouter()
+	registerWebSocketRoutes(root, api, routes)
+	registerConnectionsAPIRoutes(root, api, routes)
+
+	server := httptest.NewServer(root)
+	t.Cleanup(func() {
+		api.Close()
+		server.Close()
+	})
+
+	return server, recorded
+}
+
+func dialTestWebSocket(t *testing.T, server *httptest.Server, path string) *websocket.Conn {
+	t.Helper()
+
+	conn, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, nil)
+	if err != nil {
+		status := 0
+		if response != nil {
+			status = response.StatusCode
+		}
+
+		t.Fatalf("failed to connect (status %d): %v", status, err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func readTestWebSocketMessage(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read a message: %v", err)
+	}
+
+	return string(message)
+}
+
+func webSocketTestConfig() *config.TerrableConfig {
+	return &config.TerrableConfig{
+		WebSocketApi: &config.WebSocketAPIConfig{RouteSelectionExpression: "$request.body.action", Path: "/ws"},
+		Handlers: []config.HandlerMapping{
+			{Name: "Connections", WebSocket: &config.WebSocketConfig{Routes: []string{"$connect", "$disconnect"}}},
+			{Name: "Joiner", WebSocket: &config.WebSocketConfig{Routes: []string{"join"}}},
+			{Name: "Failing", WebSocket: &config.WebSocketConfig{Routes: []string{"fail"}}},
+			{Name: "Fallback", WebSocket: &config.WebSocketConfig{Routes: []string{"$default"}}},
+		},
+	}
+}
+
+func TestWebSocketAPIRoutesMessages(t *testing.T) {
+	server, recorded := newTestWebSocketAPI(t, webSocketTestConfig())
+	conn := dialTestWebSocket(t, server, "/ws?room=lobby")
+
+	connect := []byte(recorded.get("Connections")[0])
+	if eventType := jsonPathValue(t, connect, "requestContext.eventType"); eventType != "CONNECT" {
+		t.Errorf("expected a CONNECT event, got %v", eventType)
+	}
+
+	if room := jsonPathValue(t, connect, "queryStringParameters.room"); room != "lobby" {
+		t.Errorf("expected the query string of the connection request, got %v", room)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"action":"join","room":"lobby"}`))
+	if response := readTestWebSocketMessage(t, conn); response != "joined" {
+		t.Errorf("expected the body the handler returned, got %q", response)
+	}
+
+	join := []byte(recorded.get("Joiner")[0])
+	checks := map[string]interface{}{
+		"requestContext.routeKey":     "join",
+		"requestContext.eventType":    "MESSAGE",
+		"requestContext.connectionId": jsonPathValue(t, connect, "requestContext.connectionId"),
+		"body":                        `{"action":"join","room":"lobby"}`,
+		"isBase64Encoded":             false,
+	}
+
+	for path, expected := range checks {
+		if value := jsonPathValue(t, join, path); value != expected {
+			t.Errorf("expected %s to be %v, got %v", path, expected, value)
+		}
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"action":"leave"}`))
+	conn.WriteMessage(websocket.BinaryMessage, []byte{0xff, 0x00})
+	waitFor(t, func() bool { return len(recorded.get("Fallback")) == 2 })
+
+	if routeKey := jsonPathValue(t, []byte(recorded.get("Fallback")[0]), "requestContext.routeKey"); routeKey != "$default" {
+		t.Errorf("expected a message without a route of its own to go to $default, got %v", routeKey)
+	}
+
+	if body := jsonPathValue(t, []byte(recorded.get("Fallback")[1]), "body"); body != "/wA=" {
+		t.Errorf("expected a binary message to be base64 encoded, got %v", body)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"action":"fail"}`))
+	if message := readTestWebSocketMessage(t, conn); !strings.Contains(message, `"message":"Internal server error"`) {
+		t.Errorf("expected a failed invocation to be reported to the client, got %s", message)
+	}
+}
+
+func TestWebSocketAPIWithoutDefaultRoute(t *testing.T) {
+	server, _ := newTestWebSocketAPI(t, &config.TerrableConfig{
+		Handlers: []config.HandlerMapping{
+			{Name: "Joiner", WebSocket: &config.WebSocketConfig{Routes: []string{"join"}}},
+		},
+	})
+
+	conn := dialTestWebSocket(t, server, "/")
+	conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+
+	if message := readTestWebSocketMessage(t, conn); !strings.Contains(message, `"message":"Forbidden"`) {
+		t.Errorf("expected a message without a route to be forbidden, got %s", message)
+	}
+}
+
+func TestWebSocketAPIConnectCanRejectConnections(t *testing.T) {
+	server, _ := newTestWebSocketAPI(t, &config.TerrableConfig{
+		Handlers: []config.HandlerMapping{
+			{Name: "Unauthorised", WebSocket: &config.WebSocketConfig{Routes: []string{"$connect"}}},
+		},
+	})
+
+	_, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/", nil)
+	if err == nil {
+		t.Fatal("expected the connection to be rejected")
+	}
+
+	if response == nil || response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the status the $connect handler returned, got %v", response)
+	}
+}
+
+func TestWebSocketConnectStatus(t *testing.T) {
+	tests := map[int]int{
+		0:    http.StatusInternalServerError,
+		42:   http.StatusInternalServerError,
+		204:  http.StatusOK,
+		403:  http.StatusForbidden,
+		1000: http.StatusInternalServerError,
+	}
+
+	for statusCode, expected := range tests {
+		output := HandlerOutput{handlerResult: &handlerResult{StatusCode: statusCode}}
+		if status := webSocketConnectStatus(output); status != expected {
+			t.Errorf("expected status code %d to answer the connection with %d, got %d", statusCode, expected, status)
+		}
+	}
+}
+
+func TestConnectionsAPI(t *testing.T) {
+	server, recorded := newTestWebSocketAPI(t, webSocketTestConfig())
+	conn := dialTestWebSocket(t, server, "/ws")
+
+	connectionID := jsonPathValue(t, []byte(recorded.get("Connections")[0]), "requestContext.connectionId").(string)
+	connectionURL := server.URL + "/" + webSocketStage + "/@connections/" + connectionID
+
+	response, err := http.Post(connectionURL, "application/octet-stream", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("expected the message to be sent, got %d", response.StatusCode)
+	}
+
+	if message := readTestWebSocketMessage(t, conn); message != "hello" {
+		t.Errorf("expected the client to receive the message, got %q", message)
+	}
+
+	response, err = http.Get(server.URL + "/@connections/" + connectionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	var connection struct {
+		ConnectedAt string `json:"connectedAt"`
+		Identity    struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+	}
+
+	if err := json.Unmarshal(body, &connection); err != nil || connection.ConnectedAt == "" || connection.Identity.SourceIP != "127.0.0.1" {
+		t.Errorf("expected the details of the connection, got %s", body)
+	}
+
+	request, _ := http.NewRequest(http.MethodDelete, connectionURL, nil)
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent {
+		t.Errorf("expected the connection to be deleted, got %d", response.StatusCode)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("expected the client to be sent a close frame, got %v", err)
+	}
+
+	waitFor(t, func() bool { return len(recorded.get("Connections")) == 2 })
+
+	disconnect := []byte(recorded.get("Connections")[1])
+	if eventType := jsonPathValue(t, disconnect, "requestContext.eventType"); eventType != "DISCONNECT" {
+		t.Errorf("expected a DISCONNECT event, got %v", eventType)
+	}
+
+	if statusCode := jsonPathValue(t, disconnect, "requestContext.disconnectStatusCode"); statusCode != float64(websocket.CloseNormalClosure) {
+		t.Errorf("expected a normal closure, got %v", statusCode)
+	}
+
+	response, err = http.Post(connectionURL, "application/octet-stream", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusGone || response.Header.Get("X-Amzn-ErrorType") != "GoneException" {
+		t.Errorf("expected a GoneException for a closed connection, got %d %s", response.StatusCode, response.Header.Get("X-Amzn-ErrorType"))
+	}
+}
+
+func TestWebSocketAPIIsOnlyServedWhenConfigured(t *testing.T) {
+	api := newWebSocketAPI()
+	routes := newWebSocketRoutes(&config.TerrableConfig{Handlers: []config.HandlerMapping{{Name: "Handler1"}}}, map[string]*HandlerInstance{})
+
+	router := mux.NewRouter()
+	registerWebSocketRoutes(router, api, routes)
+	registerConnectionsAPIRoutes(router, api, routes)
+
+	assertRouteMatches(t, router, "/@connections/abc", false)
+}
@@ -5,6 +5,14 @@ module "offline_core" {
 
   timeout = 3
 
+  build = {
+    target = "node20"
+  }
+
+  websocket_api = {
+    route_selection_expression = "$request.body.action"
+  }
+
   handlers = {
     EchoHandler = {
       source = "./src/Echo.ts"
@@ -51,6 +59,21 @@ module "offline_core" {
       }
     }
 
+    SqsPartialHandler = {
+      source = "./src/SqsPartial.ts"
+      sqs = {
+        queue                      = "arn:aws:sqs:eu-west-1:000000000000:partial-queue"
+        visibility_timeout_seconds = 60
+      }
+    }
+
+    SqsSender = {
+      source = "./src/SqsSender.ts"
+      http = {
+        POST = "/send-to-queue"
+      }
+    }
+
     ScheduledHandler = {
       source = "./src/Scheduled.ts"
       schedule = {
@@ -58,6 +81,184 @@ module "offline_core" {
       }
     }
 
+    ScheduledInputHandler = {
+      source = "./src/ScheduledInput.ts"
+      schedule = {
+        expression = "cron(0 9 ? * MON-FRI *)"
+        timezone   = "Europe/London"
+        input_transformer = {
+          input_paths = {
+            type = "$.detail-type"
+            time = "$.time"
+          }
+          input_template = <<-TEMPLATE
+            {
+              "summary": "<type> from <aws.events.rule-name>",
+              "firedAt": <time>
+            }
+          TEMPLATE
+        }
+      }
+    }
+
+    OrderEventsHandler = {
+      source = "./src/OrderEvents.ts"
+      event_pattern = {
+        source        = ["com.example.orders"]
+        "detail-type" = ["Order Placed"]
+        detail = {
+          total = [{ numeric = [">", 0] }]
+        }
+      }
+    }
+
+    EventSender = {
+      source = "./src/EventSender.ts"
+      http = {
+        POST = "/put-event"
+      }
+    }
+
+    NotificationHandler = {
+      source = "./src/Notification.ts"
+      sns = {
+        topic = "arn:aws:sns:eu-west-1:000000000000:notifications"
+        filter_policy = {
+          priority = ["high"]
+        }
+      }
+    }
+
+    SqsNotificationsHandler = {
+      source = "./src/SqsNotifications.ts"
+      sqs = {
+        queue = "arn:aws:sqs:eu-west-1:000000000000:notifications-queue"
+        sns = {
+          topic = "arn:aws:sns:eu-west-1:000000000000:notifications"
+        }
+      }
+    }
+
+    UploadsHandler = {
+      source = "./src/Uploads.ts"
+      s3 = {
+        bucket        = "arn:aws:s3:::uploads"
+        directory     = "./buckets/uploads"
+        filter_suffix = ".txt"
+      }
+    }
+
+    SnsPublisher = {
+      source = "./src/SnsPublisher.ts"
+      http = {
+        POST = "/publish"
+      }
+    }
+
+    Adder = {
+      source = "./src/Adder.ts"
+      async = {
+        maximum_retry_attempts = 1
+        on_success             = "AdderResults"
+        on_failure             = "arn:aws:sqs:eu-west-1:000000000000:adder-failures"
+      }
+    }
+
+    AdderResults = {
+      source = "./src/AdderResults.ts"
+    }
+
+    FunctionInvoker = {
+      source = "./src/FunctionInvoker.ts"
+      http = {
+        POST = "/invoke-function"
+      }
+    }
+
+    EchoFunctionURL = {
+      source = "./src/Echo.ts"
+      function_url = {
+        cors = {
+          allow_origins = ["https://example.com"]
+          allow_methods = ["GET", "POST"]
+          allow_headers = ["content-type"]
+          max_age       = 300
+        }
+      }
+    }
+
+    SignedFunctionURL = {
+      source = "./src/Echo.ts"
+      function_url = {
+        path      = "/signed-url"
+        auth_type = "AWS_IAM"
+      }
+    }
+
+    WebSocketConnections = {
+      source = "./src/WebSocketConnections.ts"
+      websocket = {
+        routes = ["$connect", "$disconnect"]
+      }
+    }
+
+    WebSocketMessages = {
+      source = "./src/WebSocketMessages.ts"
+      websocket = {
+        routes = ["$default", "echo"]
+      }
+    }
+
+    BuildSettings = {
+      source = "./src/BuildSettings.ts"
+      build = {
+        define = {
+          BUILD_STAGE = "\"offline\""
+        }
+      }
+      http = {
+        GET = "/build-settings"
+      }
+    }
+
+    EsmHandler = {
+      source = "./src/Esm.mts"
+      http = {
+        GET = "/esm"
+      }
+    }
+
+    PythonHandler = {
+      source  = "./src/python/handler.py"
+      runtime = "python3.12"
+      timeout = 1
+      http = {
+        GET = "/python"
+      }
+    }
+
+    ProvidedHandler = {
+      source  = "./src/provided/bootstrap"
+      runtime = "provided.al2023"
+      http = {
+        GET = "/provided"
+      }
+    }
+
+    IsolationOne = {
+      source = "./src/Isolation.ts"
+      http = {
+        GET = "/isolation1"
+      }
+    }
+
+    IsolationTwo = {
+      source = "./src/Isolation.ts"
+      http = {
+        GET = "/isolation2"
+      }
+    }
+
     CollisionOne = {
       source = "./src/Collision1/Collision.ts"
       http = {
@@ -0,0 +1,11 @@
+const handler = async (event) => {
+  if (event.a < 0 || event.b < 0) {
+    throw new Error("negative numbers are not supported");
+  }
+
+  console.log(`Adding ${event.a} and ${event.b}`);
+
+  return { sum: event.a + event.b };
+};
+
+export { handler };
@@ -0,0 +1,7 @@
+const handler = async (event) => {
+  const { condition, approximateInvokeCount } = event.requestContext;
+
+  console.log(`Adder ${condition} after ${approximateInvokeCount} attempt(s): ${JSON.stringify(event.responsePayload)}`);
+};
+
+export { handler };
@@ -0,0 +1,15 @@
+declare const BUILD_STAGE: string;
+
+const handler = async () => {
+    return {
+        statusCode: 200,
+        headers: {
+            "Content-Type": "application/json",
+        },
+        body: JSON.stringify({
+            stage: BUILD_STAGE,
+        }),
+    }
+}
+
+export { handler };
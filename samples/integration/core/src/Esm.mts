@@ -0,0 +1,16 @@
+const loadedWith = await Promise.resolve("top-level-await");
+
+const handler = async () => {
+    return {
+        statusCode: 200,
+        headers: {
+            "Content-Type": "application/json",
+        },
+        body: JSON.stringify({
+            loadedWith,
+            moduleType: typeof import.meta.url === "string" ? "esm" : "cjs",
+        }),
+    }
+}
+
+export { handler };
@@ -0,0 +1,33 @@
+const handler = async (event) => {
+    const endpoint = process.env.AWS_ENDPOINT_URL_EVENTBRIDGE;
+
+    const response = await fetch(endpoint, {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/x-amz-json-1.1",
+            "X-Amz-Target": "AWSEvents.PutEvents",
+        },
+        body: JSON.stringify({
+            Entries: [
+                {
+                    Source: "com.example.orders",
+                    DetailType: "Order Placed",
+                    Detail: event.body,
+                },
+            ],
+        }),
+    });
+
+    return {
+        statusCode: response.status,
+        headers: {
+            "Content-Type": "application/json",
+        },
+        body: JSON.stringify({
+            endpoint,
+            result: await response.json(),
+        }),
+    };
+}
+
+export { handler };
@@ -0,0 +1,29 @@
+const handler = async (event) => {
+    const endpoint = process.env.AWS_ENDPOINT_URL_LAMBDA;
+
+    const response = await fetch(`${endpoint}/2015-03-31/functions/Adder/invocations`, {
+        method: "POST",
+        headers: {
+            "X-Amz-Invocation-Type": "RequestResponse",
+            "X-Amz-Log-Type": "Tail",
+        },
+        body: event.body,
+    });
+
+    const logResult = response.headers.get("X-Amz-Log-Result");
+
+    return {
+        statusCode: response.status,
+        headers: {
+            "Content-Type": "application/json",
+        },
+        body: JSON.stringify({
+            endpoint,
+            functionError: response.headers.get("X-Amz-Function-Error") ?? "",
+            payload: await response.json(),
+            logs: logResult ? Buffer.from(logResult, "base64").toString("utf8") : "",
+        }),
+    };
+}
+
+export { handler };
@@ -0,0 +1,24 @@
+declare global {
+    var isolationMarker: string | undefined;
+}
+
+const handler = async (event) => {
+    const previousGlobal = globalThis.isolationMarker ?? null;
+    const previousEnv = process.env.ISOLATION_MARKER ?? null;
+
+    globalThis.isolationMarker = event.path;
+    process.env.ISOLATION_MARKER = event.path;
+
+    return {
+        statusCode: 200,
+        headers: {
+            "Content-Type": "application/json",
+        },
+        body: JSON.stringify({
+            previousGlobal,
+            previousEnv,
+        }),
+    }
+}
+
+export { handler };
@@ -0,0 +1,13 @@
+const handler = async (event) => {
+  const [record] = event.Records;
+
+  console.log(`Notification: ${record.Sns.Message}`);
+
+  return {
+    topicArn: record.Sns.TopicArn,
+    message: record.Sns.Message,
+    priority: record.Sns.MessageAttributes.priority?.Value,
+  };
+};
+
+export { handler };
@@ -0,0 +1,11 @@
+const handler = async (event) => {
+  console.log(`Order ${event.detail.orderId} placed for ${event.detail.total}`);
+
+  return {
+    source: event.source,
+    detailType: event["detail-type"],
+    orderId: event.detail.orderId,
+  };
+};
+
+export { handler };
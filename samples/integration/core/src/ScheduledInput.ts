@@ -0,0 +1,11 @@
+const handler = async (event) => {
+  return {
+    statusCode: 200,
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify(event),
+  };
+};
+
+export { handler };
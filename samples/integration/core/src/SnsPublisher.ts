@@ -0,0 +1,34 @@
+const handler = async (event) => {
+    const endpoint = process.env.AWS_ENDPOINT_URL_SNS;
+
+    const response = await fetch(endpoint, {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/x-www-form-urlencoded; charset=utf-8",
+        },
+        body: new URLSearchParams({
+            Action: "Publish",
+            Version: "2010-03-31",
+            TopicArn: "arn:aws:sns:eu-west-1:000000000000:notifications",
+            Message: event.body,
+            "MessageAttributes.entry.1.Name": "priority",
+            "MessageAttributes.entry.1.Value.DataType": "String",
+            "MessageAttributes.entry.1.Value.StringValue": "high",
+        }).toString(),
+    });
+
+    const result = await response.text();
+
+    return {
+        statusCode: response.status,
+        headers: {
+            "Content-Type": "application/json",
+        },
+        body: JSON.stringify({
+            endpoint,
+            messageId: result.match(/<MessageId>(.*)<\/MessageId>/)?.[1],
+        }),
+    };
+}
+
+export { handler };
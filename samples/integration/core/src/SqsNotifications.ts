@@ -0,0 +1,8 @@
+const handler = async (event) => {
+  for (const record of event.Records) {
+    const notification = JSON.parse(record.body);
+    console.log(`Queued notification: ${notification.Message}`);
+  }
+};
+
+export { handler };
@@ -0,0 +1,9 @@
+const handler = async (event) => {
+    return {
+        batchItemFailures: event.Records
+            .filter((record) => record.body.startsWith("fail"))
+            .map((record) => ({ itemIdentifier: record.messageId })),
+    };
+}
+
+export { handler };
@@ -0,0 +1,28 @@
+const handler = async (event) => {
+    const endpoint = process.env.AWS_ENDPOINT_URL_SQS;
+
+    const response = await fetch(endpoint, {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/x-amz-json-1.0",
+            "X-Amz-Target": "AmazonSQS.SendMessage",
+        },
+        body: JSON.stringify({
+            QueueUrl: `${endpoint}/000000000000/test-queue`,
+            MessageBody: event.body,
+        }),
+    });
+
+    return {
+        statusCode: response.status,
+        headers: {
+            "Content-Type": "application/json",
+        },
+        body: JSON.stringify({
+            endpoint,
+            result: await response.json(),
+        }),
+    };
+}
+
+export { handler };
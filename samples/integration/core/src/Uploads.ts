@@ -0,0 +1,11 @@
+const handler = async (event) => {
+  for (const record of event.Records) {
+    const { bucket, object } = record.s3;
+
+    console.log(`Upload ${record.eventName} ${bucket.name}/${object.key} (${object.size ?? 0} bytes)`);
+  }
+
+  return { processed: event.Records.length };
+};
+
+export { handler };
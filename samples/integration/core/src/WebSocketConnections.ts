@@ -0,0 +1,13 @@
+const handler = async (event) => {
+    const { eventType, connectionId, disconnectReason } = event.requestContext;
+
+    if (eventType === "CONNECT" && event.queryStringParameters?.token === "deny") {
+        return { statusCode: 403 };
+    }
+
+    console.log(`WebSocket ${eventType} ${connectionId}${disconnectReason ? `: ${disconnectReason}` : ""}`);
+
+    return { statusCode: 200 };
+}
+
+export { handler };
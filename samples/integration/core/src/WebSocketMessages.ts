@@ -0,0 +1,24 @@
+const handler = async (event) => {
+    const { routeKey, connectionId } = event.requestContext;
+
+    if (routeKey === "echo") {
+        return {
+            statusCode: 200,
+            body: JSON.stringify({
+                routeKey,
+                connectionId,
+                message: JSON.parse(event.body),
+            }),
+        };
+    }
+
+    // Everything else is pushed back to the client through the @connections API.
+    const response = await fetch(`${process.env.AWS_ENDPOINT_URL_APIGATEWAYMANAGEMENTAPI}/@connections/${connectionId}`, {
+        method: "POST",
+        body: `pushed: ${event.body}`,
+    });
+
+    return { statusCode: response.status };
+}
+
+export { handler };
@@ -0,0 +1,26 @@
+import json
+import os
+import time
+
+from greeting import greet
+
+
+def handler(event, context):
+    params = event.get("queryStringParameters") or {}
+
+    if "sleep" in params:
+        time.sleep(float(params["sleep"]))
+
+    return {
+        "statusCode": 200,
+        "headers": {
+            "Content-Type": "application/json",
+        },
+        "body": json.dumps({
+            "message": greet(params.get("name", "world")),
+            "path": event["path"],
+            "globalEnv": os.environ.get("GLOBAL_ENV"),
+            "envFileVal": os.environ.get("ENV_FILE_VAL"),
+            "remainingTime": "positive" if context.get_remaining_time_in_millis() > 0 else "expired",
+        }),
+    }
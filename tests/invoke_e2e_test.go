@@ -0,0 +1,117 @@
+//go:build e2e
+
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type invokeOutput struct {
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+func TestInvokeCommand(t *testing.T) {
+	t.Run("prints the result of an event file", func(t *testing.T) {
+		eventPath := filepath.Join(t.TempDir(), "event.json")
+		if err := os.WriteFile(eventPath, []byte(`{"httpMethod":"POST","path":"/invoked","body":"hello"}`), 0o644); err != nil {
+			t.Fatalf("failed to write event: %v", err)
+		}
+
+		output := runInvoke(t, "", "EchoHandler", "--event", eventPath)
+
+		if output.exitCode != 0 {
+			t.Fatalf("expected exit code 0, got %d\nstderr:\n%s", output.exitCode, output.stderr)
+		}
+
+		var result struct {
+			StatusCode int    `json:"statusCode"`
+			Body       string `json:"body"`
+		}
+
+		if err := json.Unmarshal([]byte(output.stdout), &result); err != nil {
+			t.Fatalf("expected stdout to only contain the JSON result: %v\nstdout:\n%s", err, output.stdout)
+		}
+
+		if result.StatusCode != 200 || !strings.Contains(result.Body, `"path":"/invoked"`) {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("reads the event from stdin", func(t *testing.T) {
+		output := runInvoke(t, `{"path":"/stdin","queryStringParameters":{"name":"stdin"}}`, "PythonHandler")
+
+		if output.exitCode != 0 {
+			t.Fatalf("expected exit code 0, got %d\nstderr:\n%s", output.exitCode, output.stderr)
+		}
+
+		if !strings.Contains(output.stdout, `Hello, stdin`) {
+			t.Errorf("expected the Python handler's result, got:\n%s", output.stdout)
+		}
+	})
+
+	t.Run("exits with an error when the handler times out", func(t *testing.T) {
+		output := runInvoke(t, `{}`, "TimeoutDelay")
+
+		if output.exitCode == 0 {
+			t.Fatalf("expected a non-zero exit code\nstdout:\n%s", output.stdout)
+		}
+
+		if !strings.Contains(output.stderr, "timed out") {
+			t.Errorf("expected the timeout to be reported, got:\n%s", output.stderr)
+		}
+	})
+
+	t.Run("exits with an error for unknown handlers", func(t *testing.T) {
+		output := runInvoke(t, `{}`, "MissingHandler")
+
+		if output.exitCode == 0 || !strings.Contains(output.stderr, "EchoHandler") {
+			t.Errorf("expected the available handlers to be listed, got exit code %d:\n%s", output.exitCode, output.stderr)
+		}
+	})
+}
+
+func runInvoke(t *testing.T, stdin string, args ...string) invokeOutput {
+	t.Helper()
+
+	rootDir, err := repoRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commandArgs := append([]string{"invoke"}, args...)
+	commandArgs = append(commandArgs,
+		"-f", filepath.Join(rootDir, "samples/integration/core/offline.tf"),
+		"-m", "offline_core",
+		"--envfile", filepath.Join(rootDir, "samples/integration/core/.env.sample"),
+	)
+
+	var stdout, stderr bytes.Buffer
+
+	command := exec.Command(builtBinary.path, commandArgs...)
+	command.Dir = t.TempDir()
+	command.Stdin = strings.NewReader(stdin)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	err = command.Run()
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("failed to run invoke: %v", err)
+	}
+
+	return invokeOutput{
+		stdout:   stdout.String(),
+		stderr:   stderr.String(),
+		exitCode: command.ProcessState.ExitCode(),
+	}
+}
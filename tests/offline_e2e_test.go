@@ -4,6 +4,7 @@ package tests
 
 import (
 	"bytes"
+	"crypto/md5"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,12 +14,15 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 const serverStartupTimeout = 60 * time.Second
@@ -174,11 +178,85 @@ func TestOfflineCoreRequests(t *testing.T) {
 			response.assertJSONNumberAtLeast(t, "recordCount", 1)
 			response.assertJSONValue(t, "firstRecord.body", "hello queue")
 			response.assertJSONValue(t, "firstRecord.eventSource", "aws:sqs")
-			response.assertJSONValue(t, "firstRecord.eventSourceARN", "arn:aws:sqs:eu-west-1:000000000000:SqsHandler")
+			response.assertJSONValue(t, "firstRecord.eventSourceARN", "arn:aws:sqs:eu-west-1:000000000000:test-queue")
 			response.assertJSONValue(t, "firstRecord.awsRegion", "eu-west-1")
 			response.assertJSONValue(t, "firstRecord.approximateReceiveCount", "1")
 		})
 
+		t.Run("retries only the messages reported in batchItemFailures", func(t *testing.T) {
+			succeeded := mustRequest(t, http.MethodPost, "/_sqs/SqsPartialHandler", nil, strings.NewReader("processed"))
+
+			succeeded.assertStatus(t, http.StatusOK)
+			succeeded.assertHeader(t, "X-Terrable-Message-Outcome", "succeeded")
+
+			failed := mustRequest(t, http.MethodPost, "/_sqs/SqsPartialHandler", nil, strings.NewReader("fail once"))
+
+			failed.assertStatus(t, http.StatusOK)
+			failed.assertHeader(t, "X-Terrable-Message-Outcome", "failed: reported in batchItemFailures")
+
+			state := mustRequest(t, http.MethodGet, "/_sqs/SqsPartialHandler", nil, nil)
+
+			state.assertStatus(t, http.StatusOK)
+			state.assertJSONValue(t, "inFlight.0.messageId", failed.headers.Get("X-Terrable-Message-Id"))
+			state.assertJSONValue(t, "inFlight.0.body", "fail once")
+			state.assertJSONValue(t, "inFlight.0.lastFailure", "reported in batchItemFailures")
+		})
+
+		t.Run("lets handlers send messages through the local SQS API", func(t *testing.T) {
+			response := mustRequest(t, http.MethodPost, "/send-to-queue", nil, strings.NewReader("sent from a handler"))
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertJSONValue(t, "endpoint", strings.Replace(testServerInstance.baseURL, "127.0.0.1", "localhost", 1))
+			response.assertJSONValue(t, "result.MD5OfMessageBody", fmt.Sprintf("%x", md5.Sum([]byte("sent from a handler"))))
+
+			if messageID, err := response.jsonValue("result.MessageId"); err != nil || messageID == "" {
+				t.Fatalf("expected a message ID, got %v (%v)", messageID, err)
+			}
+		})
+
+		t.Run("serves the SQS JSON protocol", func(t *testing.T) {
+			sqsHeaders := func(action string) map[string]string {
+				return map[string]string{
+					"Content-Type": "application/x-amz-json-1.0",
+					"X-Amz-Target": "AmazonSQS." + action,
+				}
+			}
+
+			queueUrl := mustRequest(t, http.MethodPost, "/", sqsHeaders("GetQueueUrl"), strings.NewReader(`{"QueueName":"test-queue"}`))
+
+			queueUrl.assertStatus(t, http.StatusOK)
+			queueUrl.assertJSONValue(t, "QueueUrl", testServerInstance.baseURL+"/000000000000/test-queue")
+
+			batch := mustRequest(t, http.MethodPost, "/", sqsHeaders("SendMessageBatch"), strings.NewReader(
+				`{"QueueUrl":"`+testServerInstance.baseURL+`/000000000000/test-queue","Entries":[{"Id":"a","MessageBody":"first"},{"Id":"b","MessageBody":"second"}]}`,
+			))
+
+			batch.assertStatus(t, http.StatusOK)
+			batch.assertJSONValue(t, "Successful.0.Id", "a")
+			batch.assertJSONValue(t, "Successful.1.Id", "b")
+
+			missing := mustRequest(t, http.MethodPost, "/", sqsHeaders("GetQueueUrl"), strings.NewReader(`{"QueueName":"missing-queue"}`))
+
+			missing.assertStatus(t, http.StatusBadRequest)
+			missing.assertJSONValue(t, "__type", "com.amazonaws.sqs#QueueDoesNotExist")
+			missing.assertHeader(t, "x-amzn-query-error", "AWS.SimpleQueueService.NonExistentQueue;Sender")
+		})
+
+		t.Run("exposes the state of local queues", func(t *testing.T) {
+			response := mustRequest(t, http.MethodGet, "/_sqs/SqsHandler", nil, nil)
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertHeader(t, "Content-Type", "application/json")
+			response.assertJSONValue(t, "handler", "SqsHandler")
+			response.assertJSONValue(t, "queueArn", "arn:aws:sqs:eu-west-1:000000000000:test-queue")
+			response.assertJSONNumberAtLeast(t, "batchSize", 10)
+
+			listResponse := mustRequest(t, http.MethodGet, "/_sqs", nil, nil)
+
+			listResponse.assertStatus(t, http.StatusOK)
+			listResponse.assertJSONValue(t, "queues.0.handler", "SqsHandler")
+		})
+
 		t.Run("builds an EventBridge-style event for scheduled handlers", func(t *testing.T) {
 			response := mustRequest(t, http.MethodPost, "/_scheduled/ScheduledHandler", nil, nil)
 
@@ -191,6 +269,156 @@ func TestOfflineCoreRequests(t *testing.T) {
 			response.assertJSONStringMatchesRFC3339(t, "time")
 		})
 
+		t.Run("applies the schedule input transformer", func(t *testing.T) {
+			response := mustRequest(t, http.MethodPost, "/_scheduled/ScheduledInputHandler", nil, nil)
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertJSONValue(t, "summary", "Scheduled Event from ScheduledInputHandler-scheduled")
+			response.assertJSONStringMatchesRFC3339(t, "firedAt")
+		})
+
+		t.Run("delivers events to handlers with a matching event pattern", func(t *testing.T) {
+			matched := mustRequest(t, http.MethodPost, "/_eventbridge", nil, strings.NewReader(
+				`{"Source":"com.example.orders","DetailType":"Order Placed","Detail":{"orderId":"order-1","total":25}}`,
+			))
+
+			matched.assertStatus(t, http.StatusOK)
+			matched.assertJSONValue(t, "deliveries.0.handler", "OrderEventsHandler")
+			matched.assertJSONValue(t, "deliveries.0.outcome", "succeeded")
+
+			unmatched := mustRequest(t, http.MethodPost, "/_eventbridge", nil, strings.NewReader(
+				`{"Source":"com.example.orders","DetailType":"Order Placed","Detail":{"orderId":"order-2","total":0}}`,
+			))
+
+			unmatched.assertStatus(t, http.StatusOK)
+
+			if deliveries, err := unmatched.jsonValue("deliveries"); err != nil || len(deliveries.([]interface{})) != 0 {
+				t.Fatalf("expected no deliveries, got %v (%v)", deliveries, err)
+			}
+		})
+
+		t.Run("lets handlers put events through the local EventBridge API", func(t *testing.T) {
+			response := mustRequest(t, http.MethodPost, "/put-event", nil, strings.NewReader(`{"orderId":"order-3","total":10}`))
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertJSONValue(t, "endpoint", strings.Replace(testServerInstance.baseURL, "127.0.0.1", "localhost", 1))
+
+			eventID, err := response.jsonValue("result.Entries.0.EventId")
+			if err != nil || eventID == "" {
+				t.Fatalf("expected an event ID, got %v (%v)", eventID, err)
+			}
+
+			waitForServerOutput(t, fmt.Sprintf("EventBridge event %s delivered to OrderEventsHandler", eventID))
+			waitForServerOutput(t, "Order order-3 placed for 10")
+		})
+
+		t.Run("delivers SNS messages to subscriptions whose filter policy matches", func(t *testing.T) {
+			highPriority := mustRequest(t, http.MethodPost, "/_sns/notifications", nil, strings.NewReader(
+				`{"Message":"disk full","MessageAttributes":{"priority":{"DataType":"String","StringValue":"high"}}}`,
+			))
+
+			highPriority.assertStatus(t, http.StatusOK)
+			highPriority.assertJSONValue(t, "deliveries.0.handler", "NotificationHandler")
+			highPriority.assertJSONValue(t, "deliveries.0.outcome", "succeeded")
+			highPriority.assertJSONValue(t, "deliveries.1.handler", "SqsNotificationsHandler")
+			highPriority.assertJSONValue(t, "deliveries.1.protocol", "sqs")
+
+			lowPriority := mustRequest(t, http.MethodPost, "/_sns/notifications", nil, strings.NewReader(
+				`{"Message":"disk nearly full","MessageAttributes":{"priority":{"DataType":"String","StringValue":"low"}}}`,
+			))
+
+			lowPriority.assertStatus(t, http.StatusOK)
+			lowPriority.assertJSONValue(t, "deliveries.0.handler", "SqsNotificationsHandler")
+
+			waitForServerOutput(t, "Queued notification: disk full")
+			waitForServerOutput(t, "Queued notification: disk nearly full")
+		})
+
+		t.Run("lets handlers publish messages through the local SNS API", func(t *testing.T) {
+			response := mustRequest(t, http.MethodPost, "/publish", nil, strings.NewReader("published from a handler"))
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertJSONValue(t, "endpoint", strings.Replace(testServerInstance.baseURL, "127.0.0.1", "localhost", 1))
+
+			messageID, err := response.jsonValue("messageId")
+			if err != nil || messageID == nil || messageID == "" {
+				t.Fatalf("expected a message ID, got %v (%v)", messageID, err)
+			}
+
+			waitForServerOutput(t, fmt.Sprintf("SNS message %s delivered to NotificationHandler", messageID))
+			waitForServerOutput(t, "Notification: published from a handler")
+		})
+
+		t.Run("notifies handlers of files added to and removed from a bucket directory", func(t *testing.T) {
+			rootDir, err := repoRoot()
+			if err != nil {
+				t.Fatalf("failed to find repository root: %v", err)
+			}
+
+			directory := filepath.Join(rootDir, "samples", "integration", "core", "buckets", "uploads")
+			t.Cleanup(func() { os.RemoveAll(filepath.Dir(directory)) })
+
+			upload := filepath.Join(directory, "report.txt")
+			if err := os.WriteFile(upload, []byte("quarterly"), 0o644); err != nil {
+				t.Fatalf("failed to add a file to the bucket: %v", err)
+			}
+
+			waitForServerOutput(t, "S3 event ObjectCreated:Put report.txt delivered to UploadsHandler")
+			waitForServerOutput(t, "Upload ObjectCreated:Put uploads/report.txt (9 bytes)")
+
+			if err := os.Remove(upload); err != nil {
+				t.Fatalf("failed to remove a file from the bucket: %v", err)
+			}
+
+			waitForServerOutput(t, "S3 event ObjectRemoved:Delete report.txt delivered to UploadsHandler")
+		})
+
+		t.Run("lets handlers invoke other functions through the local Lambda API", func(t *testing.T) {
+			response := mustRequest(t, http.MethodPost, "/invoke-function", nil, strings.NewReader(`{"a": 2, "b": 3}`))
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertJSONValue(t, "endpoint", strings.Replace(testServerInstance.baseURL, "127.0.0.1", "localhost", 1))
+			response.assertJSONValue(t, "functionError", "")
+
+			payload, err := response.jsonValue("payload")
+			if err != nil || !reflect.DeepEqual(payload, map[string]interface{}{"sum": float64(5)}) {
+				t.Errorf("expected exactly the value Adder returned, got %v (%v)", payload, err)
+			}
+
+			logs, err := response.jsonValue("logs")
+			if err != nil || !strings.Contains(fmt.Sprint(logs), "Adding 2 and 3") || !strings.Contains(fmt.Sprint(logs), "REPORT RequestId:") {
+				t.Errorf("expected the tail of Adder's logs, got %v (%v)", logs, err)
+			}
+
+			failed := mustRequest(t, http.MethodPost, "/invoke-function", nil, strings.NewReader(`{"a": -1, "b": 3}`))
+
+			failed.assertStatus(t, http.StatusOK)
+			failed.assertJSONValue(t, "functionError", "Unhandled")
+			failed.assertJSONValue(t, "payload.errorMessage", "negative numbers are not supported")
+		})
+
+		t.Run("runs Event invocations in the background", func(t *testing.T) {
+			response := mustRequest(t, http.MethodPost, "/2015-03-31/functions/Adder/invocations", map[string]string{
+				"X-Amz-Invocation-Type": "Event",
+			}, strings.NewReader(`{"a": 40, "b": 2}`))
+
+			response.assertStatus(t, http.StatusAccepted)
+			waitForServerOutput(t, "Adding 40 and 2")
+			waitForServerOutput(t, "Lambda async invocation of Adder completed")
+			waitForServerOutput(t, `Adder Success after 1 attempt(s): {"sum":42}`+"\n")
+		})
+
+		t.Run("retries failed Event invocations and records the failure", func(t *testing.T) {
+			response := mustRequest(t, http.MethodPost, "/2015-03-31/functions/Adder/invocations", map[string]string{
+				"X-Amz-Invocation-Type": "Event",
+			}, strings.NewReader(`{"a": -4, "b": 2}`))
+
+			response.assertStatus(t, http.StatusAccepted)
+			waitForServerOutput(t, "Async invocation of Adder failed (handler error: negative numbers are not supported), retry 1 of 1")
+			waitForServerOutput(t, "Async invocation of Adder discarded after 2 attempts (RetriesExhausted)")
+			waitForServerOutput(t, "Async RetriesExhausted record of Adder for arn:aws:sqs:eu-west-1:000000000000:adder-failures written to .terrable/async-destinations.log")
+		})
+
 		t.Run("timeout request does not break later requests", func(t *testing.T) {
 			timeoutResponse := mustRequest(t, http.MethodGet, "/timeout", nil, nil)
 			timeoutResponse.assertStatus(t, http.StatusGatewayTimeout)
@@ -208,6 +436,141 @@ func TestOfflineCoreRequests(t *testing.T) {
 			secondResponse.assertStatus(t, http.StatusOK)
 			secondResponse.assertJSONValue(t, "collision", "2")
 		})
+
+		t.Run("applies handler build settings", func(t *testing.T) {
+			response := mustRequest(t, http.MethodGet, "/build-settings", nil, nil)
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertJSONValue(t, "stage", "offline")
+		})
+
+		t.Run("serves function URLs with the function URL event format", func(t *testing.T) {
+			response := mustRequest(t, http.MethodPost, "/_url/EchoFunctionURL/orders?id=42", map[string]string{"Origin": "https://example.com"}, strings.NewReader("hello"))
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertHeader(t, "Access-Control-Allow-Origin", "https://example.com")
+			response.assertJSONValue(t, "event.version", "2.0")
+			response.assertJSONValue(t, "event.rawPath", "/orders")
+			response.assertJSONValue(t, "event.rawQueryString", "id=42")
+			response.assertJSONValue(t, "event.requestContext.domainName", "127.0.0.1")
+			response.assertJSONValue(t, "event.requestContext.http.method", "POST")
+			response.assertJSONValue(t, "event.body", "hello")
+		})
+
+		t.Run("answers function URL preflight requests with its CORS configuration", func(t *testing.T) {
+			response := mustRequest(t, http.MethodOptions, "/_url/EchoFunctionURL", map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": "POST",
+			}, nil)
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertHeader(t, "Access-Control-Allow-Methods", "GET, POST")
+			response.assertHeader(t, "Access-Control-Max-Age", "300")
+		})
+
+		t.Run("requires signed requests for AWS_IAM function URLs", func(t *testing.T) {
+			unsigned := mustRequest(t, http.MethodGet, "/signed-url", nil, nil)
+			unsigned.assertStatus(t, http.StatusForbidden)
+			unsigned.assertJSONValue(t, "Message", "Forbidden")
+
+			signed := mustRequest(t, http.MethodGet, "/signed-url", map[string]string{
+				"Authorization": "AWS4-HMAC-SHA256 Credential=AKIALOCAL/20240101/eu-west-1/lambda/aws4_request, SignedHeaders=host, Signature=abc",
+			}, nil)
+			signed.assertStatus(t, http.StatusOK)
+			signed.assertJSONValue(t, "event.rawPath", "/")
+			signed.assertJSONValue(t, "event.requestContext.authorizer.iam.accessKey", "AKIALOCAL")
+		})
+
+		t.Run("routes WebSocket messages with the route selection expression", func(t *testing.T) {
+			conn := mustDialWebSocket(t, "/")
+			defer conn.Close()
+
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"action":"echo","text":"hi"}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			response := httpResponse{body: mustReadWebSocketMessage(t, conn)}
+			response.assertJSONValue(t, "routeKey", "echo")
+			response.assertJSONValue(t, "message.text", "hi")
+
+			if err := conn.WriteMessage(websocket.TextMessage, []byte("plain text")); err != nil {
+				t.Fatal(err)
+			}
+
+			if message := string(mustReadWebSocketMessage(t, conn)); message != "pushed: plain text" {
+				t.Fatalf("expected $default to push the message back through @connections, got %q", message)
+			}
+
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"))
+			waitForServerOutput(t, "Client-side close frame status code '1000' and reason 'bye'")
+		})
+
+		t.Run("rejects WebSocket connections that $connect rejects", func(t *testing.T) {
+			_, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(testServerInstance.baseURL, "http")+"/?token=deny", nil)
+			if err == nil {
+				t.Fatal("expected the connection to be rejected")
+			}
+
+			if response == nil || response.StatusCode != http.StatusForbidden {
+				t.Fatalf("expected status 403, got %v", response)
+			}
+		})
+
+		t.Run("supports ES module handlers with top-level await", func(t *testing.T) {
+			response := mustRequest(t, http.MethodGet, "/esm", nil, nil)
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertJSONValue(t, "loadedWith", "top-level-await")
+			response.assertJSONValue(t, "moduleType", "esm")
+		})
+
+		t.Run("runs Python handlers", func(t *testing.T) {
+			response := mustRequest(t, http.MethodGet, "/python?name=terrable", nil, nil)
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertJSONValue(t, "message", "Hello, terrable")
+			response.assertJSONValue(t, "path", "/python")
+			response.assertJSONValue(t, "globalEnv", "global-env-var")
+			response.assertJSONValue(t, "envFileVal", "value-from-env-file")
+			response.assertJSONValue(t, "remainingTime", "positive")
+		})
+
+		t.Run("Python timeout does not break later requests", func(t *testing.T) {
+			timeoutResponse := mustRequest(t, http.MethodGet, "/python?sleep=2", nil, nil)
+			timeoutResponse.assertStatus(t, http.StatusGatewayTimeout)
+
+			response := mustRequest(t, http.MethodGet, "/python", nil, nil)
+			response.assertStatus(t, http.StatusOK)
+			response.assertJSONValue(t, "message", "Hello, world")
+		})
+
+		t.Run("runs bootstraps through the Lambda Runtime API", func(t *testing.T) {
+			response := mustRequest(t, http.MethodGet, "/provided", nil, nil)
+
+			response.assertStatus(t, http.StatusOK)
+			response.assertJSONValue(t, "path", "/provided")
+			response.assertJSONValue(t, "functionName", "ProvidedHandler")
+			response.assertJSONValue(t, "globalEnv", "global-env-var")
+			response.assertJSONValue(t, "deadline", "set")
+		})
+
+		t.Run("reports bootstrap invocation errors", func(t *testing.T) {
+			response := mustRequest(t, http.MethodGet, "/provided?fail=1", nil, nil)
+
+			response.assertStatus(t, http.StatusInternalServerError)
+			response.assertJSONValue(t, "errorType", "BootstrapError")
+			response.assertJSONValue(t, "errorMessage", "Bootstrap failure")
+		})
+
+		t.Run("isolates globals and environment between handlers", func(t *testing.T) {
+			firstResponse := mustRequest(t, http.MethodGet, "/isolation1", nil, nil)
+			firstResponse.assertStatus(t, http.StatusOK)
+
+			secondResponse := mustRequest(t, http.MethodGet, "/isolation2", nil, nil)
+			secondResponse.assertStatus(t, http.StatusOK)
+			secondResponse.assertJSONNull(t, "previousGlobal")
+			secondResponse.assertJSONNull(t, "previousEnv")
+		})
 	})
 }
 
@@ -510,6 +873,22 @@ func (s *testServer) Stop() error {
 	}
 }
 
+// waitForServerOutput waits for a fragment to be logged by the offline server,
+// for work it does in the background.
+func waitForServerOutput(t *testing.T, fragment string) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+
+	for !strings.Contains(testServerInstance.output.String(), fragment) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the server output to contain %q, got:\n%s", fragment, testServerInstance.output.String())
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 func waitForServer(server *testServer, checks []readinessCheck, timeout time.Duration) error {
 	client := &http.Client{Timeout: 2 * time.Second}
 	deadline := time.Now().Add(timeout)
@@ -595,6 +974,29 @@ func mustRequest(t *testing.T, method, path string, headers map[string]string, b
 	}
 }
 
+func mustDialWebSocket(t *testing.T, path string) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(testServerInstance.baseURL, "http")+path, nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v\nserver output:\n%s", err, testServerInstance.output.String())
+	}
+
+	return conn
+}
+
+func mustReadWebSocketMessage(t *testing.T, conn *websocket.Conn) []byte {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read message: %v\nserver output:\n%s", err, testServerInstance.output.String())
+	}
+
+	return message
+}
+
 func (r httpResponse) assertStatus(t *testing.T, expected int) {
 	t.Helper()
 
@@ -630,6 +1032,19 @@ func (r httpResponse) assertJSONValue(t *testing.T, path, expected string) {
 	}
 }
 
+func (r httpResponse) assertJSONNull(t *testing.T, path string) {
+	t.Helper()
+
+	value, err := r.jsonValue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != nil {
+		t.Fatalf("expected %s to be null, got %v", path, value)
+	}
+}
+
 func (r httpResponse) assertJSONNumberAtLeast(t *testing.T, path string, minimum float64) {
 	t.Helper()
 
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a parsed EventBridge input path, such as $.detail.items[0] or
+// $.detail['instance-id'], that selects part of an event.
+type JSONPath []jsonPathStep
+
+type jsonPathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// ParseJSONPath parses an input path made of $ followed by .name, ['name'] and
+// [index] steps.
+func ParseJSONPath(path string) (JSONPath, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("%q must start with $", path)
+	}
+
+	var steps JSONPath
+	rest := path[1:]
+
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("%q has an empty name after a .", path)
+			}
+
+			steps = append(steps, jsonPathStep{key: key})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("%q has a [ without a closing ]", path)
+			}
+
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+				continue
+			}
+
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("%q has %q in brackets, expected an index or a quoted name", path, inner)
+			}
+
+			steps = append(steps, jsonPathStep{index: index, isIndex: true})
+		default:
+			return nil, fmt.Errorf("%q has an unexpected %q, expected . or [", path, rest[0])
+		}
+	}
+
+	return steps, nil
+}
+
+// Select returns the part of a decoded JSON value that the path points to, and
+// whether it exists.
+func (path JSONPath) Select(value interface{}) (interface{}, bool) {
+	for _, step := range path {
+		if step.isIndex {
+			elements, ok := value.([]interface{})
+			if !ok || step.index >= len(elements) {
+				return nil, false
+			}
+
+			value = elements[step.index]
+			continue
+		}
+
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if value, ok = object[step.key]; !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
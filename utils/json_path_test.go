@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONPathSelect(t *testing.T) {
+	var event interface{}
+	json.Unmarshal([]byte(`{
+		"source": "aws.events",
+		"resources": ["arn:one", "arn:two"],
+		"detail": {"instance-id": "i-123", "items": [{"sku": "A1"}], "empty": null}
+	}`), &event)
+
+	tests := []struct {
+		path   string
+		want   interface{}
+		wantOk bool
+	}{
+		{path: "$", want: event, wantOk: true},
+		{path: "$.source", want: "aws.events", wantOk: true},
+		{path: "$.resources[1]", want: "arn:two", wantOk: true},
+		{path: "$.detail['instance-id']", want: "i-123", wantOk: true},
+		{path: `$.detail["instance-id"]`, want: "i-123", wantOk: true},
+		{path: "$.detail.items[0].sku", want: "A1", wantOk: true},
+		{path: "$.detail.empty", want: nil, wantOk: true},
+		{path: "$.detail.missing", wantOk: false},
+		{path: "$.resources[2]", wantOk: false},
+		{path: "$.source.length", wantOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := ParseJSONPath(tt.path)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			value, ok := path.Select(event)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, value)
+		})
+	}
+}
+
+func TestParseJSONPathRejectsInvalidPaths(t *testing.T) {
+	tests := map[string]string{
+		"detail":          `"detail" must start with $`,
+		"$.":              `"$." has an empty name after a .`,
+		"$.items[0":       `"$.items[0" has a [ without a closing ]`,
+		"$.items[first]":  `"$.items[first]" has "first" in brackets, expected an index or a quoted name`,
+		"$detail":         `"$detail" has an unexpected 'd', expected . or [`,
+		"$.items[-1]":     `"$.items[-1]" has "-1" in brackets`,
+		"$.detail..items": `"$.detail..items" has an empty name after a .`,
+	}
+
+	for path, wantErr := range tests {
+		t.Run(path, func(t *testing.T) {
+			_, err := ParseJSONPath(path)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), wantErr)
+			}
+		})
+	}
+}
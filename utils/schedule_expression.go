@@ -0,0 +1,436 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduleExpression is a parsed EventBridge schedule expression, either
+// rate(...) or a six-field cron(...), evaluated in a time zone.
+type ScheduleExpression struct {
+	rate     time.Duration
+	cron     *cronExpression
+	location *time.Location
+}
+
+type cronExpression struct {
+	minutes     []bool
+	hours       []bool
+	daysOfMonth []bool
+	months      []bool
+	daysOfWeek  []bool
+	years       []bool
+	// anyDayOfMonth and anyDayOfWeek are set by '?', which leaves the day to
+	// the other day field. Exactly one of them is set.
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+
+	// The day-of-month field can instead be L, the last day of the month, LW,
+	// the last weekday of the month, or nW, the weekday nearest to day n.
+	lastDayOfMonth     bool
+	lastWeekdayOfMonth bool
+	nearestWeekday     int
+
+	// The day-of-week field can instead be dL, the last day d of the month, or
+	// d#n, the nth day d of the month.
+	lastDayOfWeek int
+	nthDayOfWeek  int
+	nth           int
+}
+
+const (
+	cronMinYear = 1970
+	cronMaxYear = 2199
+)
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	cronMinuteField     = cronField{name: "minutes", min: 0, max: 59}
+	cronHourField       = cronField{name: "hours", min: 0, max: 23}
+	cronDayOfMonthField = cronField{name: "day-of-month", min: 1, max: 31}
+	cronMonthField      = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	cronDayOfWeekField = cronField{name: "day-of-week", min: 1, max: 7, names: map[string]int{
+		"SUN": 1, "MON": 2, "TUE": 3, "WED": 4, "THU": 5, "FRI": 6, "SAT": 7,
+	}}
+	cronYearField = cronField{name: "year", min: cronMinYear, max: cronMaxYear}
+)
+
+// ParseScheduleExpression parses an EventBridge schedule expression. The
+// timezone is an IANA name such as "Europe/London" and defaults to UTC.
+func ParseScheduleExpression(expression string, timezone string) (*ScheduleExpression, error) {
+	location := time.UTC
+
+	if timezone != "" {
+		loaded, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown schedule timezone %q, expected an IANA time zone such as Europe/London", timezone)
+		}
+
+		location = loaded
+	}
+
+	expression = strings.TrimSpace(expression)
+
+	switch {
+	case strings.HasPrefix(expression, "rate(") && strings.HasSuffix(expression, ")"):
+		rate, err := parseRateExpression(strings.TrimSuffix(strings.TrimPrefix(expression, "rate("), ")"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule expression %q: %w", expression, err)
+		}
+
+		return &ScheduleExpression{rate: rate, location: location}, nil
+	case strings.HasPrefix(expression, "cron(") && strings.HasSuffix(expression, ")"):
+		cron, err := parseCronExpression(strings.TrimSuffix(strings.TrimPrefix(expression, "cron("), ")"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule expression %q: %w", expression, err)
+		}
+
+		return &ScheduleExpression{cron: cron, location: location}, nil
+	default:
+		return nil, fmt.Errorf("invalid schedule expression %q: expected rate(...) or cron(...)", expression)
+	}
+}
+
+// Next returns the first time the schedule fires after the given time, in the
+// schedule's time zone. A rate schedule fires one interval after the given
+// time. The zero time is returned when a cron schedule never fires again.
+func (schedule *ScheduleExpression) Next(after time.Time) time.Time {
+	if schedule.cron == nil {
+		return after.Add(schedule.rate).In(schedule.location)
+	}
+
+	return schedule.cron.next(after.In(schedule.location))
+}
+
+func parseRateExpression(rate string) (time.Duration, error) {
+	parts := strings.Fields(rate)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("a rate needs a value and a unit, for example rate(5 minutes)")
+	}
+
+	value, err := strconv.Atoi(parts[0])
+	if err != nil || value < 1 {
+		return 0, fmt.Errorf("rate value %q must be a positive whole number", parts[0])
+	}
+
+	var unit time.Duration
+	var singular string
+
+	switch parts[1] {
+	case "minute", "minutes":
+		unit, singular = time.Minute, "minute"
+	case "hour", "hours":
+		unit, singular = time.Hour, "hour"
+	case "day", "days":
+		unit, singular = 24*time.Hour, "day"
+	default:
+		return 0, fmt.Errorf("rate unit %q must be minute(s), hour(s) or day(s)", parts[1])
+	}
+
+	if value == 1 && parts[1] != singular {
+		return 0, fmt.Errorf("a rate of 1 must use the singular unit %q", singular)
+	}
+
+	if value > 1 && parts[1] == singular {
+		return 0, fmt.Errorf("a rate of %d must use the plural unit %q", value, singular+"s")
+	}
+
+	return time.Duration(value) * unit, nil
+}
+
+func parseCronExpression(cron string) (*cronExpression, error) {
+	fields := strings.Fields(cron)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("cron needs six fields (minutes hours day-of-month month day-of-week year), got %d", len(fields))
+	}
+
+	expression := &cronExpression{
+		anyDayOfMonth: fields[2] == "?",
+		anyDayOfWeek:  fields[4] == "?",
+	}
+
+	switch {
+	case expression.anyDayOfMonth && expression.anyDayOfWeek:
+		return nil, fmt.Errorf("day-of-month and day-of-week cannot both be ?")
+	case !expression.anyDayOfMonth && !expression.anyDayOfWeek:
+		return nil, fmt.Errorf("one of day-of-month and day-of-week must be ?, because both cannot be specified")
+	}
+
+	var err error
+	if expression.minutes, err = parseCronField(fields[0], cronMinuteField); err != nil {
+		return nil, err
+	}
+
+	if expression.hours, err = parseCronField(fields[1], cronHourField); err != nil {
+		return nil, err
+	}
+
+	if !expression.anyDayOfMonth {
+		if err := expression.parseDayOfMonth(fields[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	if expression.months, err = parseCronField(fields[3], cronMonthField); err != nil {
+		return nil, err
+	}
+
+	if !expression.anyDayOfWeek {
+		if err := expression.parseDayOfWeek(fields[4]); err != nil {
+			return nil, err
+		}
+	}
+
+	if expression.years, err = parseCronField(fields[5], cronYearField); err != nil {
+		return nil, err
+	}
+
+	return expression, nil
+}
+
+// parseDayOfMonth accepts the L, LW and nW tokens on their own, or else an
+// ordinary field.
+func (cron *cronExpression) parseDayOfMonth(value string) error {
+	upper := strings.ToUpper(value)
+
+	switch {
+	case upper == "L":
+		cron.lastDayOfMonth = true
+		return nil
+	case upper == "LW":
+		cron.lastWeekdayOfMonth = true
+		return nil
+	case strings.ContainsAny(upper, "LW") && strings.ContainsAny(upper, ",-/*"):
+		return fmt.Errorf("day-of-month %q can only use L and W on their own, as L, LW or a day followed by W", value)
+	case strings.HasSuffix(upper, "W"):
+		day, err := strconv.Atoi(strings.TrimSuffix(upper, "W"))
+		if err != nil || day < 1 || day > 31 {
+			return fmt.Errorf("day-of-month %q must be a day from 1 to 31 followed by W", value)
+		}
+
+		cron.nearestWeekday = day
+		return nil
+	case strings.ContainsAny(upper, "LW"):
+		return fmt.Errorf("day-of-month %q can only use L and W on their own, as L, LW or a day followed by W", value)
+	}
+
+	var err error
+	cron.daysOfMonth, err = parseCronField(value, cronDayOfMonthField)
+	return err
+}
+
+// parseDayOfWeek accepts the L, dL and d#n tokens on their own, or else an
+// ordinary field. L alone is the last day of the week, SAT.
+func (cron *cronExpression) parseDayOfWeek(value string) error {
+	upper := strings.ToUpper(value)
+
+	switch {
+	case upper == "L":
+		cron.daysOfWeek = make([]bool, cronDayOfWeekField.max+1)
+		cron.daysOfWeek[cronDayOfWeekField.max] = true
+		return nil
+	case strings.Contains(upper, "L") && strings.ContainsAny(upper, ",-/#"):
+		return fmt.Errorf("day-of-week %q can only use L on its own or after a single day", value)
+	case strings.HasSuffix(upper, "L"):
+		day, err := parseCronValue(strings.TrimSuffix(upper, "L"), cronDayOfWeekField)
+		if err != nil {
+			return fmt.Errorf("day-of-week %q must be a day followed by L: %w", value, err)
+		}
+
+		cron.lastDayOfWeek = day
+		return nil
+	case strings.Contains(upper, "#"):
+		dayPart, nthPart, _ := strings.Cut(upper, "#")
+
+		day, err := parseCronValue(dayPart, cronDayOfWeekField)
+		if err != nil {
+			return fmt.Errorf("day-of-week %q must be a day, #, and an occurrence from 1 to 5: %w", value, err)
+		}
+
+		nth, err := strconv.Atoi(nthPart)
+		if err != nil || nth < 1 || nth > 5 {
+			return fmt.Errorf("day-of-week %q must be a day, #, and an occurrence from 1 to 5", value)
+		}
+
+		cron.nthDayOfWeek, cron.nth = day, nth
+		return nil
+	case strings.Contains(upper, "L"):
+		return fmt.Errorf("day-of-week %q can only use L on its own or after a single day", value)
+	}
+
+	var err error
+	cron.daysOfWeek, err = parseCronField(value, cronDayOfWeekField)
+	return err
+}
+
+// parseCronField returns the values a field matches, indexed by value. Each
+// comma-separated item is *, a value, or a range, optionally with a /step.
+func parseCronField(value string, field cronField) ([]bool, error) {
+	if value == "?" {
+		return nil, fmt.Errorf("%s cannot be ?, which is only allowed in day-of-month or day-of-week", field.name)
+	}
+
+	matches := make([]bool, field.max+1)
+
+	for _, item := range strings.Split(value, ",") {
+		if item == "" {
+			return nil, fmt.Errorf("%s %q has an empty list item", field.name, value)
+		}
+
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			parsed, err := strconv.Atoi(stepPart)
+			if err != nil || parsed < 1 || parsed > field.max-field.min+1 {
+				return nil, fmt.Errorf("%s step %q must be a whole number from 1 to %d", field.name, stepPart, field.max-field.min+1)
+			}
+
+			step = parsed
+		}
+
+		start, end := field.min, field.max
+
+		if rangePart != "*" {
+			startPart, endPart, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			if start, err = parseCronValue(startPart, field); err != nil {
+				return nil, err
+			}
+
+			end = start
+			if isRange {
+				if end, err = parseCronValue(endPart, field); err != nil {
+					return nil, err
+				}
+			} else if hasStep {
+				end = field.max
+			}
+
+			if end < start {
+				return nil, fmt.Errorf("%s range %q ends before it starts", field.name, rangePart)
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			matches[i] = true
+		}
+	}
+
+	return matches, nil
+}
+
+func parseCronValue(value string, field cronField) (int, error) {
+	if number, ok := field.names[strings.ToUpper(value)]; ok {
+		return number, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err == nil && number >= field.min && number <= field.max {
+		return number, nil
+	}
+
+	if field.names != nil {
+		return 0, fmt.Errorf("%s %q must be from %d to %d or %s to %s", field.name, value, field.min, field.max, cronValueName(field, field.min), cronValueName(field, field.max))
+	}
+
+	return 0, fmt.Errorf("%s %q must be from %d to %d", field.name, value, field.min, field.max)
+}
+
+func cronValueName(field cronField, value int) string {
+	for name, number := range field.names {
+		if number == value {
+			return name
+		}
+	}
+
+	return strconv.Itoa(value)
+}
+
+// next finds the first matching minute after t, in t's location. Fields are
+// checked from the year down and a mismatch skips to the start of the next
+// year, month, day or hour, so the search stays short.
+func (cron *cronExpression) next(t time.Time) time.Time {
+	location := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, location).Add(time.Minute)
+
+	for t.Year() <= cronMaxYear {
+		switch {
+		case t.Year() < cronMinYear || !cron.years[t.Year()]:
+			t = time.Date(t.Year()+1, time.January, 1, 0, 0, 0, 0, location)
+		case !cron.months[t.Month()]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+		case !cron.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+		case !cron.hours[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, location)
+		case !cron.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (cron *cronExpression) matchesDay(t time.Time) bool {
+	lastDay := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+
+	if cron.anyDayOfMonth {
+		dayOfWeek := int(t.Weekday()) + 1
+
+		switch {
+		case cron.lastDayOfWeek > 0:
+			return dayOfWeek == cron.lastDayOfWeek && t.Day()+7 > lastDay
+		case cron.nthDayOfWeek > 0:
+			return dayOfWeek == cron.nthDayOfWeek && (t.Day()-1)/7+1 == cron.nth
+		default:
+			return cron.daysOfWeek[dayOfWeek]
+		}
+	}
+
+	switch {
+	case cron.lastDayOfMonth:
+		return t.Day() == lastDay
+	case cron.lastWeekdayOfMonth:
+		return t.Day() == nearestWeekday(t, lastDay, lastDay)
+	case cron.nearestWeekday > 0:
+		return cron.nearestWeekday <= lastDay && t.Day() == nearestWeekday(t, cron.nearestWeekday, lastDay)
+	default:
+		return cron.daysOfMonth[t.Day()]
+	}
+}
+
+// nearestWeekday returns the weekday closest to day in t's month without
+// leaving the month.
+func nearestWeekday(t time.Time, day int, lastDay int) int {
+	switch time.Date(t.Year(), t.Month(), day, 0, 0, 0, 0, t.Location()).Weekday() {
+	case time.Saturday:
+		if day == 1 {
+			return day + 2
+		}
+
+		return day - 1
+	case time.Sunday:
+		if day == lastDay {
+			return day - 2
+		}
+
+		return day + 1
+	default:
+		return day
+	}
+}
@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleExpressionNext(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		timezone   string
+		after      string
+		want       []string
+	}{
+		{
+			name:       "rate in minutes",
+			expression: "rate(5 minutes)",
+			after:      "2026-10-19T12:00:30Z",
+			want:       []string{"2026-10-19T12:05:30Z", "2026-10-19T12:10:30Z"},
+		},
+		{
+			name:       "rate of one day",
+			expression: "rate(1 day)",
+			after:      "2026-10-19T12:00:00Z",
+			want:       []string{"2026-10-20T12:00:00Z"},
+		},
+		{
+			name:       "every fifteen minutes",
+			expression: "cron(0/15 * * * ? *)",
+			after:      "2026-10-19T12:07:00Z",
+			want:       []string{"2026-10-19T12:15:00Z", "2026-10-19T12:30:00Z", "2026-10-19T12:45:00Z", "2026-10-19T13:00:00Z"},
+		},
+		{
+			name:       "weekdays at ten",
+			expression: "cron(0 10 ? * MON-FRI *)",
+			after:      "2026-10-23T10:00:00Z",
+			want:       []string{"2026-10-26T10:00:00Z", "2026-10-27T10:00:00Z"},
+		},
+		{
+			name:       "first of the month",
+			expression: "cron(30 6 1 * ? *)",
+			after:      "2026-10-19T00:00:00Z",
+			want:       []string{"2026-11-01T06:30:00Z", "2026-12-01T06:30:00Z"},
+		},
+		{
+			name:       "month names and lists",
+			expression: "cron(0 0 1 JAN,JUL ? *)",
+			after:      "2026-10-19T00:00:00Z",
+			want:       []string{"2027-01-01T00:00:00Z", "2027-07-01T00:00:00Z"},
+		},
+		{
+			name:       "limited years",
+			expression: "cron(0 0 1 1 ? 2027-2028)",
+			after:      "2026-10-19T00:00:00Z",
+			want:       []string{"2027-01-01T00:00:00Z", "2028-01-01T00:00:00Z", "0001-01-01T00:00:00Z"},
+		},
+		{
+			name:       "time zone",
+			expression: "cron(0 9 * * ? *)",
+			timezone:   "America/New_York",
+			after:      "2026-10-19T00:00:00Z",
+			want:       []string{"2026-10-19T13:00:00Z"},
+		},
+		{
+			name:       "across a daylight saving change",
+			expression: "cron(0 9 * * ? *)",
+			timezone:   "Europe/London",
+			after:      "2026-10-24T12:00:00Z",
+			want:       []string{"2026-10-25T09:00:00Z", "2026-10-26T09:00:00Z"},
+		},
+		{
+			name:       "local time skipped by daylight saving",
+			expression: "cron(30 1 * * ? *)",
+			timezone:   "Europe/London",
+			after:      "2026-03-28T12:00:00Z",
+			want:       []string{"2026-03-30T00:30:00Z", "2026-03-31T00:30:00Z"},
+		},
+		{
+			name:       "last day of the month",
+			expression: "cron(0 0 L * ? *)",
+			after:      "2026-10-19T00:00:00Z",
+			want:       []string{"2026-10-31T00:00:00Z", "2026-11-30T00:00:00Z", "2026-12-31T00:00:00Z", "2027-01-31T00:00:00Z", "2027-02-28T00:00:00Z"},
+		},
+		{
+			name:       "last weekday of the month",
+			expression: "cron(0 0 LW * ? *)",
+			after:      "2026-10-19T00:00:00Z",
+			want:       []string{"2026-10-30T00:00:00Z", "2026-11-30T00:00:00Z", "2026-12-31T00:00:00Z", "2027-01-29T00:00:00Z"},
+		},
+		{
+			name:       "weekday nearest to the first",
+			expression: "cron(0 0 1W * ? *)",
+			after:      "2026-10-19T00:00:00Z",
+			want:       []string{"2026-11-02T00:00:00Z", "2026-12-01T00:00:00Z", "2027-01-01T00:00:00Z"},
+		},
+		{
+			name:       "last friday of the month",
+			expression: "cron(0 0 ? * 6L *)",
+			after:      "2026-10-19T00:00:00Z",
+			want:       []string{"2026-10-30T00:00:00Z", "2026-11-27T00:00:00Z", "2026-12-25T00:00:00Z"},
+		},
+		{
+			name:       "first monday of the month",
+			expression: "cron(0 0 ? * MON#1 *)",
+			after:      "2026-10-19T00:00:00Z",
+			want:       []string{"2026-11-02T00:00:00Z", "2026-12-07T00:00:00Z", "2027-01-04T00:00:00Z"},
+		},
+		{
+			name:       "last day of the week",
+			expression: "cron(0 0 ? * L *)",
+			after:      "2026-10-19T00:00:00Z",
+			want:       []string{"2026-10-24T00:00:00Z", "2026-10-31T00:00:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseScheduleExpression(tt.expression, tt.timezone)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			next, _ := time.Parse(time.RFC3339, tt.after)
+			for _, want := range tt.want {
+				next = schedule.Next(next)
+				assert.Equal(t, want, next.UTC().Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func TestParseScheduleExpressionRejectsInvalidExpressions(t *testing.T) {
+	tests := []struct {
+		expression string
+		timezone   string
+		wantErr    string
+	}{
+		{expression: "every 5 minutes", wantErr: "expected rate(...) or cron(...)"},
+		{expression: "rate(5)", wantErr: "a rate needs a value and a unit"},
+		{expression: "rate(0 minutes)", wantErr: `rate value "0" must be a positive whole number`},
+		{expression: "rate(1 minutes)", wantErr: `a rate of 1 must use the singular unit "minute"`},
+		{expression: "rate(5 hour)", wantErr: `a rate of 5 must use the plural unit "hours"`},
+		{expression: "rate(5 weeks)", wantErr: `rate unit "weeks" must be minute(s), hour(s) or day(s)`},
+		{expression: "cron(0 10 * * ?)", wantErr: "cron needs six fields (minutes hours day-of-month month day-of-week year), got 5"},
+		{expression: "cron(0 10 * * * *)", wantErr: "one of day-of-month and day-of-week must be ?"},
+		{expression: "cron(0 10 ? * ? *)", wantErr: "day-of-month and day-of-week cannot both be ?"},
+		{expression: "cron(? 10 * * ? *)", wantErr: "minutes cannot be ?, which is only allowed in day-of-month or day-of-week"},
+		{expression: "cron(60 10 * * ? *)", wantErr: `minutes "60" must be from 0 to 59`},
+		{expression: "cron(0 24 * * ? *)", wantErr: `hours "24" must be from 0 to 23`},
+		{expression: "cron(0 10 32 * ? *)", wantErr: `day-of-month "32" must be from 1 to 31`},
+		{expression: "cron(0 10 ? 13 MON *)", wantErr: `month "13" must be from 1 to 12 or JAN to DEC`},
+		{expression: "cron(0 10 ? * MON-FUN *)", wantErr: `day-of-week "FUN" must be from 1 to 7 or SUN to SAT`},
+		{expression: "cron(0 10 * 12-1 ? *)", wantErr: `month range "12-1" ends before it starts`},
+		{expression: "cron(0/0 10 * * ? *)", wantErr: `minutes step "0" must be a whole number from 1 to 60`},
+		{expression: "cron(0 10 1,, * ? *)", wantErr: `day-of-month "1,," has an empty list item`},
+		{expression: "cron(0 10 * * ? 1969)", wantErr: `year "1969" must be from 1970 to 2199`},
+		{expression: "cron(0 10 1,L * ? *)", wantErr: `day-of-month "1,L" can only use L and W on their own`},
+		{expression: "cron(0 10 32W * ? *)", wantErr: `day-of-month "32W" must be a day from 1 to 31 followed by W`},
+		{expression: "cron(0 10 ? * MON#6 *)", wantErr: `day-of-week "MON#6" must be a day, #, and an occurrence from 1 to 5`},
+		{expression: "cron(0 10 ? * 8L *)", wantErr: `day-of-week "8L" must be a day followed by L`},
+		{expression: "cron(0 10 ? * MON,L *)", wantErr: `day-of-week "MON,L" can only use L on its own or after a single day`},
+		{expression: "cron(0 L * * ? *)", wantErr: `hours "L" must be from 0 to 23`},
+		{expression: "rate(5 minutes)", timezone: "Mars/Olympus_Mons", wantErr: `unknown schedule timezone "Mars/Olympus_Mons"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := ParseScheduleExpression(tt.expression, tt.timezone)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/terrable-dev/terrable/config"
+)
+
+// TerrableConfigFileName is the optional file, next to the Terraform file,
+// that holds defaults for settings which have no place in the Terraform module.
+const TerrableConfigFileName = "terrable.json"
+
+type terrableConfigFile struct {
+	Build *buildConfigFile `json:"build"`
+}
+
+type buildConfigFile struct {
+	Target   string            `json:"target"`
+	Format   string            `json:"format"`
+	External []string          `json:"external"`
+	Define   map[string]string `json:"define"`
+	Loader   map[string]string `json:"loader"`
+	Tsconfig string            `json:"tsconfig"`
+	Minify   *bool             `json:"minify"`
+}
+
+func TerrableConfigFilePath(terraformFilename string) string {
+	return filepath.Join(filepath.Dir(terraformFilename), TerrableConfigFileName)
+}
+
+// ParseTerrableConfigFile reads the build defaults from a terrable.json file.
+// A missing file is not an error and results in no defaults.
+func ParseTerrableConfigFile(filename string) (*config.BuildConfig, error) {
+	content, err := os.ReadFile(filename)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filename, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	var parsedFile terrableConfigFile
+	if err := decoder.Decode(&parsedFile); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", filename, err)
+	}
+
+	if parsedFile.Build == nil {
+		return nil, nil
+	}
+
+	buildConfig := &config.BuildConfig{
+		Target:   parsedFile.Build.Target,
+		Format:   parsedFile.Build.Format,
+		External: parsedFile.Build.External,
+		Define:   parsedFile.Build.Define,
+		Loader:   parsedFile.Build.Loader,
+		Minify:   parsedFile.Build.Minify,
+	}
+
+	if parsedFile.Build.Tsconfig != "" {
+		tsconfigPath, err := getAbsoluteHandlerSourcePath(filename, parsedFile.Build.Tsconfig)
+		if err != nil {
+			return nil, err
+		}
+
+		buildConfig.Tsconfig = tsconfigPath
+	}
+
+	return buildConfig, nil
+}
+
+// applyBuildDefaults layers the module and handler build settings on top of the
+// defaults read from a terrable.json file.
+func applyBuildDefaults(terrableConfig *config.TerrableConfig, defaults *config.BuildConfig) {
+	if defaults == nil {
+		return
+	}
+
+	terrableConfig.Build = config.MergeBuildConfig(defaults, terrableConfig.Build)
+
+	for i := range terrableConfig.Handlers {
+		terrableConfig.Handlers[i].Build = config.MergeBuildConfig(defaults, terrableConfig.Handlers[i].Build)
+	}
+}
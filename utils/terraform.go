@@ -1,16 +1,21 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"math/big"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/terrable-dev/terrable/config"
 	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
 )
 
 func ParseTerraformFile(filename string, targetModuleName string) (*config.TerrableConfig, error) {
@@ -32,7 +37,21 @@ func ParseTerraformFile(filename string, targetModuleName string) (*config.Terra
 		return nil, err
 	}
 
-	return ParseModuleConfiguration(filename, targetModule)
+	terrableConfig, err := ParseModuleConfiguration(filename, targetModule)
+
+	if err != nil {
+		return nil, err
+	}
+
+	buildDefaults, err := ParseTerrableConfigFile(TerrableConfigFilePath(filename))
+
+	if err != nil {
+		return nil, err
+	}
+
+	applyBuildDefaults(terrableConfig, buildDefaults)
+
+	return terrableConfig, nil
 }
 
 func ParseHCL(content string) (*hcl.File, error) {
@@ -94,7 +113,9 @@ func ParseModuleConfiguration(filename string, moduleBlock *hcl.Block) (*config.
 			{Name: "environment_variables", Required: false},
 			{Name: "http_api", Required: false},
 			{Name: "rest_api", Required: false},
+			{Name: "websocket_api", Required: false},
 			{Name: "timeout", Required: false},
+			{Name: "build", Required: false},
 		},
 	})
 
@@ -124,6 +145,20 @@ func ParseModuleConfiguration(filename string, moduleBlock *hcl.Block) (*config.
 		}
 	}
 
+	if build, ok := moduleContent.Attributes["build"]; ok {
+		buildValue, diags := build.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("error parsing build configuration: %s", diags.Error())
+		}
+
+		parsedBuild, err := parseBuildConfig(buildValue, filename)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing build configuration: %w", err)
+		}
+
+		terrableConfig.Build = parsedBuild
+	}
+
 	if httpAPI, ok := moduleContent.Attributes["http_api"]; ok {
 		httpAPIValue, diags := httpAPI.Expr.Value(nil)
 		if diags.HasErrors() {
@@ -152,6 +187,20 @@ func ParseModuleConfiguration(filename string, moduleBlock *hcl.Block) (*config.
 		terrableConfig.RestApi = parsedRESTAPI
 	}
 
+	if webSocketAPI, ok := moduleContent.Attributes["websocket_api"]; ok {
+		webSocketAPIValue, diags := webSocketAPI.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("error parsing websocket_api configuration: %s", diags.Error())
+		}
+
+		parsedWebSocketAPI, err := parseWebSocketAPIConfig(webSocketAPIValue)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing websocket_api configuration: %w", err)
+		}
+
+		terrableConfig.WebSocketApi = parsedWebSocketAPI
+	}
+
 	if handlers, ok := moduleContent.Attributes["handlers"]; ok {
 		handlersValue, _ := handlers.Expr.Value(nil)
 		handlerMap := handlersValue.AsValueMap()
@@ -169,25 +218,84 @@ func ParseModuleConfiguration(filename string, moduleBlock *hcl.Block) (*config.
 				}
 			}
 
-			sqs := make(map[string]interface{})
+			var functionURL *config.FunctionURLConfig
+			if functionURLConfig, ok := handlerConfig["function_url"]; ok && !functionURLConfig.IsNull() {
+				parsedFunctionURL, err := parseFunctionURLConfig(functionURLConfig, handlerName)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing function_url configuration for handler %s: %w", handlerName, err)
+				}
+
+				functionURL = parsedFunctionURL
+			}
+
+			var webSocket *config.WebSocketConfig
+			if webSocketConfig, ok := handlerConfig["websocket"]; ok && !webSocketConfig.IsNull() {
+				parsedWebSocket, err := parseWebSocketConfig(webSocketConfig)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing websocket configuration for handler %s: %w", handlerName, err)
+				}
+
+				webSocket = parsedWebSocket
+			}
+
+			var sqs *config.SqsConfig
 			if sqsConfig, ok := handlerConfig["sqs"]; ok && !sqsConfig.IsNull() {
-				sqsConfigMap := sqsConfig.AsValueMap()
-				for key, value := range sqsConfigMap {
-					sqs[key] = value
+				parsedSqs, err := parseSqsConfig(sqsConfig)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing sqs configuration for handler %s: %w", handlerName, err)
+				}
+
+				sqs = parsedSqs
+			}
+
+			var sns *config.SnsConfig
+			if snsConfig, ok := handlerConfig["sns"]; ok && !snsConfig.IsNull() {
+				parsedSns, err := parseSnsConfig(snsConfig, false)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing sns configuration for handler %s: %w", handlerName, err)
+				}
+
+				sns = parsedSns
+			}
+
+			var s3 *config.S3Config
+			if s3Config, ok := handlerConfig["s3"]; ok && !s3Config.IsNull() {
+				parsedS3, err := parseS3Config(s3Config, filename)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing s3 configuration for handler %s: %w", handlerName, err)
 				}
+
+				s3 = parsedS3
 			}
 
 			var schedule *config.ScheduleConfig
 			if scheduleConfig, ok := handlerConfig["schedule"]; ok && !scheduleConfig.IsNull() {
-				scheduleConfigMap := scheduleConfig.AsValueMap()
-				expression, ok := scheduleConfigMap["expression"]
-				if !ok || expression.IsNull() || expression.Type() != cty.String {
-					return nil, fmt.Errorf("handler schedule expression must be a string for handler %s", handlerName)
+				parsedSchedule, err := parseScheduleConfig(scheduleConfig)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing schedule for handler %s: %w", handlerName, err)
 				}
 
-				schedule = &config.ScheduleConfig{
-					Expression: expression.AsString(),
+				schedule = parsedSchedule
+			}
+
+			var eventPattern string
+			if eventPatternConfig, ok := handlerConfig["event_pattern"]; ok && !eventPatternConfig.IsNull() {
+				parsedEventPattern, err := parseJSONValue(eventPatternConfig, "event_pattern")
+				if err != nil {
+					return nil, fmt.Errorf("error parsing event_pattern for handler %s: %w", handlerName, err)
 				}
+
+				eventPattern = parsedEventPattern
+			}
+
+			var async *config.AsyncConfig
+			if asyncConfig, ok := handlerConfig["async"]; ok && !asyncConfig.IsNull() {
+				parsedAsync, err := parseAsyncConfig(asyncConfig)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing async configuration for handler %s: %w", handlerName, err)
+				}
+
+				async = parsedAsync
 			}
 
 			// Use global timeout as default for handler
@@ -202,6 +310,26 @@ func ParseModuleConfiguration(filename string, moduleBlock *hcl.Block) (*config.
 				}
 			}
 
+			var runtime string
+			if handlerRuntime, ok := handlerConfig["runtime"]; ok && !handlerRuntime.IsNull() {
+				if handlerRuntime.Type() != cty.String {
+					return nil, fmt.Errorf("handler runtime must be a string for handler %s", handlerName)
+				}
+
+				runtime = handlerRuntime.AsString()
+			}
+
+			// Handler build settings are layered on top of the module's
+			build := terrableConfig.Build
+			if handlerBuild, ok := handlerConfig["build"]; ok && !handlerBuild.IsNull() {
+				parsedBuild, err := parseBuildConfig(handlerBuild, filename)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing build configuration for handler %s: %w", handlerName, err)
+				}
+
+				build = config.MergeBuildConfig(terrableConfig.Build, parsedBuild)
+			}
+
 			absoluteSourceFilePath, err := getAbsoluteHandlerSourcePath(filename, source)
 			if err != nil {
 				return nil, fmt.Errorf("error getting absolute source path for handler %s: %w", handlerName, err)
@@ -211,10 +339,18 @@ func ParseModuleConfiguration(filename string, moduleBlock *hcl.Block) (*config.
 				Name:             handlerName,
 				Source:           absoluteSourceFilePath,
 				ConfiguredSource: source,
+				Runtime:          runtime,
 				Http:             http,
+				FunctionURL:      functionURL,
+				WebSocket:        webSocket,
 				Sqs:              sqs,
+				Sns:              sns,
+				S3:               s3,
 				Schedule:         schedule,
+				EventPattern:     eventPattern,
+				Async:            async,
 				Timeout:          timeout,
+				Build:            build,
 			})
 		}
 	}
@@ -311,6 +447,609 @@ func parseCorsConfig(corsConfig cty.Value) (*config.CorsConfig, error) {
 	return parsedConfig, nil
 }
 
+func parseBuildConfig(buildConfig cty.Value, filename string) (*config.BuildConfig, error) {
+	if buildConfig.IsNull() {
+		return nil, nil
+	}
+
+	if !buildConfig.Type().IsObjectType() && !buildConfig.Type().IsMapType() {
+		return nil, fmt.Errorf("build must be an object")
+	}
+
+	parsedConfig := &config.BuildConfig{}
+
+	for key, value := range buildConfig.AsValueMap() {
+		if value.IsNull() {
+			continue
+		}
+
+		switch key {
+		case "target":
+			if value.Type() != cty.String {
+				return nil, fmt.Errorf("target must be a string")
+			}
+
+			parsedConfig.Target = value.AsString()
+		case "format":
+			if value.Type() != cty.String {
+				return nil, fmt.Errorf("format must be a string")
+			}
+
+			parsedConfig.Format = value.AsString()
+		case "external":
+			external, err := parseStringList(value, "external")
+			if err != nil {
+				return nil, err
+			}
+
+			parsedConfig.External = external
+		case "define":
+			define, err := parseStringMap(value, "define")
+			if err != nil {
+				return nil, err
+			}
+
+			parsedConfig.Define = define
+		case "loader":
+			loader, err := parseStringMap(value, "loader")
+			if err != nil {
+				return nil, err
+			}
+
+			parsedConfig.Loader = loader
+		case "tsconfig":
+			if value.Type() != cty.String {
+				return nil, fmt.Errorf("tsconfig must be a string")
+			}
+
+			tsconfigPath, err := getAbsoluteHandlerSourcePath(filename, value.AsString())
+			if err != nil {
+				return nil, err
+			}
+
+			parsedConfig.Tsconfig = tsconfigPath
+		case "minify":
+			if value.Type() != cty.Bool {
+				return nil, fmt.Errorf("minify must be a boolean")
+			}
+
+			minify := value.True()
+			parsedConfig.Minify = &minify
+		default:
+			return nil, fmt.Errorf("unknown build setting %q", key)
+		}
+	}
+
+	return parsedConfig, nil
+}
+
+// parseFunctionURLConfig reads the function URL of a handler. It is served at
+// /_url/<handler name> unless a path or a port is given.
+func parseFunctionURLConfig(functionURLConfig cty.Value, handlerName string) (*config.FunctionURLConfig, error) {
+	if !functionURLConfig.Type().IsObjectType() && !functionURLConfig.Type().IsMapType() {
+		return nil, fmt.Errorf("function_url must be an object")
+	}
+
+	parsedConfig := &config.FunctionURLConfig{AuthType: "NONE"}
+
+	for key, value := range functionURLConfig.AsValueMap() {
+		if value.IsNull() {
+			continue
+		}
+
+		if (key == "path" || key == "auth_type") && value.Type() != cty.String {
+			return nil, fmt.Errorf("%s must be a string", key)
+		}
+
+		var err error
+
+		switch key {
+		case "path":
+			parsedConfig.Path = strings.TrimSuffix(value.AsString(), "/")
+			if !strings.HasPrefix(value.AsString(), "/") || parsedConfig.Path == "" {
+				err = fmt.Errorf("path must start with / and cannot be the root path")
+			}
+		case "port":
+			parsedConfig.Port, err = parseWholeNumber(value, key)
+			if err == nil && (parsedConfig.Port < 1 || parsedConfig.Port > 65535) {
+				err = fmt.Errorf("port must be between 1 and 65535")
+			}
+		case "auth_type":
+			parsedConfig.AuthType = value.AsString()
+			if parsedConfig.AuthType != "NONE" && parsedConfig.AuthType != "AWS_IAM" {
+				err = fmt.Errorf("auth_type must be NONE or AWS_IAM, got %q", parsedConfig.AuthType)
+			}
+		case "cors":
+			if !value.Type().IsObjectType() && !value.Type().IsMapType() {
+				return nil, fmt.Errorf("cors must be an object")
+			}
+
+			parsedConfig.Cors, err = parseCorsConfig(value)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if parsedConfig.Path != "" && parsedConfig.Port != 0 {
+		return nil, fmt.Errorf("only one of path and port can be set")
+	}
+
+	if parsedConfig.Path == "" && parsedConfig.Port == 0 {
+		parsedConfig.Path = "/_url/" + handlerName
+	}
+
+	return parsedConfig, nil
+}
+
+// parseWebSocketAPIConfig reads the module's WebSocket API. Settings that are
+// not given keep the values of config.DefaultWebSocketAPIConfig.
+func parseWebSocketAPIConfig(webSocketAPIConfig cty.Value) (*config.WebSocketAPIConfig, error) {
+	if webSocketAPIConfig.IsNull() {
+		return nil, nil
+	}
+
+	if !webSocketAPIConfig.Type().IsObjectType() && !webSocketAPIConfig.Type().IsMapType() {
+		return nil, fmt.Errorf("websocket_api must be an object")
+	}
+
+	parsedConfig := config.DefaultWebSocketAPIConfig()
+
+	for key, value := range webSocketAPIConfig.AsValueMap() {
+		if value.IsNull() {
+			continue
+		}
+
+		if value.Type() != cty.String {
+			return nil, fmt.Errorf("%s must be a string", key)
+		}
+
+		switch key {
+		case "route_selection_expression":
+			parsedConfig.RouteSelectionExpression = value.AsString()
+
+			bodyPath, ok := strings.CutPrefix(parsedConfig.RouteSelectionExpression, "$request.body")
+			if _, err := ParseJSONPath("$" + bodyPath); !ok || bodyPath == "" || err != nil {
+				return nil, fmt.Errorf("route_selection_expression must select a field of the message body, such as $request.body.action, got %q", parsedConfig.RouteSelectionExpression)
+			}
+		case "path":
+			if !strings.HasPrefix(value.AsString(), "/") {
+				return nil, fmt.Errorf("path must start with /")
+			}
+
+			parsedConfig.Path = value.AsString()
+			if parsedConfig.Path != "/" {
+				parsedConfig.Path = strings.TrimSuffix(parsedConfig.Path, "/")
+			}
+		}
+	}
+
+	return &parsedConfig, nil
+}
+
+// parseWebSocketConfig reads the WebSocket API routes a handler is attached to.
+func parseWebSocketConfig(webSocketConfig cty.Value) (*config.WebSocketConfig, error) {
+	if !webSocketConfig.Type().IsObjectType() && !webSocketConfig.Type().IsMapType() {
+		return nil, fmt.Errorf("websocket must be an object")
+	}
+
+	routes, ok := webSocketConfig.AsValueMap()["routes"]
+	if !ok || routes.IsNull() {
+		return nil, fmt.Errorf("routes is required")
+	}
+
+	parsedRoutes, err := parseStringList(routes, "routes")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parsedRoutes) == 0 {
+		return nil, fmt.Errorf("routes must list at least one route")
+	}
+
+	for _, route := range parsedRoutes {
+		if route == "" {
+			return nil, fmt.Errorf("routes cannot be empty")
+		}
+	}
+
+	return &config.WebSocketConfig{Routes: parsedRoutes}, nil
+}
+
+func parseSqsConfig(sqsConfig cty.Value) (*config.SqsConfig, error) {
+	if !sqsConfig.Type().IsObjectType() && !sqsConfig.Type().IsMapType() {
+		return nil, fmt.Errorf("sqs must be an object")
+	}
+
+	parsedConfig := &config.SqsConfig{}
+
+	// Settings that only matter when deployed are ignored
+	for key, value := range sqsConfig.AsValueMap() {
+		if value.IsNull() {
+			continue
+		}
+
+		var err error
+
+		switch key {
+		case "queue":
+			if value.Type() != cty.String {
+				return nil, fmt.Errorf("queue must be a string")
+			}
+
+			parsedConfig.Queue = value.AsString()
+		case "batch_size":
+			parsedConfig.BatchSize, err = parseWholeNumber(value, key)
+		case "maximum_batching_window_in_seconds":
+			parsedConfig.MaximumBatchingWindowSeconds, err = parseWholeNumber(value, key)
+		case "visibility_timeout_seconds":
+			parsedConfig.VisibilityTimeoutSeconds, err = parseWholeNumber(value, key)
+		case "max_receive_count":
+			parsedConfig.MaxReceiveCount, err = parseWholeNumber(value, key)
+		case "content_based_deduplication":
+			if value.Type() != cty.Bool {
+				return nil, fmt.Errorf("content_based_deduplication must be a boolean")
+			}
+
+			parsedConfig.ContentBasedDeduplication = value.True()
+		case "sns":
+			parsedConfig.Sns, err = parseSnsConfig(value, true)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if parsedConfig.Queue == "" {
+		return nil, fmt.Errorf("queue is required")
+	}
+
+	if parsedConfig.ContentBasedDeduplication && !strings.HasSuffix(parsedConfig.QueueName(), ".fifo") {
+		return nil, fmt.Errorf("content_based_deduplication only applies to .fifo queues")
+	}
+
+	return parsedConfig, nil
+}
+
+// parseSnsConfig reads a topic subscription. Only queues can have raw message
+// delivery.
+func parseSnsConfig(snsConfig cty.Value, queueSubscription bool) (*config.SnsConfig, error) {
+	if !snsConfig.Type().IsObjectType() && !snsConfig.Type().IsMapType() {
+		return nil, fmt.Errorf("sns must be an object")
+	}
+
+	parsedConfig := &config.SnsConfig{}
+
+	for key, value := range snsConfig.AsValueMap() {
+		if value.IsNull() {
+			continue
+		}
+
+		switch key {
+		case "topic", "filter_policy_scope":
+			if value.Type() != cty.String {
+				return nil, fmt.Errorf("%s must be a string", key)
+			}
+
+			if key == "topic" {
+				parsedConfig.Topic = value.AsString()
+			} else {
+				parsedConfig.FilterPolicyScope = value.AsString()
+			}
+		case "filter_policy":
+			filterPolicy, err := parseJSONValue(value, key)
+			if err != nil {
+				return nil, err
+			}
+
+			parsedConfig.FilterPolicy = filterPolicy
+		case "raw_message_delivery":
+			if value.Type() != cty.Bool {
+				return nil, fmt.Errorf("raw_message_delivery must be a boolean")
+			}
+
+			if !queueSubscription {
+				return nil, fmt.Errorf("raw_message_delivery only applies to sqs queue subscriptions")
+			}
+
+			parsedConfig.RawMessageDelivery = value.True()
+		}
+	}
+
+	if parsedConfig.Topic == "" {
+		return nil, fmt.Errorf("topic is required")
+	}
+
+	if scope := parsedConfig.FilterPolicyScope; scope != "" && scope != "MessageAttributes" && scope != "MessageBody" {
+		return nil, fmt.Errorf("filter_policy_scope must be MessageAttributes or MessageBody, got %q", scope)
+	}
+
+	return parsedConfig, nil
+}
+
+// s3EventTypes lists the notification event types a bucket can send to a
+// handler.
+var s3EventTypes = []string{
+	"s3:ObjectCreated:*",
+	"s3:ObjectCreated:Put",
+	"s3:ObjectCreated:Post",
+	"s3:ObjectCreated:Copy",
+	"s3:ObjectCreated:CompleteMultipartUpload",
+	"s3:ObjectRemoved:*",
+	"s3:ObjectRemoved:Delete",
+	"s3:ObjectRemoved:DeleteMarkerCreated",
+}
+
+// parseS3Config reads a bucket notification. The directory that stands in for
+// the bucket is relative to the Terraform file, and every created and removed
+// object is notified when no events are listed.
+func parseS3Config(s3Config cty.Value, filename string) (*config.S3Config, error) {
+	if !s3Config.Type().IsObjectType() && !s3Config.Type().IsMapType() {
+		return nil, fmt.Errorf("s3 must be an object")
+	}
+
+	parsedConfig := &config.S3Config{}
+
+	for key, value := range s3Config.AsValueMap() {
+		if value.IsNull() {
+			continue
+		}
+
+		if key == "events" {
+			events, err := parseStringList(value, key)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, event := range events {
+				if !slices.Contains(s3EventTypes, event) {
+					return nil, fmt.Errorf("events contains unknown event type %q: expected one of %s", event, strings.Join(s3EventTypes, ", "))
+				}
+			}
+
+			parsedConfig.Events = events
+			continue
+		}
+
+		if value.Type() != cty.String {
+			return nil, fmt.Errorf("%s must be a string", key)
+		}
+
+		switch key {
+		case "bucket":
+			parsedConfig.Bucket = value.AsString()
+		case "directory":
+			directory, err := getAbsoluteHandlerSourcePath(filename, value.AsString())
+			if err != nil {
+				return nil, err
+			}
+
+			parsedConfig.Directory = directory
+		case "filter_prefix":
+			parsedConfig.FilterPrefix = value.AsString()
+		case "filter_suffix":
+			parsedConfig.FilterSuffix = value.AsString()
+		}
+	}
+
+	if parsedConfig.Bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+
+	if parsedConfig.Directory == "" {
+		return nil, fmt.Errorf("directory is required")
+	}
+
+	if len(parsedConfig.Events) == 0 {
+		parsedConfig.Events = []string{"s3:ObjectCreated:*", "s3:ObjectRemoved:*"}
+	}
+
+	return parsedConfig, nil
+}
+
+// parseAsyncConfig reads the asynchronous invocation settings of a handler,
+// keeping the defaults for those that are not set and enforcing the limits
+// Lambda has for them.
+func parseAsyncConfig(asyncConfig cty.Value) (*config.AsyncConfig, error) {
+	if !asyncConfig.Type().IsObjectType() && !asyncConfig.Type().IsMapType() {
+		return nil, fmt.Errorf("async must be an object")
+	}
+
+	parsedConfig := config.DefaultAsyncConfig()
+
+	for key, value := range asyncConfig.AsValueMap() {
+		if value.IsNull() {
+			continue
+		}
+
+		var err error
+
+		switch key {
+		case "maximum_retry_attempts":
+			parsedConfig.MaximumRetryAttempts, err = parseWholeNumber(value, key)
+			if err == nil && parsedConfig.MaximumRetryAttempts > 2 {
+				err = fmt.Errorf("maximum_retry_attempts must be between 0 and 2")
+			}
+		case "maximum_event_age_in_seconds":
+			parsedConfig.MaximumEventAgeSeconds, err = parseWholeNumber(value, key)
+			if err == nil && (parsedConfig.MaximumEventAgeSeconds < 60 || parsedConfig.MaximumEventAgeSeconds > 21600) {
+				err = fmt.Errorf("maximum_event_age_in_seconds must be between 60 and 21600")
+			}
+		case "retry_backoff_seconds":
+			parsedConfig.RetryBackoffSeconds, err = parseWholeNumber(value, key)
+		case "on_success", "on_failure":
+			if value.Type() != cty.String {
+				return nil, fmt.Errorf("%s must be a string", key)
+			}
+
+			if key == "on_success" {
+				parsedConfig.OnSuccess = value.AsString()
+			} else {
+				parsedConfig.OnFailure = value.AsString()
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &parsedConfig, nil
+}
+
+func parseScheduleConfig(scheduleConfig cty.Value) (*config.ScheduleConfig, error) {
+	if !scheduleConfig.Type().IsObjectType() && !scheduleConfig.Type().IsMapType() {
+		return nil, fmt.Errorf("schedule must be an object")
+	}
+
+	parsedConfig := &config.ScheduleConfig{}
+	var inputs []string
+
+	for key, value := range scheduleConfig.AsValueMap() {
+		if value.IsNull() {
+			continue
+		}
+
+		if (key == "expression" || key == "timezone" || key == "input_path") && value.Type() != cty.String {
+			return nil, fmt.Errorf("%s must be a string", key)
+		}
+
+		switch key {
+		case "expression":
+			parsedConfig.Expression = value.AsString()
+		case "timezone":
+			parsedConfig.Timezone = value.AsString()
+		case "input":
+			input, err := parseJSONValue(value, key)
+			if err != nil {
+				return nil, err
+			}
+
+			parsedConfig.Input = input
+			inputs = append(inputs, key)
+		case "input_path":
+			if _, err := ParseJSONPath(value.AsString()); err != nil {
+				return nil, fmt.Errorf("input_path %w", err)
+			}
+
+			parsedConfig.InputPath = value.AsString()
+			inputs = append(inputs, key)
+		case "input_transformer":
+			transformer, err := parseInputTransformerConfig(value)
+			if err != nil {
+				return nil, err
+			}
+
+			parsedConfig.InputTransformer = transformer
+			inputs = append(inputs, key)
+		}
+	}
+
+	if parsedConfig.Expression == "" {
+		return nil, fmt.Errorf("expression is required")
+	}
+
+	if len(inputs) > 1 {
+		sort.Strings(inputs)
+		return nil, fmt.Errorf("only one of input, input_path and input_transformer can be set, got %s", strings.Join(inputs, " and "))
+	}
+
+	if _, err := ParseScheduleExpression(parsedConfig.Expression, parsedConfig.Timezone); err != nil {
+		return nil, err
+	}
+
+	return parsedConfig, nil
+}
+
+// parseJSONValue accepts JSON text, such as a heredoc, or a Terraform value,
+// which is converted to JSON.
+func parseJSONValue(value cty.Value, fieldName string) (string, error) {
+	if value.Type() == cty.String {
+		if !json.Valid([]byte(value.AsString())) {
+			return "", fmt.Errorf("%s must be valid JSON", fieldName)
+		}
+
+		return value.AsString(), nil
+	}
+
+	converted, err := ctyjson.Marshal(value, value.Type())
+	if err != nil {
+		return "", fmt.Errorf("%s could not be converted to JSON: %w", fieldName, err)
+	}
+
+	return string(converted), nil
+}
+
+func parseInputTransformerConfig(transformerConfig cty.Value) (*config.InputTransformerConfig, error) {
+	if !transformerConfig.Type().IsObjectType() && !transformerConfig.Type().IsMapType() {
+		return nil, fmt.Errorf("input_transformer must be an object")
+	}
+
+	transformerConfigMap := transformerConfig.AsValueMap()
+	transformer := &config.InputTransformerConfig{}
+
+	template, ok := transformerConfigMap["input_template"]
+	if !ok || template.IsNull() || template.Type() != cty.String {
+		return nil, fmt.Errorf("input_transformer input_template must be a string")
+	}
+
+	transformer.InputTemplate = template.AsString()
+
+	if inputPaths, ok := transformerConfigMap["input_paths"]; ok && !inputPaths.IsNull() {
+		paths, err := parseStringMap(inputPaths, "input_paths")
+		if err != nil {
+			return nil, err
+		}
+
+		for name, path := range paths {
+			if strings.HasPrefix(name, "aws.") {
+				return nil, fmt.Errorf("input path name %q is reserved, names cannot start with aws.", name)
+			}
+
+			if _, err := ParseJSONPath(path); err != nil {
+				return nil, fmt.Errorf("input path %q %w", name, err)
+			}
+		}
+
+		transformer.InputPaths = paths
+	}
+
+	return transformer, nil
+}
+
+func parseWholeNumber(value cty.Value, fieldName string) (int, error) {
+	if value.Type() != cty.Number {
+		return 0, fmt.Errorf("%s must be a number", fieldName)
+	}
+
+	number, accuracy := value.AsBigFloat().Int64()
+	if accuracy != big.Exact || number < 0 {
+		return 0, fmt.Errorf("%s must be a whole number of zero or more", fieldName)
+	}
+
+	return int(number), nil
+}
+
+func parseStringMap(value cty.Value, fieldName string) (map[string]string, error) {
+	if !value.Type().IsObjectType() && !value.Type().IsMapType() {
+		return nil, fmt.Errorf("%s must be a map of strings", fieldName)
+	}
+
+	values := make(map[string]string)
+
+	for key, element := range value.AsValueMap() {
+		if element.IsNull() || element.Type() != cty.String {
+			return nil, fmt.Errorf("%s must be a map of strings", fieldName)
+		}
+
+		values[key] = element.AsString()
+	}
+
+	return values, nil
+}
+
 func parseStringList(value cty.Value, fieldName string) ([]string, error) {
 	if value.IsNull() {
 		return nil, nil
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestParseAsyncConfiguration(t *testing.T) {
+	terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+	content := `
+		module "orders_api" {
+		  handlers = {
+		    Fulfilment = {
+		      source = "./src/Fulfilment.ts"
+		      async = {
+		        maximum_retry_attempts       = 1
+		        maximum_event_age_in_seconds = 3600
+		        retry_backoff_seconds        = 5
+		        on_success                   = "Audit"
+		        on_failure                   = "arn:aws:sqs:eu-west-1:000000000000:fulfilment-failures"
+		      }
+		    }
+
+		    NoRetries = {
+		      source = "./src/NoRetries.ts"
+		      async = {
+		        maximum_retry_attempts = 0
+		      }
+		    }
+
+		    Audit = {
+		      source = "./src/Audit.ts"
+		    }
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	terrableConfig, err := ParseTerraformFile(terraformFile, "orders_api")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	handlers := map[string]config.HandlerMapping{}
+	for _, handler := range terrableConfig.Handlers {
+		handlers[handler.Name] = handler
+	}
+
+	assert.Equal(t, &config.AsyncConfig{
+		MaximumRetryAttempts:   1,
+		MaximumEventAgeSeconds: 3600,
+		RetryBackoffSeconds:    5,
+		OnSuccess:              "Audit",
+		OnFailure:              "arn:aws:sqs:eu-west-1:000000000000:fulfilment-failures",
+	}, handlers["Fulfilment"].Async)
+
+	assert.Equal(t, &config.AsyncConfig{
+		MaximumRetryAttempts:   0,
+		MaximumEventAgeSeconds: 21600,
+		RetryBackoffSeconds:    1,
+	}, handlers["NoRetries"].Async)
+
+	assert.Nil(t, handlers["Audit"].Async)
+}
+
+func TestParseAsyncConfigurationRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler string
+		message string
+	}{
+		{
+			name:    "too many retries",
+			handler: `async = { maximum_retry_attempts = 3 }`,
+			message: "error parsing async configuration for handler Fulfilment: maximum_retry_attempts must be between 0 and 2",
+		},
+		{
+			name:    "event age below the minimum",
+			handler: `async = { maximum_event_age_in_seconds = 30 }`,
+			message: "maximum_event_age_in_seconds must be between 60 and 21600",
+		},
+		{
+			name:    "negative backoff",
+			handler: `async = { retry_backoff_seconds = -1 }`,
+			message: "retry_backoff_seconds must be a whole number of zero or more",
+		},
+		{
+			name:    "destination that is not a string",
+			handler: `async = { on_failure = ["Audit"] }`,
+			message: "on_failure must be a string",
+		},
+		{
+			name:    "not an object",
+			handler: `async = "Audit"`,
+			message: "async must be an object",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+			content := `
+				module "orders_api" {
+				  handlers = {
+				    Fulfilment = {
+				      source = "./src/Fulfilment.ts"
+				      ` + test.handler + `
+				    }
+				  }
+				}
+			`
+
+			if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+				t.Fatalf("failed to write Terraform file: %v", err)
+			}
+
+			_, err := ParseTerraformFile(terraformFile, "orders_api")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestParseBuildConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	terraformFile := filepath.Join(dir, "main.tf")
+
+	content := `
+		module "build_api" {
+		  build = {
+		    target   = "node20"
+		    external = ["@aws-sdk/*"]
+		    define = {
+		      STAGE = "\"module\""
+		      REGION = "\"eu-west-1\""
+		    }
+		    tsconfig = "./tsconfig.build.json"
+		  }
+
+		  handlers = {
+		    DefaultHandler = {
+		      source = "./src/Default.ts"
+		    }
+
+		    OverrideHandler = {
+		      source = "./src/Override.ts"
+		      build = {
+		        target   = "node18"
+		        external = ["sharp"]
+		        define = {
+		          STAGE = "\"handler\""
+		        }
+		        loader = {
+		          ".txt" = "text"
+		        }
+		        minify = true
+		      }
+		    }
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	terrableConfig, err := ParseTerraformFile(terraformFile, "build_api")
+	if err != nil {
+		t.Fatalf("failed to parse Terraform file: %v", err)
+	}
+
+	handlers := make(map[string]config.HandlerMapping)
+	for _, handler := range terrableConfig.Handlers {
+		handlers[handler.Name] = handler
+	}
+
+	defaultBuild := handlers["DefaultHandler"].Build
+	if assert.NotNil(t, defaultBuild) {
+		assert.Equal(t, "node20", defaultBuild.Target)
+		assert.Equal(t, []string{"@aws-sdk/*"}, defaultBuild.External)
+		assert.Equal(t, map[string]string{"STAGE": `"module"`, "REGION": `"eu-west-1"`}, defaultBuild.Define)
+		assert.Equal(t, filepath.Join(dir, "tsconfig.build.json"), defaultBuild.Tsconfig)
+		assert.Nil(t, defaultBuild.Minify)
+	}
+
+	overrideBuild := handlers["OverrideHandler"].Build
+	if assert.NotNil(t, overrideBuild) {
+		assert.Equal(t, "node18", overrideBuild.Target)
+		assert.Equal(t, []string{"sharp"}, overrideBuild.External)
+		assert.Equal(t, map[string]string{"STAGE": `"handler"`, "REGION": `"eu-west-1"`}, overrideBuild.Define)
+		assert.Equal(t, map[string]string{".txt": "text"}, overrideBuild.Loader)
+		assert.Equal(t, filepath.Join(dir, "tsconfig.build.json"), overrideBuild.Tsconfig)
+		if assert.NotNil(t, overrideBuild.Minify) {
+			assert.True(t, *overrideBuild.Minify)
+		}
+	}
+}
+
+func TestParseBuildConfigurationRejectsUnknownSettings(t *testing.T) {
+	dir := t.TempDir()
+	terraformFile := filepath.Join(dir, "main.tf")
+
+	content := `
+		module "build_api" {
+		  build = {
+		    targett = "node20"
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	_, err := ParseTerraformFile(terraformFile, "build_api")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `unknown build setting "targett"`)
+	}
+}
+
+func TestTerrableConfigFileProvidesBuildDefaults(t *testing.T) {
+	dir := t.TempDir()
+	terraformFile := filepath.Join(dir, "main.tf")
+
+	content := `
+		module "build_api" {
+		  build = {
+		    define = {
+		      STAGE = "\"module\""
+		    }
+		  }
+
+		  handlers = {
+		    Handler = {
+		      source = "./src/Handler.ts"
+		    }
+		  }
+		}
+	`
+
+	configFile := `{
+		"build": {
+			"target": "node20",
+			"external": ["@aws-sdk/*"],
+			"define": { "STAGE": "\"file\"", "VERSION": "\"1\"" },
+			"tsconfig": "./tsconfig.json"
+		}
+	}`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, TerrableConfigFileName), []byte(configFile), 0o644); err != nil {
+		t.Fatalf("failed to write terrable config file: %v", err)
+	}
+
+	terrableConfig, err := ParseTerraformFile(terraformFile, "build_api")
+	if err != nil {
+		t.Fatalf("failed to parse Terraform file: %v", err)
+	}
+
+	build := terrableConfig.Handlers[0].Build
+	if assert.NotNil(t, build) {
+		assert.Equal(t, "node20", build.Target)
+		assert.Equal(t, []string{"@aws-sdk/*"}, build.External)
+		assert.Equal(t, map[string]string{"STAGE": `"module"`, "VERSION": `"1"`}, build.Define)
+		assert.Equal(t, filepath.Join(dir, "tsconfig.json"), build.Tsconfig)
+	}
+}
+
+func TestParseTerrableConfigFileRejectsUnknownFields(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), TerrableConfigFileName)
+
+	if err := os.WriteFile(configFile, []byte(`{ "build": { "targets": "node20" } }`), 0o644); err != nil {
+		t.Fatalf("failed to write terrable config file: %v", err)
+	}
+
+	_, err := ParseTerrableConfigFile(configFile)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "targets")
+	}
+}
+
+func TestParseTerrableConfigFileIgnoresMissingFile(t *testing.T) {
+	build, err := ParseTerrableConfigFile(filepath.Join(t.TempDir(), TerrableConfigFileName))
+
+	assert.NoError(t, err)
+	assert.Nil(t, build)
+}
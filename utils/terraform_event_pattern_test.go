@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEventPatternConfiguration(t *testing.T) {
+	terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+	content := `
+		module "events_api" {
+		  handlers = {
+		    ObjectPattern = {
+		      source = "./src/Shipping.ts"
+		      event_pattern = {
+		        source        = ["com.example.orders"]
+		        "detail-type" = ["Order Placed"]
+		        detail = {
+		          total = [{ numeric = [">", 100] }]
+		        }
+		      }
+		    }
+
+		    TextPattern = {
+		      source        = "./src/Audit.ts"
+		      event_pattern = <<-PATTERN
+		        {"source": [{"prefix": "com.example."}]}
+		      PATTERN
+		    }
+
+		    NoPattern = {
+		      source = "./src/Api.ts"
+		    }
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	terrableConfig, err := ParseTerraformFile(terraformFile, "events_api")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	patterns := map[string]string{}
+	for _, handler := range terrableConfig.Handlers {
+		patterns[handler.Name] = handler.EventPattern
+	}
+
+	assert.JSONEq(t, `{"source":["com.example.orders"],"detail-type":["Order Placed"],"detail":{"total":[{"numeric":[">",100]}]}}`, patterns["ObjectPattern"])
+	assert.JSONEq(t, `{"source":[{"prefix":"com.example."}]}`, patterns["TextPattern"])
+	assert.Empty(t, patterns["NoPattern"])
+}
+
+func TestParseEventPatternRejectsInvalidJSON(t *testing.T) {
+	terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+	content := `
+		module "events_api" {
+		  handlers = {
+		    Shipping = {
+		      source        = "./src/Shipping.ts"
+		      event_pattern = "{\"source\": "
+		    }
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	_, err := ParseTerraformFile(terraformFile, "events_api")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "error parsing event_pattern for handler Shipping")
+	}
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestParseFunctionURLConfiguration(t *testing.T) {
+	terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+	content := `
+		module "webhooks" {
+		  handlers = {
+		    Default = {
+		      source       = "./src/Default.ts"
+		      function_url = {}
+		    }
+
+		    AtPath = {
+		      source = "./src/AtPath.ts"
+		      function_url = {
+		        path = "/hooks/stripe/"
+		        cors = {
+		          allow_origins = ["https://example.com"]
+		          allow_methods = ["POST"]
+		          max_age       = 300
+		        }
+		      }
+		    }
+
+		    OnPort = {
+		      source = "./src/OnPort.ts"
+		      function_url = {
+		        port      = 9100
+		        auth_type = "AWS_IAM"
+		      }
+		    }
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	terrableConfig, err := ParseTerraformFile(terraformFile, "webhooks")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	handlers := map[string]config.HandlerMapping{}
+	for _, handler := range terrableConfig.Handlers {
+		handlers[handler.Name] = handler
+	}
+
+	assert.Equal(t, &config.FunctionURLConfig{Path: "/_url/Default", AuthType: "NONE"}, handlers["Default"].FunctionURL)
+
+	assert.Equal(t, &config.FunctionURLConfig{
+		Path:     "/hooks/stripe",
+		AuthType: "NONE",
+		Cors: &config.CorsConfig{
+			AllowOrigins: []string{"https://example.com"},
+			AllowMethods: []string{"POST"},
+			MaxAge:       300,
+		},
+	}, handlers["AtPath"].FunctionURL)
+
+	assert.Equal(t, &config.FunctionURLConfig{Port: 9100, AuthType: "AWS_IAM"}, handlers["OnPort"].FunctionURL)
+}
+
+func TestParseFunctionURLConfigurationRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler string
+		message string
+	}{
+		{
+			name:    "unknown auth type",
+			handler: `function_url = { auth_type = "COGNITO" }`,
+			message: `error parsing function_url configuration for handler Webhook: auth_type must be NONE or AWS_IAM, got "COGNITO"`,
+		},
+		{
+			name:    "relative path",
+			handler: `function_url = { path = "hooks" }`,
+			message: "path must start with / and cannot be the root path",
+		},
+		{
+			name:    "root path",
+			handler: `function_url = { path = "/" }`,
+			message: "path must start with / and cannot be the root path",
+		},
+		{
+			name:    "path and port",
+			handler: `function_url = { path = "/hooks", port = 9100 }`,
+			message: "only one of path and port can be set",
+		},
+		{
+			name:    "port out of range",
+			handler: `function_url = { port = 70000 }`,
+			message: "port must be between 1 and 65535",
+		},
+		{
+			name:    "cors that is not an object",
+			handler: `function_url = { cors = true }`,
+			message: "cors must be an object",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+			content := `
+				module "webhooks" {
+				  handlers = {
+				    Webhook = {
+				      source = "./src/Webhook.ts"
+				      ` + test.handler + `
+				    }
+				  }
+				}
+			`
+
+			if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+				t.Fatalf("failed to write Terraform file: %v", err)
+			}
+
+			_, err := ParseTerraformFile(terraformFile, "webhooks")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.message)
+			}
+		})
+	}
+}
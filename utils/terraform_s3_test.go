@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestParseS3Configuration(t *testing.T) {
+	dir := t.TempDir()
+	terraformFile := filepath.Join(dir, "main.tf")
+
+	content := `
+		module "uploads_api" {
+		  handlers = {
+		    Thumbnails = {
+		      source = "./src/Thumbnails.ts"
+		      s3 = {
+		        bucket        = "arn:aws:s3:::uploads"
+		        directory     = "./buckets/uploads"
+		        events        = ["s3:ObjectCreated:*"]
+		        filter_prefix = "images/"
+		        filter_suffix = ".jpg"
+		      }
+		    }
+
+		    Cleanup = {
+		      source = "./src/Cleanup.ts"
+		      s3 = {
+		        bucket    = "uploads"
+		        directory = "/srv/uploads"
+		      }
+		    }
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	terrableConfig, err := ParseTerraformFile(terraformFile, "uploads_api")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	handlers := map[string]config.HandlerMapping{}
+	for _, handler := range terrableConfig.Handlers {
+		handlers[handler.Name] = handler
+	}
+
+	assert.Equal(t, &config.S3Config{
+		Bucket:       "arn:aws:s3:::uploads",
+		Directory:    filepath.Join(dir, "buckets", "uploads"),
+		Events:       []string{"s3:ObjectCreated:*"},
+		FilterPrefix: "images/",
+		FilterSuffix: ".jpg",
+	}, handlers["Thumbnails"].S3)
+	assert.Equal(t, "uploads", handlers["Thumbnails"].S3.BucketName())
+
+	assert.Equal(t, &config.S3Config{
+		Bucket:    "uploads",
+		Directory: "/srv/uploads",
+		Events:    []string{"s3:ObjectCreated:*", "s3:ObjectRemoved:*"},
+	}, handlers["Cleanup"].S3)
+}
+
+func TestParseS3ConfigurationRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler string
+		message string
+	}{
+		{
+			name:    "missing bucket",
+			handler: `s3 = { directory = "./uploads" }`,
+			message: "error parsing s3 configuration for handler Thumbnails: bucket is required",
+		},
+		{
+			name:    "missing directory",
+			handler: `s3 = { bucket = "uploads" }`,
+			message: "directory is required",
+		},
+		{
+			name:    "unknown event type",
+			handler: `s3 = { bucket = "uploads", directory = "./uploads", events = ["s3:ObjectRestore:*"] }`,
+			message: `events contains unknown event type "s3:ObjectRestore:*"`,
+		},
+		{
+			name:    "events that are not a list",
+			handler: `s3 = { bucket = "uploads", directory = "./uploads", events = "s3:ObjectCreated:*" }`,
+			message: "events must be a list of strings",
+		},
+		{
+			name:    "filter that is not a string",
+			handler: `s3 = { bucket = "uploads", directory = "./uploads", filter_prefix = 1 }`,
+			message: "filter_prefix must be a string",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+			content := `
+				module "uploads_api" {
+				  handlers = {
+				    Thumbnails = {
+				      source = "./src/Thumbnails.ts"
+				      ` + test.handler + `
+				    }
+				  }
+				}
+			`
+
+			if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+				t.Fatalf("failed to write Terraform file: %v", err)
+			}
+
+			_, err := ParseTerraformFile(terraformFile, "uploads_api")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestParseTerraformFileRejectsInvalidScheduleExpression(t *testing.T) {
+	terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+	content := `
+		module "scheduled_api" {
+		  handlers = {
+		    NightlyHandler = {
+		      source = "./src/Nightly.ts"
+		      schedule = {
+		        expression = "cron(0 2 * * MON-FRI *)"
+		      }
+		    }
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	_, err := ParseTerraformFile(terraformFile, "scheduled_api")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `error parsing schedule for handler NightlyHandler: invalid schedule expression "cron(0 2 * * MON-FRI *)": one of day-of-month and day-of-week must be ?`)
+	}
+}
+
+func TestParseScheduleInputConfiguration(t *testing.T) {
+	terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+	content := `
+		module "scheduled_api" {
+		  handlers = {
+		    ConstantInput = {
+		      source = "./src/Report.ts"
+		      schedule = {
+		        expression = "rate(1 day)"
+		        input      = { report = "daily", limit = 10 }
+		      }
+		    }
+
+		    TextInput = {
+		      source = "./src/Report.ts"
+		      schedule = {
+		        expression = "rate(1 day)"
+		        input      = "{\"report\": \"weekly\"}"
+		      }
+		    }
+
+		    PathInput = {
+		      source = "./src/Report.ts"
+		      schedule = {
+		        expression = "rate(1 day)"
+		        input_path = "$.detail"
+		      }
+		    }
+
+		    TransformedInput = {
+		      source = "./src/Report.ts"
+		      schedule = {
+		        expression = "rate(1 day)"
+		        input_transformer = {
+		          input_paths    = { time = "$.time" }
+		          input_template = "{\"firedAt\": <time>}"
+		        }
+		      }
+		    }
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	terrableConfig, err := ParseTerraformFile(terraformFile, "scheduled_api")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	schedules := make(map[string]*config.ScheduleConfig)
+	for _, handler := range terrableConfig.Handlers {
+		schedules[handler.Name] = handler.Schedule
+	}
+
+	assert.JSONEq(t, `{"report":"daily","limit":10}`, schedules["ConstantInput"].Input)
+	assert.Equal(t, `{"report": "weekly"}`, schedules["TextInput"].Input)
+	assert.Equal(t, "$.detail", schedules["PathInput"].InputPath)
+	assert.Equal(t, &config.InputTransformerConfig{
+		InputPaths:    map[string]string{"time": "$.time"},
+		InputTemplate: `{"firedAt": <time>}`,
+	}, schedules["TransformedInput"].InputTransformer)
+}
+
+func TestParseScheduleInputConfigurationRejectsInvalidSettings(t *testing.T) {
+	tests := map[string]struct {
+		schedule string
+		wantErr  string
+	}{
+		"invalid JSON text": {
+			schedule: `input = "{report"`,
+			wantErr:  "input must be valid JSON",
+		},
+		"invalid input path": {
+			schedule: `input_path = "detail"`,
+			wantErr:  `input_path "detail" must start with $`,
+		},
+		"several inputs": {
+			schedule: `input = {}, input_path = "$.detail"`,
+			wantErr:  "only one of input, input_path and input_transformer can be set, got input and input_path",
+		},
+		"missing template": {
+			schedule: `input_transformer = { input_paths = { time = "$.time" } }`,
+			wantErr:  "input_transformer input_template must be a string",
+		},
+		"reserved input path name": {
+			schedule: `input_transformer = { input_paths = { "aws.time" = "$.time" }, input_template = "<aws.time>" }`,
+			wantErr:  `input path name "aws.time" is reserved`,
+		},
+		"invalid transformer path": {
+			schedule: `input_transformer = { input_paths = { time = "$.time[" }, input_template = "<time>" }`,
+			wantErr:  `input path "time" "$.time[" has a [ without a closing ]`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+			content := `
+				module "scheduled_api" {
+				  handlers = {
+				    ReportHandler = {
+				      source = "./src/Report.ts"
+				      schedule = { expression = "rate(1 day)", ` + tt.schedule + ` }
+				    }
+				  }
+				}
+			`
+
+			if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+				t.Fatalf("failed to write Terraform file: %v", err)
+			}
+
+			_, err := ParseTerraformFile(terraformFile, "scheduled_api")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "error parsing schedule for handler ReportHandler: "+tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestParseSnsConfiguration(t *testing.T) {
+	terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+	content := `
+		module "orders_api" {
+		  handlers = {
+		    Notify = {
+		      source = "./src/Notify.ts"
+		      sns = {
+		        topic = "arn:aws:sns:eu-west-1:000000000000:orders"
+		        filter_policy = {
+		          channel = ["web"]
+		          total   = [{ numeric = [">=", 100] }]
+		        }
+		      }
+		    }
+
+		    Refunds = {
+		      source = "./src/Refunds.ts"
+		      sns = {
+		        topic               = "orders"
+		        filter_policy       = "{\"type\": [\"refund\"]}"
+		        filter_policy_scope = "MessageBody"
+		      }
+		    }
+
+		    Fulfilment = {
+		      source = "./src/Fulfilment.ts"
+		      sqs = {
+		        queue = "arn:aws:sqs:eu-west-1:000000000000:fulfilment"
+		        sns = {
+		          topic                = "orders"
+		          raw_message_delivery = true
+		        }
+		      }
+		    }
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	terrableConfig, err := ParseTerraformFile(terraformFile, "orders_api")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	handlers := map[string]config.HandlerMapping{}
+	for _, handler := range terrableConfig.Handlers {
+		handlers[handler.Name] = handler
+	}
+
+	if assert.NotNil(t, handlers["Notify"].Sns) {
+		assert.Equal(t, "orders", handlers["Notify"].Sns.TopicName())
+		assert.JSONEq(t, `{"channel":["web"],"total":[{"numeric":[">=",100]}]}`, handlers["Notify"].Sns.FilterPolicy)
+	}
+
+	assert.Equal(t, &config.SnsConfig{Topic: "orders", FilterPolicy: `{"type": ["refund"]}`, FilterPolicyScope: "MessageBody"}, handlers["Refunds"].Sns)
+	assert.Equal(t, &config.SnsConfig{Topic: "orders", RawMessageDelivery: true}, handlers["Fulfilment"].Sqs.Sns)
+}
+
+func TestParseSnsConfigurationRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler string
+		message string
+	}{
+		{
+			name:    "missing topic",
+			handler: `sns = { filter_policy = { channel = ["web"] } }`,
+			message: "error parsing sns configuration for handler Notify: topic is required",
+		},
+		{
+			name:    "unknown filter policy scope",
+			handler: `sns = { topic = "orders", filter_policy_scope = "Headers" }`,
+			message: `filter_policy_scope must be MessageAttributes or MessageBody, got "Headers"`,
+		},
+		{
+			name:    "raw message delivery to a handler",
+			handler: `sns = { topic = "orders", raw_message_delivery = true }`,
+			message: "raw_message_delivery only applies to sqs queue subscriptions",
+		},
+		{
+			name:    "invalid filter policy JSON",
+			handler: `sns = { topic = "orders", filter_policy = "{" }`,
+			message: "filter_policy must be valid JSON",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+			content := `
+				module "orders_api" {
+				  handlers = {
+				    Notify = {
+				      source = "./src/Notify.ts"
+				      ` + test.handler + `
+				    }
+				  }
+				}
+			`
+
+			if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+				t.Fatalf("failed to write Terraform file: %v", err)
+			}
+
+			_, err := ParseTerraformFile(terraformFile, "orders_api")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.message)
+			}
+		})
+	}
+}
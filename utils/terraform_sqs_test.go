@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestParseSqsConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	terraformFile := filepath.Join(dir, "main.tf")
+
+	content := `
+		module "queue_api" {
+		  handlers = {
+		    DefaultQueue = {
+		      source = "./src/Default.ts"
+		      sqs = {
+		        queue = "arn:aws:sqs:eu-west-1:000000000000:default-queue"
+		      }
+		    }
+
+		    TunedQueue = {
+		      source = "./src/Tuned.ts"
+		      sqs = {
+		        queue                              = "tuned-queue"
+		        batch_size                         = 5
+		        maximum_batching_window_in_seconds = 2
+		        visibility_timeout_seconds         = 10
+		        max_receive_count                  = 3
+		      }
+		    }
+
+		    FifoQueue = {
+		      source = "./src/Fifo.ts"
+		      sqs = {
+		        queue                       = "orders.fifo"
+		        content_based_deduplication = true
+		      }
+		    }
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	terrableConfig, err := ParseTerraformFile(terraformFile, "queue_api")
+	if err != nil {
+		t.Fatalf("failed to parse Terraform file: %v", err)
+	}
+
+	handlers := make(map[string]config.HandlerMapping)
+	for _, handler := range terrableConfig.Handlers {
+		handlers[handler.Name] = handler
+	}
+
+	assert.Equal(t, &config.SqsConfig{Queue: "arn:aws:sqs:eu-west-1:000000000000:default-queue"}, handlers["DefaultQueue"].Sqs)
+	assert.Equal(t, "default-queue", handlers["DefaultQueue"].Sqs.QueueName())
+
+	assert.Equal(t, &config.SqsConfig{
+		Queue:                        "tuned-queue",
+		BatchSize:                    5,
+		MaximumBatchingWindowSeconds: 2,
+		VisibilityTimeoutSeconds:     10,
+		MaxReceiveCount:              3,
+	}, handlers["TunedQueue"].Sqs)
+	assert.Equal(t, "tuned-queue", handlers["TunedQueue"].Sqs.QueueName())
+
+	assert.Equal(t, &config.SqsConfig{Queue: "orders.fifo", ContentBasedDeduplication: true}, handlers["FifoQueue"].Sqs)
+}
+
+func TestParseSqsConfigurationRejectsInvalidSettings(t *testing.T) {
+	tests := map[string]string{
+		"missing queue":     `sqs = { batch_size = 5 }`,
+		"fractional number": `sqs = { queue = "q", batch_size = 1.5 }`,
+		"string number":     `sqs = { queue = "q", max_receive_count = "three" }`,
+		"string boolean":    `sqs = { queue = "q.fifo", content_based_deduplication = "yes" }`,
+		"standard queue":    `sqs = { queue = "q", content_based_deduplication = true }`,
+	}
+
+	for name, sqs := range tests {
+		t.Run(name, func(t *testing.T) {
+			terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+			content := `
+				module "queue_api" {
+				  handlers = {
+				    QueueHandler = {
+				      source = "./src/Queue.ts"
+				      ` + sqs + `
+				    }
+				  }
+				}
+			`
+
+			if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+				t.Fatalf("failed to write Terraform file: %v", err)
+			}
+
+			_, err := ParseTerraformFile(terraformFile, "queue_api")
+			if err == nil || !strings.Contains(err.Error(), "sqs configuration for handler QueueHandler") {
+				t.Fatalf("expected an sqs configuration error, got %v", err)
+			}
+		})
+	}
+}
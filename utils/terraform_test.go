@@ -27,6 +27,7 @@ func TestParseModuleConfiguration(t *testing.T) {
                             source = "./test.ts"
                             schedule = {
                                 expression = "rate(5 minutes)"
+                                timezone   = "Europe/London"
                             }
                         }
                     }
@@ -198,6 +199,7 @@ func TestParseModuleConfiguration(t *testing.T) {
 				if tt.name == "parses handler schedule expression" {
 					if assert.NotNil(t, config.Handlers[0].Schedule) {
 						assert.Equal(t, "rate(5 minutes)", config.Handlers[0].Schedule.Expression)
+						assert.Equal(t, "Europe/London", config.Handlers[0].Schedule.Timezone)
 					}
 				}
 			}
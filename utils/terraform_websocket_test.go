@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terrable-dev/terrable/config"
+)
+
+func TestParseWebSocketConfiguration(t *testing.T) {
+	terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+	content := `
+		module "chat" {
+		  websocket_api = {
+		    route_selection_expression = "$request.body.type"
+		    path                       = "/chat/"
+		  }
+
+		  handlers = {
+		    Connections = {
+		      source = "./src/Connections.ts"
+		      websocket = {
+		        routes = ["$connect", "$disconnect"]
+		      }
+		    }
+
+		    SendMessage = {
+		      source = "./src/SendMessage.ts"
+		      websocket = {
+		        routes = ["sendMessage"]
+		      }
+		    }
+		  }
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	terrableConfig, err := ParseTerraformFile(terraformFile, "chat")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, &config.WebSocketAPIConfig{RouteSelectionExpression: "$request.body.type", Path: "/chat"}, terrableConfig.WebSocketApi)
+
+	handlers := map[string]config.HandlerMapping{}
+	for _, handler := range terrableConfig.Handlers {
+		handlers[handler.Name] = handler
+	}
+
+	assert.Equal(t, &config.WebSocketConfig{Routes: []string{"$connect", "$disconnect"}}, handlers["Connections"].WebSocket)
+	assert.Equal(t, &config.WebSocketConfig{Routes: []string{"sendMessage"}}, handlers["SendMessage"].WebSocket)
+}
+
+func TestParseWebSocketAPIDefaults(t *testing.T) {
+	terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+	content := `
+		module "chat" {
+		  websocket_api = {}
+		}
+	`
+
+	if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write Terraform file: %v", err)
+	}
+
+	terrableConfig, err := ParseTerraformFile(terraformFile, "chat")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &config.WebSocketAPIConfig{RouteSelectionExpression: "$request.body.action", Path: "/"}, terrableConfig.WebSocketApi)
+	}
+}
+
+func TestParseWebSocketConfigurationRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		module  string
+		handler string
+		message string
+	}{
+		{
+			name:    "route selection expression outside the body",
+			module:  `websocket_api = { route_selection_expression = "$request.header.action" }`,
+			message: `error parsing websocket_api configuration: route_selection_expression must select a field of the message body, such as $request.body.action, got "$request.header.action"`,
+		},
+		{
+			name:    "whole body as the route",
+			module:  `websocket_api = { route_selection_expression = "$request.body" }`,
+			message: "route_selection_expression must select a field of the message body",
+		},
+		{
+			name:    "relative path",
+			module:  `websocket_api = { path = "chat" }`,
+			message: "path must start with /",
+		},
+		{
+			name:    "missing routes",
+			handler: `websocket = {}`,
+			message: "error parsing websocket configuration for handler Chat: routes is required",
+		},
+		{
+			name:    "empty routes",
+			handler: `websocket = { routes = [] }`,
+			message: "routes must list at least one route",
+		},
+		{
+			name:    "routes that are not strings",
+			handler: `websocket = { routes = [{ key = "join" }] }`,
+			message: "routes must be a list of strings",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			terraformFile := filepath.Join(t.TempDir(), "main.tf")
+
+			content := `
+				module "chat" {
+				  ` + test.module + `
+
+				  handlers = {
+				    Chat = {
+				      source = "./src/Chat.ts"
+				      ` + test.handler + `
+				    }
+				  }
+				}
+			`
+
+			if err := os.WriteFile(terraformFile, []byte(content), 0o644); err != nil {
+				t.Fatalf("failed to write Terraform file: %v", err)
+			}
+
+			_, err := ParseTerraformFile(terraformFile, "chat")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.message)
+			}
+		})
+	}
+}